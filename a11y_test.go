@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// a11yIssue is an accessibility problem found on a page
+type a11yIssue struct {
+	Page    string
+	Rule    string
+	Element string // the offending tag, e.g. `<img src="logo.png">`
+	Message string
+}
+
+// String formats the issue for test failures
+func (i a11yIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s %s", i.Page, i.Rule, i.Message, i.Element)
+}
+
+// a11yDocuments exercise what documents can render: landing pages, nested
+// folders, images, tables, code, task lists, details and links
+var a11yDocuments = map[string]string{
+	"README.md":       "# Project\n\nWelcome. See the [guide](guide/setup.md).\n",
+	"guide/README.md": "# Guide\n\nThe guide.\n",
+	"guide/setup.md": "---\ntags: [ops]\n---\n# Setup guide\n\n![Architecture diagram](diagram.png)\n\n" +
+		"## Steps\n\n- [ ] install\n- [x] configure\n\n| Name | Value |\n|------|-------|\n| port | 8090 |\n\n" +
+		"```go\nfmt.Println(\"hi\")\n```\n\n<details><summary>More</summary>\n\nHidden text.\n\n</details>\n\n" +
+		"Back to the [project](../README.md) or [an anchor](#steps).\n",
+	"reference/api notes.md": "# API notes\n\nSee <https://example.com> and the [guide](../guide/setup.md#steps).\n",
+}
+
+// auditPages renders the index page, a search results page and every
+// document as the server does, and audits them
+func auditPages(t *testing.T, a *App) (pages int, issues []a11yIssue) {
+	t.Helper()
+	targets := []string{"/", "/search?q=guide", "/search?q=nothing-matches"}
+	for _, doc := range a.Documents {
+		targets = append(targets, docURL(doc.RelPath))
+	}
+
+	handlers := map[string]http.HandlerFunc{"/": a.handleIndex, "/search": a.handleSearchPage}
+	for _, target := range targets {
+		handler := a.handleDocument
+		if u, _ := url.Parse(target); handlers[u.Path] != nil {
+			handler = handlers[u.Path]
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d", target, rec.Code)
+			continue
+		}
+		found, err := auditPage(target, rec.Body.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", target, err)
+		}
+		pages++
+		issues = append(issues, found...)
+	}
+	return pages, issues
+}
+
+func TestA11yPages(t *testing.T) {
+	a := newTestApp(t, a11yDocuments)
+	pages, issues := auditPages(t, a)
+	if pages != 3+len(a.Documents) {
+		t.Errorf("audited %d pages, want %d", pages, 3+len(a.Documents))
+	}
+	for _, issue := range issues {
+		t.Error(issue)
+	}
+}
+
+func TestA11yPreferences(t *testing.T) {
+	a := newTestApp(t, a11yDocuments)
+	a.preferencesKey = []byte("0123456789abcdef0123456789abcdef")
+	cookie := &http.Cookie{Name: preferencesCookieName, Value: signPreferences(a.preferencesKey, Preferences{Theme: "contrast", FontSize: "large", TreeDensity: "compact"})}
+	for _, target := range []string{"/", docURL("guide/setup.md")} {
+		handler := a.handleDocument
+		if target == "/" {
+			handler = a.handleIndex
+		}
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if !strings.Contains(rec.Body.String(), "theme-contrast") {
+			t.Errorf("GET %s does not apply the high contrast theme", target)
+		}
+		issues, err := auditPage(target, rec.Body.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, issue := range issues {
+			t.Error(issue)
+		}
+	}
+}
+
+func TestAuditPageFindsIssues(t *testing.T) {
+	page := `<!DOCTYPE html><html><head></head><body>
+<a href="/elsewhere">Home</a>
+<img src="logo.png">
+<input type="text" name="q">
+<label for="named">Name</label><input id="named">
+<label>Wrapped <input type="text"></label>
+<input type="hidden" name="token">
+<button></button>
+<button aria-label="Close"></button>
+<a href="/empty"></a>
+<a href="/icon"><img src="i.png" alt="Settings"></a>
+<div id="dup"></div><div id="dup"></div>
+<li role="treeitem">Orphan</li>
+<ul role="tree"><li role="treeitem">Item<ul role="group"><li role="treeitem">Nested</li></ul></li></ul>
+</body></html>`
+	issues, err := auditPage("/bad", []byte(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := make(map[string]int)
+	for _, issue := range issues {
+		rules[issue.Rule]++
+	}
+	want := map[string]int{"html-lang": 1, "title": 1, "skip-link": 1, "main": 1, "img-alt": 1, "label": 1, "button-name": 1, "link-name": 1, "duplicate-id": 1, "aria-tree": 1}
+	for rule, count := range want {
+		if rules[rule] != count {
+			t.Errorf("%d %s issues, want %d (issues: %v)", rules[rule], rule, count, issues)
+		}
+	}
+	if len(issues) != len(want) {
+		t.Errorf("%d issues, want %d: %v", len(issues), len(want), issues)
+	}
+}
+
+// auditPage checks a page for the accessibility problems that can be found
+// in its HTML:
+//
+//   - html-lang: <html> has no lang attribute
+//   - title: the page has no <title>
+//   - skip-link: the first link of the page does not skip to an element on it
+//   - main: the page has no main landmark, or more than one
+//   - img-alt: an image has no alt attribute
+//   - label: a form control has no label
+//   - button-name: a button has no text or aria-label
+//   - link-name: a link has no text, aria-label or image with alt text
+//   - duplicate-id: an id is used more than once
+//   - aria-tree: a tree item is outside a tree
+func auditPage(page string, body []byte) ([]a11yIssue, error) {
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	var issues []a11yIssue
+	report := func(rule string, n *html.Node, format string, args ...interface{}) {
+		issues = append(issues, a11yIssue{Page: page, Rule: rule, Element: describeNode(n), Message: fmt.Sprintf(format, args...)})
+	}
+
+	ids := make(map[string]int)
+	labelled := make(map[string]bool) // ids of the controls of <label for>
+	var firstLink *html.Node
+	var title *html.Node
+	mains := 0
+	walkNodes(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		if id := attr(n, "id"); id != "" {
+			ids[id]++
+		}
+		switch n.DataAtom {
+		case atom.Label:
+			if target := attr(n, "for"); target != "" {
+				labelled[target] = true
+			}
+		case atom.A:
+			if firstLink == nil && hasAttr(n, "href") {
+				firstLink = n
+			}
+		case atom.Title:
+			title = n
+		case atom.Main:
+			mains++
+		}
+		if attr(n, "role") == "main" && n.DataAtom != atom.Main {
+			mains++
+		}
+	})
+
+	if root := findElement(doc, atom.Html); root == nil || strings.TrimSpace(attr(root, "lang")) == "" {
+		report("html-lang", root, "the page has no language")
+	}
+	if title == nil || strings.TrimSpace(textContent(title)) == "" {
+		report("title", title, "the page has no title")
+	}
+	if firstLink == nil || !strings.HasPrefix(attr(firstLink, "href"), "#") || ids[strings.TrimPrefix(attr(firstLink, "href"), "#")] == 0 {
+		report("skip-link", firstLink, "the first link of the page does not skip to its content")
+	}
+	if mains != 1 {
+		report("main", nil, "the page has %d main landmarks instead of one", mains)
+	}
+	for id, count := range ids {
+		if count > 1 {
+			report("duplicate-id", nil, "id %q is used %d times", id, count)
+		}
+	}
+
+	walkNodes(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode {
+			return
+		}
+		switch n.DataAtom {
+		case atom.Img:
+			if !hasAttr(n, "alt") {
+				report("img-alt", n, "the image has no alt text")
+			}
+		case atom.Input, atom.Select, atom.Textarea:
+			switch attr(n, "type") {
+			case "hidden", "submit", "button", "reset", "image":
+				return
+			}
+			if !hasName(n) && !labelled[attr(n, "id")] && !hasAncestor(n, atom.Label) {
+				report("label", n, "the %s has no label", n.Data)
+			}
+		case atom.Button:
+			if !hasName(n) && strings.TrimSpace(textContent(n)) == "" {
+				report("button-name", n, "the button has no name")
+			}
+		case atom.A:
+			if hasAttr(n, "href") && !hasName(n) && strings.TrimSpace(textContent(n)) == "" && !hasImageText(n) {
+				report("link-name", n, "the link has no text")
+			}
+		}
+		if attr(n, "role") == "treeitem" && !hasRole(n.Parent, "tree") {
+			report("aria-tree", n, "the tree item is not in a tree")
+		}
+	})
+	return issues, nil
+}
+
+// walkNodes calls fn for n and every node under it, in document order
+func walkNodes(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkNodes(c, fn)
+	}
+}
+
+// findElement returns the first element under n with the given tag
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	var found *html.Node
+	walkNodes(n, func(c *html.Node) {
+		if found == nil && c.Type == html.ElementNode && c.DataAtom == a {
+			found = c
+		}
+	})
+	return found
+}
+
+// attr returns the value of an attribute of n, "" if it has none
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasAttr reports whether n has an attribute, even if empty
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// hasName reports whether n is named by an ARIA attribute or a title
+func hasName(n *html.Node) bool {
+	for _, key := range []string{"aria-label", "aria-labelledby", "title"} {
+		if strings.TrimSpace(attr(n, key)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAncestor reports whether n is inside an element with the given tag
+func hasAncestor(n *html.Node, a atom.Atom) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.Type == html.ElementNode && p.DataAtom == a {
+			return true
+		}
+	}
+	return false
+}
+
+// hasRole reports whether n or one of its ancestors has the given role.
+// Tree items are in groups, which are in items, up to the tree.
+func hasRole(n *html.Node, role string) bool {
+	for ; n != nil; n = n.Parent {
+		if n.Type == html.ElementNode && attr(n, "role") == role {
+			return true
+		}
+	}
+	return false
+}
+
+// hasImageText reports whether n contains an image with alt text
+func hasImageText(n *html.Node) bool {
+	found := false
+	walkNodes(n, func(c *html.Node) {
+		if c.Type == html.ElementNode && (c.DataAtom == atom.Img || c.DataAtom == atom.Svg) && (strings.TrimSpace(attr(c, "alt")) != "" || hasName(c)) {
+			found = true
+		}
+	})
+	return found
+}
+
+// textContent returns the text under n
+func textContent(n *html.Node) string {
+	var b strings.Builder
+	walkNodes(n, func(c *html.Node) {
+		if c.Type == html.TextNode {
+			b.WriteString(c.Data)
+		}
+	})
+	return b.String()
+}
+
+// describeNode returns the start tag of n, to point at it in a report
+func describeNode(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString("<" + n.Data)
+	for _, a := range n.Attr {
+		if a.Key == "style" || a.Key == "onclick" {
+			continue
+		}
+		fmt.Fprintf(&b, " %s=%q", a.Key, a.Val)
+	}
+	b.WriteString(">")
+	return b.String()
+}
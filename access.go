@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// passwordHashPrefix marks auth.users passwords given as a SHA-256 hash
+const passwordHashPrefix = "sha256:"
+
+// User is the authenticated user of a request
+type User struct {
+	Name   string
+	Groups []string
+}
+
+type userContextKey struct{}
+
+// requestUser returns the authenticated user of r, nil if anonymous
+func requestUser(r *http.Request) *User {
+	user, _ := r.Context().Value(userContextKey{}).(*User)
+	return user
+}
+
+// authEnabled reports whether users can authenticate
+func (c AuthConfig) authEnabled() bool {
+	return len(c.Users) > 0 || c.UserHeader != ""
+}
+
+// authenticate returns the user of r from the trusted proxy header or HTTP
+// basic auth. ok is false if r carries credentials that are wrong.
+func (a *App) authenticate(r *http.Request) (user *User, ok bool) {
+	auth := a.Config.Auth
+	name := ""
+	var groups []string
+	if auth.UserHeader != "" {
+		name = strings.TrimSpace(r.Header.Get(auth.UserHeader))
+		if auth.GroupsHeader != "" {
+			for _, group := range strings.Split(r.Header.Get(auth.GroupsHeader), ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					groups = append(groups, group)
+				}
+			}
+		}
+	}
+	if username, password, found := r.BasicAuth(); name == "" && found && len(auth.Users) > 0 {
+		expected, known := auth.Users[username]
+		if !known || !checkPassword(expected, password) {
+			return nil, false
+		}
+		name = username
+	}
+	if name == "" {
+		return nil, true
+	}
+
+	for group, members := range auth.Groups {
+		if indexOf(members, name) >= 0 && indexOf(groups, group) < 0 {
+			groups = append(groups, group)
+		}
+	}
+	return &User{Name: name, Groups: groups}, true
+}
+
+// checkPassword compares password with a configured one, given in plain
+// text or as "sha256:<hex digest>"
+func checkPassword(expected, password string) bool {
+	if strings.HasPrefix(expected, passwordHashPrefix) {
+		sum := sha256.Sum256([]byte(password))
+		password = hex.EncodeToString(sum[:])
+		expected = strings.ToLower(strings.TrimPrefix(expected, passwordHashPrefix))
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
+
+// withAuth identifies the user of each request when auth is configured.
+// Anonymous requests are rejected with auth.required, and /login asks the
+// browser for basic auth credentials before returning to the index.
+func (a *App) withAuth(next http.Handler) http.Handler {
+	if !a.Config.Auth.authEnabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := a.authenticate(r)
+		if !ok || (user == nil && (a.Config.Auth.Required || r.URL.Path == "/login")) {
+			a.requireAuth(w)
+			return
+		}
+		if r.URL.Path == "/login" {
+			http.Redirect(w, r, a.Config.BasePath+"/", http.StatusFound)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userContextKey{}, user)))
+	})
+}
+
+// requireAuth asks for basic auth credentials, or refuses the request when
+// users are only identified by the proxy
+func (a *App) requireAuth(w http.ResponseWriter) {
+	if len(a.Config.Auth.Users) == 0 {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	realm := a.Config.Title
+	if realm == "" {
+		realm = "DimanDocs"
+	}
+	w.Header().Set("WWW-Authenticate", `Basic realm="`+strings.ReplaceAll(realm, `"`, "'")+`", charset="UTF-8"`)
+	http.Error(w, "Authentication required", http.StatusUnauthorized)
+}
+
+// Access decides which sources a request can read. A nil Access reads
+// everything.
+type Access struct {
+	sources map[string]bool // readable source names
+}
+
+// access returns the Access of the user of r, nil when no directory has an
+// allow list. A source is readable if every directory with its name allows
+// the user.
+func (a *App) access(r *http.Request) *Access {
+	restricted := false
+	for _, dir := range a.Config.Directories {
+		if len(dir.Allow) > 0 {
+			restricted = true
+			break
+		}
+	}
+	if !restricted {
+		return nil
+	}
+
+	user := requestUser(r)
+	ac := &Access{sources: make(map[string]bool)}
+	denied := make(map[string]bool)
+	for _, dir := range a.Config.Directories {
+		if len(dir.Allow) == 0 || user.allowedBy(dir.Allow) {
+			ac.sources[dir.Name] = true
+		} else {
+			denied[dir.Name] = true
+		}
+	}
+	for name := range denied {
+		delete(ac.sources, name)
+	}
+	return ac
+}
+
+// allowedBy reports whether an allow list names the user or, as "@group",
+// one of their groups
+func (u *User) allowedBy(allow []string) bool {
+	if u == nil {
+		return false
+	}
+	for _, entry := range allow {
+		if group, ok := strings.CutPrefix(entry, "@"); ok {
+			if indexOf(u.Groups, group) >= 0 {
+				return true
+			}
+		} else if entry == u.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// CanRead reports whether doc can be read
+func (ac *Access) CanRead(doc *Document) bool {
+	return doc != nil && (ac == nil || ac.sources[doc.SourceName])
+}
+
+// CanReadSource reports whether the documents of a source can be read
+func (ac *Access) CanReadSource(name string) bool {
+	return ac == nil || ac.sources[name]
+}
+
+// Trees returns the trees of the readable sources
+func (ac *Access) Trees(trees []DirectoryTree) []DirectoryTree {
+	if ac == nil {
+		return trees
+	}
+	var readable []DirectoryTree
+	for _, tree := range trees {
+		if ac.sources[tree.Name] {
+			readable = append(readable, tree)
+		}
+	}
+	return readable
+}
+
+// Groups returns the groups of the readable sources
+func (ac *Access) Groups(groups []DirectoryGroup) []DirectoryGroup {
+	if ac == nil {
+		return groups
+	}
+	var readable []DirectoryGroup
+	for _, group := range groups {
+		if ac.sources[group.Name] {
+			readable = append(readable, group)
+		}
+	}
+	return readable
+}
+
+// readableDocument returns the document with the given relative path if the
+// user of r can read it, nil otherwise
+func (a *App) readableDocument(r *http.Request, relPath string) *Document {
+	doc := a.findDocument(relPath)
+	if !a.access(r).CanRead(doc) {
+		return nil
+	}
+	return doc
+}
+
+// checkAuth validates auth and the allow lists of directories
+func (v *configValidator) checkAuth(config Config) {
+	for user := range config.Auth.Users {
+		if user == "" || strings.Contains(user, ":") {
+			v.add("auth.users", "invalid user name %q (names can't be empty or contain \":\")", user)
+		}
+	}
+	if config.Auth.GroupsHeader != "" && config.Auth.UserHeader == "" {
+		v.add("auth.groups_header", "groups_header needs user_header")
+	}
+	if config.Auth.Required && !config.Auth.authEnabled() {
+		v.add("auth.required", "required needs users or user_header to identify users")
+	}
+	for i, dir := range config.Directories {
+		if len(dir.Allow) > 0 && !config.Auth.authEnabled() {
+			v.add(fmt.Sprintf("directories[%d].allow", i), "allow lists need auth.users or auth.user_header to identify users")
+		}
+	}
+}
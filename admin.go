@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// minAdminTokenLength is the shortest admin_token accepted
+const minAdminTokenLength = 16
+
+// isAdmin reports whether r can use the admin API: with admin_token it must
+// send it as a bearer token, with admin_users come from one of them. Without
+// either, only local requests can, and only while the server listens on a
+// loopback address or the default host (all interfaces, outside of
+// containers) without base_path or auth.user_header: a proxy on the same
+// machine makes every request look local.
+func (a *App) isAdmin(r *http.Request) bool {
+	if token := a.Config.AdminToken; token != "" {
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok &&
+			subtle.ConstantTimeCompare([]byte(strings.TrimSpace(bearer)), []byte(token)) == 1 {
+			return true
+		}
+	}
+	if len(a.Config.AdminUsers) > 0 {
+		return requestUser(r).allowedBy(a.Config.AdminUsers)
+	}
+	defaultHost := a.Config.Host == "" && !a.Container
+	return a.Config.AdminToken == "" && (a.LocalOnly || defaultHost) && a.Config.BasePath == "" && a.Config.Auth.UserHeader == "" && isLocalRequest(r)
+}
+
+// withAdmin only lets admins reach an admin route. Actions must be POSTed
+// from a dimandocs page or a script, not from other sites.
+func (a *App) withAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !a.isAdmin(r) {
+			if requestUser(r) == nil && len(a.Config.AdminUsers) > 0 && len(a.Config.Auth.Users) > 0 {
+				a.requireAuth(w)
+				return
+			}
+			http.Error(w, "The admin API is not available to this request (see admin_token and admin_users)", http.StatusForbidden)
+			return
+		}
+		if r.Method != http.MethodGet && !isSameOrigin(r) {
+			http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// withLocalOrAdmin only lets requests from this machine and admins reach
+// an operational route, such as metrics or locating files for other
+// invocations
+func (a *App) withLocalOrAdmin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !isLocalRequest(r) && !a.isAdmin(r) {
+			http.Error(w, "Only available from localhost or to admins (see admin_token and admin_users)", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// registerAdminRoutes adds the admin API under /admin/. Its handlers take
+// the documents lock themselves (see withDocumentsLock).
+func (a *App) registerAdminRoutes() {
+	http.HandleFunc("/admin/stats", a.withAdmin(a.handleAdminStats))
+	http.HandleFunc("/admin/rescan", a.withAdmin(a.handleAdminRescan))
+	http.HandleFunc("/admin/cache/clear", a.withAdmin(a.handleAdminCacheClear))
+	http.HandleFunc("/admin/config/reload", a.withAdmin(a.handleAdminConfigReload))
+}
+
+// AdminStats is the response of /admin/stats
+type AdminStats struct {
+	Version            string        `json:"version"`
+	Started            time.Time     `json:"started"`
+	Uptime             string        `json:"uptime"`
+	ConfigFile         string        `json:"config_file"`
+	Documents          int           `json:"documents"`
+	VersionedDocuments int           `json:"versioned_documents"` // documents of non-default versions
+	Words              int           `json:"words"`
+	Size               int64         `json:"size"`
+	Sources            []SourceStats `json:"sources"`
+	LastScan           ScanStats     `json:"last_scan"`
+	RenderCache        int           `json:"render_cache"`   // rendered documents in memory
+	DocumentCache      *CacheStatus  `json:"document_cache"` // only with --cache
+	Clients            int           `json:"clients"`        // open browser tabs
+}
+
+// ScanStats are the counters of the most recent directory scan
+type ScanStats struct {
+	Walked    int64 `json:"walked"`
+	Matched   int64 `json:"matched"`
+	Processed int64 `json:"processed"`
+	Reused    int64 `json:"reused"`
+}
+
+// handleAdminStats reports the state of the server
+func (a *App) handleAdminStats(w http.ResponseWriter, r *http.Request) {
+	a.docsMu.RLock()
+	stats := AdminStats{
+		Version:     Version,
+		Started:     a.Instance.Started,
+		Uptime:      time.Since(a.Instance.Started).Round(time.Second).String(),
+		ConfigFile:  a.ConfigFile,
+		Documents:   len(a.Documents),
+		RenderCache: a.Renders.Len(),
+		Clients:     a.Clients.Count(),
+	}
+	for _, docs := range a.Versions {
+		stats.VersionedDocuments += len(docs)
+	}
+	sources := make(map[string]*SourceStats)
+	for _, doc := range a.Documents {
+		source, ok := sources[doc.SourceName]
+		if !ok {
+			source = &SourceStats{Name: doc.SourceName}
+			sources[doc.SourceName] = source
+		}
+		source.Documents++
+		source.Words += doc.Words
+		source.Size += doc.Size
+		stats.Words += doc.Words
+		stats.Size += doc.Size
+	}
+	for _, dir := range a.Config.Directories {
+		if source, ok := sources[dir.Name]; ok {
+			stats.Sources = append(stats.Sources, *source)
+			delete(sources, dir.Name)
+		}
+	}
+	a.docsMu.RUnlock()
+
+	if scan := a.scanProgress(); scan != nil {
+		stats.LastScan = ScanStats{Walked: scan.Walked(), Matched: scan.Matched(), Processed: scan.Processed(), Reused: scan.Reused()}
+	}
+	if a.UseCache {
+		status := a.cacheStatus()
+		stats.DocumentCache = &status
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleAdminRescan scans the directories again, fully unless ?full=0
+func (a *App) handleAdminRescan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	start := time.Now()
+	changed, err := a.rescan(r.URL.Query().Get("full") != "0")
+	if err != nil {
+		slog.Error("failed to scan directories", "error", err)
+		http.Error(w, fmt.Sprintf("Failed to scan directories: %v", err), http.StatusInternalServerError)
+		return
+	}
+	count := a.documentCount()
+	slog.Info("documents re-scanned from the admin API", "documents", count, "changed", changed)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"changed":   changed,
+		"documents": count,
+		"duration":  time.Since(start).Round(time.Millisecond).String(),
+	})
+}
+
+// handleAdminCacheClear empties the render cache, in memory and on disk, and
+// deletes the document cache file. With --cache the file is written again by
+// the next re-scan.
+func (a *App) handleAdminCacheClear(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	rendered := a.Renders.Len()
+	removed, err := a.Renders.ClearDisk()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to clear the render cache: %v", err), http.StatusInternalServerError)
+		return
+	}
+	var files []string
+	paths := []string{legacyCacheFileName}
+	for _, format := range cacheFormats {
+		paths = append(paths, a.cachePath(format))
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err == nil {
+			files = append(files, path)
+		} else if !os.IsNotExist(err) {
+			http.Error(w, fmt.Sprintf("Failed to remove the document cache: %v", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	slog.Info("caches cleared from the admin API", "rendered", rendered, "files", removed+len(files))
+	if files == nil {
+		files = []string{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"rendered":        rendered,
+		"rendered_files":  removed,
+		"document_caches": files,
+	})
+}
+
+// handleAdminConfigReload reads the config file again and re-scans the
+// directories. Settings used when the server started are reported in
+// "restart" rather than applied.
+func (a *App) handleAdminConfigReload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	restart, err := a.reloadConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if restart == nil {
+		restart = []string{}
+	}
+	a.docsMu.RLock()
+	configFile, count := a.ConfigFile, len(a.Documents)
+	a.docsMu.RUnlock()
+	slog.Info("config reloaded from the admin API", "file", configFile, "documents", count, "restart", restart)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"documents": count,
+		"restart":   restart,
+	})
+}
+
+// reloadConfig loads the config file the server started with, keeping the
+// flag overrides and PATH argument, and swaps it in if it is valid. It
+// returns the changed settings that need a restart to take effect.
+func (a *App) reloadConfig() ([]string, error) {
+	next := NewApp()
+	next.WorkingDir = a.WorkingDir
+	next.Overrides = a.Overrides
+	if err := next.LoadConfig(a.ConfigFile, a.TargetPath); err != nil {
+		return nil, err
+	}
+
+	// Scans read the config, so none may run while it is swapped
+	a.rescanMu.Lock()
+	a.docsMu.Lock()
+	restart := restartSettings(a.Config, next.Config)
+	a.Config = next.Config
+	a.IgnoreRegexes = next.IgnoreRegexes
+	a.FileMatchers = next.FileMatchers
+	if next.ConfigFile != "" {
+		a.ConfigFile = next.ConfigFile
+	}
+	a.Markdown = newMarkdownRenderer(a.Config, a.resolveWikiLink)
+	a.Sanitizer = newSanitizer(a.Config)
+	a.docsMu.Unlock()
+	a.rescanMu.Unlock()
+
+	a.commits.mu.Lock()
+	a.commits.dates = nil
+	a.commits.mu.Unlock()
+
+	if _, err := a.rescan(true); err != nil {
+		return restart, fmt.Errorf("config reloaded, but scanning failed: %w", err)
+	}
+	return restart, nil
+}
+
+// restartSettings returns the settings that differ between two configs and
+// are only read when the server starts
+func restartSettings(old, next Config) []string {
+	same := map[string]bool{
+		"port":                   old.Port == next.Port,
+		"host":                   old.Host == next.Host,
+		"strict_port":            old.StrictPort == next.StrictPort,
+		"base_path":              old.BasePath == next.BasePath,
+		"static_dir":             old.StaticDir == next.StaticDir,
+		"cache_format":           old.CacheFormat == next.CacheFormat,
+		"rescan_interval":        old.RescanInterval == next.RescanInterval,
+		"render_cache_size":      old.RenderCacheSize == next.RenderCacheSize,
+		"prerender":              old.Prerender == next.Prerender,
+		"render_cache_dir":       old.RenderCacheDir == next.RenderCacheDir,
+		"access_log":             old.AccessLog == next.AccessLog,
+		"access_log_max_size":    old.AccessLogMaxSize == next.AccessLogMaxSize,
+		"access_log_max_backups": old.AccessLogMaxBackups == next.AccessLogMaxBackups,
+		"annotations":            old.Annotations == next.Annotations,
+		"notify":                 old.Notify == next.Notify,
+		"auth":                   old.Auth.authEnabled() == next.Auth.authEnabled(),
+	}
+	var changed []string
+	for name, ok := range same {
+		if !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// checkAdmin validates admin_token and admin_users, which are required
+// when the server listens on a network interface
+func (v *configValidator) checkAdmin(config Config) {
+	if config.AdminToken != "" && len(config.AdminToken) < minAdminTokenLength {
+		v.add("admin_token", "too short (at least %d characters)", minAdminTokenLength)
+	}
+	if len(config.AdminUsers) > 0 && !config.Auth.authEnabled() {
+		v.add("admin_users", "admin_users need auth.users or auth.user_header to identify users")
+	}
+	if config.Host != "" && !isLoopbackHost(config.Host) && config.AdminToken == "" && len(config.AdminUsers) == 0 {
+		v.add("host", "listening on %s needs admin_token or admin_users for the admin API", config.Host)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestLocalAdminWithoutToken(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+	for _, tc := range []struct {
+		name      string
+		host      string
+		localOnly bool
+		container bool
+		basePath  string
+		remote    string
+		want      bool
+	}{
+		{"default host", "", false, false, "", "127.0.0.1:40000", true},
+		{"default host, remote request", "", false, false, "", "192.0.2.1:40000", false},
+		{"loopback host", "127.0.0.1", true, false, "", "127.0.0.1:40000", true},
+		{"container", "", false, true, "", "127.0.0.1:40000", false},
+		{"network host", "192.0.2.10", false, false, "", "127.0.0.1:40000", false},
+		{"base path", "", false, false, "/docs", "127.0.0.1:40000", false},
+	} {
+		a.Config.Host, a.LocalOnly, a.Container, a.Config.BasePath = tc.host, tc.localOnly, tc.container, tc.basePath
+		r := httptest.NewRequest(http.MethodPost, "/api/reload", nil)
+		r.RemoteAddr, r.Host = tc.remote, "localhost:8090"
+		if got := a.isAdmin(r); got != tc.want {
+			t.Errorf("%s: isAdmin = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestReloadWithDefaultConfig(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+	r := httptest.NewRequest(http.MethodPost, "/api/reload", nil)
+	r.RemoteAddr, r.Host = "127.0.0.1:40000", "localhost:8090"
+	w := httptest.NewRecorder()
+	a.withAdmin(a.handleReload)(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("got %d %q, want %d", w.Code, w.Body, http.StatusOK)
+	}
+}
+
+// Run with -race: the count reported after a re-scan is read while other
+// re-scans swap the documents
+func TestConcurrentAdminRescans(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			a.handleAdminRescan(w, httptest.NewRequest(http.MethodPost, "/admin/rescan", nil))
+			if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"documents":1`) {
+				t.Errorf("got %d %q", w.Code, w.Body)
+			}
+		}()
+	}
+	wg.Wait()
+}
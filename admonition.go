@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindAdmonition is the node kind of admonition blocks
+var KindAdmonition = ast.NewNodeKind("Admonition")
+
+// Admonition is a GitHub-style alert: a blockquote starting with a
+// "[!NOTE]", "[!TIP]", "[!IMPORTANT]", "[!WARNING]" or "[!CAUTION]" line
+type Admonition struct {
+	ast.BaseBlock
+	AdmonitionType string // lowercase, e.g. "note"
+}
+
+// Kind implements ast.Node
+func (n *Admonition) Kind() ast.NodeKind {
+	return KindAdmonition
+}
+
+// Dump implements ast.Node
+func (n *Admonition) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"AdmonitionType": n.AdmonitionType}, nil)
+}
+
+// admonitionMarker matches the first line of an admonition
+var admonitionMarker = regexp.MustCompile(`^\[!(?i:(note|tip|important|warning|caution))\]\s*$`)
+
+// admonitionTransformer turns blockquotes starting with a marker line into
+// admonitions
+type admonitionTransformer struct{}
+
+// Transform implements parser.ASTTransformer
+func (t *admonitionTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+
+	var quotes []*ast.Blockquote
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if quote, ok := n.(*ast.Blockquote); ok && entering {
+			quotes = append(quotes, quote)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, quote := range quotes {
+		para, ok := quote.FirstChild().(*ast.Paragraph)
+		if !ok || para.Lines().Len() == 0 {
+			continue
+		}
+		first := para.Lines().At(0)
+		m := admonitionMarker.FindSubmatch(first.Value(source))
+		if m == nil {
+			continue
+		}
+
+		// Drop the marker line from the paragraph, and the paragraph itself
+		// if nothing else is left
+		for c := para.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			if t, ok := c.(*ast.Text); !ok || t.Segment.Start >= first.Stop {
+				break
+			}
+			para.RemoveChild(para, c)
+			c = next
+		}
+		lines := text.NewSegments()
+		for i := 1; i < para.Lines().Len(); i++ {
+			lines.Append(para.Lines().At(i))
+		}
+		para.SetLines(lines)
+		if !para.HasChildren() {
+			quote.RemoveChild(quote, para)
+		}
+
+		admonition := &Admonition{AdmonitionType: strings.ToLower(string(m[1]))}
+		for c := quote.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			admonition.AppendChild(admonition, c)
+			c = next
+		}
+		quote.Parent().ReplaceChild(quote.Parent(), quote, admonition)
+	}
+}
+
+// admonitionRenderer renders admonitions as a titled box
+type admonitionRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *admonitionRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindAdmonition, r.render)
+}
+
+func (r *admonitionRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		w.WriteString("</div>\n")
+		return ast.WalkContinue, nil
+	}
+	kind := node.(*Admonition).AdmonitionType
+	title := strings.ToUpper(kind[:1]) + kind[1:]
+	fmt.Fprintf(w, "<div class=\"admonition admonition-%s\">\n<p class=\"admonition-title\">%s</p>\n", kind, title)
+	return ast.WalkContinue, nil
+}
+
+// admonitions is the goldmark extension adding admonition blocks
+type admonitions struct{}
+
+// Extend implements goldmark.Extender
+func (e *admonitions) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&admonitionTransformer{}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&admonitionRenderer{}, 100)))
+}
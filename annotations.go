@@ -0,0 +1,298 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// annotationsFileName stores the comments left on documents, shared by
+	// everyone using the server, in the state directory (see statePath)
+	annotationsFileName = ".dimandocs-annotations.json"
+
+	maxAnnotationText         = 4000 // characters
+	maxAnnotationAuthor       = 80   // characters
+	maxAnnotationHeading      = 200  // characters
+	maxAnnotationsPerDocument = 500
+	maxAnnotationLines        = 200 // lines a comment can span
+)
+
+// Annotation is a comment on a document, anchored to a heading or to a
+// range of lines of its markdown source
+type Annotation struct {
+	ID      string `json:"id"`
+	Path    string `json:"path"`              // RelPath of the document
+	Anchor  string `json:"anchor,omitempty"`  // heading ID
+	Heading string `json:"heading,omitempty"` // heading text when the comment was left
+
+	// LineStart and LineEnd are the first and last line commented on,
+	// counted from 1 (0 for comments on a heading)
+	LineStart int `json:"line_start,omitempty"`
+	LineEnd   int `json:"line_end,omitempty"`
+
+	Author  string    `json:"author"`
+	Text    string    `json:"text"`
+	Created time.Time `json:"created"`
+
+	// Client is the browser that left the comment, the only one allowed to
+	// delete it. It is never sent to browsers.
+	Client string `json:"client,omitempty"`
+}
+
+// AnnotationView is an annotation as returned by /api/annotations
+type AnnotationView struct {
+	Annotation
+	Excerpt string `json:"excerpt,omitempty"` // the commented lines as they are now
+	Mine    bool   `json:"mine"`              // left by the requesting browser
+}
+
+// AnnotationStore keeps the annotations of every document and persists them
+// to a file so they survive restarts
+type AnnotationStore struct {
+	mu          sync.Mutex
+	path        string
+	annotations map[string][]Annotation // by document RelPath, oldest first
+}
+
+// LoadAnnotations reads the annotations file, starting empty if it does not
+// exist
+func LoadAnnotations(path string) *AnnotationStore {
+	s := &AnnotationStore{path: path, annotations: make(map[string][]Annotation)}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read annotations", "file", path, "error", err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(data, &s.annotations); err != nil {
+		slog.Warn("failed to parse annotations, starting empty", "file", path, "error", err)
+		s.annotations = make(map[string][]Annotation)
+	}
+	return s
+}
+
+// List returns a copy of the annotations of a document, oldest first
+func (s *AnnotationStore) List(relPath string) []Annotation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Annotation(nil), s.annotations[relPath]...)
+}
+
+// Add stores an annotation, giving it an ID and creation time. It reports
+// false if the document already has maxAnnotationsPerDocument.
+func (s *AnnotationStore) Add(annotation Annotation) (Annotation, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.annotations[annotation.Path]) >= maxAnnotationsPerDocument {
+		return annotation, false
+	}
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	annotation.ID = hex.EncodeToString(buf)
+	annotation.Created = time.Now().UTC()
+	s.annotations[annotation.Path] = append(s.annotations[annotation.Path], annotation)
+	s.save()
+	return annotation, true
+}
+
+// Delete removes an annotation of a document left by client. found is false
+// if there is no such annotation, allowed if it was left by another browser.
+func (s *AnnotationStore) Delete(relPath, id, client string) (found, allowed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.annotations[relPath]
+	for i, annotation := range list {
+		if annotation.ID != id {
+			continue
+		}
+		if annotation.Client != client {
+			return true, false
+		}
+		list = append(list[:i:i], list[i+1:]...)
+		if len(list) == 0 {
+			delete(s.annotations, relPath)
+		} else {
+			s.annotations[relPath] = list
+		}
+		s.save()
+		return true, true
+	}
+	return false, false
+}
+
+// save writes the annotations file; the caller holds s.mu
+func (s *AnnotationStore) save() {
+	data, err := json.MarshalIndent(s.annotations, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(s.path, data, 0644)
+	}
+	if err != nil {
+		slog.Warn("failed to save annotations", "file", s.path, "error", err)
+	}
+}
+
+// annotationRequest is the body of POST /api/annotations
+type annotationRequest struct {
+	Path      string `json:"path"`
+	Anchor    string `json:"anchor"`
+	Heading   string `json:"heading"`
+	LineStart int    `json:"line_start"`
+	LineEnd   int    `json:"line_end"`
+	Author    string `json:"author"`
+	Text      string `json:"text"`
+}
+
+// handleAnnotations lists the annotations of a document (GET ?path=), adds
+// one (POST) and deletes one left by the requesting browser (DELETE
+// ?path=&id=). It is only available with the annotations option.
+func (a *App) handleAnnotations(w http.ResponseWriter, r *http.Request) {
+	if a.Annotations == nil {
+		http.Error(w, "Annotations are disabled (set \"annotations\": true in the config)", http.StatusNotFound)
+		return
+	}
+	client := a.clientID(w, r)
+
+	switch r.Method {
+	case http.MethodGet:
+		doc := a.readableDocument(r, strings.TrimPrefix(r.URL.Query().Get("path"), "/"))
+		if doc == nil {
+			http.NotFound(w, r)
+			return
+		}
+		a.writeAnnotations(w, http.StatusOK, doc, a.Annotations.List(doc.RelPath), client)
+
+	case http.MethodPost:
+		if !isSameOrigin(r) {
+			http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+		var req annotationRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		doc := a.readableDocument(r, strings.TrimPrefix(req.Path, "/"))
+		if doc == nil {
+			http.NotFound(w, r)
+			return
+		}
+		annotation, err := a.newAnnotation(doc, req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		annotation.Client = client
+		annotation, ok := a.Annotations.Add(annotation)
+		if !ok {
+			http.Error(w, fmt.Sprintf("A document can have at most %d comments", maxAnnotationsPerDocument), http.StatusConflict)
+			return
+		}
+		slog.Info("annotation added", "path", doc.RelPath, "id", annotation.ID)
+		a.writeAnnotations(w, http.StatusCreated, doc, []Annotation{annotation}, client)
+
+	case http.MethodDelete:
+		if !isSameOrigin(r) {
+			http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+			return
+		}
+		path := strings.TrimPrefix(r.URL.Query().Get("path"), "/")
+		found, allowed := a.Annotations.Delete(path, r.URL.Query().Get("id"), client)
+		switch {
+		case !found:
+			http.NotFound(w, r)
+		case !allowed:
+			http.Error(w, "Only the browser that left a comment can delete it", http.StatusForbidden)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// newAnnotation checks a comment to add to doc: it needs text and either a
+// heading anchor or a line range within the document
+func (a *App) newAnnotation(doc *Document, req annotationRequest) (Annotation, error) {
+	annotation := Annotation{
+		Path:   doc.RelPath,
+		Author: strings.TrimSpace(req.Author),
+		Text:   strings.TrimSpace(req.Text),
+	}
+	switch {
+	case annotation.Text == "":
+		return annotation, fmt.Errorf("text is required")
+	case utf8.RuneCountInString(annotation.Text) > maxAnnotationText:
+		return annotation, fmt.Errorf("text is longer than %d characters", maxAnnotationText)
+	case utf8.RuneCountInString(annotation.Author) > maxAnnotationAuthor:
+		return annotation, fmt.Errorf("author is longer than %d characters", maxAnnotationAuthor)
+	}
+	if annotation.Author == "" {
+		annotation.Author = "Anonymous"
+	}
+
+	if req.Anchor != "" {
+		annotation.Anchor = req.Anchor
+		annotation.Heading = strings.TrimSpace(req.Heading)
+		if utf8.RuneCountInString(annotation.Heading) > maxAnnotationHeading {
+			annotation.Heading = string([]rune(annotation.Heading)[:maxAnnotationHeading])
+		}
+		return annotation, nil
+	}
+
+	content, err := a.readDocumentContent(doc)
+	if err != nil {
+		return annotation, err
+	}
+	lines := strings.Count(strings.TrimSuffix(content, "\n"), "\n") + 1
+	switch {
+	case req.LineStart < 1 || req.LineEnd < req.LineStart:
+		return annotation, fmt.Errorf("anchor or a line range (line_start <= line_end) is required")
+	case req.LineEnd > lines:
+		return annotation, fmt.Errorf("the document has %d lines", lines)
+	case req.LineEnd-req.LineStart >= maxAnnotationLines:
+		return annotation, fmt.Errorf("a comment can span at most %d lines", maxAnnotationLines)
+	}
+	annotation.LineStart, annotation.LineEnd = req.LineStart, req.LineEnd
+	return annotation, nil
+}
+
+// writeAnnotations responds with annotations of doc, adding the current
+// text of commented lines
+func (a *App) writeAnnotations(w http.ResponseWriter, status int, doc *Document, annotations []Annotation, client string) {
+	var lines []string
+	views := make([]AnnotationView, 0, len(annotations))
+	for _, annotation := range annotations {
+		view := AnnotationView{Annotation: annotation, Mine: annotation.Client == client}
+		view.Client = ""
+		if annotation.LineStart > 0 {
+			if lines == nil {
+				content, err := a.readDocumentContent(doc)
+				if err != nil {
+					slog.Warn("failed to read content", "path", doc.Path, "error", err)
+				}
+				lines = strings.Split(content, "\n")
+			}
+			if annotation.LineStart <= len(lines) {
+				end := annotation.LineEnd
+				if end > len(lines) {
+					end = len(lines)
+				}
+				view.Excerpt = strings.Join(lines[annotation.LineStart-1:end], "\n")
+			}
+		}
+		views = append(views, view)
+	}
+	writeJSON(w, status, map[string][]AnnotationView{"annotations": views})
+}
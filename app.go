@@ -6,45 +6,31 @@ import (
 	"encoding/json"
 	"fmt"
 	"html/template"
+	"io"
 	"io/ioutil"
-	"log"
+	"log/slog"
+	"mime"
 	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"regexp"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
-
-	"github.com/yuin/goldmark"
-	"github.com/yuin/goldmark/extension"
-	"github.com/yuin/goldmark/parser"
-	"github.com/yuin/goldmark/renderer/html"
 )
 
 //go:embed templates/*
 var templatesFS embed.FS
 
-// Goldmark markdown renderer with GitHub Flavored Markdown support
-var markdownRenderer = goldmark.New(
-	goldmark.WithExtensions(
-		extension.GFM, // GitHub Flavored Markdown
-	),
-	goldmark.WithParserOptions(
-		parser.WithAutoHeadingID(), // Auto-generate heading IDs
-	),
-	goldmark.WithRendererOptions(
-		html.WithUnsafe(), // Allow raw HTML in markdown
-	),
-)
-
 // NewApp creates a new application instance
 func NewApp() *App {
 	return &App{
-		FileRegexes: make(map[string]*regexp.Regexp),
+		FileMatchers: make(map[string]*FileMatcher),
+		Metrics:      NewMetrics(),
 	}
 }
 
@@ -57,52 +43,232 @@ func (a *App) Initialize(configFile string, targetPath string, useCache bool) er
 	}
 	a.WorkingDir = workingDir
 	a.UseCache = useCache
+	a.TargetPath = targetPath
 
 	// Load configuration
 	if err := a.LoadConfig(configFile, targetPath); err != nil {
 		return err
 	}
 
+	a.Markdown = newMarkdownRenderer(a.Config, a.resolveWikiLink)
+	a.Sanitizer = newSanitizer(a.Config)
+	a.Renders = NewRenderCache(a.renderCacheSize(), a.Config.RenderCacheDir)
+	a.History = LoadHistory(a.statePath(historyFileName))
+	a.Views = LoadViews(a.statePath(viewsFileName))
+	a.Moves = LoadMoves(a.statePath(movesFileName))
+	a.preferencesKey = loadPreferencesKey(a.statePath(preferencesSecretFileName))
+	if a.Config.Annotations {
+		a.Annotations = LoadAnnotations(a.statePath(annotationsFileName))
+	}
+
+	if a.Config.Notify.WebhookURL != "" {
+		site := a.Config.Title
+		if site == "" {
+			site = "DimanDocs"
+		}
+		a.Notifier = NewNotifier(a.Config.Notify, site, func() string {
+			if a.Config.Notify.URL != "" {
+				return a.Config.Notify.URL
+			}
+			return a.Instance.URL()
+		})
+	}
+
+	if a.Config.AccessLog != "" {
+		accessLog, err := OpenRotatingFile(a.Config.AccessLog, a.Config.AccessLogMaxSize, a.Config.AccessLogMaxBackups)
+		if err != nil {
+			return fmt.Errorf("failed to open access log: %w", err)
+		}
+		a.AccessLog = accessLog
+	}
+
 	// Try to load from cache if enabled
 	if a.UseCache {
-		if err := a.loadFromCache(); err == nil {
-			fmt.Printf("Loaded %d documents from cache\n", len(a.Documents))
+		err := a.loadFromCache()
+		if err == nil {
+			slog.Info("loaded documents from cache", "documents", len(a.Documents))
+			a.Links = a.buildLinkGraph()
+			a.prerenderDocuments(a.allDocuments())
 			return nil
 		}
 		// If cache failed, continue with normal scan
-		fmt.Println("Cache not found or invalid, scanning directories...")
+		slog.Info("cache not used, scanning directories", "reason", err)
+	}
+
+	// Servers scan in the background once they listen (see Start), except
+	// when opening a file, whose URL is only known after the scan
+	if a.TargetFile == "" {
+		a.indexing.running = true
+		return nil
 	}
+	return a.scanDocuments()
+}
 
-	// Scan directories for documents
-	if err := a.ScanDirectories(); err != nil {
+// scanDocuments scans the directories for documents, builds the link graph,
+// saves the documents to the cache and pre-renders them if enabled
+func (a *App) scanDocuments() error {
+	docs, err := a.scanAll(nil)
+	if err != nil {
 		return err
 	}
+	a.docsMu.Lock()
+	a.setDocuments(docs)
+	a.Links = a.buildLinkGraph()
+	a.docsMu.Unlock()
 
 	// Save to cache if enabled
 	if a.UseCache {
 		if err := a.saveToCache(); err != nil {
-			log.Printf("Warning: failed to save cache: %v", err)
+			slog.Warn("failed to save cache", "error", err)
 		} else {
-			fmt.Printf("Saved %d documents to cache\n", len(a.Documents))
+			slog.Info("saved documents to cache", "documents", len(a.Documents))
 		}
 	}
-
+	a.prerenderDocuments(a.allDocuments())
 	return nil
 }
 
-// ScanDirectories scans all configured directories for documents
+// ScanDirectories scans all configured directories for documents.
+// Directories are walked concurrently and matching files are processed by a
+// bounded pool of workers; the resulting documents keep the walk order.
 func (a *App) ScanDirectories() error {
-	for _, dirConfig := range a.Config.Directories {
-		if err := a.scanDirectory(dirConfig.Path, dirConfig.Name, a.FileRegexes[dirConfig.Path]); err != nil {
-			return fmt.Errorf("failed to scan directory %s: %w", dirConfig.Path, err)
-		}
+	docs, err := a.scanAll(nil)
+	if err != nil {
+		return err
 	}
+	a.setDocuments(docs)
 	return nil
 }
 
-// scanDirectory scans a single directory for matching files
-func (a *App) scanDirectory(rootDir string, sourceName string, fileRegex *regexp.Regexp) error {
-	return filepath.Walk(rootDir, func(path string, info os.FileInfo, err error) error {
+// scanAll walks every configured directory and returns the documents found.
+// Documents in reuse (by path) whose file has the same size and modification
+// time are returned as they are instead of processing the file again.
+func (a *App) scanAll(reuse map[string]Document) ([]Document, error) {
+	a.syncRemoteSources()
+
+	workers := a.Config.ScanWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	progress := &ScanProgress{}
+	a.scanMu.Lock()
+	a.Scan = progress
+	a.scanMu.Unlock()
+	stopReport := progress.report(2 * time.Second)
+	defer stopReport()
+	limits := a.newScanLimits()
+
+	jobs := make(chan scanJob, workers*4)
+	results := make(chan scanResult, workers*4)
+
+	// Walk each configured directory in its own goroutine
+	var walkers sync.WaitGroup
+	walkErrs := make([]error, len(a.Config.Directories))
+	for i, dirConfig := range a.Config.Directories {
+		walkers.Add(1)
+		go func(i int, dirConfig DirectoryConfig) {
+			defer walkers.Done()
+			if err := a.scanDirectory(i, dirConfig.Path, dirConfig.Name, a.FileMatchers[dirConfig.Path], jobs, progress, limits); err != nil {
+				walkErrs[i] = fmt.Errorf("failed to scan directory %s: %w", dirConfig.Path, err)
+			}
+		}(i, dirConfig)
+	}
+	go func() {
+		walkers.Wait()
+		close(jobs)
+	}()
+
+	// Process matching files in a bounded worker pool
+	var pool sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		pool.Add(1)
+		go func() {
+			defer pool.Done()
+			for job := range jobs {
+				if doc, ok := reuse[job.path]; ok && !doc.ModTime.IsZero() && doc.ModTime.Equal(job.modTime) && doc.Size == job.size {
+					progress.reused.Add(1)
+					progress.processed.Add(1)
+					results <- scanResult{job: job, doc: doc, ok: true}
+					continue
+				}
+				doc, err := a.processFile(job.path, job.rootDir, job.sourceName)
+				if err != nil {
+					slog.Warn("failed to process file", "path", job.path, "error", err)
+				}
+				progress.processed.Add(1)
+				results <- scanResult{job: job, doc: doc, ok: err == nil}
+			}
+		}()
+	}
+	go func() {
+		pool.Wait()
+		close(results)
+	}()
+
+	var collected []scanResult
+	for res := range results {
+		if res.ok {
+			collected = append(collected, res)
+		}
+	}
+
+	for _, err := range walkErrs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Restore the order in which files were discovered
+	sort.Slice(collected, func(i, j int) bool {
+		if collected[i].job.dirIndex != collected[j].job.dirIndex {
+			return collected[i].job.dirIndex < collected[j].job.dirIndex
+		}
+		return collected[i].job.seq < collected[j].job.seq
+	})
+
+	docs := make([]Document, len(collected))
+	for i, res := range collected {
+		docs[i] = res.doc
+	}
+	return docs, nil
+}
+
+// scanDirectory walks a single directory and queues matching files for processing
+func (a *App) scanDirectory(dirIndex int, rootDir string, sourceName string, matcher *FileMatcher, jobs chan<- scanJob, progress *ScanProgress, limits *scanLimits) error {
+	seq := 0
+	return a.walkDirectory(rootDir, matcher, func(path, relPath string, info os.FileInfo) error {
+		if limits.exceeded(progress) {
+			return filepath.SkipAll
+		}
+		progress.walked.Add(1)
+		if matcher.Match(relPath) {
+			if !limits.add(progress, info.Size()) {
+				return filepath.SkipAll
+			}
+			progress.matched.Add(1)
+			jobs <- scanJob{
+				dirIndex:   dirIndex,
+				seq:        seq,
+				path:       path,
+				rootDir:    rootDir,
+				sourceName: sourceName,
+				size:       info.Size(),
+				modTime:    info.ModTime(),
+			}
+			seq++
+		}
+		return nil
+	})
+}
+
+// walkDirectory walks a configured directory and calls fn for each file
+// that is not excluded by ignore_patterns, the directory's matcher or the
+// .gitignore/.dimandocsignore files found along the way. relPath is the
+// slash-separated path relative to rootDir.
+func (a *App) walkDirectory(rootDir string, matcher *FileMatcher, fn func(path, relPath string, info os.FileInfo) error) error {
+	ignoreFiles := newIgnoreRules(a.ignoreFileNames())
+	return walkFiles(rootDir, a.Config.FollowSymlinks, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
 		}
@@ -114,65 +280,92 @@ func (a *App) scanDirectory(rootDir string, sourceName string, fileRegex *regexp
 			return nil
 		}
 
-		if !info.IsDir() {
-			filename := info.Name()
-			if fileRegex.MatchString(filename) {
-				if err := a.processFile(path, rootDir, sourceName); err != nil {
-					log.Printf("Failed to process file %s: %v", path, err)
-				}
+		relPath, err := filepath.Rel(rootDir, path)
+		if err != nil {
+			relPath = info.Name()
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		// Honor the directory's ignore_patterns and .gitignore/.dimandocsignore
+		// files found along the way
+		if relPath != "." && (matcher.Ignored(path, relPath, info.IsDir()) || ignoreFiles.Ignored(relPath, info.IsDir())) {
+			if info.IsDir() {
+				return filepath.SkipDir
 			}
+			return nil
 		}
 
-		return nil
+		if info.IsDir() {
+			dirRel := relPath
+			if dirRel == "." {
+				dirRel = ""
+			}
+			ignoreFiles.load(dirRel, path)
+			return nil
+		}
+		return fn(path, relPath, info)
 	})
 }
 
-// extractOverviewParagraph extracts the first paragraph after "## Overview" heading
-func extractOverviewParagraph(content string) string {
-	lines := strings.Split(content, "\n")
-	foundOverview := false
-	var paragraphLines []string
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
+// metadataReadLimit is how much of a file is read at scan time to extract
+// the title and overview; the full content is loaded on demand
+const metadataReadLimit = 64 * 1024
 
-		// Check if we found the Overview heading
-		if strings.HasPrefix(trimmedLine, "## Overview") {
-			foundOverview = true
-			continue
-		}
-
-		// If we found Overview, start collecting paragraph lines
-		if foundOverview {
-			// Skip empty lines after the heading
-			if trimmedLine == "" && len(paragraphLines) == 0 {
-				continue
-			}
+// readFileHead reads at most limit bytes from the start of a file
+func readFileHead(path string, limit int64) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(io.LimitReader(f, limit))
+}
 
-			// Stop if we hit another heading or empty line after content
-			if (strings.HasPrefix(trimmedLine, "#") || trimmedLine == "") && len(paragraphLines) > 0 {
-				break
-			}
+// readDocumentContent loads a document's content from disk, honoring max_file_size
+func (a *App) readDocumentContent(doc *Document) (string, error) {
+	if doc.Content != "" {
+		return doc.Content, nil
+	}
 
-			// Collect non-empty lines
-			if trimmedLine != "" {
-				paragraphLines = append(paragraphLines, trimmedLine)
-			}
+	limit := a.Config.MaxFileSize
+	if limit <= 0 {
+		content, err := ioutil.ReadFile(doc.Path)
+		if err != nil {
+			return "", err
 		}
+		return string(content), nil
 	}
 
-	return strings.Join(paragraphLines, " ")
+	content, err := readFileHead(doc.Path, limit)
+	if err != nil {
+		return "", err
+	}
+	if doc.Size > limit && !isOpenAPIFile(doc.Path) && !isTableFile(doc.Path) {
+		content = append(content, fmt.Sprintf("\n\n> **Truncated:** this document is larger than %d bytes.\n", limit)...)
+	}
+	return string(content), nil
 }
 
-// processFile processes a single markdown file
-func (a *App) processFile(path, rootDir, sourceName string) error {
-	content, err := ioutil.ReadFile(path)
+// processFile processes a single markdown file into a Document.
+// Only the beginning of the file is read; content is loaded on demand.
+func (a *App) processFile(path, rootDir, sourceName string) (Document, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to stat file: %w", err)
+	}
+	if limit := a.Config.MaxFileSize; limit > 0 && info.Size() > limit && !a.Config.TruncateLargeFiles {
+		return Document{}, fmt.Errorf("file size %d exceeds max_file_size %d, skipping", info.Size(), limit)
+	}
+
+	content, err := readFileHead(path, metadataReadLimit)
 	if err != nil {
-		return fmt.Errorf("failed to read file: %w", err)
+		return Document{}, fmt.Errorf("failed to read file: %w", err)
 	}
 
+	// Paths shown and used in URLs are slash-separated on every OS
 	relPath, _ := filepath.Rel(rootDir, path)
-	dirName := filepath.Dir(relPath)
+	dirName := filepath.ToSlash(filepath.Dir(relPath))
+	relPath = filepath.ToSlash(relPath)
 	if dirName == "." {
 		dirName = "Root"
 	}
@@ -187,45 +380,82 @@ func (a *App) processFile(path, rootDir, sourceName string) error {
 
 	absPath, _ := filepath.Abs(path)
 	absDir := filepath.Dir(absPath)
-	relAbsDir, _ := filepath.Rel(a.WorkingDir, absDir)
+	relAbsDir, err := filepath.Rel(a.WorkingDir, absDir)
+	if err != nil {
+		// On another drive than the working directory (Windows)
+		relAbsDir = absDir
+	}
+	relAbsDir = filepath.ToSlash(relAbsDir)
 
 	// If path starts with ../, replace it with /
 	if strings.HasPrefix(relAbsDir, "../") {
 		relAbsDir = "/" + strings.TrimPrefix(relAbsDir, "../")
 	}
 
-	title := dirName
-	if strings.Contains(string(content), "# ") {
-		lines := strings.Split(string(content), "\n")
-		for _, line := range lines {
-			if strings.HasPrefix(line, "# ") {
-				title = strings.TrimPrefix(line, "# ")
-				break
-			}
-		}
-	}
+	title := substituteVariables(extractTitle(string(content), dirName), a.Config.Variables)
+	language, _ := detectLanguage(relPath)
 
 	// Extract overview paragraph
-	overview := extractOverviewParagraph(string(content))
+	overview := substituteVariables(extractOverview(string(content), a.Config.Overview), a.Config.Variables)
+
+	// Collect tags from frontmatter ("tags:" or "tag:"). API specs and
+	// tables have none; the title and overview of specs come from their
+	// info object.
+	var frontmatter map[string][]string
+	switch {
+	case isOpenAPIFile(path):
+		title, overview = a.openAPISummary(path, dirName)
+	case isTableFile(path):
+		title, overview = dirName, ""
+	default:
+		frontmatter = parseFrontmatter(string(content))
+	}
+	tags := append(frontmatter["tags"], frontmatter["tag"]...)
+	slug := ""
+	if values := frontmatter["slug"]; len(values) > 0 {
+		slug = values[0]
+	}
+	order := 0
+	if values := frontmatter["order"]; len(values) > 0 {
+		if order, err = strconv.Atoi(values[0]); err != nil {
+			slog.Warn("ignoring invalid order", "path", path, "order", values[0])
+		}
+	}
 
 	doc := Document{
 		Title:      title,
 		Path:       path,
-		Content:    string(content),
 		RelPath:    relPath,
 		DirName:    dirName,
 		SourceDir:  rootDir,
 		SourceName: sourceName,
 		AbsPath:    relAbsDir,
 		Overview:   overview,
+		Size:       info.Size(),
+		Tags:       tags,
+		Tasks:      countTasks(string(content)),
+		Words:      a.countWords(path, content, info.Size()),
+		Language:   language,
+		Order:      order,
+		ModTime:    info.ModTime(),
+		Hash:       contentHash(string(content)),
+		Slug:       slug,
 	}
 
-	a.Documents = append(a.Documents, doc)
-	return nil
+	return doc, nil
+}
+
+// ignoreFileNames returns the ignore files honored while scanning
+func (a *App) ignoreFileNames() []string {
+	if a.Config.RespectGitignore != nil && !*a.Config.RespectGitignore {
+		return []string{".dimandocsignore"}
+	}
+	return ignoreFileNames
 }
 
 // shouldIgnorePath checks if a path should be ignored
 func (a *App) shouldIgnorePath(path string) bool {
+	path = filepath.ToSlash(path) // patterns use "/" on Windows too
 	for _, regex := range a.IgnoreRegexes {
 		if regex.MatchString(path) {
 			return true
@@ -243,7 +473,9 @@ func (a *App) GroupDocumentsByDirectory() []DirectoryGroup {
 	}
 
 	var groups []DirectoryGroup
-	for name, docs := range groupMap {
+	for _, name := range a.sourceNames(groupMap) {
+		docs := groupMap[name]
+		sort.Slice(docs, func(i, j int) bool { return docs[i].RelPath < docs[j].RelPath })
 		groups = append(groups, DirectoryGroup{
 			Name:      name,
 			Documents: docs,
@@ -262,7 +494,8 @@ func (a *App) BuildDirectoryTrees() []DirectoryTree {
 	}
 
 	var trees []DirectoryTree
-	for sourceName, docs := range groupMap {
+	for _, sourceName := range a.sourceNames(groupMap) {
+		docs := groupMap[sourceName]
 		root := &TreeNode{
 			Name:     sourceName,
 			Path:     "",
@@ -276,6 +509,8 @@ func (a *App) BuildDirectoryTrees() []DirectoryTree {
 			doc := &docs[i]
 			addDocumentToTree(root, doc, doc.SourceDir)
 		}
+		setFolderIndexes(root)
+		a.sortTree(root, a.navOrder(sourceName))
 
 		trees = append(trees, DirectoryTree{
 			Name: sourceName,
@@ -344,10 +579,95 @@ func addDocumentToTree(root *TreeNode, doc *Document, sourceDir string) {
 func (a *App) SetupRoutes() {
 	http.HandleFunc("/", a.handleIndex)
 	http.HandleFunc("/doc/", a.handleDocument)
+	http.HandleFunc("/d/", a.handleSlug)
+	http.HandleFunc("/dir/", a.handleFolder)
+	http.HandleFunc("/combined/", a.handleCombined)
+	http.HandleFunc("/export/", a.handleExport)
+	http.HandleFunc("/raw/", a.handleRaw)
+	http.HandleFunc("/download/", a.handleDownload)
 	http.HandleFunc("/api/search", a.handleSearch)
-	http.HandleFunc("/api/reload", a.handleReload)
+	http.HandleFunc("/api/quickopen", a.handleQuickOpen)
+	http.HandleFunc("/api/reload", a.withAdmin(a.handleReload))
+	http.HandleFunc("/api/rescan", a.withAdmin(a.handleRescan))
+	http.HandleFunc("/api/rescan/", a.withAdmin(a.handleRescan))
+	http.HandleFunc("/api/open", a.handleOpen)
+	http.HandleFunc("/api/documents/", a.handleDocumentAPI)
 	http.HandleFunc("/events", a.handleEvents)
-	http.HandleFunc("/static/", a.handleStatic)
+	http.HandleFunc("/debug/metrics", a.withLocalOrAdmin(a.handleMetrics))
+	http.HandleFunc("/api/locate", a.withLocalOrAdmin(a.handleLocate))
+	http.HandleFunc("/api/ping", a.handlePing)
+	http.HandleFunc("/stats", a.handleStats)
+	http.HandleFunc("/stale", a.handleStale)
+	http.HandleFunc("/diff", a.handleDiff)
+	http.HandleFunc("/graph", a.handleGraphPage)
+	http.HandleFunc("/api/linkcheck", a.handleLinkCheck)
+	http.HandleFunc("/api/graph", a.handleGraph)
+	http.HandleFunc("/api/recent", a.handleRecent)
+	http.HandleFunc("/api/favorites", a.handleFavorites)
+	http.HandleFunc("/api/searches", a.handleSearches)
+	http.HandleFunc("/api/preferences", a.handlePreferences)
+	http.HandleFunc("/api/annotations", a.handleAnnotations)
+	http.HandleFunc("/api/stats/views", a.handleViewStats)
+	http.HandleFunc("/api/scan/status", a.handleScanStatus)
+	a.registerAdminRoutes()
+	http.HandleFunc("/search", a.handleSearchPage)
+	http.HandleFunc("/opensearch.xml", a.handleOpenSearch)
+	http.HandleFunc("/api/suggest", a.handleSuggest)
+	http.Handle("/static/", newStaticHandler(a.Config.StaticDir))
+	http.HandleFunc("/assets/", a.handleAssets)
+	http.HandleFunc("/manifest.webmanifest", a.handleManifest)
+	http.HandleFunc("/sw.js", a.handleServiceWorker)
+	http.HandleFunc("/favicon.ico", a.handleFavicon)
+}
+
+// withBasePath serves next under basePath (e.g. "/docs") by stripping it from
+// request paths. Routes and handlers are registered without the prefix; links
+// in pages get it through the basePath template function.
+func withBasePath(basePath string, next http.Handler) http.Handler {
+	if basePath == "" {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == basePath {
+			http.Redirect(w, r, basePath+"/", http.StatusMovedPermanently)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, basePath+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		http.StripPrefix(basePath, next).ServeHTTP(w, r)
+	})
+}
+
+// templateFuncs are the functions shared by templates: basePath returns the
+// URL prefix to put in front of absolute links, asset the URL of a bundled
+// asset by its hashed name, integrity the attributes checking an asset loaded
+// from a CDN, size formats a number of bytes
+func (a *App) templateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"basePath": func() string { return a.Config.BasePath },
+		"asset": func(name string) string {
+			url := a.assets().URL(name)
+			if strings.HasPrefix(url, "/") {
+				url = a.Config.BasePath + url
+			}
+			return url
+		},
+		"integrity":  func(name string) template.HTMLAttr { return a.assets().Integrity(name) },
+		"size":       formatSize,
+		"pathEscape": escapePath,
+	}
+}
+
+// extractTitle returns the first "# " heading of content, or fallback
+func extractTitle(content, fallback string) string {
+	for _, line := range strings.Split(content, "\n") {
+		if strings.HasPrefix(line, "# ") {
+			return strings.TrimPrefix(line, "# ")
+		}
+	}
+	return fallback
 }
 
 // handleEvents handles SSE connections for client tracking
@@ -386,25 +706,60 @@ func (a *App) handleEvents(w http.ResponseWriter, r *http.Request) {
 
 // handleIndex handles the index page
 func (a *App) handleIndex(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFS(templatesFS, "templates/index.html")
+	if a.handleVersionedDocument(w, r) {
+		return
+	}
+	// "/" also receives every path no other route matches
+	if r.URL.Path != "/" {
+		a.notFound(w, r)
+		return
+	}
+
+	tmpl, err := a.parseTemplates("templates/index.html", "templates/search.html", "templates/shortcuts.html", "templates/tree.html", "templates/preferences.html", "templates/a11y.html")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		a.serveError(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	groups := a.GroupDocumentsByDirectory()
-	trees := a.BuildDirectoryTrees()
+	access := a.access(r)
+	groups := access.Groups(a.GroupDocumentsByDirectory())
+	trees := access.Trees(a.BuildDirectoryTrees())
+	prefs := a.preferencesView(r, trees)
+	trees = preferredFirst(trees, prefs.DefaultSource)
+	client := a.clientID(w, r)
+	recent, favorites := a.History.Get(client)
+	recentSearches, savedSearches := a.History.Searches(client)
 
 	data := IndexData{
 		Title:          a.Config.Title,
 		Groups:         groups,
 		Trees:          trees,
 		TotalDocuments: len(a.Documents),
+		Recent:         a.documentLinks(access, recent),
+		Favorites:      a.documentLinks(access, favorites),
+		RecentSearches: recentSearches,
+		SavedSearches:  savedSearches,
+		Prefs:          prefs,
 	}
-
-	if err := tmpl.Execute(w, data); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to execute template: %v", err), http.StatusInternalServerError)
+	if access != nil {
+		data.TotalDocuments = 0
+		for _, group := range groups {
+			data.TotalDocuments += len(group.Documents)
+		}
+	}
+	data.MostViewed, _ = a.documentViews(access, mostViewedCount)
+	data.Admin = a.isAdmin(r)
+	data.Indexing = a.isIndexing()
+	if progress := a.scanProgress(); progress != nil && !data.Indexing {
+		data.ScanLimit = progress.Limit()
+	}
+	if user := requestUser(r); user != nil {
+		data.User = user.Name
+	} else {
+		data.Login = len(a.Config.Auth.Users) > 0
 	}
+
+	servePage(w, r, tmpl, data)
 }
 
 // stripFrontmatter converts YAML frontmatter to a preformatted code block
@@ -441,53 +796,136 @@ func stripFrontmatter(content string) string {
 	return content
 }
 
-// handleDocument handles individual document pages
-func (a *App) handleDocument(w http.ResponseWriter, r *http.Request) {
-	path := strings.TrimPrefix(r.URL.Path, "/doc/")
-
-	var docIndex = -1
-	for i, d := range a.Documents {
-		if d.RelPath == path {
-			docIndex = i
-			break
+// removeFrontmatter returns content without its YAML frontmatter block
+func removeFrontmatter(content string) string {
+	if !strings.HasPrefix(content, "---\n") && !strings.HasPrefix(content, "---\r\n") {
+		return content
+	}
+	lines := strings.Split(content, "\n")
+	for i := 1; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "---" {
+			return strings.Join(lines[i+1:], "\n")
 		}
 	}
+	return content
+}
 
-	if docIndex == -1 {
-		http.NotFound(w, r)
-		return
+// parseFrontmatter extracts simple "key: value" pairs from YAML frontmatter.
+// Inline lists ("tags: [a, b]"), comma separated values and block lists
+// ("- a" lines) are returned as multiple values for the key.
+func parseFrontmatter(content string) map[string][]string {
+	if !strings.HasPrefix(content, "---\n") && !strings.HasPrefix(content, "---\r\n") {
+		return nil
 	}
 
-	doc := &a.Documents[docIndex]
+	values := make(map[string][]string)
+	lines := strings.Split(content, "\n")
+	key := ""
+	for _, line := range lines[1:] {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "---" {
+			return values
+		}
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
 
-	// Load content on demand if not loaded yet
-	if doc.Content == "" {
-		content, err := ioutil.ReadFile(doc.Path)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to read document: %v", err), http.StatusInternalServerError)
+		// Block list item belonging to the previous key
+		if strings.HasPrefix(trimmed, "- ") && key != "" {
+			values[key] = append(values[key], unquoteYAML(strings.TrimPrefix(trimmed, "- ")))
+			continue
+		}
+
+		idx := strings.Index(line, ":")
+		if idx <= 0 || line[0] == ' ' || line[0] == '\t' {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(line[:idx]))
+		value := strings.TrimSpace(line[idx+1:])
+		if value == "" {
+			continue
+		}
+		if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+			for _, item := range strings.Split(value[1:len(value)-1], ",") {
+				if item = unquoteYAML(item); item != "" {
+					values[key] = append(values[key], item)
+				}
+			}
+			continue
+		}
+		values[key] = append(values[key], unquoteYAML(value))
+	}
+
+	// No closing delimiter found
+	return nil
+}
+
+// unquoteYAML trims whitespace and surrounding quotes from a YAML scalar
+func unquoteYAML(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	return value
+}
+
+// handleDocument handles individual document pages
+func (a *App) handleDocument(w http.ResponseWriter, r *http.Request) {
+	relPath := strings.TrimPrefix(r.URL.Path, "/doc/")
+	doc := a.readableDocument(r, relPath)
+	if doc == nil {
+		if !a.isIndexing() && a.redirectMoved(w, r, relPath) {
 			return
 		}
-		doc.Content = string(content)
+		a.notFound(w, r)
+		return
 	}
+	a.serveDocument(w, r, doc)
+}
 
-	tmpl, err := template.ParseFS(templatesFS, "templates/document.html")
+// serveDocument renders a document page
+func (a *App) serveDocument(w http.ResponseWriter, r *http.Request, doc *Document) {
+	tmpl, err := a.parseTemplates("templates/document.html", "templates/search.html", "templates/shortcuts.html", "templates/tree.html", "templates/preferences.html", "templates/a11y.html")
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		a.serveError(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Remove YAML frontmatter if present
-	content := stripFrontmatter(doc.Content)
-
-	// Render markdown to HTML using Goldmark with GFM support
-	var buf bytes.Buffer
-	if err := markdownRenderer.Convert([]byte(content), &buf); err != nil {
-		http.Error(w, fmt.Sprintf("Failed to render markdown: %v", err), http.StatusInternalServerError)
+	page, err := queryInt(r, "page", 1)
+	if err != nil {
+		a.serveError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	printMode := r.URL.Query().Get("print") == "1"
+
+	// Load content on demand and render it, reusing cached HTML when
+	// unchanged. Large documents are shown a page at a time, except when
+	// printing.
+	var htmlContent []byte
+	var pages []DocumentPage
+	var pageAnchors map[string]int
+	if printMode {
+		htmlContent, err = a.renderDocument(doc)
+	} else {
+		htmlContent, pages, pageAnchors, err = a.renderDocumentPage(doc, page)
+	}
+	if err != nil {
+		a.serveError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	htmlContent := buf.Bytes()
 
-	trees := a.BuildDirectoryTrees()
+	access := a.access(r)
+	trees := access.Trees(a.BuildDirectoryTrees())
+	prefs := a.preferencesView(r, trees)
+	trees = preferredFirst(trees, prefs.DefaultSource)
+	client := a.clientID(w, r)
+	if doc.Version == "" {
+		a.History.Viewed(client, doc.RelPath)
+	}
+	if !printMode {
+		a.Views.Add(doc.RelPath)
+	}
 
 	data := DocumentData{
 		Title:      doc.Title,
@@ -497,46 +935,170 @@ func (a *App) handleDocument(w http.ResponseWriter, r *http.Request) {
 		Content:    template.HTML(htmlContent),
 		Trees:      trees,
 		CurrentDoc: doc.RelPath,
+		PrintMode:  printMode,
+		Editable:   a.Editable && doc.Version == "" && !a.isRemoteDocument(doc), // the editor API only reaches the default version
+		CanOpen:    a.canOpen(r),
+		Favorite:   a.History.IsFavorite(client, doc.RelPath),
+		Backlinks:  a.backlinksOf(access, doc),
+		Math:       a.Config.Math,
+		Annotate:   a.Annotations != nil && doc.Version == "" && !printMode,
+		Table:      isTableFile(doc.Path),
+		Tasks:      doc.Tasks,
+		Words:      doc.Words,
+		Language:   a.documentLanguage(doc),
+		Admin:      a.isAdmin(r),
+		Prefs:      prefs,
+		Page:       page,
+		Pages:      pages,
+	}
+	data.ReadingTime = doc.ReadingTime()
+	if doc.Version == "" && !printMode {
+		data.Stale = a.staleDocument(doc)
+	}
+	data.Description = truncateOverview(doc.Overview, metaDescriptionLength)
+	data.SiteName = a.Config.Title
+	if data.SiteName == "" {
+		data.SiteName = "DimanDocs"
+	}
+	data.URL = requestOrigin(r) + a.Config.BasePath + r.URL.EscapedPath()
+	if slug := a.documentSlug(doc); slug != "" {
+		data.Permalink = "/d/" + slug
+		data.URL = requestOrigin(r) + a.Config.BasePath + data.Permalink
+	}
+	if doc.Version == "" {
+		data.Translations = a.translationsOf(doc)
+	}
+	data.Versions = a.documentVersions(doc)
+	data.Version = doc.Version
+	data.PageAnchors = pageAnchors
+	for i, p := range pages {
+		if p.Current {
+			if i > 0 {
+				data.PrevPage = &pages[i-1]
+			}
+			if i < len(pages)-1 {
+				data.NextPage = &pages[i+1]
+			}
+		}
 	}
 
-	if err := tmpl.Execute(w, data); err != nil {
+	servePage(w, r, tmpl, data)
+}
+
+// metaDescriptionLength is the most characters of the overview used for the
+// description shown when a document link is shared
+const metaDescriptionLength = 200
+
+// servePage renders a page template. Pages are buffered so they can be sent
+// with an ETag and a failed template does not leave a half-written page.
+func servePage(w http.ResponseWriter, r *http.Request, tmpl *template.Template, data interface{}) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
 		http.Error(w, fmt.Sprintf("Failed to execute template: %v", err), http.StatusInternalServerError)
+		return
 	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	serveCached(w, r, "", time.Time{}, buf.Bytes())
+}
+
+// findDocument returns the document with the given relative path, or nil
+func (a *App) findDocument(relPath string) *Document {
+	return lookupDocument(a.Documents, relPath)
+}
+
+// handleRaw serves the original markdown source of a document
+func (a *App) handleRaw(w http.ResponseWriter, r *http.Request) {
+	a.serveSource(w, r, strings.TrimPrefix(r.URL.Path, "/raw/"), false)
+}
+
+// handleDownload serves the original markdown source of a document as an attachment
+func (a *App) handleDownload(w http.ResponseWriter, r *http.Request) {
+	a.serveSource(w, r, strings.TrimPrefix(r.URL.Path, "/download/"), true)
+}
+
+// serveSource writes the markdown file of a document to the response
+func (a *App) serveSource(w http.ResponseWriter, r *http.Request, relPath string, attachment bool) {
+	doc := a.readableDocument(r, relPath)
+	if doc == nil {
+		a.notFound(w, r)
+		return
+	}
+
+	f, err := os.Open(doc.Path)
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to read document: %v", err), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to read document: %v", err), http.StatusInternalServerError)
+		return
+	}
+	content, err := ioutil.ReadAll(f)
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to read document: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	if isTableFile(doc.Path) && attachment {
+		w.Header().Set("Content-Type", tableContentType(doc.Path))
+	}
+	if attachment {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+			"filename": filepath.Base(doc.Path),
+		}))
+	}
+	serveCached(w, r, filepath.Base(doc.Path), info.ModTime(), content)
 }
 
 // handleSearch handles search API requests
 func (a *App) handleSearch(w http.ResponseWriter, r *http.Request) {
-	query := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+	query, err := parseSearchQuery(strings.TrimSpace(r.URL.Query().Get("q")), a.Config.Search)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	if query == "" {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode([]Document{})
+	// Results are paginated with limit/offset, capped by search.max_results
+	maxResults := a.Config.Search.MaxResults
+	if maxResults <= 0 {
+		maxResults = defaultSearchMaxResults
+	}
+	limit, err := queryInt(r, "limit", maxResults)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if limit == 0 || limit > maxResults {
+		limit = maxResults
+	}
+	offset, err := queryInt(r, "offset", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Load all contents if not loaded yet (for search to work)
-	if a.UseCache {
-		for i := range a.Documents {
-			if a.Documents[i].Content == "" {
-				content, err := ioutil.ReadFile(a.Documents[i].Path)
-				if err != nil {
-					log.Printf("Warning: failed to read content for %s: %v", a.Documents[i].Path, err)
-					continue
-				}
-				a.Documents[i].Content = string(content)
-			}
-		}
+	if query.Empty() {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode([]SearchResult{})
+		return
 	}
 
-	var results []Document
-	for _, doc := range a.Documents {
-		// Search in title, content, and overview (case-insensitive)
-		if strings.Contains(strings.ToLower(doc.Title), query) ||
-			strings.Contains(strings.ToLower(doc.Content), query) ||
-			strings.Contains(strings.ToLower(doc.Overview), query) {
-			results = append(results, doc)
-		}
+	results := a.search(a.access(r), query, r.URL.Query().Get("from"))
+
+	// Report the total so clients can page through results
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(results)))
+	if offset > len(results) {
+		offset = len(results)
 	}
+	results = results[offset:]
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	a.linkSections(results, query)
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(results); err != nil {
@@ -544,7 +1106,7 @@ func (a *App) handleSearch(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// handleReload reloads all documents from the filesystem
+// handleReload reloads all documents from the filesystem (admins only)
 func (a *App) handleReload(w http.ResponseWriter, r *http.Request) {
 	// Only allow POST requests
 	if r.Method != http.MethodPost {
@@ -552,55 +1114,47 @@ func (a *App) handleReload(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("Reloading documents from filesystem...")
-
-	// Clear existing documents
-	a.Documents = []Document{}
+	slog.Info("reloading documents from filesystem")
 
-	// Re-scan all configured directories
-	for _, dir := range a.Config.Directories {
-		if err := a.scanDirectory(dir.Path, dir.Name, a.FileRegexes[dir.Path]); err != nil {
-			log.Printf("Error scanning directory %s: %v", dir.Path, err)
-		}
+	// Re-scan all configured directories; the cache is updated if enabled
+	_, err := a.rescan(true)
+	count := a.documentCount()
+	if err != nil {
+		slog.Error("failed to scan directories, keeping the current documents", "documents", count, "error", err)
+		http.Error(w, fmt.Sprintf("Failed to scan directories, the %d documents found before are kept: %v", count, err), http.StatusInternalServerError)
+		return
 	}
 
-	log.Printf("Reload complete: found %d documents", len(a.Documents))
-
-	// Update cache with new document list if caching is enabled
-	if a.UseCache {
-		if err := a.saveToCache(); err != nil {
-			log.Printf("Warning: failed to update cache: %v", err)
-		} else {
-			log.Println("Cache updated with new document list")
-		}
-	}
+	slog.Info("reload complete", "documents", count)
 
 	// Return success response
 	w.Header().Set("Content-Type", "application/json")
 	response := map[string]interface{}{
 		"success": true,
-		"count":   len(a.Documents),
-		"message": fmt.Sprintf("Reloaded %d documents", len(a.Documents)),
+		"count":   count,
+		"message": fmt.Sprintf("Reloaded %d documents", count),
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
-// handleStatic handles static file serving
-func (a *App) handleStatic(w http.ResponseWriter, r *http.Request) {
-	http.ServeFile(w, r, r.URL.Path[1:])
-}
+// listen opens a listener on host, starting at startPort. Unless strict is
+// set, the next free port is used when startPort is busy (up to 100 ports).
+func listen(host string, startPort int, strict bool) (net.Listener, int, error) {
+	if strict {
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(startPort)))
+		if err != nil {
+			return nil, 0, fmt.Errorf("port %d is not available: %w", startPort, err)
+		}
+		return listener, startPort, nil
+	}
 
-// findAvailablePort finds an available port starting from the given port
-func findAvailablePort(startPort int) (int, error) {
 	for port := startPort; port < startPort+100; port++ {
-		addr := fmt.Sprintf(":%d", port)
-		listener, err := net.Listen("tcp", addr)
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 		if err == nil {
-			listener.Close()
-			return port, nil
+			return listener, port, nil
 		}
 	}
-	return 0, fmt.Errorf("no available port found in range %d-%d", startPort, startPort+100)
+	return nil, 0, fmt.Errorf("no available port found in range %d-%d", startPort, startPort+100)
 }
 
 // openBrowser opens the default browser with the given URL
@@ -623,160 +1177,231 @@ func openBrowser(url string) error {
 
 // getFileURL finds the URL path for a specific file
 func (a *App) getFileURL(targetFile string) (string, error) {
-	// Find the document that matches the target file
-	for _, doc := range a.Documents {
+	doc := a.findFile(targetFile)
+	if doc == nil {
+		return "", fmt.Errorf("file not found in documents")
+	}
+	return docURL(doc.RelPath), nil
+}
+
+// findFile returns the document at an absolute path, or nil. Paths are
+// compared first; only documents with the same name are compared as files,
+// which finds a file through another spelling of its path (a mapped drive
+// and its UNC path on Windows) without a stat per document.
+func (a *App) findFile(targetFile string) *Document {
+	var sameName []*Document
+	for i := range a.Documents {
+		doc := &a.Documents[i]
 		absDocPath, err := filepath.Abs(doc.Path)
 		if err != nil {
 			continue
 		}
-		if absDocPath == targetFile {
-			return "/doc/" + doc.RelPath, nil
+		if samePath(absDocPath, targetFile) {
+			return doc
+		}
+		if strings.EqualFold(filepath.Base(absDocPath), filepath.Base(targetFile)) {
+			sameName = append(sameName, doc)
+		}
+	}
+
+	if len(sameName) > 0 {
+		if target, err := os.Stat(targetFile); err == nil {
+			for _, doc := range sameName {
+				if info, err := os.Stat(doc.Path); err == nil && os.SameFile(target, info) {
+					return doc
+				}
+			}
 		}
 	}
-	return "", fmt.Errorf("file not found in documents")
+	return nil
 }
 
-// Start starts the HTTP server
-func (a *App) Start(serveMode bool) error {
-	// Get desired port from config
-	desiredPort := 8090
+// printBanner prints the startup messages shown to the user, unless --quiet
+func (a *App) printBanner(format string, args ...interface{}) {
+	if !a.Quiet {
+		fmt.Printf(format, args...)
+	}
+}
+
+// desiredPort returns the configured port, or 8090
+func (a *App) desiredPort() int {
 	if a.Config.Port != "" {
 		if p, err := strconv.Atoi(a.Config.Port); err == nil {
-			desiredPort = p
+			return p
+		}
+	}
+	return 8090
+}
+
+// Start starts the HTTP server
+func (a *App) Start(serveMode bool) error {
+	// Containers never open a browser or shut down on their own, listen on
+	// all interfaces and must not move to another port than the published one
+	host := a.Config.Host
+	if a.Container {
+		serveMode = true
+		if host == "" {
+			host = "0.0.0.0"
 		}
 	}
 
 	// Find an available port
-	port, err := findAvailablePort(desiredPort)
+	desiredPort := a.desiredPort()
+	listener, port, err := listen(host, desiredPort, a.Config.StrictPort || a.Container)
 	if err != nil {
 		return err
 	}
+	if port != desiredPort {
+		slog.Warn("port is busy, using the next free port (set strict_port to fail instead)", "requested", desiredPort, "port", port)
+	}
+	// Local actions (opening the editor, the admin API without a token) are
+	// only trusted when other machines can't reach the server directly
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok {
+		a.LocalOnly = addr.IP.IsLoopback()
+	}
+
+	a.Instance = InstanceInfo{
+		App:        instanceApp,
+		Version:    Version,
+		PID:        os.Getpid(),
+		Port:       port,
+		WorkingDir: a.WorkingDir,
+		ConfigFile: a.ConfigFile,
+		BasePath:   a.Config.BasePath,
+		Started:    time.Now(),
+	}
 
 	// Initialize client tracker
 	a.Clients = NewClientTracker(serveMode)
+	a.Clients.beforeExit = a.saveState
 
-	a.SetupRoutes()
-
-	// Load document contents in background if using cache
-	if a.UseCache {
-		// Check if we need to load contents
-		needsContentLoading := false
-		for _, doc := range a.Documents {
-			if doc.Content == "" {
-				needsContentLoading = true
-				break
-			}
-		}
-
-		if needsContentLoading {
-			go func() {
-				fmt.Println("Loading document contents in background...")
-				if err := a.loadDocumentContents(); err != nil {
-					log.Printf("Warning: failed to load some document contents: %v", err)
-				}
-				fmt.Printf("Finished loading contents for %d documents\n", len(a.Documents))
-			}()
-		}
+	if interval := a.rescanInterval(); interval > 0 {
+		go a.rescanPeriodically(interval)
+	}
+	if interval := a.remoteRefreshInterval(); interval > 0 {
+		go a.refreshRemoteSources(interval)
 	}
+	go a.Views.saveEvery(viewsSaveInterval)
+	go a.History.saveEvery(historySaveInterval)
 
-	url := fmt.Sprintf("http://localhost:%d", port)
+	a.SetupRoutes()
+
+	url := a.Instance.URL() + "/"
 
 	// If a specific file was requested, find its URL path
 	if a.TargetFile != "" {
 		fileURL, err := a.getFileURL(a.TargetFile)
 		if err != nil {
-			log.Printf("Warning: could not find URL for file %s: %v\n", a.TargetFile, err)
+			slog.Warn("could not find URL for file", "path", a.TargetFile, "error", err)
 		} else {
-			url = fmt.Sprintf("http://localhost:%d%s", port, fileURL)
+			url = a.Instance.URL() + fileURL
 		}
 	}
 
-	fmt.Printf("\n")
-	fmt.Printf("DimanDocs Server Started\n")
-	fmt.Printf("========================\n")
-	fmt.Printf("Found %d documents\n", len(a.Documents))
-	fmt.Printf("Server running at: http://localhost:%d\n", port)
+	if a.PIDFile != "" {
+		if err := a.writeInstanceFile(); err != nil {
+			return err
+		}
+	}
+
+	slog.Debug("server started", "url", a.Instance.URL(), "documents", len(a.Documents), "serve", serveMode)
+
+	a.printBanner("\n")
+	a.printBanner("DimanDocs Server Started\n")
+	a.printBanner("========================\n")
+	if a.isIndexing() {
+		a.printBanner("Scanning documents in the background\n")
+	} else {
+		a.printBanner("Found %d documents\n", len(a.Documents))
+	}
+	a.printBanner("Server running at: %s/\n", a.Instance.URL())
+	if host != "" {
+		a.printBanner("Listening on: %s\n", net.JoinHostPort(host, strconv.Itoa(port)))
+	}
 	if a.TargetFile != "" {
-		fmt.Printf("Opening file: %s\n", a.TargetFile)
+		a.printBanner("Opening file: %s\n", a.TargetFile)
+	}
+	if interval := a.rescanInterval(); interval > 0 {
+		a.printBanner("Re-scanning documents every %s (%s)\n", interval, a.rescanMode())
 	}
-	fmt.Printf("\n")
+	if a.DevDir != "" {
+		a.printBanner("Dev mode: templates and assets are read from %s\n", a.DevDir)
+	}
+	a.printBanner("\n")
 
 	// Open browser unless in serve mode
 	if !serveMode {
-		fmt.Printf("Opening browser...\n")
-		if err := openBrowser(url); err != nil {
-			log.Printf("Could not open browser automatically: %v\n", err)
-			fmt.Printf("Please open your browser manually to: %s\n", url)
+		if a.NoBrowser {
+			a.printBanner("Open your browser to: %s\n", url)
+		} else {
+			a.printBanner("Opening browser...\n")
+			if err := openBrowser(url); err != nil {
+				slog.Warn("could not open browser automatically", "error", err)
+				a.printBanner("Please open your browser manually to: %s\n", url)
+			}
 		}
-		fmt.Printf("Will auto-shutdown after all browser tabs are closed\n")
+		a.printBanner("Will auto-shutdown after all browser tabs are closed\n")
 	} else {
-		fmt.Printf("Running in serve mode (no auto-shutdown)\n")
-		fmt.Printf("Press Ctrl+C to stop the server\n")
+		a.printBanner("Running in serve mode (no auto-shutdown)\n")
+		a.printBanner("Press Ctrl+C to stop the server\n")
 	}
-	fmt.Printf("\n")
+	a.printBanner("\n")
 
-	return http.ListenAndServe(fmt.Sprintf(":%d", port), nil)
+	if a.isIndexing() {
+		go a.scanInBackground()
+	}
+	return http.Serve(listener, logRequests(withBasePath(a.Config.BasePath, a.withAuth(a.withDocumentsLock(a.instrument(http.DefaultServeMux))))))
 }
 
 // loadFromCache loads documents from cache file (without content)
 func (a *App) loadFromCache() error {
-	cacheFile := ".dimandocs-cache.json"
-
-	data, err := ioutil.ReadFile(cacheFile)
+	cache, err := a.readCache()
 	if err != nil {
-		return fmt.Errorf("failed to read cache file: %w", err)
+		return err
 	}
-
-	var cache CacheData
-	if err := json.Unmarshal(data, &cache); err != nil {
-		return fmt.Errorf("failed to parse cache file: %w", err)
+	if cache.Fingerprint != a.cacheFingerprint() {
+		return fmt.Errorf("cache was written with a different configuration or version")
 	}
 
-	// Convert CachedDocuments to Documents (Content will be empty initially)
-	a.Documents = make([]Document, len(cache.Documents))
+	// Convert CachedDocuments to Documents (content is loaded on demand)
+	docs := make([]Document, len(cache.Documents))
 	for i, cached := range cache.Documents {
-		a.Documents[i] = Document{
+		docs[i] = Document{
 			Title:      cached.Title,
 			Path:       cached.Path,
-			Content:    "", // Empty - will be loaded later
 			RelPath:    cached.RelPath,
 			DirName:    cached.DirName,
 			SourceDir:  cached.SourceDir,
 			SourceName: cached.SourceName,
 			AbsPath:    cached.AbsPath,
 			Overview:   cached.Overview,
+			Size:       cached.Size,
+			Tags:       cached.Tags,
+			Tasks:      cached.Tasks,
+			Words:      cached.Words,
+			Language:   cached.Language,
+			Order:      cached.Order,
+			ModTime:    cached.ModTime,
+			Hash:       cached.Hash,
+			Slug:       cached.Slug,
 		}
 	}
+	a.setDocuments(docs)
 
 	return nil
 }
 
-// loadDocumentContents loads the content of all documents from their files
-func (a *App) loadDocumentContents() error {
-	for i := range a.Documents {
-		// Skip if content already loaded
-		if a.Documents[i].Content != "" {
-			continue
-		}
-
-		content, err := ioutil.ReadFile(a.Documents[i].Path)
-		if err != nil {
-			log.Printf("Warning: failed to read content for %s: %v", a.Documents[i].Path, err)
-			continue
-		}
-
-		a.Documents[i].Content = string(content)
-	}
-	return nil
-}
-
 // saveToCache saves documents to cache file (without content)
 func (a *App) saveToCache() error {
-	cacheFile := ".dimandocs-cache.json"
+	return a.writeCache(a.cacheData())
+}
 
+// cacheData returns the documents to cache
+func (a *App) cacheData() CacheData {
 	// Convert Documents to CachedDocuments (exclude Content field)
-	cachedDocs := make([]CachedDocument, len(a.Documents))
-	for i, doc := range a.Documents {
+	docs := a.allDocuments()
+	cachedDocs := make([]CachedDocument, len(docs))
+	for i, doc := range docs {
 		cachedDocs[i] = CachedDocument{
 			Title:      doc.Title,
 			Path:       doc.Path,
@@ -786,22 +1411,21 @@ func (a *App) saveToCache() error {
 			SourceName: doc.SourceName,
 			AbsPath:    doc.AbsPath,
 			Overview:   doc.Overview,
+			Size:       doc.Size,
+			Tags:       doc.Tags,
+			Tasks:      doc.Tasks,
+			Words:      doc.Words,
+			Language:   doc.Language,
+			Order:      doc.Order,
+			ModTime:    doc.ModTime,
+			Hash:       doc.Hash,
+			Slug:       doc.Slug,
 		}
 	}
 
-	cache := CacheData{
-		Documents: cachedDocs,
-		Version:   Version,
-	}
-
-	data, err := json.MarshalIndent(cache, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal cache data: %w", err)
-	}
-
-	if err := ioutil.WriteFile(cacheFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write cache file: %w", err)
+	return CacheData{
+		Documents:   cachedDocs,
+		Version:     Version,
+		Fingerprint: a.cacheFingerprint(),
 	}
-
-	return nil
 }
\ No newline at end of file
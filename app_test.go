@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestApp scans files (relative path -> content) in a temporary
+// directory configured as the "Docs" source, and sets the app up as the
+// server does before handling requests
+func newTestApp(t *testing.T, files map[string]string) *App {
+	t.Helper()
+	root := t.TempDir()
+	docs := filepath.Join(root, "docs")
+	for name, content := range files {
+		path := filepath.Join(docs, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config, err := json.Marshal(map[string]interface{}{
+		"directories": []map[string]string{{"path": docs, "name": "Docs", "file_pattern": `\.md$`}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	configFile := filepath.Join(root, "dimandocs.json")
+	if err := os.WriteFile(configFile, config, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a := NewApp()
+	a.WorkingDir = root
+	if err := a.LoadConfig(configFile, ""); err != nil {
+		t.Fatal(err)
+	}
+	a.Markdown = newMarkdownRenderer(a.Config, a.resolveWikiLink)
+	if err := a.ScanDirectories(); err != nil {
+		t.Fatal(err)
+	}
+	a.Sanitizer = newSanitizer(a.Config)
+	a.Renders = NewRenderCache(a.renderCacheSize(), "")
+	a.History = LoadHistory(filepath.Join(root, historyFileName))
+	a.Views = LoadViews(filepath.Join(root, viewsFileName))
+	a.Moves = LoadMoves(filepath.Join(root, movesFileName))
+	a.Links = a.buildLinkGraph()
+	return a
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+//go:embed assets
+var assetsFS embed.FS
+
+// immutableCacheControl is used for assets requested by their hashed name,
+// whose content can never change
+const immutableCacheControl = "public, max-age=31536000, immutable"
+
+// assetFallbacks are used for assets that are not bundled: KaTeX is loaded
+// from its CDN unless its dist/ folder was copied to assets/katex/ before
+// building
+var assetFallbacks = map[string]string{
+	"katex/": "https://cdn.jsdelivr.net/npm/katex@0.16.11/dist/",
+}
+
+// assetIntegrity are the Subresource Integrity hashes of the assets loaded
+// from a fallback URL, so browsers refuse them if the CDN serves anything
+// else. They must be updated with the version in assetFallbacks.
+var assetIntegrity = map[string]string{
+	"katex/katex.min.css":              "sha384-nB0miv6/jRmo5UMMR1wu3Gz6NLsoTkbqJghGIsx//Rlm+ZU03BU6SQNC66uf4l5+",
+	"katex/katex.min.js":               "sha384-7zkQWkzuo3B5mTepMUcHkMB5jZaolc2xDwL6VFqjFALcbeS9Ggm/Yr2r3Dy4lfFg",
+	"katex/contrib/auto-render.min.js": "sha384-43gviWU0YVjaDtb/GhzOouOXtZMP/7XUzwPTstBeZFe/+rCMvRwr4yROQP43s0Xk",
+}
+
+// assetBundle holds the assets embedded from assets/. Each asset is served
+// under its name with a content hash ("search.3f2a9c1be0.js"), which pages
+// link to so browsers can cache it forever, and under its plain name, which
+// relative URLs inside assets (e.g. fonts in a stylesheet) use.
+type assetBundle struct {
+	files  map[string][]byte // name -> content
+	hashed map[string]string // name -> hashed name
+	names  map[string]string // hashed name -> name
+	etags  map[string]string // name -> ETag
+}
+
+// bundledAssets are the embedded assets, hashed once at startup
+var bundledAssets = loadAssetBundle(assetsFS)
+
+// loadAssetBundle reads and hashes every file under assets/
+func loadAssetBundle(fsys fs.FS) *assetBundle {
+	b := &assetBundle{
+		files:  make(map[string][]byte),
+		hashed: make(map[string]string),
+		names:  make(map[string]string),
+		etags:  make(map[string]string),
+	}
+	fs.WalkDir(fsys, "assets", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(p, "assets/")
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + contentHash(string(data))[:10] + ext
+		b.files[name] = data
+		b.hashed[name] = hashed
+		b.names[hashed] = name
+		b.etags[name] = etagFor(data)
+		return nil
+	})
+	return b
+}
+
+// URL returns the path of an asset by its hashed name, without the base
+// path. Assets that are not bundled use their fallback URL if they have one.
+func (b *assetBundle) URL(name string) string {
+	if hashed, ok := b.hashed[name]; ok {
+		return "/assets/" + hashed
+	}
+	for prefix, fallback := range assetFallbacks {
+		if strings.HasPrefix(name, prefix) {
+			return fallback + strings.TrimPrefix(name, prefix)
+		}
+	}
+	return "/assets/" + name
+}
+
+// Integrity returns the integrity and crossorigin attributes of an asset
+// loaded from its fallback URL, and nothing for a bundled asset
+func (b *assetBundle) Integrity(name string) template.HTMLAttr {
+	if _, ok := b.hashed[name]; ok {
+		return ""
+	}
+	hash, ok := assetIntegrity[name]
+	if !ok {
+		return ""
+	}
+	return template.HTMLAttr(`integrity="` + hash + `" crossorigin="anonymous"`)
+}
+
+// ServeHTTP serves /assets/ by hashed or plain name, with an ETag
+func (b *assetBundle) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requested := strings.TrimPrefix(r.URL.Path, "/assets/")
+	cacheControl := staticCacheControl
+	name, ok := b.names[requested]
+	if ok {
+		cacheControl = immutableCacheControl
+	} else {
+		name = requested
+	}
+	data, ok := b.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("ETag", b.etags[name])
+	w.Header().Set("Cache-Control", cacheControl)
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(data))
+}
@@ -0,0 +1,175 @@
+// Comments on documents (annotations option). Comments on a heading are
+// shown under it; comments on lines of the source, and on headings that are
+// not on this page, are listed in the Comments section below the document.
+(function() {
+    var panel = document.getElementById('annotations');
+    if (!panel) return;
+
+    var path = panel.getAttribute('data-path');
+    var api = basePath + '/api/annotations';
+    var content = document.getElementById('document-content');
+    var list = document.getElementById('annotation-list');
+    var count = document.getElementById('annotation-count');
+    var form = document.getElementById('annotation-form');
+    var anchor = document.getElementById('annotation-anchor');
+    var lines = document.getElementById('annotation-lines');
+    var lineStart = document.getElementById('annotation-line-start');
+    var lineEnd = document.getElementById('annotation-line-end');
+    var author = document.getElementById('annotation-author');
+    var text = document.getElementById('annotation-text');
+    var status = document.getElementById('annotation-status');
+    var authorKey = 'dimandocs-annotation-author';
+
+    var headings = {};
+    content.querySelectorAll('h1[id], h2[id], h3[id], h4[id]').forEach(function(heading) {
+        headings[heading.id] = heading;
+        var option = document.createElement('option');
+        option.value = heading.id;
+        option.textContent = heading.textContent.trim();
+        anchor.insertBefore(option, anchor.lastElementChild);
+
+        var badge = document.createElement('button');
+        badge.type = 'button';
+        badge.className = 'annotation-badge';
+        badge.title = 'Comment on this section';
+        badge.addEventListener('click', function() {
+            anchor.value = heading.id;
+            anchor.dispatchEvent(new Event('change'));
+            form.scrollIntoView({ behavior: 'smooth', block: 'center' });
+            text.focus({ preventScroll: true });
+        });
+        heading.appendChild(badge);
+    });
+    if (anchor.options.length > 1) anchor.selectedIndex = 0;
+    lines.classList.toggle('hidden', anchor.value !== '');
+    author.value = localStorage.getItem(authorKey) || '';
+
+    anchor.addEventListener('change', function() {
+        lines.classList.toggle('hidden', anchor.value !== '');
+    });
+
+    function formatDate(value) {
+        var date = new Date(value);
+        return date.toLocaleDateString() + ' ' + date.toLocaleTimeString([], { hour: '2-digit', minute: '2-digit' });
+    }
+
+    function element(tag, className, textContent) {
+        var el = document.createElement(tag);
+        if (className) el.className = className;
+        if (textContent) el.textContent = textContent;
+        return el;
+    }
+
+    // Comment shows one annotation; where says what it is anchored to when
+    // it is not shown under its heading
+    function comment(annotation, where) {
+        var item = element('div', 'annotation');
+        var meta = element('div', 'annotation-meta');
+        meta.appendChild(element('strong', '', annotation.author));
+        meta.appendChild(element('span', 'annotation-date', formatDate(annotation.created)));
+        if (where) {
+            if (annotation.line_start) {
+                meta.appendChild(element('span', 'annotation-where', annotation.line_start === annotation.line_end
+                    ? 'line ' + annotation.line_start
+                    : 'lines ' + annotation.line_start + '-' + annotation.line_end));
+            } else {
+                meta.appendChild(element('span', 'annotation-where', '§ ' + (annotation.heading || annotation.anchor)));
+            }
+        }
+        if (annotation.mine) {
+            var remove = element('button', 'annotation-delete', 'Delete');
+            remove.type = 'button';
+            remove.addEventListener('click', function() { deleteAnnotation(annotation); });
+            meta.appendChild(remove);
+        }
+        item.appendChild(meta);
+        if (where && annotation.excerpt !== undefined && annotation.line_start) {
+            item.appendChild(element('pre', 'annotation-excerpt', annotation.excerpt));
+        }
+        item.appendChild(element('div', 'annotation-text', annotation.text));
+        return item;
+    }
+
+    function render(annotations) {
+        content.querySelectorAll('.annotation-thread').forEach(function(thread) { thread.remove(); });
+        list.innerHTML = '';
+        var threads = {};
+        var counts = {};
+        annotations.forEach(function(annotation) {
+            var heading = annotation.anchor && headings[annotation.anchor];
+            if (!heading) {
+                list.appendChild(comment(annotation, true));
+                return;
+            }
+            if (!threads[annotation.anchor]) {
+                threads[annotation.anchor] = element('div', 'annotation-thread');
+                heading.insertAdjacentElement('afterend', threads[annotation.anchor]);
+            }
+            threads[annotation.anchor].appendChild(comment(annotation, false));
+            counts[annotation.anchor] = (counts[annotation.anchor] || 0) + 1;
+        });
+        Object.keys(headings).forEach(function(id) {
+            var badge = headings[id].querySelector('.annotation-badge');
+            badge.textContent = counts[id] ? '💬 ' + counts[id] : '💬';
+            badge.classList.toggle('has-comments', !!counts[id]);
+        });
+        count.textContent = annotations.length ? '(' + annotations.length + ')' : '';
+        if (!list.children.length) {
+            list.appendChild(element('p', 'annotation-empty', annotations.length
+                ? 'Comments on sections are shown under their heading.'
+                : 'No comments yet.'));
+        }
+    }
+
+    async function load() {
+        try {
+            var response = await fetch(api + '?path=' + encodeURIComponent(path));
+            if (!response.ok) throw new Error(await response.text());
+            render((await response.json()).annotations);
+        } catch (error) {
+            console.error('Loading comments failed:', error);
+        }
+    }
+
+    async function deleteAnnotation(annotation) {
+        if (!confirm('Delete this comment?')) return;
+        try {
+            var response = await fetch(api + '?path=' + encodeURIComponent(path) + '&id=' + encodeURIComponent(annotation.id), { method: 'DELETE' });
+            if (!response.ok) throw new Error(await response.text());
+        } catch (error) {
+            alert('Could not delete comment: ' + error.message);
+        }
+        load();
+    }
+
+    form.addEventListener('submit', async function(e) {
+        e.preventDefault();
+        var body = { path: path, author: author.value, text: text.value };
+        if (anchor.value) {
+            body.anchor = anchor.value;
+            body.heading = anchor.options[anchor.selectedIndex].textContent;
+        } else {
+            body.line_start = parseInt(lineStart.value, 10) || 0;
+            body.line_end = parseInt(lineEnd.value, 10) || body.line_start;
+        }
+        localStorage.setItem(authorKey, author.value);
+        status.textContent = 'Saving...';
+        status.classList.remove('error');
+        try {
+            var response = await fetch(api, {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(body)
+            });
+            if (!response.ok) throw new Error(await response.text());
+            text.value = '';
+            status.textContent = '';
+            load();
+        } catch (error) {
+            status.textContent = 'Not saved: ' + error.message;
+            status.classList.add('error');
+        }
+    });
+
+    load();
+})();
@@ -0,0 +1,145 @@
+// Search terms in documents opened with ?q=: the occurrences of the query's
+// terms in the document are highlighted, and a bar at the bottom of the page
+// counts them and goes through them (n and Shift+N, or the arrow keys while
+// it has focus). Closing the bar removes the highlights and the query from
+// the address.
+(function() {
+    var content = document.getElementById('document-content');
+    var query = new URLSearchParams(window.location.search).get('q');
+    if (!content || !query) return;
+
+    // The terms of the query as the search parses them; negated terms and
+    // the title:, path: and tag: qualifiers don't match the text
+    function terms(query) {
+        var tokens = query.match(/(?:[^\s"]+|"[^"]*")+/g) || [];
+        var regex = false;
+        var values = [];
+        tokens.forEach(function(token) {
+            if (/^regex:(1|true)$/i.test(token)) { regex = true; return; }
+            if (token.length > 1 && token.charAt(0) === '-') return;
+            if (/^(title|path|tag):/i.test(token)) return;
+            var value = token.replace(/^"+|"+$/g, '');
+            if (value) values.push(value);
+        });
+        return values.map(function(value) {
+            return regex ? value : value.replace(/[.*+?^${}()|[\]\\]/g, '\\$&');
+        }).filter(function(source) {
+            try { new RegExp(source); return true; } catch (e) { return false; }
+        });
+    }
+
+    var sources = terms(query);
+    if (!sources.length) return;
+    var pattern = new RegExp(sources.join('|'), 'gi');
+
+    // Text nodes are collected before any is split
+    var walker = document.createTreeWalker(content, NodeFilter.SHOW_TEXT, {
+        acceptNode: function(node) {
+            var parent = node.parentNode;
+            if (parent.closest('script, style, .heading-anchor, .katex')) return NodeFilter.FILTER_REJECT;
+            return node.nodeValue.trim() ? NodeFilter.FILTER_ACCEPT : NodeFilter.FILTER_REJECT;
+        }
+    });
+    var nodes = [];
+    while (walker.nextNode()) nodes.push(walker.currentNode);
+
+    var marks = [];
+    nodes.forEach(function(node) {
+        var text = node.nodeValue;
+        var fragment = document.createDocumentFragment();
+        var last = 0;
+        var match;
+        pattern.lastIndex = 0;
+        while ((match = pattern.exec(text)) !== null) {
+            if (match[0] === '') { pattern.lastIndex++; continue; }
+            fragment.appendChild(document.createTextNode(text.slice(last, match.index)));
+            var mark = document.createElement('mark');
+            mark.className = 'search-match';
+            mark.textContent = match[0];
+            fragment.appendChild(mark);
+            marks.push(mark);
+            last = match.index + match[0].length;
+        }
+        if (last === 0) return;
+        fragment.appendChild(document.createTextNode(text.slice(last)));
+        node.parentNode.replaceChild(fragment, node);
+    });
+
+    var bar = document.createElement('div');
+    bar.className = 'match-bar';
+    bar.setAttribute('role', 'search');
+    bar.innerHTML = '<span class="match-query"></span> <span class="match-count" aria-live="polite"></span>' +
+        '<button type="button" class="match-prev" title="Previous match (Shift+N)" aria-label="Previous match">&uarr;</button>' +
+        '<button type="button" class="match-next" title="Next match (n)" aria-label="Next match">&darr;</button>' +
+        '<button type="button" class="match-close" title="Clear highlights (Escape)" aria-label="Clear highlights">&times;</button>';
+    bar.querySelector('.match-query').textContent = '“' + query + '”';
+    document.body.appendChild(bar);
+
+    var count = bar.querySelector('.match-count');
+    var current = -1;
+
+    function go(index) {
+        if (!marks.length) return;
+        if (current >= 0) marks[current].classList.remove('current');
+        current = (index + marks.length) % marks.length;
+        var mark = marks[current];
+        mark.classList.add('current');
+        // Collapsed sections holding the match are opened
+        for (var details = mark.closest('details'); details; details = details.parentNode.closest('details')) {
+            details.open = true;
+        }
+        mark.scrollIntoView({ behavior: 'smooth', block: 'center' });
+        count.textContent = (current + 1) + ' of ' + marks.length;
+    }
+
+    function close() {
+        marks.forEach(function(mark) {
+            var parent = mark.parentNode;
+            parent.replaceChild(document.createTextNode(mark.textContent), mark);
+            parent.normalize();
+        });
+        marks = [];
+        bar.remove();
+        document.removeEventListener('keydown', onKey);
+        var params = new URLSearchParams(window.location.search);
+        params.delete('q');
+        var search = params.toString();
+        history.replaceState(history.state, '', window.location.pathname + (search ? '?' + search : '') + window.location.hash);
+    }
+
+    function isTyping(el) {
+        return el && (el.tagName === 'INPUT' || el.tagName === 'TEXTAREA' || el.tagName === 'SELECT' || el.isContentEditable);
+    }
+
+    function onKey(e) {
+        if (e.ctrlKey || e.metaKey || e.altKey || isTyping(e.target)) return;
+        var inBar = bar.contains(e.target);
+        if (e.key === 'n' || e.key === 'N') {
+            go(current + (e.key === 'N' ? -1 : 1));
+        } else if (inBar && (e.key === 'ArrowDown' || e.key === 'ArrowUp')) {
+            go(current + (e.key === 'ArrowUp' ? -1 : 1));
+        } else if (inBar && e.key === 'Escape') {
+            close();
+        } else {
+            return;
+        }
+        e.preventDefault();
+    }
+
+    bar.querySelector('.match-prev').addEventListener('click', function() { go(current - 1); });
+    bar.querySelector('.match-next').addEventListener('click', function() { go(current + 1); });
+    bar.querySelector('.match-close').addEventListener('click', close);
+    document.addEventListener('keydown', onKey);
+
+    if (!marks.length) {
+        count.textContent = 'No matches on this page';
+        bar.querySelector('.match-prev').disabled = true;
+        bar.querySelector('.match-next').disabled = true;
+        return;
+    }
+    count.textContent = marks.length + (marks.length === 1 ? ' match' : ' matches');
+    // A link to a section lands on the section; otherwise on the first match
+    if (!window.location.hash) {
+        setTimeout(function() { go(0); }, 100);
+    }
+})();
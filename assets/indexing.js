@@ -0,0 +1,33 @@
+// Shows the progress of the first scan of the directories, which runs in
+// the background when the server starts, and reloads the page once the
+// documents can be browsed
+(function() {
+    var banner = document.getElementById('indexing-banner');
+    if (!banner) return;
+    var text = banner.querySelector('.indexing-text');
+
+    async function poll() {
+        try {
+            var response = await fetch(basePath + '/api/scan/status', { cache: 'no-store' });
+            if (!response.ok) throw new Error(await response.text());
+            var status = await response.json();
+            if (status.state === 'ready') {
+                window.location.reload();
+                return;
+            }
+            if (status.state === 'failed') {
+                text.textContent = 'Indexing failed: ' + status.error;
+                banner.classList.add('failed');
+                return;
+            }
+            text.textContent = status.matched
+                ? 'Indexing ' + status.processed + ' of ' + status.matched + ' files...'
+                : 'Indexing documents...';
+        } catch (error) {
+            console.error('Reading the scan status failed:', error);
+        }
+        setTimeout(poll, 1000);
+    }
+
+    poll();
+})();
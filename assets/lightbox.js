@@ -0,0 +1,98 @@
+// Lightbox for the images of a document: clicking one shows it over the
+// page with its caption (the figure caption or alt text). Clicking the
+// image toggles between fitting the window and its full size, the arrow
+// keys go to the previous/next image, and Escape or clicking outside
+// closes it. Images inside links keep opening the link.
+(function() {
+    var content = document.getElementById('document-content');
+    if (!content) return;
+
+    var images = Array.prototype.filter.call(content.querySelectorAll('img'), function(img) {
+        return !img.closest('a');
+    });
+    if (!images.length) return;
+
+    var overlay = document.createElement('div');
+    overlay.className = 'lightbox hidden';
+    overlay.setAttribute('role', 'dialog');
+    overlay.setAttribute('aria-modal', 'true');
+    overlay.innerHTML = '<button type="button" class="lightbox-close" aria-label="Close">&times;</button>' +
+        '<div class="lightbox-stage"><img class="lightbox-image" alt=""></div>' +
+        '<div class="lightbox-caption"></div>';
+    document.body.appendChild(overlay);
+
+    var stage = overlay.querySelector('.lightbox-stage');
+    var shown = overlay.querySelector('.lightbox-image');
+    var caption = overlay.querySelector('.lightbox-caption');
+    var current = -1;
+    var opener = null;
+
+    function captionOf(img) {
+        var figure = img.closest('figure');
+        var figcaption = figure && figure.querySelector('figcaption');
+        return figcaption ? figcaption.textContent : (img.getAttribute('alt') || '');
+    }
+
+    function show(index) {
+        current = (index + images.length) % images.length;
+        var img = images[current];
+        shown.src = img.currentSrc || img.src;
+        shown.alt = img.alt;
+        caption.textContent = captionOf(img);
+        caption.style.display = caption.textContent ? '' : 'none';
+        overlay.classList.remove('zoomed');
+    }
+
+    function open(index) {
+        opener = document.activeElement;
+        show(index);
+        overlay.classList.remove('hidden');
+        document.body.classList.add('lightbox-open');
+        overlay.querySelector('.lightbox-close').focus();
+    }
+
+    function close() {
+        overlay.classList.add('hidden');
+        document.body.classList.remove('lightbox-open');
+        shown.removeAttribute('src');
+        if (opener && opener.focus) opener.focus();
+    }
+
+    images.forEach(function(img, index) {
+        img.classList.add('lightbox-target');
+        img.addEventListener('click', function() {
+            open(index);
+        });
+    });
+
+    shown.addEventListener('click', function(e) {
+        e.stopPropagation();
+        overlay.classList.toggle('zoomed');
+    });
+    overlay.addEventListener('click', function(e) {
+        if (e.target === overlay || e.target === stage || e.target.classList.contains('lightbox-close')) {
+            close();
+        }
+    });
+
+    // Captured before the keyboard shortcuts, which must not act on the
+    // page behind the lightbox
+    document.addEventListener('keydown', function(e) {
+        if (overlay.classList.contains('hidden')) return;
+        e.stopPropagation();
+        switch (e.key) {
+        case 'Escape':
+            close();
+            break;
+        case 'ArrowLeft':
+            show(current - 1);
+            break;
+        case 'ArrowRight':
+            show(current + 1);
+            break;
+        default:
+            return;
+        }
+        e.preventDefault();
+    }, true);
+})();
@@ -0,0 +1,11 @@
+// Install the service worker, which lives next to the web manifest so its
+// scope covers every page (including behind a base_path)
+if ('serviceWorker' in navigator) {
+    window.addEventListener('load', function() {
+        var manifest = document.querySelector('link[rel="manifest"]');
+        if (!manifest) return;
+        navigator.serviceWorker.register(new URL('sw.js', manifest.href).href).catch(function(error) {
+            console.error('Service worker registration failed:', error);
+        });
+    });
+}
@@ -0,0 +1,48 @@
+// Reload button: starts a re-scan of all directories (POST /api/rescan),
+// shows its progress on the button and reloads the page once it is done
+(function() {
+    var button = document.getElementById('reload-btn');
+    if (!button) return;
+
+    function reset() {
+        button.disabled = false;
+        button.textContent = 'Reload';
+    }
+
+    function progress(job) {
+        button.textContent = job.matched
+            ? 'Scanning ' + job.processed + ' of ' + job.matched + '...'
+            : 'Scanning...';
+    }
+
+    async function poll(url) {
+        while (true) {
+            await new Promise(function(resolve) { setTimeout(resolve, 500); });
+            var response = await fetch(url);
+            if (!response.ok) throw new Error(await response.text());
+            var job = await response.json();
+            if (job.state !== 'running') return job;
+            progress(job);
+        }
+    }
+
+    button.addEventListener('click', async function() {
+        button.disabled = true;
+        button.textContent = 'Scanning...';
+        try {
+            var response = await fetch(basePath + '/api/rescan', { method: 'POST' });
+            if (!response.ok) throw new Error(await response.text());
+            var job = await response.json();
+            if (job.state === 'running') {
+                progress(job);
+                job = await poll(basePath + '/api/rescan/' + encodeURIComponent(job.id));
+            }
+            if (job.state === 'failed') throw new Error(job.error);
+            window.location.reload();
+        } catch (error) {
+            console.error('Re-scan failed:', error);
+            alert('Error reloading documents: ' + error.message);
+            reset();
+        }
+    });
+})();
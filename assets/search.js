@@ -0,0 +1,209 @@
+// Search-as-you-type: debounced requests to /api/search with keyboard navigation
+function DimanSearch(input, list, info) {
+    var timeout = null;
+    var selected = -1;
+    var lastQuery = null;
+
+    function items() {
+        return list.querySelectorAll('.search-result');
+    }
+
+    function select(index) {
+        var links = items();
+        if (links.length === 0) { selected = -1; return; }
+        if (index < 0) index = 0;
+        if (index >= links.length) index = links.length - 1;
+        if (selected >= 0 && links[selected]) {
+            links[selected].classList.remove('selected');
+            links[selected].setAttribute('aria-selected', 'false');
+        }
+        selected = index;
+        links[selected].classList.add('selected');
+        links[selected].setAttribute('aria-selected', 'true');
+        links[selected].scrollIntoView({ block: 'nearest' });
+        input.setAttribute('aria-activedescendant', links[selected].id);
+    }
+
+    function setInfo(text) {
+        if (!info) return;
+        info.textContent = text;
+        info.classList.toggle('hidden', text === '');
+    }
+
+    function render(results) {
+        list.innerHTML = '';
+        selected = -1;
+        input.removeAttribute('aria-activedescendant');
+        results.forEach(function(doc, i) {
+            var li = document.createElement('li');
+            li.setAttribute('role', 'presentation');
+            var a = document.createElement('a');
+            a.className = 'search-result';
+            // Results are options of the search box's listbox, reached with
+            // the arrow keys rather than Tab
+            a.id = list.id + '-' + i;
+            a.setAttribute('role', 'option');
+            a.setAttribute('aria-selected', 'false');
+            a.tabIndex = -1;
+            a.href = basePath + doc.url
+                + '?' + (doc.page ? 'page=' + doc.page + '&' : '')
+                + 'q=' + encodeURIComponent(lastQuery)
+                + (doc.anchor ? '#' + encodeURIComponent(doc.anchor) : '');
+
+            var title = document.createElement('span');
+            title.className = 'search-result-title';
+            title.textContent = doc.title;
+            if (doc.section) {
+                var section = document.createElement('span');
+                section.className = 'search-result-section';
+                section.textContent = ' › ' + doc.section;
+                title.appendChild(section);
+            }
+            a.appendChild(title);
+
+            var path = document.createElement('span');
+            path.className = 'search-result-path';
+            path.textContent = doc.path;
+            a.appendChild(path);
+
+            if (doc.snippet) {
+                var snippet = document.createElement('span');
+                snippet.className = 'search-result-snippet';
+                snippet.textContent = doc.snippet;
+                a.appendChild(snippet);
+            }
+
+            li.appendChild(a);
+            list.appendChild(li);
+        });
+        list.classList.toggle('hidden', results.length === 0);
+        input.setAttribute('aria-expanded', results.length > 0);
+        if (results.length > 0) select(0);
+    }
+
+    async function search(query) {
+        if (query === lastQuery) return;
+        lastQuery = query;
+        if (!query) {
+            render([]);
+            setInfo('');
+            return;
+        }
+        try {
+            // Results near the document being viewed rank higher
+            var sidebar = document.getElementById('tree-sidebar');
+            var from = sidebar ? sidebar.getAttribute('data-current-doc') : '';
+            var response = await fetch(basePath + '/api/search?q=' + encodeURIComponent(query)
+                + (from ? '&from=' + encodeURIComponent(from) : ''));
+            var results = (await response.json()) || [];
+            if (query !== lastQuery) return; // a newer query is in flight
+            var total = parseInt(response.headers.get('X-Total-Count'), 10) || results.length;
+            render(results);
+            setInfo(total === 0 ? 'No documents found'
+                : 'Found ' + total + ' match' + (total !== 1 ? 'es' : '')
+                  + (total > results.length ? ' (showing ' + results.length + ')' : ''));
+        } catch (error) {
+            console.error('Search failed:', error);
+            setInfo('Search failed. Please try again.');
+        }
+    }
+
+    input.addEventListener('input', function() {
+        clearTimeout(timeout);
+        var query = input.value.trim();
+        timeout = setTimeout(function() { search(query); }, 200);
+    });
+
+    // Remember the query when one of its results is opened
+    function record() {
+        if (lastQuery && navigator.sendBeacon) {
+            navigator.sendBeacon(basePath + '/api/searches', JSON.stringify({ query: lastQuery }));
+        }
+    }
+    list.addEventListener('click', function(e) {
+        if (e.target.closest('.search-result')) record();
+    });
+
+    input.addEventListener('keydown', function(e) {
+        if (e.key === 'ArrowDown') {
+            e.preventDefault();
+            select(selected + 1);
+        } else if (e.key === 'ArrowUp') {
+            e.preventDefault();
+            select(selected - 1);
+        } else if (e.key === 'Enter') {
+            var links = items();
+            if (selected >= 0 && links[selected]) {
+                e.preventDefault();
+                record();
+                window.location.href = links[selected].href;
+            }
+        }
+    });
+
+    return {
+        reset: function() {
+            input.value = '';
+            lastQuery = null;
+            render([]);
+            setInfo('');
+        }
+    };
+}
+
+// Global Ctrl+K / Cmd+K shortcut. Pages with an inline search box focus it,
+// other pages open the search overlay. While the overlay is open, focus
+// stays in its search box; closing it returns focus to where it was.
+var openSearch = (function() {
+    var overlay = document.getElementById('search-overlay');
+    var inline = document.getElementById('search-input');
+    var overlaySearch = null;
+    var opener = null;
+
+    function openOverlay() {
+        if (overlay.classList.contains('hidden')) opener = document.activeElement;
+        overlay.classList.remove('hidden');
+        document.getElementById('search-overlay-input').focus();
+    }
+
+    function closeOverlay() {
+        overlay.classList.add('hidden');
+        overlaySearch.reset();
+        if (opener && opener.focus) opener.focus();
+        opener = null;
+    }
+
+    if (overlay) {
+        overlaySearch = DimanSearch(
+            document.getElementById('search-overlay-input'),
+            document.getElementById('search-overlay-results'),
+            null
+        );
+        overlay.addEventListener('click', function(e) {
+            if (e.target === overlay) closeOverlay();
+        });
+    }
+
+    document.addEventListener('keydown', function(e) {
+        if ((e.ctrlKey || e.metaKey) && e.key.toLowerCase() === 'k') {
+            e.preventDefault();
+            open();
+        } else if (e.key === 'Escape' && overlay && !overlay.classList.contains('hidden')) {
+            closeOverlay();
+        } else if (e.key === 'Tab' && overlay && !overlay.classList.contains('hidden')) {
+            e.preventDefault();
+            document.getElementById('search-overlay-input').focus();
+        }
+    });
+
+    function open() {
+        if (inline) {
+            inline.focus();
+            inline.select();
+        } else if (overlay) {
+            openOverlay();
+        }
+    }
+    return open;
+})();
+
@@ -0,0 +1,110 @@
+// Single-key shortcuts, ignored while typing. Items are the tree entries
+// rendered by the page; the current document comes from data-current-doc.
+(function() {
+    var overlay = document.getElementById('shortcuts-overlay');
+    var sidebar = document.getElementById('tree-sidebar');
+    var selected = null;
+
+    function isTyping(target) {
+        return target.isContentEditable || /^(INPUT|TEXTAREA|SELECT)$/.test(target.tagName);
+    }
+
+    // Tree entries that are currently shown, in page order
+    function visibleItems() {
+        var items = document.querySelectorAll('.tree-item, .sidebar-tree-item');
+        return Array.prototype.filter.call(items, function(item) {
+            return item.offsetParent !== null;
+        });
+    }
+
+    function move(step) {
+        var items = visibleItems();
+        if (items.length === 0) return;
+        var index = items.indexOf(selected);
+        if (index < 0) {
+            index = items.indexOf(document.querySelector('.sidebar-tree-item.current'));
+            index = index < 0 ? (step > 0 ? 0 : items.length - 1) : index + step;
+        } else {
+            index += step;
+        }
+        index = Math.max(0, Math.min(items.length - 1, index));
+        if (selected) selected.classList.remove('kbd-selected');
+        selected = items[index];
+        selected.classList.add('kbd-selected');
+        selected.scrollIntoView({ block: 'nearest' });
+    }
+
+    // Neighbouring document of the current one in tree order
+    function adjacentDocument(step) {
+        var current = sidebar && sidebar.getAttribute('data-current-doc');
+        if (!current) return null;
+        var files = Array.prototype.slice.call(sidebar.querySelectorAll('.sidebar-tree-item.file'));
+        for (var i = 0; i < files.length; i++) {
+            if (files[i].getAttribute('data-path') === current) {
+                return files[i + step] || null;
+            }
+        }
+        return null;
+    }
+
+    function toggleTree() {
+        if (!sidebar) return;
+        if (sidebar.classList.contains('collapsed')) {
+            expandTree();
+        } else {
+            collapseTree();
+        }
+    }
+
+    function toggleHelp(show) {
+        overlay.classList.toggle('hidden', !show);
+    }
+
+    overlay.addEventListener('click', function(e) {
+        if (e.target === overlay) toggleHelp(false);
+    });
+
+    document.addEventListener('keydown', function(e) {
+        if (e.key === 'Escape') {
+            if (!overlay.classList.contains('hidden')) {
+                toggleHelp(false);
+            } else if (e.target.id === 'search-input') {
+                e.target.blur();
+            }
+            return;
+        }
+        if (e.ctrlKey || e.metaKey || e.altKey || isTyping(e.target)) return;
+
+        switch (e.key) {
+        case 'j':
+            move(1);
+            break;
+        case 'k':
+            move(-1);
+            break;
+        case 'Enter':
+            if (!selected) return;
+            selected.click();
+            break;
+        case '/':
+            openSearch();
+            break;
+        case 't':
+            toggleTree();
+            break;
+        case '[':
+        case ']':
+            var doc = adjacentDocument(e.key === ']' ? 1 : -1);
+            if (!doc) return;
+            window.location.href = doc.href;
+            break;
+        case '?':
+            toggleHelp(overlay.classList.contains('hidden'));
+            break;
+        default:
+            return;
+        }
+        e.preventDefault();
+    });
+})();
+
@@ -0,0 +1,92 @@
+// Service worker keeping visited pages readable offline. Pages are fetched
+// from the network first and the last copy is used when the server can't
+// be reached; assets with a hashed name never change and come from the
+// cache first. The API, the event stream and downloads are left alone.
+var CACHE = 'dimandocs-pages-v2';
+var MAX_ENTRIES = 300;
+var scope = new URL(self.registration.scope).pathname; // base path + '/'
+
+self.addEventListener('install', function() {
+    self.skipWaiting();
+});
+
+self.addEventListener('activate', function(event) {
+    // Drop the caches of older versions, which may hold downloads
+    event.waitUntil(caches.keys().then(function(names) {
+        return Promise.all(names.filter(function(name) {
+            return name.indexOf('dimandocs-pages-') === 0 && name !== CACHE;
+        }).map(function(name) {
+            return caches.delete(name);
+        }));
+    }).then(function() {
+        return self.clients.claim();
+    }));
+});
+
+// Path of url below the base path, or null if it is not served offline
+function sitePath(url) {
+    if (url.origin !== self.location.origin || url.pathname.indexOf(scope) !== 0) return null;
+    var path = url.pathname.slice(scope.length - 1);
+    if (/^\/(api|events|debug|export|download)(\/|$)/.test(path) || path === '/sw.js') return null;
+    if (/^\/combined(\/|$)/.test(path) && url.searchParams.has('format')) return null;
+    return path;
+}
+
+// Keep the cache from growing without bound, dropping the oldest entries
+function trim(cache) {
+    return cache.keys().then(function(keys) {
+        return Promise.all(keys.slice(0, Math.max(0, keys.length - MAX_ENTRIES)).map(function(key) {
+            return cache.delete(key);
+        }));
+    });
+}
+
+function store(request, response) {
+    // Downloads can be large and are not pages to read offline
+    if (!response.ok || /^\s*attachment/i.test(response.headers.get('Content-Disposition') || '')) return;
+    var copy = response.clone();
+    caches.open(CACHE).then(function(cache) {
+        return cache.delete(request).then(function() {
+            return cache.put(request, copy);
+        }).then(function() {
+            return trim(cache);
+        });
+    });
+}
+
+function offline() {
+    return new Response('<!DOCTYPE html><title>Offline</title><body style="font-family: sans-serif; padding: 40px">' +
+        '<h1>Offline</h1><p>This page was not visited while the documentation server was reachable.</p></body>',
+        { status: 503, headers: { 'Content-Type': 'text/html; charset=utf-8' } });
+}
+
+function networkFirst(request) {
+    return fetch(request).then(function(response) {
+        store(request, response);
+        return response;
+    }).catch(function() {
+        return caches.match(request).then(function(cached) {
+            return cached || offline();
+        });
+    });
+}
+
+function cacheFirst(request) {
+    return caches.match(request).then(function(cached) {
+        return cached || fetch(request).then(function(response) {
+            store(request, response);
+            return response;
+        });
+    });
+}
+
+self.addEventListener('fetch', function(event) {
+    if (event.request.method !== 'GET') return;
+    var path = sitePath(new URL(event.request.url));
+    if (path === null) return;
+    if (/^\/assets\/.+\.[0-9a-f]{10}\.\w+$/.test(path)) {
+        event.respondWith(cacheFirst(event.request));
+    } else {
+        event.respondWith(networkFirst(event.request));
+    }
+});
@@ -0,0 +1,68 @@
+// Sorting of tables with the "sortable" class (CSV and TSV documents):
+// clicking a header, or pressing Enter on it, sorts the rows by that
+// column, ascending then descending. Columns of numbers sort as numbers
+// and empty cells go last.
+(function() {
+    var number = /^[-+]?(\d{1,3}(,\d{3})+|\d*)(\.\d+)?(e[-+]?\d+)?%?$/i;
+
+    function isNumber(value) {
+        return value !== '' && value !== '-' && value !== '+' && number.test(value);
+    }
+
+    function toNumber(value) {
+        return parseFloat(value.replace(/,/g, ''));
+    }
+
+    function compare(a, b) {
+        if (a === '' || b === '') {
+            return (a === '') - (b === '');
+        }
+        if (isNumber(a) && isNumber(b)) {
+            return toNumber(a) - toNumber(b);
+        }
+        return a.localeCompare(b, undefined, { numeric: true, sensitivity: 'base' });
+    }
+
+    document.querySelectorAll('table.sortable').forEach(function(table) {
+        if (!table.tHead || !table.tBodies.length) {
+            return;
+        }
+        var headers = table.tHead.rows[0].cells;
+        Array.prototype.forEach.call(headers, function(header, column) {
+            function sort() {
+                var ascending = header.getAttribute('aria-sort') !== 'ascending';
+                Array.prototype.forEach.call(headers, function(other) {
+                    other.removeAttribute('aria-sort');
+                });
+                header.setAttribute('aria-sort', ascending ? 'ascending' : 'descending');
+
+                var body = table.tBodies[0];
+                var rows = Array.prototype.slice.call(body.rows);
+                var values = new Map(rows.map(function(row) {
+                    var cell = row.cells[column];
+                    return [row, cell ? cell.textContent.trim() : ''];
+                }));
+                rows.sort(function(x, y) {
+                    var a = values.get(x), b = values.get(y);
+                    // Empty cells stay last in both directions
+                    if (a === '' || b === '') {
+                        return compare(a, b);
+                    }
+                    return ascending ? compare(a, b) : compare(b, a);
+                });
+                rows.forEach(function(row) {
+                    body.appendChild(row);
+                });
+            }
+
+            header.tabIndex = 0;
+            header.addEventListener('click', sort);
+            header.addEventListener('keydown', function(event) {
+                if (event.key === 'Enter' || event.key === ' ') {
+                    event.preventDefault();
+                    sort();
+                }
+            });
+        });
+    });
+})();
@@ -0,0 +1,78 @@
+// Open and closed tree folders, kept per browser in localStorage and shared
+// by the index page and the document sidebar. Folders are keyed by their
+// source and TreeNode.Path (data-source / data-node); folders that were
+// never toggled keep the state rendered by the server.
+function DimanTree(container, childrenClass) {
+    var storageKey = 'dimandocs-tree-open';
+    var state = {};
+    try {
+        state = JSON.parse(localStorage.getItem(storageKey)) || {};
+    } catch (error) {
+        console.error('Ignoring saved tree state:', error);
+    }
+
+    function folders() {
+        return container.querySelectorAll('[data-node]');
+    }
+
+    function key(folder) {
+        var group = folder.closest('[data-source]');
+        return (group ? group.getAttribute('data-source') : '') + ':' + folder.getAttribute('data-node');
+    }
+
+    function children(folder) {
+        var next = folder.nextElementSibling;
+        return next && next.classList.contains(childrenClass) ? next : null;
+    }
+
+    function setOpen(folder, open) {
+        var list = children(folder);
+        if (!list) return;
+        list.classList.toggle('open', open);
+        var toggle = folder.querySelector('.tree-toggle, .sidebar-tree-toggle');
+        if (toggle) toggle.classList.toggle('open', open);
+        var item = folder.parentElement;
+        if (item && item.getAttribute('role') === 'treeitem') item.setAttribute('aria-expanded', open);
+    }
+
+    function save() {
+        try {
+            localStorage.setItem(storageKey, JSON.stringify(state));
+        } catch (error) {
+            console.error('Saving tree state failed:', error);
+        }
+    }
+
+    folders().forEach(function(folder) {
+        if (Object.prototype.hasOwnProperty.call(state, key(folder))) {
+            setOpen(folder, state[key(folder)]);
+        }
+    });
+
+    return {
+        toggle: function(folder) {
+            var list = children(folder);
+            if (!list) return;
+            var open = !list.classList.contains('open');
+            setOpen(folder, open);
+            state[key(folder)] = open;
+            save();
+        },
+        setAll: function(open) {
+            folders().forEach(function(folder) {
+                setOpen(folder, open);
+                state[key(folder)] = open;
+            });
+            save();
+        },
+        // Open the folders containing item, without remembering them
+        reveal: function(item) {
+            for (var el = item.parentElement; el && el !== container; el = el.parentElement) {
+                if (el.classList.contains(childrenClass) && el.previousElementSibling) {
+                    setOpen(el.previousElementSibling, true);
+                }
+            }
+        }
+    };
+}
+
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssetIntegrity(t *testing.T) {
+	// KaTeX from the CDN is checked against its hash
+	cdn := loadAssetBundle(fstest.MapFS{"assets/search.js": {Data: []byte("search")}})
+	for name := range assetIntegrity {
+		if url := cdn.URL(name); !strings.HasPrefix(url, "https://") {
+			t.Errorf("%s: URL %s", name, url)
+		}
+		if attrs := string(cdn.Integrity(name)); !strings.Contains(attrs, `integrity="sha384-`) || !strings.Contains(attrs, `crossorigin="anonymous"`) {
+			t.Errorf("%s: attributes %q", name, attrs)
+		}
+	}
+	if attrs := cdn.Integrity("search.js"); attrs != "" {
+		t.Errorf("bundled asset: attributes %q", attrs)
+	}
+
+	// Bundled KaTeX is served like any other asset
+	bundled := loadAssetBundle(fstest.MapFS{"assets/katex/katex.min.js": {Data: []byte("katex")}})
+	if url := bundled.URL("katex/katex.min.js"); !strings.HasPrefix(url, "/assets/katex/") {
+		t.Errorf("bundled KaTeX URL %s", url)
+	}
+	if attrs := bundled.Integrity("katex/katex.min.js"); attrs != "" {
+		t.Errorf("bundled KaTeX: attributes %q", attrs)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	// Pages and sources change while documents are edited, so browsers keep
+	// them but revalidate with the ETag on every request
+	revalidateCacheControl = "no-cache"
+
+	// Static assets rarely change; they are reused for an hour before
+	// being revalidated
+	staticCacheControl = "public, max-age=3600"
+)
+
+// etagFor returns a strong ETag derived from the content hash of data
+func etagFor(data []byte) string {
+	return fmt.Sprintf("%q", contentHash(string(data))[:32])
+}
+
+// serveCached writes content with an ETag and Cache-Control header, answering
+// If-None-Match and If-Modified-Since with 304 Not Modified. modTime is only
+// used for Last-Modified and may be zero when content does not come from a
+// single file.
+func serveCached(w http.ResponseWriter, r *http.Request, name string, modTime time.Time, content []byte) {
+	w.Header().Set("ETag", etagFor(content))
+	w.Header().Set("Cache-Control", revalidateCacheControl)
+	http.ServeContent(w, r, name, modTime, bytes.NewReader(content))
+}
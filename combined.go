@@ -0,0 +1,267 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	stdhtml "html"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CombinedDocument is a section of a combined document
+type CombinedDocument struct {
+	ID      string // anchor of the section, e.g. "doc-3"
+	Title   string
+	Path    string
+	Heading bool // the document does not start with a title of its own
+	Content template.HTML
+}
+
+// CombinedView is a folder exported as one document, as
+// templates/combined.html shows it
+type CombinedView struct {
+	Title     string
+	AppTitle  string
+	Date      string
+	Documents []CombinedDocument
+}
+
+// combinedHref matches the links of rendered documents
+var combinedHref = regexp.MustCompile(`href="([^"]*)"`)
+
+// combinedIDAttr matches the id attributes of rendered documents
+var combinedIDAttr = regexp.MustCompile(`(\s)id="([^"]*)"`)
+
+// combinedDocuments returns the documents of a folder and its subfolders in
+// the order of the tree, each folder's landing page first
+func combinedDocuments(docs []*Document, node *TreeNode) []*Document {
+	if node.Index != nil {
+		docs = append(docs, node.Index)
+	}
+	for _, child := range node.Children {
+		if child.IsFile && child.Document != node.Index {
+			docs = append(docs, child.Document)
+		}
+	}
+	for _, child := range node.Children {
+		if !child.IsFile {
+			docs = combinedDocuments(docs, child)
+		}
+	}
+	return docs
+}
+
+// handleCombined serves /combined/{path}: the documents of a folder and its
+// subfolders as one document, with a cover page listing them and a heading
+// for each. ?format=html and ?format=markdown download it, ?format=pdf
+// opens the browser's print dialog to save it as PDF. An empty path
+// combines every document.
+func (a *App) handleCombined(w http.ResponseWriter, r *http.Request) {
+	relPath := strings.Trim(strings.TrimPrefix(r.URL.Path, "/combined/"), "/")
+	format := r.URL.Query().Get("format")
+	switch format {
+	case "", "html", "markdown", "pdf":
+	default:
+		a.serveError(w, fmt.Sprintf("Unknown format %q (use html, markdown or pdf)", format), http.StatusBadRequest)
+		return
+	}
+
+	var docs []*Document
+	for _, tree := range a.access(r).Trees(a.BuildDirectoryTrees()) {
+		if relPath == "" {
+			docs = combinedDocuments(docs, tree.Root)
+		} else if node := findTreeNode(tree, relPath); node != nil {
+			docs = combinedDocuments(docs, node)
+		}
+	}
+	if len(docs) == 0 {
+		a.notFound(w, r)
+		return
+	}
+
+	title := path.Base(relPath)
+	if relPath == "" {
+		title = a.Config.Title
+		if title == "" {
+			title = "Documentation"
+		}
+	}
+
+	if format == "markdown" {
+		content, err := a.combinedMarkdown(title, docs)
+		if err != nil {
+			a.serveError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": title + ".md"}))
+		w.Write([]byte(content))
+		return
+	}
+
+	content, err := a.combinedHTML(title, docs)
+	if err != nil {
+		a.serveError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmpl, err := a.parseTemplates("templates/standalone.html")
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	data := RenderPageData{Title: title, Content: template.HTML(content), Math: a.Config.Math, Print: format == "pdf"}
+	if format == "" {
+		data.Exports = a.Config.BasePath + "/combined/" + escapePath(relPath)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to execute template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if format == "html" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": title + ".html"}))
+	}
+	w.Write(buf.Bytes())
+}
+
+// combinedHTML renders documents as the sections of one document, after a
+// cover page. Links between them point to their sections.
+func (a *App) combinedHTML(title string, docs []*Document) ([]byte, error) {
+	view := CombinedView{Title: title, AppTitle: a.Config.Title, Date: time.Now().Format("January 2, 2006")}
+	sections := make(map[string]string) // anchors by document path
+	for i, doc := range docs {
+		sections[doc.Path] = fmt.Sprintf("doc-%d", i+1)
+	}
+	for _, doc := range docs {
+		html, err := a.renderDocument(doc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", doc.RelPath, err)
+		}
+		content := a.combinedLinks(combinedIDs(string(html), sections[doc.Path]), doc, sections)
+		view.Documents = append(view.Documents, CombinedDocument{
+			ID:      sections[doc.Path],
+			Title:   doc.Title,
+			Path:    doc.RelPath,
+			Heading: !strings.HasPrefix(strings.TrimSpace(content), "<h1"),
+			Content: template.HTML(content),
+		})
+	}
+
+	tmpl, err := a.parseTemplates("templates/combined.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, view); err != nil {
+		return nil, fmt.Errorf("failed to render combined document: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// combinedID returns the id an element of a document gets in the combined
+// document, prefixed with the anchor of its section (e.g. "doc-3-overview")
+// so the same heading in two documents doesn't clash
+func combinedID(section, id string) string {
+	return section + "-" + id
+}
+
+// combinedIDs prefixes the ids of a rendered document with the anchor of its
+// section
+func combinedIDs(html, section string) string {
+	return combinedIDAttr.ReplaceAllStringFunc(html, func(match string) string {
+		groups := combinedIDAttr.FindStringSubmatch(match)
+		id := stdhtml.UnescapeString(groups[2])
+		return groups[1] + `id="` + stdhtml.EscapeString(combinedID(section, id)) + `"`
+	})
+}
+
+// combinedLinks points the links of a rendered document to the sections of
+// the combined document holding their targets, and the relative links to
+// other documents to their pages on the server. Fragments point to the ids
+// made by combinedIDs.
+func (a *App) combinedLinks(html string, doc *Document, sections map[string]string) string {
+	docPrefix := a.Config.BasePath + "/doc/"
+	return combinedHref.ReplaceAllStringFunc(html, func(match string) string {
+		href := stdhtml.UnescapeString(match[len(`href="`) : len(match)-1])
+		if href == "" || isExternalLink(href) {
+			return match
+		}
+		if strings.HasPrefix(href, "#") {
+			fragment, err := url.PathUnescape(href[1:])
+			if err != nil || fragment == "" {
+				return match
+			}
+			return `href="#` + stdhtml.EscapeString(url.PathEscape(combinedID(sections[doc.Path], fragment))) + `"`
+		}
+
+		var target *Document
+		var fragment string
+		if strings.HasPrefix(href, docPrefix) {
+			u, err := url.Parse(strings.TrimPrefix(href, docPrefix))
+			if err != nil {
+				return match
+			}
+			target, fragment = a.findDocument(u.Path), u.Fragment
+		} else {
+			var filePath string
+			filePath, fragment = resolveLink(doc, href)
+			for i := range a.Documents {
+				if a.Documents[i].Path == filePath {
+					target = &a.Documents[i]
+					break
+				}
+			}
+		}
+		if target == nil {
+			return match
+		}
+
+		if id, ok := sections[target.Path]; ok {
+			if fragment != "" {
+				id = combinedID(id, fragment)
+			}
+			return `href="#` + stdhtml.EscapeString(url.PathEscape(id)) + `"`
+		}
+		href = docPrefix + escapePath(target.RelPath)
+		if fragment != "" {
+			href += "#" + url.PathEscape(fragment)
+		}
+		return `href="` + stdhtml.EscapeString(href) + `"`
+	})
+}
+
+// combinedMarkdown concatenates the markdown of documents after a list of
+// them, with a title heading for the documents that don't start with one
+func (a *App) combinedMarkdown(title string, docs []*Document) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	if a.Config.Title != "" {
+		fmt.Fprintf(&b, "Exported from %s on %s.\n\n", a.Config.Title, time.Now().Format("January 2, 2006"))
+	} else {
+		fmt.Fprintf(&b, "Exported on %s.\n\n", time.Now().Format("January 2, 2006"))
+	}
+	for i, doc := range docs {
+		fmt.Fprintf(&b, "%d. %s (`%s`)\n", i+1, doc.Title, doc.RelPath)
+	}
+
+	for _, doc := range docs {
+		content, err := a.documentMarkdown(doc)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", doc.RelPath, err)
+		}
+		content = strings.TrimSpace(content)
+		b.WriteString("\n---\n\n")
+		if !strings.HasPrefix(content, "# ") {
+			fmt.Fprintf(&b, "# %s\n\n", doc.Title)
+		}
+		b.WriteString(content + "\n")
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCombinedHeadingIDs(t *testing.T) {
+	a := newTestApp(t, map[string]string{
+		"a.md": "# A\n\n## Overview\n\nSee [below](#overview) and [B's overview](b.md#overview).\n",
+		"b.md": "# B\n\n## Overview\n\nBack to [A](a.md).\n",
+	})
+	var docs []*Document
+	for _, relPath := range []string{"a.md", "b.md"} {
+		doc := a.findDocument(relPath)
+		if doc == nil {
+			t.Fatalf("%s not found", relPath)
+		}
+		docs = append(docs, doc)
+	}
+	html, err := a.combinedHTML("Combined", docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(html)
+	for _, want := range []string{
+		`id="doc-1-overview"`,
+		`id="doc-2-overview"`,
+		`href="#doc-1-overview"`,
+		`href="#doc-2-overview"`,
+		`href="#doc-1"`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("combined document has no %s", want)
+		}
+	}
+	if strings.Contains(got, `id="overview"`) {
+		t.Error("combined document has an unprefixed heading id")
+	}
+}
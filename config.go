@@ -2,32 +2,70 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 )
 
-// LoadConfig loads configuration from file and compiles regex patterns
+// LoadConfig loads configuration from file and compiles regex patterns.
+// The file may be JSON, YAML or TOML, detected by its extension. Values are
+// applied in order of precedence: defaults, config file, DIMANDOCS_*
+// environment variables, command line flags and finally the PATH argument.
 func (a *App) LoadConfig(configFile string, targetPath string) error {
 	if configFile == "" {
-		configFile = "dimandocs.json"
+		configFile = findDefaultConfigFile()
 	}
 
-	// Check if config file exists
-	data, err := ioutil.ReadFile(configFile)
-	if err != nil {
-		// If file doesn't exist and it's the default config, use default configuration
-		if os.IsNotExist(err) && configFile == "dimandocs.json" {
-			a.Config = getDefaultConfig()
-		} else {
+	// Problems are collected and reported together once the config is loaded
+	var problems []ConfigProblem
+	var lines map[string]int
+
+	if configFile == "" {
+		// No config file in the current directory, use default configuration
+		a.Config = getDefaultConfig()
+	} else {
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
 			return fmt.Errorf("failed to read config file: %w", err)
 		}
-	} else {
-		// Config file exists, parse it
+		if absPath, err := filepath.Abs(configFile); err == nil {
+			a.ConfigFile = absPath
+		}
+
+		// YAML and TOML files are converted to JSON, which is then validated
+		// and parsed like a JSON config file
+		data, lines, problems = decodeConfigFile(configFile, data)
+		if len(problems) > 0 {
+			return newConfigError(configFile, problems)
+		}
+
+		// Check the config structure and parse it. Values of the wrong type
+		// are skipped by Unmarshal and already reported as problems.
+		problems = checkConfigData(data, lines)
 		if err := json.Unmarshal(data, &a.Config); err != nil {
-			return fmt.Errorf("failed to parse config file: %w", err)
+			var typeErr *json.UnmarshalTypeError
+			if !errors.As(err, &typeErr) {
+				return newConfigError(configFile, problems)
+			}
+		}
+	}
+
+	// Environment variables override the config file, and flags override both
+	envFields, err := applyEnvOverrides(&a.Config)
+	if err != nil {
+		return err
+	}
+	flagFields := applyFlagOverrides(&a.Config, a.Overrides)
+	for _, field := range append(envFields, flagFields...) {
+		// Overridden values no longer come from a line in the config file
+		for key := range lines {
+			if key == field || strings.HasPrefix(key, field+".") || strings.HasPrefix(key, field+"[") {
+				delete(lines, key)
+			}
 		}
 	}
 
@@ -38,6 +76,17 @@ func (a *App) LoadConfig(configFile string, targetPath string) error {
 		}
 	}
 
+	// Report every problem at once rather than failing on the first
+	problems = append(problems, checkConfig(lines, a.Config, targetPath != "")...)
+	if err := newConfigError(configFile, problems); err != nil {
+		return err
+	}
+
+	// "/docs/" and "/docs" are the same prefix, "/" is no prefix at all
+	a.Config.BasePath = strings.TrimRight(a.Config.BasePath, "/")
+
+	a.resolveRemoteDirectories()
+
 	// Compile ignore patterns
 	for _, pattern := range a.Config.IgnorePatterns {
 		regex, err := regexp.Compile(pattern)
@@ -48,17 +97,13 @@ func (a *App) LoadConfig(configFile string, targetPath string) error {
 	}
 
 	// Compile file patterns for each directory
-	a.FileRegexes = make(map[string]*regexp.Regexp)
+	a.FileMatchers = make(map[string]*FileMatcher)
 	for _, dirConfig := range a.Config.Directories {
-		pattern := dirConfig.FilePattern
-		if pattern == "" {
-			pattern = "^(?i)(readme\\.md)$" // Default to README.md files
-		}
-		regex, err := regexp.Compile(pattern)
+		matcher, err := newFileMatcher(dirConfig)
 		if err != nil {
-			return fmt.Errorf("failed to compile file pattern '%s' for directory '%s': %w", pattern, dirConfig.Path, err)
+			return err
 		}
-		a.FileRegexes[dirConfig.Path] = regex
+		a.FileMatchers[dirConfig.Path] = matcher
 	}
 
 	return nil
@@ -139,7 +184,7 @@ func getDefaultConfig() Config {
 // handleTargetPath processes the target path (file or directory)
 func (a *App) handleTargetPath(targetPath string) error {
 	// Get absolute path
-	absPath, err := filepath.Abs(targetPath)
+	absPath, err := filepath.Abs(cleanTargetPath(targetPath))
 	if err != nil {
 		return fmt.Errorf("failed to resolve path %s: %w", targetPath, err)
 	}
@@ -167,9 +212,10 @@ func (a *App) handleTargetPath(targetPath string) error {
 		dirPath := filepath.Dir(absPath)
 		a.Config.Directories = []DirectoryConfig{
 			{
-				Path:        dirPath,
-				Name:        "Documents",
-				FilePattern: "\\.md$",
+				Path:          dirPath,
+				Name:          "Documents",
+				FilePattern:   "\\.md$",
+				IncludeHidden: strings.HasPrefix(filepath.Base(absPath), "."), // so the file itself is found
 			},
 		}
 	}
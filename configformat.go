@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFiles are looked up in the current directory, in order, when
+// no config file is given
+var defaultConfigFiles = []string{"dimandocs.json", "dimandocs.yaml", "dimandocs.yml", "dimandocs.toml"}
+
+// findDefaultConfigFile returns the first default config file that exists,
+// or an empty string if there is none
+func findDefaultConfigFile() string {
+	for _, name := range defaultConfigFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// configFormat detects the format of a config file from its extension.
+// Unknown extensions are treated as JSON.
+func configFormat(configFile string) string {
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	}
+	return "json"
+}
+
+// decodeConfigFile converts a config file to JSON, the canonical format the
+// config is validated and parsed from. It also returns the line of each field
+// in the original file.
+func decodeConfigFile(configFile string, data []byte) ([]byte, map[string]int, []ConfigProblem) {
+	switch configFormat(configFile) {
+	case "yaml":
+		return yamlToJSON(data)
+	case "toml":
+		return tomlToJSON(data)
+	}
+	return data, fieldLines(data), nil
+}
+
+// yamlToJSON converts YAML config data to JSON
+func yamlToJSON(data []byte) ([]byte, map[string]int, []ConfigProblem) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(data, &node); err != nil {
+		return nil, nil, []ConfigProblem{{Line: yamlErrorLine(err), Message: fmt.Sprintf("invalid YAML: %v", err)}}
+	}
+
+	var raw interface{}
+	if err := node.Decode(&raw); err != nil {
+		return nil, nil, []ConfigProblem{{Message: fmt.Sprintf("invalid YAML: %v", err)}}
+	}
+	if raw == nil {
+		raw = map[string]interface{}{}
+	}
+
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, []ConfigProblem{{Message: fmt.Sprintf("unsupported YAML value: %v", err)}}
+	}
+
+	lines := make(map[string]int)
+	yamlFieldLines(&node, "", lines)
+	return jsonData, lines, nil
+}
+
+// yamlFieldLines records the line of every field under node
+func yamlFieldLines(node *yaml.Node, field string, lines map[string]int) {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			yamlFieldLines(child, field, lines)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := joinField(field, node.Content[i].Value)
+			lines[key] = node.Content[i].Line
+			yamlFieldLines(node.Content[i+1], key, lines)
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			item := fmt.Sprintf("%s[%d]", field, i)
+			lines[item] = child.Line
+			yamlFieldLines(child, item, lines)
+		}
+	}
+}
+
+// yamlErrorLinePattern extracts the line number from yaml.v3 error messages
+var yamlErrorLinePattern = regexp.MustCompile(`line (\d+)`)
+
+// yamlErrorLine returns the line reported in a YAML error, or 0
+func yamlErrorLine(err error) int {
+	if m := yamlErrorLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		return line
+	}
+	return 0
+}
+
+// tomlToJSON converts TOML config data to JSON. TOML does not expose the
+// position of keys, so problems are reported by field only.
+func tomlToJSON(data []byte) ([]byte, map[string]int, []ConfigProblem) {
+	var raw map[string]interface{}
+	if err := toml.Unmarshal(data, &raw); err != nil {
+		line := 0
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			line = parseErr.Position.Line
+		}
+		return nil, nil, []ConfigProblem{{Line: line, Message: fmt.Sprintf("invalid TOML: %v", err)}}
+	}
+
+	jsonData, err := json.Marshal(raw)
+	if err != nil {
+		return nil, nil, []ConfigProblem{{Message: fmt.Sprintf("unsupported TOML value: %v", err)}}
+	}
+	return jsonData, nil, nil
+}
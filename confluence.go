@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	goldmarkhtml "github.com/yuin/goldmark/renderer/html"
+)
+
+// confluenceLabel marks the pages created by dimandocs, so they can be
+// found again without the state file
+const confluenceLabel = "dimandocs"
+
+var (
+	// confluenceCodeBlock matches the fenced and indented code blocks of
+	// rendered markdown, with their language
+	confluenceCodeBlock = regexp.MustCompile(`(?s)<pre><code(?: class="language-([^"]+)")?>(.*?)</code></pre>`)
+
+	// confluenceCheckbox matches the checkbox of a task list item
+	confluenceCheckbox = regexp.MustCompile(`<input[^>]*type="checkbox"[^>]*>`)
+
+	// confluenceFigure rewrites the figures of captioned images, which the
+	// storage format does not have, as the image followed by its caption
+	confluenceFigure = strings.NewReplacer(
+		"<figure>\n", "", "\n</figure>", "",
+		"<figcaption>", "<p><em>", "</figcaption>", "</em></p>",
+		` loading="lazy"`, "",
+	)
+
+	// confluenceLink matches a link and its attributes and body
+	confluenceLink = regexp.MustCompile(`(?s)<a ([^>]*)>(.*?)</a>`)
+	htmlHref       = regexp.MustCompile(`\bhref="([^"]*)"`)
+)
+
+// confluenceLanguages maps code block languages to the names of the
+// Confluence code macro, where they differ
+var confluenceLanguages = map[string]string{
+	"javascript": "js",
+	"python":     "py",
+	"yaml":       "yml",
+	"sh":         "bash",
+	"shell":      "bash",
+	"c++":        "cpp",
+	"csharp":     "c#",
+	"html":       "xml",
+}
+
+// confluenceTarget publishes to a Confluence space with the REST API. Pages
+// are written in the storage format, XHTML with Confluence macros, and
+// links between documents become links to their pages.
+type confluenceTarget struct {
+	p        *publisher
+	config   ConfluenceConfig
+	markdown goldmark.Markdown // renders XHTML
+}
+
+// newConfluenceTarget returns the target configured in publish.confluence
+func newConfluenceTarget(p *publisher) (*confluenceTarget, error) {
+	config := p.app.Config.Publish.Confluence
+	if err := missingPublishSettings(map[string]string{
+		"publish.confluence.url":   config.URL,
+		"publish.confluence.space": config.Space,
+		"publish.confluence.token": config.Token,
+	}); err != nil {
+		return nil, err
+	}
+	config.URL = strings.TrimRight(config.URL, "/")
+	return &confluenceTarget{
+		p:        p,
+		config:   config,
+		markdown: newMarkdownRenderer(p.app.Config, p.app.resolveWikiLink, goldmarkhtml.WithXHTML()),
+	}, nil
+}
+
+// request sends a request to the REST API, with the API token as basic
+// auth password for Confluence Cloud or as a personal access token
+func (c *confluenceTarget) request(method, path string, body, result interface{}) error {
+	req, err := newJSONRequest(method, c.config.URL+"/rest/api"+path, body)
+	if err != nil {
+		return err
+	}
+	if c.config.User != "" {
+		req.SetBasicAuth(c.config.User, c.config.Token)
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	}
+	return publishRequest(req, result)
+}
+
+// ancestors returns the ancestors of a page under parentID, the configured
+// parent page for the top level
+func (c *confluenceTarget) ancestors(parentID string) []map[string]string {
+	if parentID == "" {
+		parentID = c.config.ParentID
+	}
+	if parentID == "" {
+		return nil
+	}
+	return []map[string]string{{"id": parentID}}
+}
+
+// find implements publishTarget. A page with the same title is only used if
+// it has the dimandocs label; others are never overwritten.
+func (c *confluenceTarget) find(page *publishPage) (string, error) {
+	query := url.Values{"spaceKey": {c.config.Space}, "title": {page.Title}, "type": {"page"}, "expand": {"metadata.labels"}}
+	var result struct {
+		Results []struct {
+			ID       string `json:"id"`
+			Metadata struct {
+				Labels struct {
+					Results []struct {
+						Name string `json:"name"`
+					} `json:"results"`
+				} `json:"labels"`
+			} `json:"metadata"`
+		} `json:"results"`
+	}
+	if err := c.request(http.MethodGet, "/content?"+query.Encode(), nil, &result); err != nil {
+		if errors.Is(err, errPageNotFound) {
+			return "", fmt.Errorf("space %s not found", c.config.Space)
+		}
+		return "", err
+	}
+	for _, found := range result.Results {
+		for _, label := range found.Metadata.Labels.Results {
+			if label.Name == confluenceLabel {
+				return found.ID, nil
+			}
+		}
+		return "", fmt.Errorf("page %q already exists in space %s and was not published by dimandocs", page.Title, c.config.Space)
+	}
+	return "", nil
+}
+
+// create implements publishTarget
+func (c *confluenceTarget) create(page *publishPage, parentID string) (string, error) {
+	body := map[string]interface{}{
+		"type":  "page",
+		"title": page.Title,
+		"space": map[string]string{"key": c.config.Space},
+		"body": map[string]interface{}{
+			"storage": map[string]string{"value": "", "representation": "storage"},
+		},
+		"metadata": map[string]interface{}{
+			"labels": []map[string]string{{"prefix": "global", "name": confluenceLabel}},
+		},
+	}
+	if ancestors := c.ancestors(parentID); ancestors != nil {
+		body["ancestors"] = ancestors
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := c.request(http.MethodPost, "/content", body, &created); err != nil {
+		if errors.Is(err, errPageNotFound) {
+			return "", fmt.Errorf("space %s or parent page not found", c.config.Space)
+		}
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// update implements publishTarget, as a new version of the page
+func (c *confluenceTarget) update(page *publishPage, parentID string) error {
+	var current struct {
+		Version struct {
+			Number int `json:"number"`
+		} `json:"version"`
+	}
+	if err := c.request(http.MethodGet, "/content/"+url.PathEscape(page.id)+"?expand=version", nil, &current); err != nil {
+		return err
+	}
+	value, err := c.storageFormat(page)
+	if err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"id":      page.id,
+		"type":    "page",
+		"title":   page.Title,
+		"version": map[string]interface{}{"number": current.Version.Number + 1, "message": "Published by dimandocs"},
+		"body": map[string]interface{}{
+			"storage": map[string]string{"value": value, "representation": "storage"},
+		},
+	}
+	if ancestors := c.ancestors(parentID); ancestors != nil {
+		body["ancestors"] = ancestors
+	}
+	return c.request(http.MethodPut, "/content/"+url.PathEscape(page.id), body, nil)
+}
+
+// storageFormat returns the content of a page in the storage format.
+// Directories without an index document list their pages.
+func (c *confluenceTarget) storageFormat(page *publishPage) (string, error) {
+	content, err := c.p.pageContent(page)
+	if err != nil {
+		return "", err
+	}
+	if page.Doc == nil {
+		return `<ac:structured-macro ac:name="children" />`, nil
+	}
+
+	var buf bytes.Buffer
+	if err := c.markdown.Convert([]byte(content), &buf); err != nil {
+		return "", fmt.Errorf("failed to render markdown: %w", err)
+	}
+	out := buf.Bytes()
+	if c.p.app.Sanitizer != nil {
+		out = c.p.app.Sanitizer.SanitizeBytes(out)
+	}
+
+	storage := confluenceCodeBlock.ReplaceAllStringFunc(string(out), func(block string) string {
+		match := confluenceCodeBlock.FindStringSubmatch(block)
+		return confluenceCodeMacro(html.UnescapeString(match[1]), html.UnescapeString(match[2]))
+	})
+	storage = confluenceFigure.Replace(storage)
+	storage = confluenceCheckbox.ReplaceAllStringFunc(storage, func(input string) string {
+		if strings.Contains(input, "checked") {
+			return "☑"
+		}
+		return "☐"
+	})
+	storage = confluenceLink.ReplaceAllStringFunc(storage, func(link string) string {
+		match := confluenceLink.FindStringSubmatch(link)
+		href := htmlHref.FindStringSubmatch(match[1])
+		if href == nil {
+			return link
+		}
+		target := html.UnescapeString(href[1])
+		if linked := c.p.linkedPage(page.Doc, target); linked != nil {
+			return `<ac:link><ri:page ri:content-title="` + html.EscapeString(linked.Title) + `" /><ac:link-body>` + match[2] + `</ac:link-body></ac:link>`
+		}
+		if !isExternalLink(target) && !strings.HasPrefix(target, "#") {
+			// Links to files that are not published would be broken
+			return match[2]
+		}
+		return link
+	})
+	return storage, nil
+}
+
+// confluenceCodeMacro returns a code block as a code macro
+func confluenceCodeMacro(language, code string) string {
+	var b strings.Builder
+	b.WriteString(`<ac:structured-macro ac:name="code">`)
+	if language != "" {
+		if name, ok := confluenceLanguages[strings.ToLower(language)]; ok {
+			language = name
+		}
+		b.WriteString(`<ac:parameter ac:name="language">` + html.EscapeString(language) + `</ac:parameter>`)
+	}
+	code = strings.ReplaceAll(strings.TrimSuffix(code, "\n"), "]]>", "]]]]><![CDATA[>")
+	b.WriteString(`<ac:plain-text-body><![CDATA[` + code + `]]></ac:plain-text-body></ac:structured-macro>`)
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RenderPageData is passed to the page template of `dimandocs render`
+type RenderPageData struct {
+	Title   string
+	Content template.HTML
+	Math    bool
+	Print   bool   // open the print dialog once the page is loaded
+	Exports string // URL of a combined document, to link its downloads
+}
+
+// runRender implements `dimandocs render`: it converts one markdown file
+// (or stdin with "-") to HTML with the configured markdown settings, or an
+// OpenAPI spec (.yaml, .yml or .json) to its API reference. The output is
+// an HTML fragment unless --standalone or --template is given.
+func runRender(args []string) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	configFile := fs.String("config-file", os.Getenv("DIMANDOCS_CONFIG_FILE"), "Path to configuration file (default: dimandocs.json if exists)")
+	output := fs.String("output", "", "Write the HTML to this file instead of stdout")
+	standalone := fs.Bool("standalone", false, "Output a complete HTML page")
+	templateFile := fs.String("template", "", "Render the page with this html/template file (implies --standalone)")
+	title := fs.String("title", "", "Page title (default: the first heading or the file name)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one markdown file (or - for stdin)")
+	}
+	input := fs.Arg(0)
+
+	var content []byte
+	var err error
+	if input == "-" {
+		content, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		content, err = ioutil.ReadFile(input)
+	}
+	if err != nil {
+		return err
+	}
+
+	a := NewApp()
+	workingDir, err := GetWorkingDirectory()
+	if err != nil {
+		return err
+	}
+	a.WorkingDir = workingDir
+	if err := a.LoadConfig(*configFile, ""); err != nil {
+		return err
+	}
+	a.Markdown = newMarkdownRenderer(a.Config, a.resolveWikiLink)
+	a.Sanitizer = newSanitizer(a.Config)
+	// Wiki links can only be resolved against the documents of a config
+	if a.ConfigFile != "" {
+		if err := a.ScanDirectories(); err != nil {
+			return err
+		}
+	}
+
+	var html []byte
+	if isOpenAPIFile(input) {
+		html, err = a.renderOpenAPI(string(content))
+	} else {
+		html, err = a.renderMarkdown(string(content))
+	}
+	if err != nil {
+		return err
+	}
+
+	if *standalone || *templateFile != "" {
+		data := RenderPageData{Title: *title, Content: template.HTML(html), Math: a.Config.Math}
+		if data.Title == "" {
+			name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+			if input == "-" {
+				name = "Document"
+			}
+			data.Title = substituteVariables(extractTitle(string(content), name), a.Config.Variables)
+			if isOpenAPIFile(input) {
+				if title, _ := openAPIInfo(content); title != "" {
+					data.Title = substituteVariables(title, a.Config.Variables)
+				}
+			}
+		}
+
+		var tmpl *template.Template
+		if *templateFile != "" {
+			tmpl, err = template.New(filepath.Base(*templateFile)).Funcs(a.templateFuncs()).ParseFiles(*templateFile)
+		} else {
+			tmpl, err = a.parseTemplates("templates/standalone.html")
+		}
+		if err != nil {
+			return fmt.Errorf("failed to parse template: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return fmt.Errorf("failed to execute template: %w", err)
+		}
+		html = buf.Bytes()
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(html)
+		return err
+	}
+	return ioutil.WriteFile(*output, html, 0644)
+}
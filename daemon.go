@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	// pidFileName and daemonLogName are created in the working directory by
+	// `dimandocs start`
+	pidFileName   = ".dimandocs.pid"
+	daemonLogName = ".dimandocs.log"
+
+	daemonStartTimeout = 30 * time.Second
+	daemonStopTimeout  = 10 * time.Second
+)
+
+// InstanceInfo describes a running server. It is written to the pidfile once
+// the server is listening, and returned by /api/ping.
+type InstanceInfo struct {
+	App        string    `json:"app"`
+	Version    string    `json:"version"`
+	PID        int       `json:"pid"`
+	Port       int       `json:"port"`
+	WorkingDir string    `json:"working_dir"`
+	ConfigFile string    `json:"config_file"` // absolute path, empty when using the defaults
+	BasePath   string    `json:"base_path"`
+	Started    time.Time `json:"started"`
+}
+
+// instanceApp identifies dimandocs servers in /api/ping responses
+const instanceApp = "dimandocs"
+
+// instanceProbePorts is the number of ports probed from the configured one,
+// matching the range Start usually moves into when the port is busy
+const instanceProbePorts = 10
+
+// URL returns the base URL of the instance, including its base path
+func (info *InstanceInfo) URL() string {
+	return fmt.Sprintf("http://localhost:%d%s", info.Port, info.BasePath)
+}
+
+// readInstanceFile reads a pidfile, returning nil if it does not exist or the
+// process it names is no longer running
+func readInstanceFile(path string) *InstanceInfo {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var info InstanceInfo
+	if err := json.Unmarshal(data, &info); err != nil || info.PID == 0 {
+		return nil
+	}
+	if !processRunning(info.PID) {
+		return nil
+	}
+	return &info
+}
+
+// writeInstanceFile writes the pidfile of the current process and removes it
+// when the process is interrupted or terminated
+func (a *App) writeInstanceFile() error {
+	data, err := json.MarshalIndent(a.Instance, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode pidfile: %w", err)
+	}
+	if err := ioutil.WriteFile(a.PIDFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write pidfile: %w", err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		slog.Info("shutting down", "signal", sig.String())
+		a.saveState()
+		os.Remove(a.PIDFile)
+		os.Exit(0)
+	}()
+	return nil
+}
+
+// runDaemonCommand implements `dimandocs start|stop|status|restart`. args are
+// passed on to the server started in the background.
+func runDaemonCommand(command string, args []string) error {
+	pidFile, err := filepath.Abs(pidFileName)
+	if err != nil {
+		return fmt.Errorf("failed to resolve pidfile: %w", err)
+	}
+
+	switch command {
+	case "start":
+		return startDaemon(pidFile, args)
+	case "stop":
+		return stopDaemon(pidFile)
+	case "status":
+		return daemonStatus(pidFile)
+	case "restart":
+		if readInstanceFile(pidFile) != nil {
+			if err := stopDaemon(pidFile); err != nil {
+				return err
+			}
+		}
+		return startDaemon(pidFile, args)
+	}
+	return fmt.Errorf("unknown command '%s'", command)
+}
+
+// startDaemon starts the server in the background, logging to daemonLogName,
+// and waits until it is listening
+func startDaemon(pidFile string, args []string) error {
+	if info := readInstanceFile(pidFile); info != nil {
+		return fmt.Errorf("already running (PID %d) at %s", info.PID, info.URL())
+	}
+	os.Remove(pidFile)
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+	logFile, err := os.OpenFile(daemonLogName, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer logFile.Close()
+
+	cmdArgs := append([]string{"--serve", "--pid-file", pidFile}, args...)
+	cmd := exec.Command(executable, cmdArgs...)
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detachProcess(cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start server: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	deadline := time.After(daemonStartTimeout)
+	for {
+		select {
+		case err := <-exited:
+			return fmt.Errorf("server exited during startup (%v), see %s", err, daemonLogName)
+		case <-deadline:
+			return fmt.Errorf("server did not start within %s, see %s", daemonStartTimeout, daemonLogName)
+		case <-time.After(100 * time.Millisecond):
+		}
+		if info := readInstanceFile(pidFile); info != nil && info.PID == cmd.Process.Pid {
+			fmt.Printf("DimanDocs started (PID %d) at %s\n", info.PID, info.URL())
+			fmt.Printf("Logs: %s\n", daemonLogName)
+			return nil
+		}
+	}
+}
+
+// stopDaemon stops the background server and waits for it to exit
+func stopDaemon(pidFile string) error {
+	info := readInstanceFile(pidFile)
+	if info == nil {
+		os.Remove(pidFile)
+		return fmt.Errorf("not running")
+	}
+	if err := stopProcess(info.PID); err != nil {
+		return fmt.Errorf("failed to stop PID %d: %w", info.PID, err)
+	}
+
+	deadline := time.Now().Add(daemonStopTimeout)
+	for processRunning(info.PID) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("PID %d did not exit within %s", info.PID, daemonStopTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	os.Remove(pidFile)
+	fmt.Printf("DimanDocs stopped (PID %d)\n", info.PID)
+	return nil
+}
+
+// daemonStatus prints whether the background server is running
+func daemonStatus(pidFile string) error {
+	info := readInstanceFile(pidFile)
+	if info == nil {
+		fmt.Println("DimanDocs is not running")
+		return nil
+	}
+	fmt.Printf("DimanDocs is running (PID %d) at %s\n", info.PID, info.URL())
+	fmt.Printf("Working directory: %s\n", info.WorkingDir)
+	fmt.Printf("Uptime: %s\n", time.Since(info.Started).Round(time.Second))
+	return nil
+}
+
+// handOff opens targetPath in a server already running for the same working
+// directory and config instead of starting another one. Running servers are
+// found through the pidfile of `dimandocs start`, or by probing /api/ping on
+// the ports following the configured one. It reports whether it handed off.
+func handOff(a *App, configFile, targetPath string) bool {
+	info := runningInstance(a, configFile, pidFileName)
+	if info == nil {
+		return false
+	}
+
+	pageURL := info.URL()
+	if targetPath != "" {
+		absPath, err := filepath.Abs(targetPath)
+		if err != nil {
+			return false
+		}
+		docURL, err := locateDocument(info, absPath)
+		if err != nil {
+			slog.Debug("running instance cannot open file", "path", absPath, "error", err)
+			return false
+		}
+		pageURL += docURL
+	}
+
+	fmt.Printf("DimanDocs is already running (PID %d), opening %s\n", info.PID, pageURL)
+	if err := openBrowser(pageURL); err != nil {
+		slog.Warn("could not open browser automatically", "error", err)
+		fmt.Printf("Please open your browser manually to: %s\n", pageURL)
+	}
+	return true
+}
+
+// runningInstance returns the server running for the current working
+// directory and configFile: the one in pidFile, or else the first one found
+// by probing the ports it would listen on
+func runningInstance(a *App, configFile, pidFile string) *InstanceInfo {
+	// Load the config (without scanning) to know the port and config file
+	probe := NewApp()
+	probe.Overrides = a.Overrides
+	if err := probe.LoadConfig(configFile, ""); err != nil {
+		return nil
+	}
+	workingDir, err := GetWorkingDirectory()
+	if err != nil {
+		return nil
+	}
+	if info := readInstanceFile(pidFile); info != nil && info.serves(workingDir, probe.ConfigFile) {
+		return info
+	}
+	return findRunningInstance(probe, workingDir)
+}
+
+// serves reports whether the instance runs for a working directory and
+// config file
+func (info *InstanceInfo) serves(workingDir, configFile string) bool {
+	return info.WorkingDir == workingDir && info.ConfigFile == configFile
+}
+
+// findRunningInstance probes the ports the server of probe's config would
+// listen on and returns the first one serving the same working directory
+// and config
+func findRunningInstance(probe *App, workingDir string) *InstanceInfo {
+	port := probe.desiredPort()
+	client := http.Client{Timeout: 500 * time.Millisecond}
+	for p := port; p < port+instanceProbePorts; p++ {
+		resp, err := client.Get(fmt.Sprintf("http://localhost:%d%s/api/ping", p, probe.Config.BasePath))
+		if err != nil {
+			continue
+		}
+		var info InstanceInfo
+		err = json.NewDecoder(resp.Body).Decode(&info)
+		resp.Body.Close()
+		if err != nil || info.App != instanceApp {
+			continue
+		}
+		if info.serves(workingDir, probe.ConfigFile) {
+			return &info
+		}
+	}
+	return nil
+}
+
+// locateDocument asks a running instance for the URL of a document. A
+// directory is located as the instance's index page.
+func locateDocument(info *InstanceInfo, absPath string) (string, error) {
+	client := http.Client{Timeout: 2 * time.Second}
+	resp, err := client.Get(info.URL() + "/api/locate?path=" + url.QueryEscape(absPath))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var result struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.URL, nil
+}
+
+// handlePing identifies this server to other invocations. Requests from
+// other machines only get the app, version and base path, not where it runs.
+func (a *App) handlePing(w http.ResponseWriter, r *http.Request) {
+	if !isLocalRequest(r) {
+		writeJSON(w, http.StatusOK, map[string]string{"app": a.Instance.App, "version": a.Instance.Version, "base_path": a.Instance.BasePath})
+		return
+	}
+	writeJSON(w, http.StatusOK, a.Instance)
+}
+
+// handleLocate returns the URL of the document at an absolute path, so other
+// invocations can open it in this instance (see withLocalOrAdmin). Paths of
+// documents the request can't read get the same answer as missing ones.
+func (a *App) handleLocate(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "Missing path", http.StatusBadRequest)
+		return
+	}
+	target := filepath.Clean(path)
+	access := a.access(r)
+
+	for _, dir := range a.Config.Directories {
+		if absDir, err := filepath.Abs(dir.Path); err == nil && samePath(absDir, target) && access.CanReadSource(dir.Name) {
+			writeJSON(w, http.StatusOK, map[string]string{"url": "/"})
+			return
+		}
+	}
+	if doc := a.findFile(target); doc != nil && access.CanRead(doc) {
+		writeJSON(w, http.StatusOK, map[string]string{"url": docURL(doc.RelPath)})
+		return
+	}
+	http.Error(w, "Not found", http.StatusNotFound)
+}
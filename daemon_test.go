@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func locate(a *App, path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/api/locate?path="+url.QueryEscape(path), nil)
+	r.RemoteAddr = "127.0.0.1:40000"
+	r.Host = "localhost:8090"
+	w := httptest.NewRecorder()
+	a.withLocalOrAdmin(a.handleLocate)(w, r)
+	return w
+}
+
+func TestLocate(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+	docPath, err := filepath.Abs(a.Documents[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	docsDir, err := filepath.Abs(a.Config.Directories[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w := locate(a, docPath); w.Code != http.StatusOK {
+		t.Errorf("document: got %d %q", w.Code, w.Body)
+	}
+	if w := locate(a, docsDir); w.Code != http.StatusOK {
+		t.Errorf("directory: got %d %q", w.Code, w.Body)
+	}
+
+	// Missing files, other directories and documents the request can't read
+	// all get the same answer
+	missing := locate(a, filepath.Join(docsDir, "missing.md"))
+	other := locate(a, a.WorkingDir)
+	a.Config.Directories[0].Allow = []string{"alice"}
+	restricted := locate(a, docPath)
+	restrictedDir := locate(a, docsDir)
+	for name, w := range map[string]*httptest.ResponseRecorder{
+		"missing": missing, "other directory": other, "restricted": restricted, "restricted directory": restrictedDir,
+	} {
+		if w.Code != http.StatusNotFound || w.Body.String() != missing.Body.String() {
+			t.Errorf("%s: got %d %q, want %d %q", name, w.Code, w.Body, http.StatusNotFound, missing.Body)
+		}
+	}
+}
+
+func TestLocateRemote(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+	r := httptest.NewRequest(http.MethodGet, "/api/locate?path="+url.QueryEscape(a.Documents[0].Path), nil)
+	r.RemoteAddr = "192.0.2.1:40000"
+	w := httptest.NewRecorder()
+	a.withLocalOrAdmin(a.handleLocate)(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got %d %q, want %d", w.Code, w.Body, http.StatusForbidden)
+	}
+}
+
+func TestPing(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+	a.Instance = InstanceInfo{App: instanceApp, Version: Version, PID: 42, Port: 8090, WorkingDir: a.WorkingDir, ConfigFile: a.ConfigFile}
+	for _, tc := range []struct {
+		name       string
+		remoteAddr string
+		host       string
+		want       []string
+		hidden     []string
+	}{
+		{"local", "127.0.0.1:40000", "localhost:8090", []string{"pid", "working_dir", "config_file"}, nil},
+		{"remote", "192.0.2.1:40000", "docs.example.com", []string{"app", "version", "base_path"}, []string{"pid", "working_dir", "config_file", "port"}},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+		r.RemoteAddr, r.Host = tc.remoteAddr, tc.host
+		w := httptest.NewRecorder()
+		a.handlePing(w, r)
+		var got map[string]interface{}
+		if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		for _, key := range tc.want {
+			if _, ok := got[key]; !ok {
+				t.Errorf("%s: no %s in %v", tc.name, key, got)
+			}
+		}
+		for _, key := range tc.hidden {
+			if _, ok := got[key]; ok {
+				t.Errorf("%s: %s in %v", tc.name, key, got)
+			}
+		}
+	}
+}
+
+func TestRunningInstanceChecksPidfile(t *testing.T) {
+	// A port nothing listens on, so only the pidfile can find an instance
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "dimandocs.json")
+	config := fmt.Sprintf(`{"port": "%d", "directories": [{"path": %q, "name": "Docs"}]}`, port, dir)
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workingDir, err := GetWorkingDirectory()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pidFile := filepath.Join(dir, ".dimandocs.pid")
+	writePid := func(workingDir, configFile string) {
+		data, err := json.Marshal(InstanceInfo{App: instanceApp, PID: os.Getpid(), Port: port, WorkingDir: workingDir, ConfigFile: configFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(pidFile, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writePid(workingDir, configFile)
+	if info := runningInstance(NewApp(), configFile, pidFile); info == nil {
+		t.Error("matching pidfile instance not found")
+	}
+
+	writePid(dir, configFile)
+	if info := runningInstance(NewApp(), configFile, pidFile); info != nil {
+		t.Errorf("instance of another working directory used: %+v", info)
+	}
+
+	writePid(workingDir, filepath.Join(dir, "other.json"))
+	if info := runningInstance(NewApp(), configFile, pidFile); info != nil {
+		t.Errorf("instance of another config file used: %+v", info)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// detachProcess makes cmd run in its own session, so it survives the
+// terminal that started it
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+}
+
+// processRunning reports whether a process with the given PID exists
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
+
+// stopProcess asks a process to terminate
+func stopProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
@@ -0,0 +1,46 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+const (
+	createNewProcessGroup = 0x00000200
+	detachedProcess       = 0x00000008
+	processQueryLimited   = 0x1000
+	stillActive           = 259
+)
+
+// detachProcess makes cmd run without a console, so it survives the
+// terminal that started it
+func detachProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: createNewProcessGroup | detachedProcess}
+}
+
+// processRunning reports whether a process with the given PID exists
+func processRunning(pid int) bool {
+	handle, err := syscall.OpenProcess(processQueryLimited, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer syscall.CloseHandle(handle)
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return false
+	}
+	return code == stillActive
+}
+
+// stopProcess terminates a process. Windows has no SIGTERM, so the pidfile
+// is left for the caller to remove.
+func stopProcess(pid int) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return process.Kill()
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Kinds of diagrams, named as Kroki names them
+const (
+	diagramPlantUML = "plantuml"
+	diagramGraphviz = "graphviz"
+)
+
+// diagramLanguages maps the languages of diagram code blocks to their kind
+var diagramLanguages = map[string]string{
+	"plantuml": diagramPlantUML,
+	"puml":     diagramPlantUML,
+	"dot":      diagramGraphviz,
+	"graphviz": diagramGraphviz,
+}
+
+const (
+	// defaultDiagramTimeout is how long a diagram may take to render when
+	// diagrams.timeout is not set
+	defaultDiagramTimeout = 10 * time.Second
+
+	// diagramErrorLimit is the most bytes of a failed command's or
+	// server's output shown with the diagram
+	diagramErrorLimit = 1000
+
+	// diagramCacheSize is the number of rendered diagrams kept in memory
+	diagramCacheSize = 512
+)
+
+// diagramsEnabled reports whether diagram code blocks are rendered
+func diagramsEnabled(config Config) bool {
+	return config.Diagrams.PlantUML != "" || config.Diagrams.Graphviz != "" || config.Diagrams.Server != ""
+}
+
+// diagramsFingerprint identifies how diagrams are rendered, for
+// markdownFingerprint
+func diagramsFingerprint(config DiagramsConfig) string {
+	return config.PlantUML + "|" + config.Graphviz + "|" + config.Server
+}
+
+// diagramRenderer turns the source of diagrams into SVG with the
+// configured commands or Kroki server. Rendered diagrams are cached by a
+// hash of their source, the most recently used ones in memory and all of
+// them in diagrams.cache_dir.
+type diagramRenderer struct {
+	config  DiagramsConfig
+	timeout time.Duration
+	client  *http.Client
+	cache   *RenderCache // SVG by key, which is also its hash
+}
+
+// newDiagramRenderer returns the renderer for the diagrams settings
+func newDiagramRenderer(config DiagramsConfig) *diagramRenderer {
+	timeout := defaultDiagramTimeout
+	if d, err := time.ParseDuration(config.Timeout); err == nil && d > 0 {
+		timeout = d
+	}
+	if config.CacheDir != "" {
+		if err := os.MkdirAll(config.CacheDir, 0755); err != nil {
+			slog.Warn("failed to create diagram cache directory", "dir", config.CacheDir, "error", err)
+			config.CacheDir = ""
+		}
+	}
+	return &diagramRenderer{
+		config:  config,
+		timeout: timeout,
+		client:  &http.Client{Timeout: timeout},
+		cache:   NewRenderCache(diagramCacheSize, ""),
+	}
+}
+
+// command returns the command rendering a kind of diagram, "" if there is
+// none
+func (d *diagramRenderer) command(kind string) string {
+	if kind == diagramPlantUML {
+		return d.config.PlantUML
+	}
+	return d.config.Graphviz
+}
+
+// enabled reports whether a kind of diagram can be rendered
+func (d *diagramRenderer) enabled(kind string) bool {
+	return d.command(kind) != "" || d.config.Server != ""
+}
+
+// render returns the SVG of a diagram, from the cache if it was rendered
+// before
+func (d *diagramRenderer) render(kind, source string) ([]byte, error) {
+	method := d.command(kind)
+	if method == "" {
+		method = d.config.Server
+	}
+	key := contentHash(kind + "\n" + method + "\n" + source)
+
+	if svg, ok := d.cache.Get(key, key); ok {
+		return svg, nil
+	}
+	cachePath := ""
+	if d.config.CacheDir != "" {
+		cachePath = filepath.Join(d.config.CacheDir, key+".svg")
+		if svg, err := os.ReadFile(cachePath); err == nil {
+			d.cache.Put(key, key, svg)
+			return svg, nil
+		}
+	}
+
+	var svg []byte
+	var err error
+	if command := d.command(kind); command != "" {
+		svg, err = d.run(command, source)
+	} else {
+		svg, err = d.fetch(kind, source)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(svg, []byte("<svg")) {
+		return nil, errors.New("the output is not an SVG image")
+	}
+
+	d.cache.Put(key, key, svg)
+	if cachePath != "" {
+		if err := os.WriteFile(cachePath, svg, 0644); err != nil {
+			slog.Warn("failed to write diagram cache", "path", cachePath, "error", err)
+		}
+	}
+	return svg, nil
+}
+
+// run renders a diagram with a command reading its source on stdin and
+// writing SVG to stdout
+func (d *diagramRenderer) run(command, source string) ([]byte, error) {
+	args := strings.Fields(command)
+	ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = strings.NewReader(source)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("%s took longer than %s", args[0], d.timeout)
+	}
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("%s failed: %s", args[0], truncateDiagramError(message))
+	}
+	return out, nil
+}
+
+// fetch renders a diagram with a Kroki server
+func (d *diagramRenderer) fetch(kind, source string) ([]byte, error) {
+	endpoint := strings.TrimRight(d.config.Server, "/") + "/" + kind + "/svg"
+	resp, err := d.client.Post(endpoint, "text/plain; charset=utf-8", strings.NewReader(source))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %s: %s", endpoint, resp.Status, truncateDiagramError(strings.TrimSpace(string(body))))
+	}
+	return body, nil
+}
+
+// truncateDiagramError shortens the output of a failed rendering
+func truncateDiagramError(message string) string {
+	if len(message) > diagramErrorLimit {
+		return message[:diagramErrorLimit] + "..."
+	}
+	return message
+}
+
+// checkDiagrams validates the diagrams settings
+func (v *configValidator) checkDiagrams(config DiagramsConfig) {
+	if config.Server != "" {
+		if u, err := url.Parse(config.Server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("diagrams.server", "invalid URL %q (use the address of a Kroki server, e.g. \"https://kroki.io\")", config.Server)
+		}
+	}
+	if config.Timeout != "" {
+		if d, err := time.ParseDuration(config.Timeout); err != nil || d <= 0 {
+			v.add("diagrams.timeout", "invalid duration %q (use e.g. \"10s\")", config.Timeout)
+		}
+	}
+}
+
+// KindDiagram is the node kind of diagram code blocks
+var KindDiagram = ast.NewNodeKind("Diagram")
+
+// Diagram is a ```plantuml or ```dot code block, rendered as an image
+type Diagram struct {
+	ast.BaseBlock
+	Language    string // as written after the fence
+	DiagramKind string
+	Source      string
+}
+
+// Kind implements ast.Node
+func (n *Diagram) Kind() ast.NodeKind {
+	return KindDiagram
+}
+
+// IsRaw implements ast.Node; the content is not parsed as markdown
+func (n *Diagram) IsRaw() bool {
+	return true
+}
+
+// Dump implements ast.Node
+func (n *Diagram) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Language": n.Language}, nil)
+}
+
+// diagramTransformer replaces the fenced code blocks of diagrams that can
+// be rendered with Diagram nodes
+type diagramTransformer struct {
+	renderer *diagramRenderer
+}
+
+// Transform implements parser.ASTTransformer
+func (t *diagramTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var blocks []*ast.FencedCodeBlock
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if block, ok := n.(*ast.FencedCodeBlock); ok && entering {
+			if kind, ok := diagramLanguages[strings.ToLower(string(block.Language(source)))]; ok && t.renderer.enabled(kind) {
+				blocks = append(blocks, block)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, block := range blocks {
+		language := string(block.Language(source))
+		var b strings.Builder
+		lines := block.Lines()
+		for i := 0; i < lines.Len(); i++ {
+			line := lines.At(i)
+			b.Write(line.Value(source))
+		}
+		diagram := &Diagram{Language: language, DiagramKind: diagramLanguages[strings.ToLower(language)], Source: b.String()}
+		diagram.SetLines(lines)
+		block.Parent().ReplaceChild(block.Parent(), block, diagram)
+	}
+}
+
+// diagramHTMLRenderer renders diagrams as SVG images, or as their source
+// with the error if they cannot be rendered
+type diagramHTMLRenderer struct {
+	renderer *diagramRenderer
+}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *diagramHTMLRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindDiagram, r.render)
+}
+
+func (r *diagramHTMLRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	diagram := node.(*Diagram)
+	svg, err := r.renderer.render(diagram.DiagramKind, diagram.Source)
+	if err != nil {
+		slog.Warn("failed to render diagram", "kind", diagram.DiagramKind, "error", err)
+		fmt.Fprintf(w, "<div class=\"admonition admonition-warning\">\n<p class=\"admonition-title\">Diagram not rendered</p>\n<p>%s</p>\n</div>\n", html.EscapeString(err.Error()))
+		fmt.Fprintf(w, "<pre><code class=\"language-%s\">%s</code></pre>\n", html.EscapeString(diagram.Language), html.EscapeString(diagram.Source))
+		return ast.WalkSkipChildren, nil
+	}
+	fmt.Fprintf(w, "<div class=\"diagram\"><img src=\"data:image/svg+xml;base64,%s\" alt=\"%s diagram\" /></div>\n", base64.StdEncoding.EncodeToString(svg), diagram.DiagramKind)
+	return ast.WalkSkipChildren, nil
+}
+
+// diagrams is the goldmark extension rendering diagram code blocks
+type diagrams struct {
+	renderer *diagramRenderer
+}
+
+// Extend implements goldmark.Extender
+func (e *diagrams) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&diagramTransformer{renderer: e.renderer}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&diagramHTMLRenderer{renderer: e.renderer}, 100)))
+}
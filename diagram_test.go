@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDiagramCacheIsBounded(t *testing.T) {
+	d := newDiagramRenderer(DiagramsConfig{Graphviz: "cat"})
+	for i := 0; i < diagramCacheSize+10; i++ {
+		source := fmt.Sprintf("<svg>%d</svg>", i)
+		svg, err := d.render(diagramGraphviz, source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(svg) != source {
+			t.Fatalf("got %q, want %q", svg, source)
+		}
+	}
+	if n := d.cache.Len(); n != diagramCacheSize {
+		t.Errorf("%d diagrams in memory, want %d", n, diagramCacheSize)
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// diffContextLines is how many unchanged lines are shown around changes
+	diffContextLines = 3
+
+	// diffMaxCells bounds the table of the line diff (lines changed on the
+	// left times lines changed on the right); larger changes are shown as
+	// every line replaced
+	diffMaxCells = 4000000
+)
+
+// DiffLine is a line of a diff
+type DiffLine struct {
+	Kind    string // "same", "add" or "del"
+	OldLine int    // line number on the left, 0 for added lines
+	NewLine int    // line number on the right, 0 for removed lines
+	Text    string
+}
+
+// DiffRow is a row of the side-by-side view: a line removed on the left
+// next to the line added in its place on the right. Either is nil when
+// there is nothing to show on that side.
+type DiffRow struct {
+	Left  *DiffLine
+	Right *DiffLine
+}
+
+// DiffHunk is a run of changes with the unchanged lines around them
+type DiffHunk struct {
+	Skipped int        // unchanged lines left out before the hunk
+	Lines   []DiffLine // for the inline view
+	Rows    []DiffRow  // for the side-by-side view
+}
+
+// DiffSide is one of the two texts compared
+type DiffSide struct {
+	Path  string
+	Title string
+	Label string // e.g. "working copy" or "last commit a1b2c3d, 2026-03-01"
+}
+
+// DiffPage is the data of the /diff page
+type DiffPage struct {
+	Title     string
+	A, B      string // the paths compared, as requested
+	View      string // "split" or "inline"
+	Documents []DocumentLink
+	Left      *DiffSide
+	Right     *DiffSide
+	Hunks     []DiffHunk
+	Trailing  int // unchanged lines left out after the last hunk
+	Added     int
+	Removed   int
+	Error     string
+}
+
+// diffLines compares two texts line by line
+func diffLines(oldText, newText string) []DiffLine {
+	oldLines, newLines := splitLines(oldText), splitLines(newText)
+
+	// Lines are compared by number rather than by text
+	ids := make(map[string]int)
+	number := func(lines []string) []int {
+		out := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			out[i] = id
+		}
+		return out
+	}
+	a, b := number(oldLines), number(newLines)
+
+	// The common beginning and end are left out of the table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var out []DiffLine
+	same := func(i, j int) {
+		out = append(out, DiffLine{Kind: "same", OldLine: i + 1, NewLine: j + 1, Text: oldLines[i]})
+	}
+	for i := 0; i < prefix; i++ {
+		same(i, i)
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	n, m := len(midA), len(midB)
+	if n*m > diffMaxCells {
+		for i := 0; i < n; i++ {
+			out = append(out, DiffLine{Kind: "del", OldLine: prefix + i + 1, Text: oldLines[prefix+i]})
+		}
+		for j := 0; j < m; j++ {
+			out = append(out, DiffLine{Kind: "add", NewLine: prefix + j + 1, Text: newLines[prefix+j]})
+		}
+	} else {
+		// lcs[i][j] is the length of the longest common subsequence of
+		// midA[i:] and midB[j:]
+		lcs := make([][]int32, n+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, m+1)
+		}
+		for i := n - 1; i >= 0; i-- {
+			for j := m - 1; j >= 0; j-- {
+				if midA[i] == midB[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		i, j := 0, 0
+		for i < n || j < m {
+			switch {
+			case i < n && j < m && midA[i] == midB[j]:
+				same(prefix+i, prefix+j)
+				i++
+				j++
+			case j < m && (i == n || lcs[i][j+1] > lcs[i+1][j]):
+				out = append(out, DiffLine{Kind: "add", NewLine: prefix + j + 1, Text: newLines[prefix+j]})
+				j++
+			default:
+				out = append(out, DiffLine{Kind: "del", OldLine: prefix + i + 1, Text: oldLines[prefix+i]})
+				i++
+			}
+		}
+	}
+
+	for k := suffix; k > 0; k-- {
+		same(len(a)-k, len(b)-k)
+	}
+	return out
+}
+
+// splitLines splits a text into lines without their line endings
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// diffHunks groups the changed lines of a diff with diffContextLines of
+// unchanged lines around them. It returns the unchanged lines left out
+// after the last hunk.
+func diffHunks(lines []DiffLine) (hunks []DiffHunk, trailing int) {
+	last := 0 // end of the previous hunk
+	for i := 0; i < len(lines); {
+		if lines[i].Kind == "same" {
+			i++
+			continue
+		}
+		start := max(i-diffContextLines, last)
+		end := i
+		for end < len(lines) {
+			if lines[end].Kind != "same" {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Kind == "same" {
+				run++
+			}
+			if run == len(lines) || run-end > 2*diffContextLines {
+				end = min(end+diffContextLines, len(lines))
+				break
+			}
+			end = run
+		}
+		hunks = append(hunks, DiffHunk{Skipped: start - last, Lines: lines[start:end], Rows: diffRows(lines[start:end])})
+		last, i = end, end
+	}
+	return hunks, len(lines) - last
+}
+
+// diffRows lays out lines side by side, pairing each run of removed lines
+// with the run of added lines that follows it
+func diffRows(lines []DiffLine) []DiffRow {
+	var rows []DiffRow
+	for i := 0; i < len(lines); {
+		if lines[i].Kind == "same" {
+			rows = append(rows, DiffRow{Left: &lines[i], Right: &lines[i]})
+			i++
+			continue
+		}
+		var removed, added []*DiffLine
+		for ; i < len(lines) && lines[i].Kind == "del"; i++ {
+			removed = append(removed, &lines[i])
+		}
+		for ; i < len(lines) && lines[i].Kind == "add"; i++ {
+			added = append(added, &lines[i])
+		}
+		for k := 0; k < max(len(removed), len(added)); k++ {
+			var row DiffRow
+			if k < len(removed) {
+				row.Left = removed[k]
+			}
+			if k < len(added) {
+				row.Right = added[k]
+			}
+			rows = append(rows, row)
+		}
+	}
+	return rows
+}
+
+// committedContent returns a file as it is in the last commit of its git
+// repository, with a description of the commit
+func committedContent(path string) (content, commit string, err error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", "", fmt.Errorf("git is not installed")
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return "", "", err
+	}
+	out, err := exec.Command("git", "-C", filepath.Dir(abs), "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", "", fmt.Errorf("the document is not in a git repository")
+	}
+	top := strings.TrimSpace(string(out))
+	rel, err := filepath.Rel(top, abs)
+	if err != nil {
+		return "", "", err
+	}
+	rel = filepath.ToSlash(rel)
+
+	out, err = exec.Command("git", "-C", top, "log", "-1", "--format=%h, %cs", "--", rel).Output()
+	if err != nil || len(strings.TrimSpace(string(out))) == 0 {
+		return "", "", fmt.Errorf("the document has not been committed to git")
+	}
+	commit = strings.TrimSpace(string(out))
+	show, err := exec.Command("git", "-C", top, "show", "HEAD:"+rel).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("the document is not in the last commit")
+	}
+	return string(show), commit, nil
+}
+
+// handleDiff compares two documents (?a=&b=), or a document with its last
+// git commit (?a= alone), line by line; ?view=inline shows the changes one
+// under the other instead of side by side
+func (a *App) handleDiff(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := a.parseTemplates("templates/diff.html")
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	query := r.URL.Query()
+	page := DiffPage{Title: a.Config.Title, A: query.Get("a"), B: query.Get("b"), View: "split"}
+	if query.Get("view") == "inline" {
+		page.View = "inline"
+	}
+	access := a.access(r)
+	for i := range a.Documents {
+		if doc := &a.Documents[i]; access.CanRead(doc) {
+			page.Documents = append(page.Documents, DocumentLink{Path: doc.RelPath, Title: doc.Title})
+		}
+	}
+	sort.Slice(page.Documents, func(i, j int) bool { return page.Documents[i].Path < page.Documents[j].Path })
+
+	if page.A == "" {
+		servePage(w, r, tmpl, page)
+		return
+	}
+	docA := a.readableDocument(r, page.A)
+	var docB *Document
+	if page.B != "" {
+		docB = a.readableDocument(r, page.B)
+	}
+	if docA == nil || (page.B != "" && docB == nil) {
+		a.notFound(w, r)
+		return
+	}
+
+	oldText, newText, err := a.diffTexts(&page, docA, docB)
+	if err != nil {
+		page.Error = err.Error()
+		servePage(w, r, tmpl, page)
+		return
+	}
+	lines := diffLines(oldText, newText)
+	for _, line := range lines {
+		switch line.Kind {
+		case "add":
+			page.Added++
+		case "del":
+			page.Removed++
+		}
+	}
+	page.Hunks, page.Trailing = diffHunks(lines)
+	servePage(w, r, tmpl, page)
+}
+
+// diffTexts reads the two texts compared: docA and docB, or the last
+// commit of docA and its working copy when docB is nil
+func (a *App) diffTexts(page *DiffPage, docA, docB *Document) (oldText, newText string, err error) {
+	current, err := a.readDocumentContent(docA)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read %s: %v", docA.RelPath, err)
+	}
+	if docB == nil {
+		page.Left = &DiffSide{Path: docA.RelPath, Title: docA.Title}
+		page.Right = &DiffSide{Path: docA.RelPath, Title: docA.Title, Label: "working copy"}
+		committed, commit, err := committedContent(docA.Path)
+		if err != nil {
+			return "", "", err
+		}
+		page.Left.Label = "last commit " + commit
+		return committed, current, nil
+	}
+
+	other, err := a.readDocumentContent(docB)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read %s: %v", docB.RelPath, err)
+	}
+	page.Left = &DiffSide{Path: docA.RelPath, Title: docA.Title}
+	page.Right = &DiffSide{Path: docB.RelPath, Title: docB.Title}
+	return current, other, nil
+}
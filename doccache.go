@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// legacyCacheFileName is where the document cache used to be written, in
+// the current directory. It is no longer read; `cache clear` removes it.
+const legacyCacheFileName = ".dimandocs-cache.json"
+
+// Document cache formats (cache_format). JSON is readable; gob is a compact
+// binary format that is read and written one document at a time, which
+// matters for tens of thousands of documents.
+const (
+	cacheFormatJSON = "json"
+	cacheFormatGob  = "gob"
+)
+
+var cacheFormats = []string{cacheFormatJSON, cacheFormatGob}
+
+// cacheFormat returns the configured cache format
+func (a *App) cacheFormat() string {
+	if a.Config.CacheFormat == "" {
+		return cacheFormatJSON
+	}
+	return a.Config.CacheFormat
+}
+
+// cacheFile returns the path of the document cache (--cache) in the user's
+// cache directory, e.g. ~/.cache/dimandocs/<key>.json. The key is a hash of
+// the working directory, the config file and the configured directories, so
+// each setup gets its own file. Falls back to the current directory when
+// the OS has no cache directory.
+func (a *App) cacheFile() string {
+	return a.cachePath(a.cacheFormat())
+}
+
+// cachePath returns the path of the document cache in the given format
+func (a *App) cachePath(format string) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", a.WorkingDir, a.ConfigFile)
+	for _, dir := range a.Config.Directories {
+		fmt.Fprintf(h, "%s\n", dir.Path)
+	}
+	name := hex.EncodeToString(h.Sum(nil))[:16] + "." + format
+
+	base, err := os.UserCacheDir()
+	if err != nil {
+		if format == cacheFormatJSON {
+			return legacyCacheFileName
+		}
+		return ".dimandocs-cache." + format
+	}
+	return filepath.Join(base, "dimandocs", name)
+}
+
+// readCache reads the document cache in the configured format
+func (a *App) readCache() (CacheData, error) {
+	return readCacheFile(a.cacheFile(), a.cacheFormat())
+}
+
+// writeCache writes the document cache in the configured format
+func (a *App) writeCache(cache CacheData) error {
+	path := a.cacheFile()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return writeCacheFile(path, a.cacheFormat(), cache)
+}
+
+// maxCachedDocuments bounds the document count of a gob cache header; a
+// larger one means the file is corrupt, and the directories are scanned
+const maxCachedDocuments = 10000000
+
+// gobCacheHeader precedes the documents in a gob cache file
+type gobCacheHeader struct {
+	Version     string
+	Fingerprint string
+	Documents   int
+}
+
+// readCacheFile reads a cache file written by writeCacheFile
+func readCacheFile(path, format string) (CacheData, error) {
+	var cache CacheData
+	f, err := os.Open(path)
+	if err != nil {
+		return cache, fmt.Errorf("failed to read cache file: %w", err)
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	if format != cacheFormatGob {
+		if err := json.NewDecoder(r).Decode(&cache); err != nil {
+			return cache, fmt.Errorf("failed to parse cache file: %w", err)
+		}
+		return cache, nil
+	}
+
+	dec := gob.NewDecoder(r)
+	var header gobCacheHeader
+	if err := dec.Decode(&header); err != nil {
+		return cache, fmt.Errorf("failed to parse cache file: %w", err)
+	}
+	if header.Documents < 0 || header.Documents > maxCachedDocuments {
+		return cache, fmt.Errorf("failed to parse cache file: invalid document count %d", header.Documents)
+	}
+	cache.Version, cache.Fingerprint = header.Version, header.Fingerprint
+	// The count is only trusted so far: a truncated file fails to decode
+	// before a large one is allocated
+	cache.Documents = make([]CachedDocument, 0, min(header.Documents, 4096))
+	for i := 0; i < header.Documents; i++ {
+		var doc CachedDocument
+		if err := dec.Decode(&doc); err != nil {
+			return cache, fmt.Errorf("failed to parse cache file: document %d: %w", i, err)
+		}
+		cache.Documents = append(cache.Documents, doc)
+	}
+	return cache, nil
+}
+
+// writeCacheFile writes cache to a temporary file renamed over path, so an
+// interrupted write never leaves a truncated cache behind
+func writeCacheFile(path, format string, cache CacheData) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	if format == cacheFormatGob {
+		enc := gob.NewEncoder(w)
+		err = enc.Encode(gobCacheHeader{Version: cache.Version, Fingerprint: cache.Fingerprint, Documents: len(cache.Documents)})
+		for i := 0; err == nil && i < len(cache.Documents); i++ {
+			err = enc.Encode(&cache.Documents[i])
+		}
+	} else {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(cache)
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
+
+// cacheSchema is part of the cache fingerprint; it changes when documents
+// gain fields that caches written before lack
+const cacheSchema = 3
+
+// cacheFingerprint identifies the settings that decide which documents are
+// found and what is stored about them, plus the dimandocs version. A cache
+// written with a different fingerprint is ignored and rebuilt.
+func (a *App) cacheFingerprint() string {
+	data, _ := json.Marshal(struct {
+		Schema             int
+		Version            string
+		Directories        []DirectoryConfig
+		IgnorePatterns     []string
+		RespectGitignore   bool
+		FollowSymlinks     bool
+		MaxFileSize        int64
+		TruncateLargeFiles bool
+		Overview           OverviewConfig
+		Variables          string
+	}{
+		Schema:             cacheSchema,
+		Version:            Version,
+		Directories:        a.Config.Directories,
+		IgnorePatterns:     a.Config.IgnorePatterns,
+		RespectGitignore:   a.Config.RespectGitignore == nil || *a.Config.RespectGitignore,
+		FollowSymlinks:     a.Config.FollowSymlinks,
+		MaxFileSize:        a.Config.MaxFileSize,
+		TruncateLargeFiles: a.Config.TruncateLargeFiles,
+		Overview:           a.Config.Overview,
+		Variables:          variablesFingerprint(a.Config.Variables),
+	})
+	return contentHash(string(data))
+}
+
+// CacheStatus describes the document cache for `dimandocs cache status`
+type CacheStatus struct {
+	Path      string    `json:"path"`
+	Format    string    `json:"format"`
+	Exists    bool      `json:"exists"`
+	Modified  time.Time `json:"modified,omitempty"`
+	Size      int64     `json:"size,omitempty"`
+	Documents int       `json:"documents,omitempty"`
+	Version   string    `json:"version,omitempty"` // version of dimandocs that wrote it
+	Stale     bool      `json:"stale,omitempty"`   // written with another configuration or version
+	Error     string    `json:"error,omitempty"`   // why the cache cannot be used
+}
+
+// cacheStatus reads the document cache without loading it
+func (a *App) cacheStatus() CacheStatus {
+	status := CacheStatus{Path: a.cacheFile(), Format: a.cacheFormat()}
+	info, err := os.Stat(status.Path)
+	if err != nil {
+		return status
+	}
+	status.Exists = true
+	status.Modified = info.ModTime()
+	status.Size = info.Size()
+
+	cache, err := a.readCache()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.Documents = len(cache.Documents)
+	status.Version = cache.Version
+	status.Stale = cache.Fingerprint != a.cacheFingerprint()
+	return status
+}
+
+// runCacheCommand implements `dimandocs cache status|clear|rebuild|path`
+func runCacheCommand(args []string) error {
+	action := "status"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+	fs := flag.NewFlagSet("cache "+action, flag.ExitOnError)
+	configFile := fs.String("config-file", os.Getenv("DIMANDOCS_CONFIG_FILE"), "Path to configuration file (default: dimandocs.json if exists)")
+	format := fs.String("format", "text", "Output format of status: text or json")
+	fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid format '%s' (use text or json)", *format)
+	}
+
+	a := NewApp()
+	workingDir, err := GetWorkingDirectory()
+	if err != nil {
+		return err
+	}
+	a.WorkingDir = workingDir
+	if err := a.LoadConfig(*configFile, fs.Arg(0)); err != nil {
+		return err
+	}
+
+	switch action {
+	case "path":
+		fmt.Println(a.cacheFile())
+	case "status":
+		status := a.cacheStatus()
+		if *format == "json" {
+			return printJSON(status)
+		}
+		fmt.Printf("Cache file: %s\n", status.Path)
+		if !status.Exists {
+			fmt.Println("Status:     not created yet (run the server with --cache, or dimandocs cache rebuild)")
+			return nil
+		}
+		fmt.Printf("Modified:   %s (%s ago)\n", status.Modified.Format(time.RFC3339), time.Since(status.Modified).Round(time.Second))
+		fmt.Printf("Size:       %s (%s)\n", formatSize(status.Size), status.Format)
+		if status.Error != "" {
+			fmt.Printf("Status:     unreadable, will be rebuilt (%s)\n", status.Error)
+			return nil
+		}
+		fmt.Printf("Documents:  %d\n", status.Documents)
+		fmt.Printf("Version:    %s\n", status.Version)
+		if status.Stale {
+			fmt.Println("Status:     stale, will be rebuilt (written with a different configuration or version)")
+		} else {
+			fmt.Println("Status:     up to date")
+		}
+	case "clear":
+		removed := false
+		paths := []string{legacyCacheFileName}
+		for _, format := range cacheFormats {
+			paths = append(paths, a.cachePath(format))
+		}
+		for _, path := range paths {
+			if err := os.Remove(path); err == nil {
+				fmt.Printf("Removed %s\n", path)
+				removed = true
+			} else if !os.IsNotExist(err) {
+				return err
+			}
+		}
+		if !removed {
+			fmt.Println("No cache to remove")
+		}
+	case "rebuild":
+		a.Markdown = newMarkdownRenderer(a.Config, a.resolveWikiLink)
+		if err := a.ScanDirectories(); err != nil {
+			return err
+		}
+		if err := a.saveToCache(); err != nil {
+			return err
+		}
+		fmt.Printf("Cached %d documents in %s\n", len(a.allDocuments()), a.cacheFile())
+	default:
+		return fmt.Errorf("unknown action '%s' (use status, clear, rebuild or path)", action)
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/gob"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testCache returns a cache of n documents like those of a scan
+func testCache(n int) CacheData {
+	cache := CacheData{Version: Version, Fingerprint: "test"}
+	for i := 0; i < n; i++ {
+		rel := fmt.Sprintf("section-%d/document-%d.md", i%50, i)
+		cache.Documents = append(cache.Documents, CachedDocument{
+			Title:      fmt.Sprintf("Document %d", i),
+			Path:       "docs/" + rel,
+			RelPath:    rel,
+			DirName:    fmt.Sprintf("section-%d", i%50),
+			SourceDir:  "docs",
+			SourceName: "Docs",
+			AbsPath:    "/srv/docs/" + rel,
+			Overview:   strings.Repeat("An overview of the document. ", 6),
+			Size:       int64(2000 + i),
+			Tags:       []string{"guide", "ops"},
+			Tasks:      TaskProgress{Total: 4, Done: i % 5},
+			Words:      300 + i%700,
+		})
+	}
+	return cache
+}
+
+func TestCacheFileRoundTrip(t *testing.T) {
+	cache := testCache(10)
+	for _, format := range cacheFormats {
+		path := filepath.Join(t.TempDir(), "cache."+format)
+		if err := writeCacheFile(path, format, cache); err != nil {
+			t.Fatalf("%s: write: %v", format, err)
+		}
+		read, err := readCacheFile(path, format)
+		if err != nil {
+			t.Fatalf("%s: read: %v", format, err)
+		}
+		if len(read.Documents) != len(cache.Documents) || read.Fingerprint != cache.Fingerprint || read.Documents[9].RelPath != cache.Documents[9].RelPath {
+			t.Errorf("%s: read back %d documents, fingerprint %q", format, len(read.Documents), read.Fingerprint)
+		}
+	}
+}
+
+func TestReadCacheFileInvalidCount(t *testing.T) {
+	for _, count := range []int{-1, maxCachedDocuments + 1, 1 << 40} {
+		path := filepath.Join(t.TempDir(), "cache.gob")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := gob.NewEncoder(f).Encode(gobCacheHeader{Version: Version, Documents: count}); err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+		if _, err := readCacheFile(path, cacheFormatGob); err == nil || !strings.Contains(err.Error(), "invalid document count") {
+			t.Errorf("count %d: error = %v, want an invalid document count", count, err)
+		}
+	}
+
+	// A count larger than the documents in the file fails on the first
+	// missing document
+	path := filepath.Join(t.TempDir(), "cache.gob")
+	f, _ := os.Create(path)
+	enc := gob.NewEncoder(f)
+	enc.Encode(gobCacheHeader{Version: Version, Documents: maxCachedDocuments})
+	enc.Encode(&testCache(1).Documents[0])
+	f.Close()
+	if _, err := readCacheFile(path, cacheFormatGob); err == nil || !strings.Contains(err.Error(), "document 1") {
+		t.Errorf("truncated cache: error = %v", err)
+	}
+}
+
+// benchmarkCacheDocuments is the size of the caches benchmarked, a large
+// corpus where the format matters
+const benchmarkCacheDocuments = 20000
+
+func benchmarkCacheWrite(b *testing.B, format string) {
+	cache := testCache(benchmarkCacheDocuments)
+	path := filepath.Join(b.TempDir(), "cache."+format)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := writeCacheFile(path, format, cache); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if info, err := os.Stat(path); err == nil {
+		b.ReportMetric(float64(info.Size()), "file-bytes")
+	}
+}
+
+func benchmarkCacheRead(b *testing.B, format string) {
+	path := filepath.Join(b.TempDir(), "cache."+format)
+	if err := writeCacheFile(path, format, testCache(benchmarkCacheDocuments)); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := readCacheFile(path, format); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkCacheWriteJSON(b *testing.B) { benchmarkCacheWrite(b, cacheFormatJSON) }
+func BenchmarkCacheWriteGob(b *testing.B)  { benchmarkCacheWrite(b, cacheFormatGob) }
+func BenchmarkCacheReadJSON(b *testing.B)  { benchmarkCacheRead(b, cacheFormatJSON) }
+func BenchmarkCacheReadGob(b *testing.B)   { benchmarkCacheRead(b, cacheFormatGob) }
+
+func TestCacheKeepsSlugHashAndModTime(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	a := newTestApp(t, map[string]string{"guide.md": "---\nslug: getting-started\n---\n# Guide\n"})
+	a.Config.SlugURLs = true
+	a.setDocuments(a.Documents)
+	scanned := a.Documents[0]
+	if scanned.Slug != "getting-started" || scanned.Hash == "" || scanned.ModTime.IsZero() {
+		t.Fatalf("scanned slug %q, hash %q, mod time %v", scanned.Slug, scanned.Hash, scanned.ModTime)
+	}
+	for _, format := range cacheFormats {
+		a.Config.CacheFormat = format
+		if err := a.saveToCache(); err != nil {
+			t.Fatal(err)
+		}
+		a.setDocuments(nil)
+		if err := a.loadFromCache(); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if len(a.Documents) != 1 {
+			t.Fatalf("%s: loaded %d documents", format, len(a.Documents))
+		}
+		cached := a.Documents[0]
+		if cached.Slug != scanned.Slug || cached.Hash != scanned.Hash || !cached.ModTime.Equal(scanned.ModTime) {
+			t.Errorf("%s: cached slug %q, hash %q, mod time %v; want %q, %q, %v", format, cached.Slug, cached.Hash, cached.ModTime, scanned.Slug, scanned.Hash, scanned.ModTime)
+		}
+		if got := a.documentSlug(&cached); got != "getting-started" {
+			t.Errorf("%s: permalink slug after loading the cache is %q, want %q", format, got, "getting-started")
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// maxEditBodySize limits the size of documents saved from the browser
+const maxEditBodySize = 32 << 20
+
+// saveRequest is the body of POST /api/documents/{relpath}
+type saveRequest struct {
+	Content  string `json:"content"`
+	BaseHash string `json:"base_hash"` // hash of the content the edit started from
+}
+
+// handleDocumentAPI reads (GET) or saves (POST) the markdown source of a
+// document, or toggles one of its task list items (PATCH). Saving is only
+// available in --editable mode and is rejected with 409 Conflict if the
+// file changed since the editor loaded it.
+func (a *App) handleDocumentAPI(w http.ResponseWriter, r *http.Request) {
+	relPath := strings.TrimPrefix(r.URL.Path, "/api/documents/")
+	if r.Method == http.MethodPost || r.Method == http.MethodPatch {
+		a.handleDocumentWrite(w, r, relPath)
+		return
+	}
+
+	doc := a.readableDocument(r, relPath)
+	if doc == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	content, err := ioutil.ReadFile(doc.Path)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to read document: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, DocumentSource{
+		Path:        doc.RelPath,
+		Content:     string(content),
+		Hash:        contentHash(string(content)),
+		Words:       doc.Words,
+		ReadingTime: doc.ReadingTime(),
+	})
+}
+
+// handleDocumentWrite saves a document or toggles one of its tasks. It runs
+// without the documents lock (see withDocumentsLock) and works on a copy of
+// the document, so updateDocument can publish the written one.
+func (a *App) handleDocumentWrite(w http.ResponseWriter, r *http.Request, relPath string) {
+	a.docsMu.RLock()
+	found := a.readableDocument(r, relPath)
+	var doc Document
+	if found != nil {
+		doc = *found
+	}
+	a.docsMu.RUnlock()
+	if found == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !a.Editable {
+		http.Error(w, "Editing is disabled (start dimandocs with --editable)", http.StatusForbidden)
+		return
+	}
+	if a.isRemoteDocument(&doc) {
+		http.Error(w, "Documents of remote directories are read-only", http.StatusForbidden)
+		return
+	}
+	if !isSameOrigin(r) {
+		http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodPatch {
+		a.handleTaskToggle(w, r, doc)
+		return
+	}
+
+	var req saveRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxEditBodySize)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	saved, err := a.saveDocument(doc, req.Content, req.BaseHash)
+	if err == errEditConflict {
+		writeJSON(w, http.StatusConflict, saved)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, saved)
+}
+
+// errEditConflict is returned when a document changed on disk during an edit
+var errEditConflict = fmt.Errorf("document was modified since it was loaded")
+
+// saveDocument writes new content for doc if the file still has baseHash.
+// On conflict the current source is returned along with errEditConflict.
+func (a *App) saveDocument(doc Document, content, baseHash string) (DocumentSource, error) {
+	var current []byte
+	updated, err := a.updateDocument(doc, func(source []byte) ([]byte, error) {
+		current = source
+		if contentHash(string(source)) != baseHash {
+			return nil, errEditConflict
+		}
+		return []byte(content), nil
+	})
+	if err == errEditConflict {
+		return DocumentSource{Path: doc.RelPath, Content: string(current), Hash: contentHash(string(current))}, err
+	}
+	if err != nil {
+		return DocumentSource{}, err
+	}
+	slog.Info("saved document from the browser editor", "path", doc.Path)
+	return DocumentSource{Path: updated.RelPath, Content: content, Hash: contentHash(content), Words: updated.Words, ReadingTime: updated.ReadingTime()}, nil
+}
+
+// updateDocument rewrites the file of doc with the result of edit on its
+// current content. Updates are serialized from reading the file to
+// publishing the refreshed document, so concurrent edits can't overwrite
+// each other; edit errors are returned as is, without writing the file.
+func (a *App) updateDocument(doc Document, edit func(content []byte) ([]byte, error)) (Document, error) {
+	a.editMu.Lock()
+	defer a.editMu.Unlock()
+
+	current, err := ioutil.ReadFile(doc.Path)
+	if err != nil {
+		return doc, fmt.Errorf("failed to read document: %w", err)
+	}
+	content, err := edit(current)
+	if err != nil {
+		return doc, err
+	}
+	info, err := os.Stat(doc.Path)
+	if err != nil {
+		return doc, fmt.Errorf("failed to stat document: %w", err)
+	}
+	if err := ioutil.WriteFile(doc.Path, content, info.Mode().Perm()); err != nil {
+		return doc, fmt.Errorf("failed to write document: %w", err)
+	}
+
+	// Refresh title, overview and other metadata, keeping what was set when
+	// the documents were stored (see setDocuments)
+	updated, err := a.processFile(doc.Path, doc.SourceDir, doc.SourceName)
+	if err != nil {
+		updated = doc
+	}
+	updated.RelPath = doc.RelPath
+	updated.Version = doc.Version
+	a.docsMu.Lock()
+	replaceDocument(a.Documents, updated)
+	for _, docs := range a.Versions {
+		replaceDocument(docs, updated)
+	}
+	if a.Config.SlugURLs {
+		a.slugs = buildSlugs(a.Documents)
+	}
+	a.Links.Update(doc.Path, a.linkedDocuments(&updated, string(content), a.documentsByPath()))
+	a.docsMu.Unlock()
+	a.Renders.Invalidate(doc.Path)
+	return updated, nil
+}
+
+// replaceDocument replaces the document with the path of doc in docs
+func replaceDocument(docs []Document, doc Document) {
+	for i := range docs {
+		if docs[i].Path == doc.Path {
+			docs[i] = doc
+		}
+	}
+}
+
+// writeJSON writes v as a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("failed to encode response", "error", err)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// defaultEditorCommand is used when neither editor_command nor $VISUAL/$EDITOR is set
+const defaultEditorCommand = "code -g {file}:{line}"
+
+// isLocalRequest reports whether the request comes from the local machine
+// and was addressed to it by a local name. Checking the Host header keeps
+// pages of other sites whose name was rebound to 127.0.0.1 from passing.
+func isLocalRequest(r *http.Request) bool {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return isLoopbackHost(remote) && isLoopbackHost(host)
+}
+
+// isLoopbackHost reports whether host is localhost or a loopback IP
+func isLoopbackHost(host string) bool {
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isSameOrigin reports whether a browser request was issued by a dimandocs
+// page, so other sites cannot trigger local actions through the browser
+func isSameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host
+}
+
+// editorCommand builds the command used to open file at line. The template
+// is split on spaces; {file} and {line} placeholders are substituted in each
+// argument, and the file is appended if the template has no {file}.
+func editorCommand(template, file string, line int) []string {
+	if template == "" {
+		if editor := os.Getenv("VISUAL"); editor != "" {
+			template = editor + " {file}"
+		} else if editor := os.Getenv("EDITOR"); editor != "" {
+			template = editor + " {file}"
+		} else {
+			template = defaultEditorCommand
+		}
+	}
+
+	args := strings.Fields(template)
+	hasFile := false
+	for i, arg := range args {
+		if strings.Contains(arg, "{file}") {
+			hasFile = true
+		}
+		arg = strings.ReplaceAll(arg, "{file}", file)
+		arg = strings.ReplaceAll(arg, "{line}", strconv.Itoa(line))
+		args[i] = arg
+	}
+	if !hasFile {
+		args = append(args, file)
+	}
+	return args
+}
+
+// canOpen reports whether r may open documents in the editor (see
+// handleOpen), to only show the Edit button where it works
+func (a *App) canOpen(r *http.Request) bool {
+	return a.LocalOnly && a.Config.BasePath == "" && isLocalRequest(r)
+}
+
+// handleOpen opens a document in the user's editor. Only POST requests from
+// the local machine are accepted, and only when the server listens on a
+// loopback address without base_path: behind a proxy or on a network
+// interface, requests can't be told apart from remote ones.
+func (a *App) handleOpen(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !a.LocalOnly || a.Config.BasePath != "" {
+		http.Error(w, "Opening files needs the server to listen on localhost (set host to 127.0.0.1) without base_path", http.StatusForbidden)
+		return
+	}
+	if !isLocalRequest(r) || !isSameOrigin(r) {
+		http.Error(w, "Opening files is only allowed from localhost", http.StatusForbidden)
+		return
+	}
+
+	doc := a.readableDocument(r, r.URL.Query().Get("path"))
+	if doc == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	line := 1
+	if l, err := strconv.Atoi(r.URL.Query().Get("line")); err == nil && l > 0 {
+		line = l
+	}
+
+	file, err := filepath.Abs(doc.Path)
+	if err != nil {
+		file = doc.Path
+	}
+
+	args := editorCommand(a.Config.EditorCommand, file, line)
+	cmd := exec.Command(args[0], args[1:]...)
+	if err := cmd.Start(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to start editor: %v", err), http.StatusInternalServerError)
+		return
+	}
+	// Reap the editor process when it exits
+	go cmd.Wait()
+
+	slog.Info("opened file in editor", "path", file, "editor", args[0])
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"message": fmt.Sprintf("Opened %s", doc.RelPath),
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEditButtonOnlyWhereOpenWorks(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+	for _, tc := range []struct {
+		name      string
+		localOnly bool
+		basePath  string
+		remote    string
+		want      bool
+	}{
+		{"all interfaces", false, "", "127.0.0.1:40000", false},
+		{"loopback", true, "", "127.0.0.1:40000", true},
+		{"base path", true, "/docs", "127.0.0.1:40000", false},
+		{"remote request", true, "", "192.0.2.1:40000", false},
+	} {
+		a.LocalOnly, a.Config.BasePath = tc.localOnly, tc.basePath
+		r := httptest.NewRequest(http.MethodGet, "/doc/guide.md", nil)
+		r.RemoteAddr, r.Host = tc.remote, "localhost:8090"
+		w := httptest.NewRecorder()
+		a.handleDocument(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got %d", tc.name, w.Code)
+		}
+		if got := strings.Contains(w.Body.String(), `id="edit-btn"`); got != tc.want {
+			t.Errorf("%s: Edit button shown %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
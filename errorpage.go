@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is the number of similar documents a 404 page suggests
+const maxSuggestions = 5
+
+// ErrorData represents data for the error page template
+type ErrorData struct {
+	AppTitle    string
+	Status      int
+	StatusText  string
+	Message     string
+	Missing     bool           // the page does not exist, so offer a search
+	Query       string         // prefilled search
+	Suggestions []DocumentLink // documents with a path similar to the requested one
+}
+
+// serveError is http.Error for pages: it answers with an error page that
+// keeps the app header and links back to the index
+func (a *App) serveError(w http.ResponseWriter, message string, status int) {
+	a.serveErrorPage(w, status, ErrorData{Message: message})
+}
+
+// notFound answers a request for a missing page with a 404 page suggesting
+// documents whose path is similar to the requested one. While the first
+// scan runs, the page may only be missing for now (see serveIndexing).
+func (a *App) notFound(w http.ResponseWriter, r *http.Request) {
+	if a.serveIndexing(w, r) {
+		return
+	}
+	requested := requestedDocumentPath(r.URL.Path)
+	data := ErrorData{
+		Message:     "There is no page at this address. It may have been moved or renamed.",
+		Missing:     true,
+		Query:       strings.TrimSuffix(path.Base(requested), path.Ext(requested)),
+		Suggestions: a.similarDocuments(a.access(r), requested, maxSuggestions),
+	}
+	if data.Query == "." || data.Query == "/" {
+		data.Query = ""
+	}
+	a.serveErrorPage(w, http.StatusNotFound, data)
+}
+
+// serveErrorPage writes the error page with the given status, or plain text
+// if the page fails
+func (a *App) serveErrorPage(w http.ResponseWriter, status int, data ErrorData) {
+	data.AppTitle = a.Config.Title
+	data.Status = status
+	data.StatusText = http.StatusText(status)
+
+	var buf bytes.Buffer
+	tmpl, err := a.parseTemplates("templates/error.html")
+	if err == nil {
+		err = tmpl.Execute(&buf, data)
+	}
+	if err != nil {
+		slog.Error("failed to render error page", "error", err)
+		message := data.Message
+		if message == "" {
+			message = data.StatusText
+		}
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(buf.Bytes())
+}
+
+// requestedDocumentPath returns the document path of a page URL, e.g.
+// "guide/install.md" for /doc/guide/install.md or /v2/doc/guide/install.md
+func requestedDocumentPath(urlPath string) string {
+	urlPath = strings.TrimPrefix(urlPath, "/")
+	for _, prefix := range []string{"doc/", "dir/", "raw/", "download/"} {
+		if rest, ok := strings.CutPrefix(urlPath, prefix); ok {
+			return rest
+		}
+	}
+	if version, rest, ok := strings.Cut(urlPath, "/doc/"); ok && !strings.Contains(version, "/") {
+		return rest
+	}
+	return urlPath
+}
+
+// similarDocuments returns up to limit documents readable with access whose
+// path or file name is within a few edits of requested, closest first
+func (a *App) similarDocuments(access *Access, requested string, limit int) []DocumentLink {
+	requested = strings.ToLower(strings.TrimSuffix(requested, path.Ext(requested)))
+	name := path.Base(requested)
+	if requested == "" || name == "." {
+		return nil
+	}
+	maxDistance := len(name) / 3
+	if maxDistance < 2 {
+		maxDistance = 2
+	}
+
+	type match struct {
+		doc      *Document
+		distance int
+	}
+	var matches []match
+	for i := range a.Documents {
+		doc := &a.Documents[i]
+		if !access.CanRead(doc) {
+			continue
+		}
+		relPath := strings.ToLower(strings.TrimSuffix(doc.RelPath, path.Ext(doc.RelPath)))
+		distance := editDistance(requested, relPath)
+		if d := editDistance(name, path.Base(relPath)); d < distance {
+			distance = d
+		}
+		if distance <= maxDistance {
+			matches = append(matches, match{doc, distance})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].distance < matches[j].distance
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	links := make([]DocumentLink, len(matches))
+	for i, m := range matches {
+		links[i] = DocumentLink{Path: m.doc.RelPath, Title: m.doc.Title}
+	}
+	return links
+}
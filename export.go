@@ -0,0 +1,146 @@
+package main
+
+import (
+	"archive/zip"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// handleExport serves /export/{source}.zip: the original files of the
+// documents of a configured directory, and the local files they link to or
+// embed, as a zip. The source is the directory's name or its slug. Files
+// excluded by ignore patterns or ignore files are left out.
+func (a *App) handleExport(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/export/")
+	if !strings.HasSuffix(name, ".zip") {
+		a.notFound(w, r)
+		return
+	}
+	source := strings.TrimSuffix(name, ".zip")
+
+	// The files are listed under the documents lock, and the zip is written
+	// without it, so a slow download doesn't hold up re-scans
+	a.docsMu.RLock()
+	filename, files := a.exportFiles(a.access(r), source)
+	a.docsMu.RUnlock()
+	if files == nil {
+		a.notFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	zw := zip.NewWriter(w)
+	for _, file := range files {
+		if err := addZipFile(zw, file.path, file.name); err != nil {
+			slog.Warn("failed to add file to export", "path", file.path, "error", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.Warn("failed to write export", "source", source, "error", err)
+	}
+}
+
+// exportFile is a file of an export and its name in the zip
+type exportFile struct {
+	path, name string
+}
+
+// exportFiles returns the name of the zip exporting a source and the files
+// in it, nil if the source has no documents that can be read with access
+func (a *App) exportFiles(access *Access, source string) (string, []exportFile) {
+	var dirs []DirectoryConfig
+	for _, dir := range a.Config.Directories {
+		if dir.Name == source || sourcePrefix(dir.Name) == source {
+			dirs = append(dirs, dir)
+		}
+	}
+	var docs []*Document
+	for i := range a.Documents {
+		doc := &a.Documents[i]
+		if (doc.SourceName == source || sourcePrefix(doc.SourceName) == source) && access.CanRead(doc) {
+			docs = append(docs, doc)
+		}
+	}
+	if len(dirs) == 0 || len(docs) == 0 {
+		return "", nil
+	}
+
+	var files []exportFile
+	written := make(map[string]bool) // names in the zip
+	add := func(path, name string) {
+		if !written[name] {
+			written[name] = true
+			files = append(files, exportFile{path: path, name: name})
+		}
+	}
+
+	var assets []string // paths of the files linked from the documents
+	for _, doc := range docs {
+		add(doc.Path, sourceRelPath(doc))
+		content, err := a.readDocumentContent(doc)
+		if err != nil {
+			continue
+		}
+		for _, link := range a.extractLinks(content) {
+			if link.Wiki || isExternalLink(link.Target) {
+				continue
+			}
+			if path, _ := resolveLink(doc, link.Target); path != "" && path != doc.Path {
+				assets = append(assets, path)
+			}
+		}
+	}
+
+	if len(assets) > 0 {
+		// Only the files a scan would walk are exported, so linked files
+		// that are ignored or outside the directory stay out
+		exportable := make(map[string]string) // name in the zip by path
+		for _, dir := range dirs {
+			err := a.walkDirectory(dir.Path, a.FileMatchers[dir.Path], func(path, relPath string, info os.FileInfo) error {
+				exportable[filepath.Clean(path)] = relPath
+				return nil
+			})
+			if err != nil {
+				slog.Warn("failed to list files to export", "path", dir.Path, "error", err)
+			}
+		}
+		for _, path := range assets {
+			if name, ok := exportable[filepath.Clean(path)]; ok {
+				add(path, name)
+			}
+		}
+	}
+	return sourcePrefix(dirs[0].Name) + ".zip", files
+}
+
+// addZipFile writes the file at path to a zip under name, keeping its
+// modification time
+func addZipFile(zw *zip.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	dst, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"html"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindFigure is the node kind of captioned images
+var KindFigure = ast.NewNodeKind("Figure")
+
+// Figure is an image with a title on a paragraph of its own, as in
+// ![Architecture](arch.png "The services and their queues"), shown with
+// the title as its caption
+type Figure struct {
+	ast.BaseBlock
+	Caption string
+}
+
+// Kind implements ast.Node
+func (n *Figure) Kind() ast.NodeKind {
+	return KindFigure
+}
+
+// Dump implements ast.Node
+func (n *Figure) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Caption": n.Caption}, nil)
+}
+
+// figureTransformer turns paragraphs holding only an image with a title
+// into figures
+type figureTransformer struct{}
+
+// Transform implements parser.ASTTransformer
+func (t *figureTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	var paragraphs []*ast.Paragraph
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		paragraph, ok := n.(*ast.Paragraph)
+		if !ok || !entering {
+			return ast.WalkContinue, nil
+		}
+		if image, ok := paragraph.FirstChild().(*ast.Image); ok && image.NextSibling() == nil && len(image.Title) > 0 {
+			paragraphs = append(paragraphs, paragraph)
+		}
+		return ast.WalkSkipChildren, nil
+	})
+
+	for _, paragraph := range paragraphs {
+		image := paragraph.FirstChild().(*ast.Image)
+		figure := &Figure{Caption: string(image.Title)}
+		figure.AppendChild(figure, image)
+		paragraph.Parent().ReplaceChild(paragraph.Parent(), paragraph, figure)
+	}
+}
+
+// figureRenderer renders figures with a figcaption
+type figureRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRendererFuncRegisterer
+func (r *figureRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindFigure, r.render)
+}
+
+func (r *figureRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.WriteString("<figure>\n")
+		return ast.WalkContinue, nil
+	}
+	w.WriteString("\n<figcaption>" + html.EscapeString(node.(*Figure).Caption) + "</figcaption>\n</figure>\n")
+	return ast.WalkContinue, nil
+}
+
+// figures is the goldmark extension adding figures
+type figures struct{}
+
+// Extend implements goldmark.Extender
+func (e *figures) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&figureTransformer{}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&figureRenderer{}, 100)))
+}
+
+// lazyImageTransformer marks images to be loaded when they are scrolled
+// near, so long documents with many images open quickly
+type lazyImageTransformer struct{}
+
+// Transform implements parser.ASTTransformer
+func (t *lazyImageTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if image, ok := n.(*ast.Image); ok && entering {
+			image.SetAttributeString("loading", []byte("lazy"))
+		}
+		return ast.WalkContinue, nil
+	})
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Markdown flavors, the platforms whose rendering markdown.flavor matches
+const (
+	flavorGitHub    = "github"
+	flavorGitLab    = "gitlab"
+	flavorBitbucket = "bitbucket"
+)
+
+// markdownFlavor returns the flavor documents are rendered with
+func markdownFlavor(config Config) string {
+	if flavor := strings.ToLower(config.Markdown.Flavor); flavor != "" {
+		return flavor
+	}
+	return flavorGitHub
+}
+
+// mediaTags maps the extensions of the videos and sounds GitLab embeds
+// with the image syntax to the element playing them
+var mediaTags = map[string]string{
+	".mp4":  "video",
+	".m4v":  "video",
+	".mov":  "video",
+	".webm": "video",
+	".ogv":  "video",
+	".mp3":  "audio",
+	".oga":  "audio",
+	".ogg":  "audio",
+	".spx":  "audio",
+	".wav":  "audio",
+}
+
+// tocMarkers are the paragraphs replaced with a table of contents, by flavor
+var tocMarkers = map[string][]string{
+	flavorGitLab:    {"[[_TOC_]]", "[TOC]"},
+	flavorBitbucket: {"[TOC]"},
+}
+
+// inapplicableTask matches the "[~] " GitLab starts items of task lists
+// that no longer apply with
+var inapplicableTask = regexp.MustCompile(`^\[~\](\s|$)`)
+
+// KindMediaEmbed is the node kind of embedded videos and sounds
+var KindMediaEmbed = ast.NewNodeKind("MediaEmbed")
+
+// MediaEmbed is an image whose destination is a video or sound file,
+// ![demo](demo.mp4), played in the page. Its children are the alt text.
+type MediaEmbed struct {
+	ast.BaseInline
+	Tag         string // "video" or "audio"
+	Destination []byte
+	Title       []byte
+}
+
+// Kind implements ast.Node
+func (n *MediaEmbed) Kind() ast.NodeKind {
+	return KindMediaEmbed
+}
+
+// Dump implements ast.Node
+func (n *MediaEmbed) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Tag": n.Tag, "Destination": string(n.Destination)}, nil)
+}
+
+// KindTableOfContents is the node kind of [TOC] markers
+var KindTableOfContents = ast.NewNodeKind("TableOfContents")
+
+// TableOfContents is a [TOC] paragraph, shown as links to the headings of
+// the document
+type TableOfContents struct {
+	ast.BaseBlock
+	Entries []tocEntry
+}
+
+// tocEntry is a heading listed in a table of contents
+type tocEntry struct {
+	Level int
+	ID    string
+	Text  string
+}
+
+// Kind implements ast.Node
+func (n *TableOfContents) Kind() ast.NodeKind {
+	return KindTableOfContents
+}
+
+// Dump implements ast.Node
+func (n *TableOfContents) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Entries": fmt.Sprint(len(n.Entries))}, nil)
+}
+
+// multilineBlockquoteParser parses GitLab's blockquotes fenced by ">>>"
+// lines, which need no ">" on each line in between
+type multilineBlockquoteParser struct{}
+
+// isMultilineBlockquoteFence reports whether a line is a ">>>" fence
+func isMultilineBlockquoteFence(line []byte, offset int) bool {
+	w, pos := util.IndentWidth(line, offset)
+	return w < 4 && string(bytes.TrimSpace(line[pos:])) == ">>>"
+}
+
+// Trigger implements parser.BlockParser
+func (b *multilineBlockquoteParser) Trigger() []byte {
+	return []byte{'>'}
+}
+
+// Open implements parser.BlockParser
+func (b *multilineBlockquoteParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	if !isMultilineBlockquoteFence(line, reader.LineOffset()) {
+		return nil, parser.NoChildren
+	}
+	reader.Advance(segment.Len() - 1)
+	return ast.NewBlockquote(), parser.HasChildren
+}
+
+// Continue implements parser.BlockParser
+func (b *multilineBlockquoteParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	if line != nil && isMultilineBlockquoteFence(line, reader.LineOffset()) {
+		newline := 1
+		if line[len(line)-1] != '\n' {
+			newline = 0
+		}
+		reader.Advance(segment.Len() - newline)
+		return parser.Close
+	}
+	return parser.Continue | parser.HasChildren
+}
+
+// Close implements parser.BlockParser
+func (b *multilineBlockquoteParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph implements parser.BlockParser
+func (b *multilineBlockquoteParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine implements parser.BlockParser
+func (b *multilineBlockquoteParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// flavorTransformer rewrites the syntax of other platforms: [TOC] markers,
+// GitLab's inapplicable tasks and media embeds, and Bitbucket's ":::lang"
+// code blocks
+type flavorTransformer struct {
+	flavor string
+}
+
+// Transform implements parser.ASTTransformer
+func (t *flavorTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var (
+		headings   []*ast.Heading
+		tocs       []*ast.Paragraph
+		tasks      []*ast.ListItem
+		media      []*ast.Image
+		codeBlocks []*ast.CodeBlock
+	)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Heading:
+			headings = append(headings, n)
+		case *ast.Paragraph:
+			if n.Lines().Len() == 1 && indexOf(tocMarkers[t.flavor], string(bytes.TrimSpace(n.Lines().Value(source)))) >= 0 {
+				tocs = append(tocs, n)
+			}
+		case *ast.ListItem:
+			if first := n.FirstChild(); t.flavor == flavorGitLab && first != nil && first.Lines().Len() > 0 {
+				line := first.Lines().At(0)
+				if inapplicableTask.Match(line.Value(source)) {
+					tasks = append(tasks, n)
+				}
+			}
+		case *ast.Image:
+			if t.flavor == flavorGitLab && mediaTags[strings.ToLower(path.Ext(string(n.Destination)))] != "" {
+				media = append(media, n)
+			}
+		case *ast.CodeBlock:
+			if t.flavor == flavorBitbucket {
+				codeBlocks = append(codeBlocks, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	if len(tocs) > 0 {
+		var entries []tocEntry
+		for _, heading := range headings {
+			if id, ok := heading.AttributeString("id"); ok {
+				if b, ok := id.([]byte); ok {
+					entries = append(entries, tocEntry{Level: heading.Level, ID: string(b), Text: nodeText(heading, source)})
+				}
+			}
+		}
+		for _, paragraph := range tocs {
+			paragraph.Parent().ReplaceChild(paragraph.Parent(), paragraph, &TableOfContents{Entries: entries})
+		}
+	}
+	for _, item := range tasks {
+		markInapplicableTask(item.FirstChild(), source)
+	}
+	for _, image := range media {
+		embed := &MediaEmbed{Tag: mediaTags[strings.ToLower(path.Ext(string(image.Destination)))], Destination: image.Destination, Title: image.Title}
+		for c := image.FirstChild(); c != nil; {
+			next := c.NextSibling()
+			embed.AppendChild(embed, c)
+			c = next
+		}
+		image.Parent().ReplaceChild(image.Parent(), image, embed)
+	}
+	for _, block := range codeBlocks {
+		languageCodeBlock(block, source)
+	}
+}
+
+// markInapplicableTask replaces the "[~] " starting the text of a task list
+// item with a checkbox and strikes the rest through
+func markInapplicableTask(text ast.Node, source []byte) {
+	marker := text.Lines().At(0)
+	markerStop := marker.Start + len(inapplicableTask.Find(marker.Value(source)))
+	for c := text.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		t, ok := c.(*ast.Text)
+		if !ok || t.Segment.Start >= markerStop {
+			break
+		}
+		if t.Segment.Stop <= markerStop {
+			text.RemoveChild(text, c)
+		} else {
+			t.Segment = t.Segment.WithStart(markerStop)
+		}
+		c = next
+	}
+
+	strike := extast.NewStrikethrough()
+	for c := text.FirstChild(); c != nil; {
+		next := c.NextSibling()
+		strike.AppendChild(strike, c)
+		c = next
+	}
+	text.AppendChild(text, extast.NewTaskCheckBox(false))
+	text.AppendChild(text, strike)
+}
+
+// languageCodeBlock turns an indented code block starting with a ":::lang"
+// line, as Bitbucket highlights them, into a fenced code block of that
+// language
+func languageCodeBlock(block *ast.CodeBlock, source []byte) {
+	lines := block.Lines()
+	if lines.Len() < 2 {
+		return
+	}
+	first := lines.At(0)
+	value := first.Value(source)
+	trimmed := bytes.TrimSpace(value)
+	if !bytes.HasPrefix(trimmed, []byte(":::")) {
+		return
+	}
+	language := bytes.TrimSpace(trimmed[3:])
+	if len(language) == 0 || bytes.ContainsAny(language, " \t") {
+		return
+	}
+
+	start := first.Start + bytes.Index(value, language)
+	fenced := ast.NewFencedCodeBlock(ast.NewTextSegment(text.NewSegment(start, start+len(language))))
+	code := text.NewSegments()
+	for i := 1; i < lines.Len(); i++ {
+		code.Append(lines.At(i))
+	}
+	fenced.SetLines(code)
+	block.Parent().ReplaceChild(block.Parent(), block, fenced)
+}
+
+// nodeText returns the text of the inline children of a node
+func nodeText(node ast.Node, source []byte) string {
+	var b strings.Builder
+	ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := n.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() {
+				b.WriteString(" ")
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *WikiLink:
+			b.WriteString(n.Caption())
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return b.String()
+}
+
+// flavorRenderer renders media embeds and tables of contents
+type flavorRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *flavorRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMediaEmbed, r.renderMedia)
+	reg.Register(KindTableOfContents, r.renderTableOfContents)
+}
+
+// renderMedia renders a video or sound with a link to the file for browsers
+// that cannot play it
+func (r *flavorRenderer) renderMedia(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*MediaEmbed)
+	if !entering {
+		fmt.Fprintf(w, "</a></%s>", n.Tag)
+		return ast.WalkContinue, nil
+	}
+	src := util.EscapeHTML(util.URLEscape(n.Destination, true))
+	fmt.Fprintf(w, `<%s src="%s" controls="" preload="metadata"`, n.Tag, src)
+	if n.Title != nil {
+		fmt.Fprintf(w, ` title="%s"`, util.EscapeHTML(n.Title))
+	}
+	fmt.Fprintf(w, `><a href="%s">`, src)
+	return ast.WalkContinue, nil
+}
+
+// renderTableOfContents renders the headings of the document as nested
+// lists of links
+func (r *flavorRenderer) renderTableOfContents(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	entries := node.(*TableOfContents).Entries
+	if len(entries) == 0 {
+		return ast.WalkSkipChildren, nil
+	}
+
+	w.WriteString("<div class=\"inline-toc\">\n")
+	var levels []int // levels of the open lists
+	for _, entry := range entries {
+		if len(levels) == 0 || entry.Level > levels[len(levels)-1] {
+			w.WriteString("<ul>\n")
+			levels = append(levels, entry.Level)
+		} else {
+			w.WriteString("</li>\n")
+			for len(levels) > 1 && entry.Level < levels[len(levels)-1] {
+				w.WriteString("</ul>\n</li>\n")
+				levels = levels[:len(levels)-1]
+			}
+		}
+		fmt.Fprintf(w, `<li><a href="#%s">%s</a>`, util.EscapeHTML(util.URLEscape([]byte(entry.ID), false)), util.EscapeHTML([]byte(entry.Text)))
+	}
+	for range levels {
+		w.WriteString("</li>\n</ul>\n")
+	}
+	w.WriteString("</div>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// flavorExtension is the goldmark extension for the syntax of GitLab or
+// Bitbucket
+type flavorExtension struct {
+	flavor string
+}
+
+// Extend implements goldmark.Extender
+func (e *flavorExtension) Extend(m goldmark.Markdown) {
+	if e.flavor == flavorGitLab {
+		// Before the standard blockquote parser (priority 800)
+		m.Parser().AddOptions(parser.WithBlockParsers(util.Prioritized(&multilineBlockquoteParser{}, 799)))
+	}
+	m.Parser().AddOptions(parser.WithASTTransformers(util.Prioritized(&flavorTransformer{flavor: e.flavor}, 100)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&flavorRenderer{}, 100)))
+}
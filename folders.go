@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// folderIndexNames are the landing pages of a directory, by preference
+var folderIndexNames = []string{"readme", "index"}
+
+// folderIndex returns the landing page among the documents of a directory
+// node, or nil if it has none
+func folderIndex(node *TreeNode) *Document {
+	for _, want := range folderIndexNames {
+		for _, child := range node.Children {
+			if !child.IsFile {
+				continue
+			}
+			name := strings.TrimSuffix(child.Name, path.Ext(child.Name))
+			if strings.ToLower(name) == want {
+				return child.Document
+			}
+		}
+	}
+	return nil
+}
+
+// setFolderIndexes sets the landing page of node's subdirectories
+func setFolderIndexes(node *TreeNode) {
+	for _, child := range node.Children {
+		if !child.IsFile {
+			child.Index = folderIndex(child)
+			setFolderIndexes(child)
+		}
+	}
+}
+
+// FolderCrumb is a parent folder in the breadcrumbs of a folder page
+type FolderCrumb struct {
+	Name string
+	Path string
+}
+
+// FolderData is the data of an automatic folder index page
+type FolderData struct {
+	AppTitle  string
+	Name      string
+	Path      string
+	Crumbs    []FolderCrumb // enclosing folders, outermost first
+	Folders   []*TreeNode
+	Documents []*Document
+}
+
+// findTreeNode returns the directory node at relPath in tree, or nil
+func findTreeNode(tree DirectoryTree, relPath string) *TreeNode {
+	node := tree.Root
+	for _, part := range strings.Split(relPath, "/") {
+		var next *TreeNode
+		for _, child := range node.Children {
+			if !child.IsFile && child.Name == part {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// handleFolder serves /dir/{path}: the folder's landing page if it has one,
+// otherwise a page listing its subfolders and documents. Folders with the
+// same path in several sources are listed together.
+func (a *App) handleFolder(w http.ResponseWriter, r *http.Request) {
+	relPath := strings.Trim(strings.TrimPrefix(r.URL.Path, "/dir/"), "/")
+	if relPath == "" {
+		http.Redirect(w, r, a.Config.BasePath+"/", http.StatusFound)
+		return
+	}
+
+	var nodes []*TreeNode
+	for _, tree := range a.access(r).Trees(a.BuildDirectoryTrees()) {
+		if node := findTreeNode(tree, relPath); node != nil {
+			nodes = append(nodes, node)
+		}
+	}
+	if len(nodes) == 0 {
+		a.notFound(w, r)
+		return
+	}
+	if len(nodes) == 1 && nodes[0].Index != nil {
+		http.Redirect(w, r, a.Config.BasePath+docURL(nodes[0].Index.RelPath), http.StatusFound)
+		return
+	}
+
+	tmpl, err := a.parseTemplates("templates/folder.html")
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data := FolderData{AppTitle: a.Config.Title, Name: path.Base(relPath), Path: relPath}
+	parts := strings.Split(relPath, "/")
+	for i := range parts[:len(parts)-1] {
+		data.Crumbs = append(data.Crumbs, FolderCrumb{Name: parts[i], Path: strings.Join(parts[:i+1], "/")})
+	}
+	for _, node := range nodes {
+		for _, child := range node.Children {
+			if child.IsFile {
+				data.Documents = append(data.Documents, child.Document)
+			} else {
+				data.Folders = append(data.Folders, child)
+			}
+		}
+	}
+	servePage(w, r, tmpl, data)
+}
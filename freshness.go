@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commitDatesTTL is how long the last commit dates read from git are used
+// before git is asked again
+const commitDatesTTL = 5 * time.Minute
+
+// ageUnits are the suffixes accepted by parseAge besides Go durations
+var ageUnits = map[string]time.Duration{
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+}
+
+// parseAge parses an age such as "180d", "26w" or a Go duration ("720h")
+func parseAge(value string) (time.Duration, error) {
+	for suffix, unit := range ageUnits {
+		if strings.HasSuffix(value, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(value, suffix))
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid age %q", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid age %q", value)
+	}
+	return d, nil
+}
+
+// staleAfter returns the configured stale_after, 0 if documents never go
+// stale. The value is checked when the config is loaded.
+func (a *App) staleAfter() time.Duration {
+	if a.Config.StaleAfter == "" {
+		return 0
+	}
+	d, _ := parseAge(a.Config.StaleAfter)
+	return d
+}
+
+// formatAge describes how long ago something happened, e.g. "3 months"
+func formatAge(d time.Duration) string {
+	days := int(d.Hours() / 24)
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return "1 " + unit
+		}
+		return fmt.Sprintf("%d %ss", n, unit)
+	}
+	switch {
+	case days < 60:
+		return plural(days, "day")
+	case days < 730:
+		return plural(days/30, "month")
+	}
+	return plural(days/365, "year")
+}
+
+// StaleDocument is a document not updated for longer than stale_after
+type StaleDocument struct {
+	Path    string
+	Title   string
+	Updated time.Time
+	Source  string // "git" for the last commit, "file" for the modification time
+	Age     string // time since Updated, e.g. "7 months"
+}
+
+// commitDates caches the last commit date of every file tracked by git in
+// the configured directories
+type commitDates struct {
+	mu    sync.Mutex
+	read  time.Time
+	dates map[string]time.Time // by absolute path with symlinks resolved
+}
+
+// lastCommitDates returns the last commit date of the files of the
+// configured directories that are in a git repository, reading them again
+// once they are older than commitDatesTTL
+func (a *App) lastCommitDates() map[string]time.Time {
+	a.commits.mu.Lock()
+	defer a.commits.mu.Unlock()
+	if a.commits.dates != nil && time.Since(a.commits.read) < commitDatesTTL {
+		return a.commits.dates
+	}
+
+	dates := make(map[string]time.Time)
+	if _, err := exec.LookPath("git"); err == nil {
+		for _, dir := range a.Config.Directories {
+			if err := readCommitDates(dir.Path, dates); err != nil {
+				slog.Debug("no git history for directory", "path", dir.Path, "error", err)
+			}
+		}
+	}
+	a.commits.dates, a.commits.read = dates, time.Now()
+	return dates
+}
+
+// readCommitDates adds the last commit date of each file under dir to dates,
+// reading the log of the git repository dir is in once
+func readCommitDates(dir string, dates map[string]time.Time) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return err
+	}
+	out, err := exec.Command("git", "-C", abs, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return err
+	}
+	top := strings.TrimSpace(string(out))
+	rel, err := filepath.Rel(top, abs)
+	if err != nil {
+		return err
+	}
+
+	// The log lists commits newest first: a "\x01<unix time>" line followed
+	// by the files the commit touched
+	out, err = exec.Command("git", "-C", top, "-c", "core.quotePath=false", "log",
+		"--format=%x01%ct", "--name-only", "--no-renames", "--", filepath.ToSlash(rel)).Output()
+	if err != nil {
+		return err
+	}
+	var when time.Time
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "\x01") {
+			if seconds, err := strconv.ParseInt(line[1:], 10, 64); err == nil {
+				when = time.Unix(seconds, 0)
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+		path := filepath.Join(top, filepath.FromSlash(line))
+		if _, seen := dates[path]; !seen {
+			dates[path] = when
+		}
+	}
+	return scanner.Err()
+}
+
+// lastUpdate returns when a document was last changed: its last commit if
+// git tracks it, otherwise the modification time of the file
+func (a *App) lastUpdate(doc *Document) (time.Time, string) {
+	if path, err := filepath.Abs(doc.Path); err == nil {
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			if when, ok := a.lastCommitDates()[resolved]; ok {
+				return when, "git"
+			}
+		}
+	}
+	if !doc.ModTime.IsZero() {
+		return doc.ModTime, "file"
+	}
+	if info, err := os.Stat(doc.Path); err == nil {
+		return info.ModTime(), "file"
+	}
+	return time.Time{}, "file"
+}
+
+// staleDocument returns doc as a StaleDocument if it was not updated for
+// longer than stale_after, nil otherwise
+func (a *App) staleDocument(doc *Document) *StaleDocument {
+	limit := a.staleAfter()
+	if limit == 0 {
+		return nil
+	}
+	updated, source := a.lastUpdate(doc)
+	age := time.Since(updated)
+	if updated.IsZero() || age <= limit {
+		return nil
+	}
+	return &StaleDocument{Path: doc.RelPath, Title: doc.Title, Updated: updated, Source: source, Age: formatAge(age)}
+}
+
+// StaleReport is the data of the /stale page
+type StaleReport struct {
+	Title          string
+	StaleAfter     string
+	TotalDocuments int
+	Documents      []StaleDocument // least recently updated first
+}
+
+// handleStale lists the documents not updated for longer than stale_after
+func (a *App) handleStale(w http.ResponseWriter, r *http.Request) {
+	if a.staleAfter() == 0 {
+		a.serveError(w, "Freshness checks are disabled (set \"stale_after\" in the config, e.g. \"180d\")", http.StatusNotFound)
+		return
+	}
+	tmpl, err := a.parseTemplates("templates/stale.html")
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	access := a.access(r)
+	report := StaleReport{Title: a.Config.Title, StaleAfter: a.Config.StaleAfter}
+	for i := range a.Documents {
+		if !access.CanRead(&a.Documents[i]) {
+			continue
+		}
+		report.TotalDocuments++
+		if stale := a.staleDocument(&a.Documents[i]); stale != nil {
+			report.Documents = append(report.Documents, *stale)
+		}
+	}
+	sort.SliceStable(report.Documents, func(i, j int) bool {
+		return report.Documents[i].Updated.Before(report.Documents[j].Updated)
+	})
+	servePage(w, r, tmpl, report)
+}
+
+// checkStaleAfter validates stale_after
+func (v *configValidator) checkStaleAfter(value string) {
+	if value == "" {
+		return
+	}
+	if _, err := parseAge(value); err != nil {
+		v.add("stale_after", "invalid age %q (use e.g. \"180d\", \"26w\" or \"720h\")", value)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFileNames are the per-directory ignore files honored while scanning
+var ignoreFileNames = []string{".gitignore", ".dimandocsignore"}
+
+// ignoreRule is a single pattern from an ignore file
+type ignoreRule struct {
+	re       *regexp.Regexp
+	negate   bool // "!pattern" re-includes a previously ignored path
+	dirOnly  bool // "pattern/" only matches directories
+	anchored bool // pattern contains a "/" and is matched against the full path
+}
+
+// ignoreRules holds the ignore files found during a single directory walk,
+// keyed by the slash-separated directory path relative to the walk root
+type ignoreRules struct {
+	files []string
+	byDir map[string][]ignoreRule
+}
+
+// newIgnoreRules creates an empty rule set reading the given ignore file names
+func newIgnoreRules(files []string) *ignoreRules {
+	return &ignoreRules{files: files, byDir: make(map[string][]ignoreRule)}
+}
+
+// load reads the ignore files of the directory at dirPath (dirRel relative to the root)
+func (ir *ignoreRules) load(dirRel, dirPath string) {
+	for _, name := range ir.files {
+		f, err := os.Open(filepath.Join(dirPath, name))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			if rule, ok := parseIgnoreLine(scanner.Text()); ok {
+				ir.byDir[dirRel] = append(ir.byDir[dirRel], rule)
+			}
+		}
+		f.Close()
+	}
+}
+
+// parseIgnoreLine parses one line of a gitignore-style file
+func parseIgnoreLine(line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, "\r")
+	if !strings.HasSuffix(line, "\\ ") {
+		line = strings.TrimRight(line, " ")
+	}
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+
+	rule := ignoreRule{}
+	if strings.HasPrefix(line, "!") {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	rule.anchored = strings.Contains(line, "/")
+
+	re, err := globToRegexp(line)
+	if err != nil {
+		return ignoreRule{}, false
+	}
+	rule.re = re
+	return rule, true
+}
+
+// Ignored reports whether relPath (slash-separated, relative to the walk
+// root) is excluded by the ignore files of its ancestor directories. Rules
+// of deeper directories override those of their parents and, within a file,
+// the last matching rule wins, as in git.
+func (ir *ignoreRules) Ignored(relPath string, isDir bool) bool {
+	if ir == nil || len(ir.byDir) == 0 {
+		return false
+	}
+
+	ignored := false
+	dir := ""
+	rest := relPath
+	for {
+		for _, rule := range ir.byDir[dir] {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			target := path.Base(rest)
+			if rule.anchored {
+				target = rest
+			}
+			if rule.re.MatchString(target) {
+				ignored = !rule.negate
+			}
+		}
+
+		idx := strings.IndexByte(rest, '/')
+		if idx < 0 {
+			return ignored
+		}
+		if dir == "" {
+			dir = rest[:idx]
+		} else {
+			dir = dir + "/" + rest[:idx]
+		}
+		rest = rest[idx+1:]
+	}
+}
@@ -4,4 +4,16 @@ go 1.22
 
 toolchain go1.24.11
 
-require github.com/yuin/goldmark v1.7.16
+require (
+	github.com/BurntSushi/toml v1.4.0
+	github.com/microcosm-cc/bluemonday v1.0.27
+	github.com/yuin/goldmark v1.7.16
+	github.com/yuin/goldmark-emoji v1.0.6
+	golang.org/x/net v0.26.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/gorilla/css v1.0.1 // indirect
+)
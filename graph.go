@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// LinkGraph records which documents link to which, keyed by document path
+type LinkGraph struct {
+	mu        sync.RWMutex
+	links     map[string][]string // document -> documents it links to
+	backlinks map[string][]string // document -> documents linking to it
+}
+
+// GraphNode is a document in /api/graph
+type GraphNode struct {
+	ID     string   `json:"id"` // relative path
+	Title  string   `json:"title"`
+	Source string   `json:"source"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// GraphEdge is a link between two documents in /api/graph
+type GraphEdge struct {
+	Source string `json:"source"`
+	Target string `json:"target"`
+}
+
+// buildLinkGraph reads every document and records its links to other
+// documents. Documents are parsed concurrently.
+func (a *App) buildLinkGraph() *LinkGraph {
+	byPath := a.documentsByPath()
+	links := make([][]string, len(a.Documents))
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				doc := &a.Documents[i]
+				if content, err := a.readDocumentContent(doc); err == nil {
+					links[i] = a.linkedDocuments(doc, content, byPath)
+				}
+			}
+		}()
+	}
+	for i := range a.Documents {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	g := &LinkGraph{links: make(map[string][]string), backlinks: make(map[string][]string)}
+	for i, targets := range links {
+		g.set(a.Documents[i].Path, targets)
+	}
+	return g
+}
+
+// documentsByPath indexes the documents by their cleaned file path
+func (a *App) documentsByPath() map[string]*Document {
+	byPath := make(map[string]*Document, len(a.Documents))
+	for i := range a.Documents {
+		byPath[filepath.Clean(a.Documents[i].Path)] = &a.Documents[i]
+	}
+	return byPath
+}
+
+// linkedDocuments returns the paths of the other documents doc links to,
+// without duplicates
+func (a *App) linkedDocuments(doc *Document, content string, byPath map[string]*Document) []string {
+	seen := make(map[string]bool)
+	var targets []string
+	for _, link := range a.extractLinks(content) {
+		var path string
+		switch {
+		case link.Image || link.Target == "":
+			continue
+		case link.Wiki:
+			if target, _, ok := a.wikiLinkDocument(link.Target); ok && target != nil {
+				path = target.Path
+			}
+		case isExternalLink(link.Target):
+			continue
+		default:
+			path, _ = resolveLink(doc, link.Target)
+		}
+		target, ok := byPath[filepath.Clean(path)]
+		if path == "" || !ok || target.Path == doc.Path || seen[target.Path] {
+			continue
+		}
+		seen[target.Path] = true
+		targets = append(targets, target.Path)
+	}
+	return targets
+}
+
+// Update replaces the links of a document, e.g. after it was edited
+func (g *LinkGraph) Update(path string, targets []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.set(path, targets)
+}
+
+// set replaces the links of a document; the caller holds the lock
+func (g *LinkGraph) set(path string, targets []string) {
+	for _, old := range g.links[path] {
+		g.backlinks[old] = removeString(g.backlinks[old], path)
+	}
+	g.links[path] = targets
+	for _, target := range targets {
+		g.backlinks[target] = append(g.backlinks[target], path)
+	}
+}
+
+// Backlinks returns the paths of the documents linking to path
+func (g *LinkGraph) Backlinks(path string) []string {
+	if g == nil {
+		return nil
+	}
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return append([]string(nil), g.backlinks[path]...)
+}
+
+// removeString returns list without s
+func removeString(list []string, s string) []string {
+	if i := indexOf(list, s); i >= 0 {
+		return append(list[:i], list[i+1:]...)
+	}
+	return list
+}
+
+// backlinksOf returns the documents readable with access linking to doc,
+// ordered by title
+func (a *App) backlinksOf(access *Access, doc *Document) []DocumentLink {
+	byPath := a.documentsByPath()
+	var links []DocumentLink
+	for _, path := range a.Links.Backlinks(doc.Path) {
+		if source, ok := byPath[filepath.Clean(path)]; ok && access.CanRead(source) {
+			links = append(links, DocumentLink{Path: source.RelPath, Title: source.Title})
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Title < links[j].Title })
+	return links
+}
+
+// handleGraph returns the documents and the links between them
+func (a *App) handleGraph(w http.ResponseWriter, r *http.Request) {
+	access := a.access(r)
+	byPath := a.documentsByPath()
+	graph := struct {
+		Nodes []GraphNode `json:"nodes"`
+		Edges []GraphEdge `json:"edges"`
+	}{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+
+	a.Links.mu.RLock()
+	defer a.Links.mu.RUnlock()
+	for _, doc := range a.Documents {
+		if !access.CanReadSource(doc.SourceName) {
+			continue
+		}
+		graph.Nodes = append(graph.Nodes, GraphNode{ID: doc.RelPath, Title: doc.Title, Source: doc.SourceName, Tags: doc.Tags})
+		for _, path := range a.Links.links[doc.Path] {
+			if target, ok := byPath[filepath.Clean(path)]; ok && access.CanRead(target) {
+				graph.Edges = append(graph.Edges, GraphEdge{Source: doc.RelPath, Target: target.RelPath})
+			}
+		}
+	}
+	writeJSON(w, http.StatusOK, graph)
+}
+
+// GraphPageData is the data of the /graph page
+type GraphPageData struct {
+	Title   string
+	Sources []string // for the source filter, in config order
+	Tags    []string // for the tag filter, sorted
+}
+
+// handleGraphPage serves the interactive graph of documents and their links
+func (a *App) handleGraphPage(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := a.parseTemplates("templates/graph.html")
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	access := a.access(r)
+	data := GraphPageData{Title: a.Config.Title}
+	seen := make(map[string]bool)
+	for _, doc := range a.Documents {
+		if !access.CanReadSource(doc.SourceName) {
+			continue
+		}
+		if !seen["source:"+doc.SourceName] {
+			seen["source:"+doc.SourceName] = true
+			data.Sources = append(data.Sources, doc.SourceName)
+		}
+		for _, tag := range doc.Tags {
+			if !seen["tag:"+tag] {
+				seen["tag:"+tag] = true
+				data.Tags = append(data.Tags, tag)
+			}
+		}
+	}
+	sort.Strings(data.Tags)
+	servePage(w, r, tmpl, data)
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// historyFileName stores recently viewed documents and favorites of
+	// every browser in the state directory (see statePath)
+	historyFileName = ".dimandocs-history.json"
+
+	// clientCookieName identifies a browser, so each one gets its own history
+	clientCookieName = "dimandocs_client"
+
+	maxRecentDocuments = 10
+	maxRecentSearches  = 10
+	maxSavedSearches   = 50
+	maxHistoryClients  = 1000
+	maxSearchQuery     = 500  // characters
+	maxSearchName      = 100  // characters
+	maxHistoryBody     = 4096 // bytes of a favorites or searches request
+
+	// historySaveInterval is how often a changed history is written
+	historySaveInterval = 30 * time.Second
+)
+
+// ClientHistory is the history of a single browser
+type ClientHistory struct {
+	Recent    []string  `json:"recent"`    // relative paths, most recent first
+	Favorites []string  `json:"favorites"` // relative paths, in the order they were starred
+	Seen      time.Time `json:"seen"`
+
+	Searches      []string      `json:"searches,omitempty"`       // queries, most recent first
+	SavedSearches []SavedSearch `json:"saved_searches,omitempty"` // in the order they were saved
+}
+
+// SavedSearch is a search saved under a name
+type SavedSearch struct {
+	Name  string `json:"name"`
+	Query string `json:"query"`
+}
+
+// History keeps recently viewed documents and favorites per browser in
+// memory; it is written to a file periodically so it survives restarts
+type History struct {
+	mu      sync.Mutex
+	path    string
+	clients map[string]*ClientHistory
+	dirty   bool // changed since the last save
+}
+
+// LoadHistory reads the history file, starting empty if it does not exist
+func LoadHistory(path string) *History {
+	h := &History{path: path, clients: make(map[string]*ClientHistory)}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read history", "file", path, "error", err)
+		}
+		return h
+	}
+	if err := json.Unmarshal(data, &h.clients); err != nil {
+		slog.Warn("failed to parse history, starting empty", "file", path, "error", err)
+		h.clients = make(map[string]*ClientHistory)
+	}
+	return h
+}
+
+// Get returns a copy of a browser's recent documents and favorites
+func (h *History) Get(client string) (recent, favorites []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch, ok := h.clients[client]
+	if !ok {
+		return nil, nil
+	}
+	return append([]string(nil), ch.Recent...), append([]string(nil), ch.Favorites...)
+}
+
+// IsFavorite reports whether a browser starred a document
+func (h *History) IsFavorite(client, relPath string) bool {
+	_, favorites := h.Get(client)
+	return indexOf(favorites, relPath) >= 0
+}
+
+// Viewed moves a document to the top of a browser's recent documents
+func (h *History) Viewed(client, relPath string) {
+	h.update(client, func(ch *ClientHistory) {
+		if i := indexOf(ch.Recent, relPath); i >= 0 {
+			ch.Recent = append(ch.Recent[:i], ch.Recent[i+1:]...)
+		}
+		ch.Recent = append([]string{relPath}, ch.Recent...)
+		if len(ch.Recent) > maxRecentDocuments {
+			ch.Recent = ch.Recent[:maxRecentDocuments]
+		}
+	})
+}
+
+// SetFavorite stars or unstars a document for a browser
+func (h *History) SetFavorite(client, relPath string, favorite bool) {
+	h.update(client, func(ch *ClientHistory) {
+		i := indexOf(ch.Favorites, relPath)
+		switch {
+		case favorite && i < 0:
+			ch.Favorites = append(ch.Favorites, relPath)
+		case !favorite && i >= 0:
+			ch.Favorites = append(ch.Favorites[:i], ch.Favorites[i+1:]...)
+		}
+	})
+}
+
+// Searches returns a copy of a browser's recent and saved searches
+func (h *History) Searches(client string) (recent []string, saved []SavedSearch) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ch, ok := h.clients[client]
+	if !ok {
+		return nil, nil
+	}
+	return append([]string(nil), ch.Searches...), append([]SavedSearch(nil), ch.SavedSearches...)
+}
+
+// Searched moves a query to the top of a browser's recent searches
+func (h *History) Searched(client, query string) {
+	h.update(client, func(ch *ClientHistory) {
+		if i := indexOf(ch.Searches, query); i >= 0 {
+			ch.Searches = append(ch.Searches[:i], ch.Searches[i+1:]...)
+		}
+		ch.Searches = append([]string{query}, ch.Searches...)
+		if len(ch.Searches) > maxRecentSearches {
+			ch.Searches = ch.Searches[:maxRecentSearches]
+		}
+	})
+}
+
+// SaveSearch saves a query under a name for a browser, replacing a saved
+// search with the same name. An empty query deletes the saved search. It
+// reports false if the browser already has maxSavedSearches.
+func (h *History) SaveSearch(client, name, query string) bool {
+	saved := true
+	h.update(client, func(ch *ClientHistory) {
+		for i, s := range ch.SavedSearches {
+			if s.Name == name {
+				if query == "" {
+					ch.SavedSearches = append(ch.SavedSearches[:i], ch.SavedSearches[i+1:]...)
+				} else {
+					ch.SavedSearches[i].Query = query
+				}
+				return
+			}
+		}
+		if query == "" {
+			return
+		}
+		if len(ch.SavedSearches) >= maxSavedSearches {
+			saved = false
+			return
+		}
+		ch.SavedSearches = append(ch.SavedSearches, SavedSearch{Name: name, Query: query})
+	})
+	return saved
+}
+
+// update changes a browser's history, which is written by the next Save.
+// The least recently seen browsers are forgotten once there are more than
+// maxHistoryClients.
+func (h *History) update(client string, change func(*ClientHistory)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ch, ok := h.clients[client]
+	if !ok {
+		ch = &ClientHistory{}
+		h.clients[client] = ch
+	}
+	change(ch)
+	ch.Seen = time.Now()
+
+	if len(h.clients) > maxHistoryClients {
+		ids := make([]string, 0, len(h.clients))
+		for id := range h.clients {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return h.clients[ids[i]].Seen.Before(h.clients[ids[j]].Seen) })
+		for _, id := range ids[:len(ids)-maxHistoryClients] {
+			delete(h.clients, id)
+		}
+	}
+	h.dirty = true
+}
+
+// Save writes the history file if the history changed since the last save
+func (h *History) Save() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.dirty {
+		return
+	}
+	data, err := json.MarshalIndent(h.clients, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(h.path, data, 0644)
+	}
+	if err != nil {
+		slog.Warn("failed to save history", "file", h.path, "error", err)
+		return
+	}
+	h.dirty = false
+}
+
+// saveEvery saves the history every interval, for as long as the server runs
+func (h *History) saveEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		h.Save()
+	}
+}
+
+// indexOf returns the position of s in list, or -1
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
+
+// clientID returns the browser's ID from its cookie, setting a new one if it
+// has none
+func (a *App) clientID(w http.ResponseWriter, r *http.Request) string {
+	if cookie, err := r.Cookie(clientCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return ""
+	}
+	id := hex.EncodeToString(buf)
+	http.SetCookie(w, &http.Cookie{
+		Name:     clientCookieName,
+		Value:    id,
+		Path:     a.Config.BasePath + "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return id
+}
+
+// documentLinks resolves relative paths to documents, skipping the ones that
+// no longer exist or can't be read with access
+func (a *App) documentLinks(access *Access, relPaths []string) []DocumentLink {
+	var links []DocumentLink
+	for _, relPath := range relPaths {
+		if doc := a.findDocument(relPath); access.CanRead(doc) {
+			links = append(links, DocumentLink{Path: doc.RelPath, Title: doc.Title})
+		}
+	}
+	return links
+}
+
+// favoriteRequest is the body of POST /api/favorites
+type favoriteRequest struct {
+	Path     string `json:"path"`
+	Favorite bool   `json:"favorite"`
+}
+
+// handleRecent returns the recently viewed documents and favorites of the
+// requesting browser
+func (a *App) handleRecent(w http.ResponseWriter, r *http.Request) {
+	access := a.access(r)
+	recent, favorites := a.History.Get(a.clientID(w, r))
+	writeJSON(w, http.StatusOK, map[string][]DocumentLink{
+		"recent":    a.documentLinks(access, recent),
+		"favorites": a.documentLinks(access, favorites),
+	})
+}
+
+// handleFavorites stars (POST {"path": ..., "favorite": true}) or unstars a
+// document for the requesting browser
+func (a *App) handleFavorites(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !isSameOrigin(r) {
+		http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	var req favoriteRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHistoryBody)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+		return
+	}
+	doc := a.readableDocument(r, strings.TrimPrefix(req.Path, "/"))
+	if doc == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	client := a.clientID(w, r)
+	a.History.SetFavorite(client, doc.RelPath, req.Favorite)
+	_, favorites := a.History.Get(client)
+	writeJSON(w, http.StatusOK, map[string][]DocumentLink{"favorites": a.documentLinks(a.access(r), favorites)})
+}
+
+// searchRequest is the body of POST /api/searches
+type searchRequest struct {
+	Query string `json:"query"`
+	Name  string `json:"name"` // save the query under this name
+}
+
+// SearchHistory is the response of /api/searches
+type SearchHistory struct {
+	Recent []string      `json:"recent"`
+	Saved  []SavedSearch `json:"saved"`
+}
+
+// handleSearches returns the recent and saved searches of the requesting
+// browser (GET), records a search or saves it with a name (POST
+// {"query": ..., "name": ...}) and deletes a saved search (DELETE ?name=)
+func (a *App) handleSearches(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && !isSameOrigin(r) {
+		http.Error(w, "Cross-origin requests are not allowed", http.StatusForbidden)
+		return
+	}
+	client := a.clientID(w, r)
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req searchRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxHistoryBody)).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		query, name := strings.TrimSpace(req.Query), strings.TrimSpace(req.Name)
+		switch {
+		case query == "":
+			http.Error(w, "query is required", http.StatusBadRequest)
+			return
+		case utf8.RuneCountInString(query) > maxSearchQuery:
+			http.Error(w, fmt.Sprintf("query is longer than %d characters", maxSearchQuery), http.StatusBadRequest)
+			return
+		case utf8.RuneCountInString(name) > maxSearchName:
+			http.Error(w, fmt.Sprintf("name is longer than %d characters", maxSearchName), http.StatusBadRequest)
+			return
+		}
+		if name == "" {
+			a.History.Searched(client, query)
+		} else if !a.History.SaveSearch(client, name, query) {
+			http.Error(w, fmt.Sprintf("At most %d searches can be saved", maxSavedSearches), http.StatusConflict)
+			return
+		}
+	case http.MethodDelete:
+		name := strings.TrimSpace(r.URL.Query().Get("name"))
+		if name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		a.History.SaveSearch(client, name, "")
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	recent, saved := a.History.Searches(client)
+	writeJSON(w, http.StatusOK, SearchHistory{Recent: recent, Saved: saved})
+}
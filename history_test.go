@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHistorySave(t *testing.T) {
+	path := filepath.Join(t.TempDir(), historyFileName)
+	h := LoadHistory(path)
+	h.Viewed("client", "guide.md")
+	h.SetFavorite("client", "guide.md", true)
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("history written before Save: %v", err)
+	}
+
+	h.Save()
+	recent, favorites := LoadHistory(path).Get("client")
+	if len(recent) != 1 || len(favorites) != 1 {
+		t.Fatalf("got recent %v, favorites %v after Save", recent, favorites)
+	}
+
+	// Unchanged history isn't written again
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	h.Save()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("unchanged history written: %v", err)
+	}
+}
+
+func TestHandleSearches(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+	for _, tc := range []struct {
+		name   string
+		origin string
+		body   string
+		want   int
+	}{
+		{"record", "", `{"query": "runbook"}`, http.StatusOK},
+		{"save", "http://example.com", `{"query": "runbook", "name": "Runbooks"}`, http.StatusOK},
+		{"cross origin", "http://evil.example", `{"query": "runbook"}`, http.StatusForbidden},
+		{"long query", "", `{"query": "` + strings.Repeat("a", maxSearchQuery+1) + `"}`, http.StatusBadRequest},
+		{"long name", "", `{"query": "runbook", "name": "` + strings.Repeat("a", maxSearchName+1) + `"}`, http.StatusBadRequest},
+		{"large body", "", `{"query": "runbook", "x": "` + strings.Repeat("a", maxHistoryBody) + `"}`, http.StatusBadRequest},
+	} {
+		r := httptest.NewRequest(http.MethodPost, "http://example.com/api/searches", strings.NewReader(tc.body))
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		w := httptest.NewRecorder()
+		a.handleSearches(w, r)
+		if w.Code != tc.want {
+			t.Errorf("%s: got %d %q, want %d", tc.name, w.Code, w.Body, tc.want)
+		}
+	}
+}
+
+func TestHandleFavoritesCrossOrigin(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+	r := httptest.NewRequest(http.MethodPost, "http://example.com/api/favorites", strings.NewReader(`{"path": "guide.md", "favorite": true}`))
+	r.Header.Set("Origin", "http://evil.example")
+	w := httptest.NewRecorder()
+	a.handleFavorites(w, r)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("got %d %q, want %d", w.Code, w.Body, http.StatusForbidden)
+	}
+}
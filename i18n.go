@@ -0,0 +1,120 @@
+package main
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// defaultLanguage is the language of documents without a language marker
+// when default_language is not configured
+const defaultLanguage = "en"
+
+// languageCodes are the ISO 639-1 codes recognized in file and directory
+// names. Only these are detected, so names like "notes.v2.md" or a "ui"
+// directory are not mistaken for translations.
+var languageCodes = map[string]bool{
+	"ar": true, "bg": true, "bn": true, "ca": true, "cs": true, "da": true, "de": true, "el": true,
+	"en": true, "es": true, "et": true, "eu": true, "fa": true, "fi": true, "fr": true, "gl": true,
+	"he": true, "hi": true, "hr": true, "hu": true, "id": true, "it": true, "ja": true, "ko": true,
+	"lt": true, "lv": true, "ms": true, "nb": true, "nl": true, "no": true, "pl": true, "pt": true,
+	"ro": true, "ru": true, "sk": true, "sl": true, "sr": true, "sv": true, "th": true, "tr": true,
+	"uk": true, "vi": true, "zh": true,
+}
+
+// languageTag matches a language code with an optional region: "es", "pt-BR", "zh_CN"
+var languageTag = regexp.MustCompile(`^([A-Za-z]{2})(?:[-_]([A-Za-z]{2}))?$`)
+
+// normalizeLanguage returns a recognized language tag in canonical form
+// ("pt-BR"), or "" if s is not one
+func normalizeLanguage(s string) string {
+	m := languageTag.FindStringSubmatch(s)
+	if m == nil || !languageCodes[strings.ToLower(m[1])] {
+		return ""
+	}
+	if m[2] == "" {
+		return strings.ToLower(m[1])
+	}
+	return strings.ToLower(m[1]) + "-" + strings.ToUpper(m[2])
+}
+
+// detectLanguage returns the language marked in a document's relative path,
+// by a suffix ("README.es.md") or a directory ("docs/es/guide.md"), and the
+// path with the marker removed, which is the same for all translations of a
+// document. The language is "" if the path has no marker.
+func detectLanguage(relPath string) (language, key string) {
+	relPath = strings.ReplaceAll(relPath, "\\", "/")
+	dir, file := path.Split(relPath)
+
+	parts := strings.Split(file, ".")
+	if len(parts) >= 3 {
+		if lang := normalizeLanguage(parts[len(parts)-2]); lang != "" {
+			parts = append(parts[:len(parts)-2], parts[len(parts)-1])
+			return lang, dir + strings.Join(parts, ".")
+		}
+	}
+
+	segments := strings.Split(strings.TrimSuffix(dir, "/"), "/")
+	for i, segment := range segments {
+		if lang := normalizeLanguage(segment); lang != "" {
+			segments = append(segments[:i:i], segments[i+1:]...)
+			return lang, path.Join(append(segments, file)...)
+		}
+	}
+	return "", relPath
+}
+
+// documentLanguage returns the language of a document, falling back to the
+// configured default language
+func (a *App) documentLanguage(doc *Document) string {
+	if doc.Language != "" {
+		return doc.Language
+	}
+	if a.Config.DefaultLanguage != "" {
+		return normalizeLanguage(a.Config.DefaultLanguage)
+	}
+	return defaultLanguage
+}
+
+// Translation is a version of a document in another language
+type Translation struct {
+	Language string
+	Path     string // relative path
+	Current  bool
+}
+
+// translationsOf returns the versions of doc in every language, sorted by
+// language with the default language first, or nil if it has none
+func (a *App) translationsOf(doc *Document) []Translation {
+	_, key := detectLanguage(doc.RelPath)
+	var translations []Translation
+	seen := make(map[string]bool)
+	for i := range a.Documents {
+		other := &a.Documents[i]
+		if other.SourceName != doc.SourceName {
+			continue
+		}
+		if _, otherKey := detectLanguage(other.RelPath); otherKey != key {
+			continue
+		}
+		lang := a.documentLanguage(other)
+		if seen[lang] {
+			continue
+		}
+		seen[lang] = true
+		translations = append(translations, Translation{Language: lang, Path: other.RelPath, Current: other.RelPath == doc.RelPath})
+	}
+	if len(translations) < 2 {
+		return nil
+	}
+
+	defaultLang := a.documentLanguage(&Document{})
+	sort.Slice(translations, func(i, j int) bool {
+		if (translations[i].Language == defaultLang) != (translations[j].Language == defaultLang) {
+			return translations[i].Language == defaultLang
+		}
+		return translations[i].Language < translations[j].Language
+	})
+	return translations
+}
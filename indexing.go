@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Initial scan states reported by /api/scan/status
+const (
+	indexingScanning = "scanning"
+	indexingReady    = "ready"
+	indexingFailed   = "failed"
+)
+
+// indexingState tracks the first scan of the directories when it runs in
+// the background while the server already answers requests
+type indexingState struct {
+	mu       sync.Mutex
+	running  bool // set before the server starts, until the scan ends
+	started  time.Time
+	finished time.Time
+	err      error
+}
+
+// ScanStatus is the response of /api/scan/status
+type ScanStatus struct {
+	State     string     `json:"state"`     // "scanning", "ready" or "failed"
+	Walked    int64      `json:"walked"`    // files visited so far
+	Matched   int64      `json:"matched"`   // files matching a file pattern so far
+	Processed int64      `json:"processed"` // matching files processed so far
+	Documents int        `json:"documents"` // documents found, once ready
+	Started   *time.Time `json:"started,omitempty"`
+	Duration  string     `json:"duration,omitempty"` // of the scan, or so far
+	Error     string     `json:"error,omitempty"`
+	Limit     string     `json:"limit,omitempty"` // that stopped the scan early, documents are missing
+}
+
+// scanInBackground runs the first scan of the directories. Pages show its
+// progress until the documents are swapped in; re-scans wait for it.
+func (a *App) scanInBackground() {
+	a.indexing.mu.Lock()
+	a.indexing.started = time.Now()
+	a.indexing.mu.Unlock()
+
+	a.rescanMu.Lock()
+	err := a.scanDocuments()
+	a.rescanMu.Unlock()
+
+	a.indexing.mu.Lock()
+	a.indexing.running, a.indexing.finished, a.indexing.err = false, time.Now(), err
+	duration := a.indexing.finished.Sub(a.indexing.started).Round(time.Millisecond)
+	a.indexing.mu.Unlock()
+	if err != nil {
+		slog.Error("failed to scan directories", "error", err)
+		return
+	}
+	slog.Info("documents scanned", "documents", len(a.Documents), "duration", duration)
+}
+
+// isIndexing reports whether the first scan is still running
+func (a *App) isIndexing() bool {
+	a.indexing.mu.Lock()
+	defer a.indexing.mu.Unlock()
+	return a.indexing.running
+}
+
+// scanStatus returns the progress of the first scan
+func (a *App) scanStatus() ScanStatus {
+	a.indexing.mu.Lock()
+	defer a.indexing.mu.Unlock()
+	status := ScanStatus{State: indexingReady}
+	switch {
+	case a.indexing.running:
+		status.State = indexingScanning
+	case a.indexing.err != nil:
+		status.State, status.Error = indexingFailed, a.indexing.err.Error()
+	}
+	if !a.indexing.started.IsZero() {
+		started := a.indexing.started
+		status.Started = &started
+		end := a.indexing.finished
+		if end.IsZero() {
+			end = time.Now()
+		}
+		status.Duration = end.Sub(started).Round(time.Millisecond).String()
+	}
+	if progress := a.scanProgress(); progress != nil {
+		status.Walked, status.Matched, status.Processed = progress.Walked(), progress.Matched(), progress.Processed()
+		status.Limit = progress.Limit()
+	}
+	if status.State == indexingReady {
+		status.Documents = len(a.Documents)
+	}
+	return status
+}
+
+// handleScanStatus reports the progress of the first scan of the
+// directories, "ready" once documents can be browsed
+func (a *App) handleScanStatus(w http.ResponseWriter, r *http.Request) {
+	status := a.scanStatus()
+	// Only count the documents of the requesting user, and keep scan errors
+	// (which name files) to admins
+	if access := a.access(r); access != nil && status.State == indexingReady {
+		status.Documents = 0
+		for i := range a.Documents {
+			if access.CanRead(&a.Documents[i]) {
+				status.Documents++
+			}
+		}
+	}
+	if status.Error != "" && !a.isAdmin(r) && !isLocalRequest(r) {
+		status.Error = "the scan failed, see the server log"
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, status)
+}
+
+// serveIndexing answers a request for a page that may only exist once the
+// first scan is done: with a page showing its progress, which opens the
+// requested one when ready. It reports false once the scan has ended.
+func (a *App) serveIndexing(w http.ResponseWriter, r *http.Request) bool {
+	if !a.isIndexing() {
+		return false
+	}
+	tmpl, err := a.parseTemplates("templates/indexing.html")
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return true
+	}
+	var buf bytes.Buffer
+	data := struct{ Title, Path string }{a.Config.Title, r.URL.Path}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to execute template: %v", err), http.StatusInternalServerError)
+		return true
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Retry-After", "2")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write(buf.Bytes())
+	return true
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// initMaxDepth limits how deep `dimandocs init` looks for documentation
+const initMaxDepth = 3
+
+// docsDirNames are directory names that usually hold documentation
+var docsDirNames = map[string]bool{
+	"docs": true, "doc": true, "documentation": true, "wiki": true,
+	"adr": true, "adrs": true, "decisions": true, "guides": true,
+}
+
+// readmePattern matches README files
+var readmePattern = regexp.MustCompile(`^(?i)readme\.md$`)
+
+// initOptions are the flags of the init command
+type initOptions struct {
+	output string
+	format string
+	title  string
+	port   string
+	from   string
+	yes    bool
+	force  bool
+}
+
+// initConfig is the subset of Config written by `dimandocs init`
+type initConfig struct {
+	Directories    []DirectoryConfig `json:"directories"`
+	Port           string            `json:"port"`
+	Title          string            `json:"title"`
+	IgnorePatterns []string          `json:"ignore_patterns"`
+}
+
+// runInit implements `dimandocs init`: it detects documentation in the current
+// directory and writes a config file for it
+func runInit(args []string) error {
+	opts := initOptions{}
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	fs.StringVar(&opts.output, "output", "", "Config file to write (default: dimandocs.json, or dimandocs.yaml with --format=yaml)")
+	fs.StringVar(&opts.format, "format", "", "Config format: json or yaml (default: from --output extension, or json)")
+	fs.StringVar(&opts.title, "title", "", "Title displayed in the web interface")
+	fs.StringVar(&opts.port, "port", "8090", "Port for the web server")
+	fs.StringVar(&opts.from, "from", "", "Import the docs and their navigation order from a mkdocs.yml or Docusaurus sidebars.js")
+	fs.BoolVar(&opts.yes, "yes", false, "Accept the detected directories without asking")
+	fs.BoolVar(&opts.force, "force", false, "Overwrite an existing config file")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: dimandocs init [OPTIONS]\n\nGenerate a config file for the documentation found in the current directory.\n\nOPTIONS:\n")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if opts.format == "" {
+		opts.format = "json"
+		if opts.output != "" {
+			opts.format = configFormat(opts.output)
+		}
+	}
+	if opts.format != "json" && opts.format != "yaml" {
+		return fmt.Errorf("unsupported format '%s' (use json or yaml)", opts.format)
+	}
+	if opts.output == "" {
+		opts.output = "dimandocs." + opts.format
+	}
+	if _, err := os.Stat(opts.output); err == nil && !opts.force {
+		return fmt.Errorf("%s already exists (use --force to overwrite)", opts.output)
+	}
+
+	workingDir, err := GetWorkingDirectory()
+	if err != nil {
+		return err
+	}
+
+	defaults := getDefaultConfig()
+	config := initConfig{
+		Port:           opts.port,
+		Title:          opts.title,
+		IgnorePatterns: defaults.IgnorePatterns,
+	}
+	if config.Title == "" {
+		config.Title = titleCase(filepath.Base(workingDir)) + " Documentation"
+	}
+
+	var proposals []DirectoryConfig
+	if opts.from != "" {
+		imported, err := importNav(opts.from, workingDir)
+		if err != nil {
+			return err
+		}
+		if imported.Title != "" && opts.title == "" {
+			config.Title = imported.Title
+		}
+		proposals = append(proposals, imported.Directory)
+		fmt.Printf("Imported the navigation of %d documents from %s\n", len(imported.Directory.Nav), opts.from)
+		for _, missing := range imported.Missing {
+			fmt.Fprintf(os.Stderr, "  not found, skipped: %s\n", missing)
+		}
+	} else if proposals, err = detectDocsDirectories(workingDir, defaults.IgnorePatterns); err != nil {
+		return err
+	}
+
+	interactive := !opts.yes && isTerminal(os.Stdin)
+	if interactive {
+		in := bufio.NewReader(os.Stdin)
+		fmt.Printf("Creating %s for %s\n\n", opts.output, workingDir)
+		for _, dir := range proposals {
+			if !askYesNo(in, fmt.Sprintf("Include %s (%s)?", dir.Path, describePattern(dir)), true) {
+				continue
+			}
+			dir.Name = ask(in, "  Name", dir.Name)
+			config.Directories = append(config.Directories, dir)
+		}
+		config.Title = ask(in, "Title", config.Title)
+		config.Port = ask(in, "Port", config.Port)
+		fmt.Println()
+	} else {
+		config.Directories = proposals
+	}
+
+	if len(config.Directories) == 0 {
+		config.Directories = defaults.Directories
+	}
+
+	var data []byte
+	if opts.format == "yaml" {
+		data = formatInitYAML(config)
+	} else {
+		data, err = json.MarshalIndent(config, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode config: %w", err)
+		}
+		data = append(data, '\n')
+	}
+
+	if err := ioutil.WriteFile(opts.output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", opts.output, err)
+	}
+
+	fmt.Printf("Wrote %s with %d director", opts.output, len(config.Directories))
+	if len(config.Directories) == 1 {
+		fmt.Println("y:")
+	} else {
+		fmt.Println("ies:")
+	}
+	for _, dir := range config.Directories {
+		fmt.Printf("  %-30s %s (%s)\n", dir.Path, dir.Name, describePattern(dir))
+	}
+	fmt.Printf("\nRun 'dimandocs' to browse them. See the README for all configuration options.\n")
+	return nil
+}
+
+// detectDocsDirectories proposes directories to browse: well-known
+// documentation folders (docs/, wiki/, ...) and README files elsewhere
+func detectDocsDirectories(root string, ignorePatterns []string) ([]DirectoryConfig, error) {
+	var ignores []*regexp.Regexp
+	for _, pattern := range ignorePatterns {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile ignore pattern '%s': %w", pattern, err)
+		}
+		ignores = append(ignores, regex)
+	}
+
+	var docsDirs []string
+	hasReadmes := false
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		relPath, err := filepath.Rel(root, path)
+		if err != nil || relPath == "." {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		for _, regex := range ignores {
+			if regex.MatchString(relPath) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".") || strings.Count(relPath, "/") >= initMaxDepth {
+				return filepath.SkipDir
+			}
+			if docsDirNames[strings.ToLower(info.Name())] {
+				docsDirs = append(docsDirs, relPath)
+				// Everything below is covered by this directory
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if readmePattern.MatchString(info.Name()) {
+			hasReadmes = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %w", root, err)
+	}
+
+	sort.Strings(docsDirs)
+	var proposals []DirectoryConfig
+	for _, dir := range docsDirs {
+		proposals = append(proposals, DirectoryConfig{
+			Path:        "./" + dir,
+			Name:        titleCase(dir),
+			FilePattern: `\.md$`,
+		})
+	}
+	if hasReadmes {
+		proposals = append(proposals, DirectoryConfig{
+			Path:        "./",
+			Name:        "READMEs",
+			FilePattern: readmePattern.String(),
+		})
+	}
+	return proposals, nil
+}
+
+// titleCase turns a path or file name into a display name, e.g.
+// "docs/user-guide" becomes "Docs / User Guide"
+func titleCase(name string) string {
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		words := strings.FieldsFunc(part, func(r rune) bool {
+			return r == '-' || r == '_' || r == ' ' || r == '.'
+		})
+		for j, word := range words {
+			r := []rune(word)
+			words[j] = strings.ToUpper(string(r[0])) + string(r[1:])
+		}
+		parts[i] = strings.Join(words, " ")
+	}
+	return strings.Join(parts, " / ")
+}
+
+// describePattern summarizes which files of a directory are included
+func describePattern(dir DirectoryConfig) string {
+	if dir.FilePattern == readmePattern.String() {
+		return "README files"
+	}
+	if dir.FilePattern == `\.mdx?$` {
+		return "all .md and .mdx files"
+	}
+	return "all .md files"
+}
+
+// isTerminal reports whether f is an interactive terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// ask prompts for a value, returning def if the answer is empty
+func ask(in *bufio.Reader, prompt, def string) string {
+	fmt.Printf("%s [%s]: ", prompt, def)
+	answer, _ := in.ReadString('\n')
+	if answer = strings.TrimSpace(answer); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// askYesNo prompts for a yes/no answer, returning def if the answer is empty
+func askYesNo(in *bufio.Reader, prompt string, def bool) bool {
+	hint := "Y/n"
+	if !def {
+		hint = "y/N"
+	}
+	fmt.Printf("%s [%s]: ", prompt, hint)
+	answer, _ := in.ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// formatInitYAML writes config as YAML, with comments describing the
+// settings and examples of optional ones
+func formatInitYAML(config initConfig) []byte {
+	var b strings.Builder
+	b.WriteString("# DimanDocs configuration, generated by `dimandocs init`.\n")
+	b.WriteString("# See the README for all options.\n\n")
+	fmt.Fprintf(&b, "# Title displayed in the web interface\ntitle: %s\n\n", yamlQuote(config.Title))
+	fmt.Fprintf(&b, "# Port for the web server (a string)\nport: %s\n\n", yamlQuote(config.Port))
+
+	b.WriteString("# Directories to browse. file_pattern is a regex matched against file names;\n")
+	b.WriteString("# use file_patterns and pattern_type: glob for globs like docs/**/*.md\n")
+	b.WriteString("directories:\n")
+	for _, dir := range config.Directories {
+		fmt.Fprintf(&b, "  - path: %s\n", yamlQuote(dir.Path))
+		fmt.Fprintf(&b, "    name: %s\n", yamlQuote(dir.Name))
+		fmt.Fprintf(&b, "    file_pattern: %s\n", yamlQuote(dir.FilePattern))
+		if len(dir.Nav) > 0 {
+			b.WriteString("    # Order of documents in the trees, before those not listed\n")
+			b.WriteString("    nav:\n")
+			for _, entry := range dir.Nav {
+				fmt.Fprintf(&b, "      - %s\n", yamlQuote(entry))
+			}
+		}
+	}
+
+	b.WriteString("\n# Regex patterns for paths to skip while scanning\n")
+	b.WriteString("ignore_patterns:\n")
+	for _, pattern := range config.IgnorePatterns {
+		fmt.Fprintf(&b, "  - %s\n", yamlQuote(pattern))
+	}
+
+	b.WriteString(`
+# Optional settings (uncomment to use):
+# respect_gitignore: true      # skip files excluded by .gitignore
+# follow_symlinks: true        # scan directories linked into the tree
+# max_file_size: 1048576       # skip documents larger than 1 MB
+# search:
+#   fields: [title, overview, content]
+# editor_command: 'code -g {file}:{line}'
+`)
+	return []byte(b.String())
+}
+
+// yamlQuote returns s as a single-quoted YAML string, where backslashes need
+// no escaping
+func yamlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
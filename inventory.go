@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// InventoryEntry is a document as printed by `dimandocs list`
+type InventoryEntry struct {
+	Title  string `json:"title"`
+	Path   string `json:"path"`   // relative to its source directory
+	Source string `json:"source"` // name of the configured directory
+	File   string `json:"file"`   // path on disk
+}
+
+// InventoryNode is a tree node as printed by `dimandocs tree --format=json`
+type InventoryNode struct {
+	Name     string           `json:"name"`
+	Path     string           `json:"path,omitempty"`
+	Title    string           `json:"title,omitempty"` // files only
+	Children []*InventoryNode `json:"children,omitempty"`
+}
+
+// loadCommandApp loads the config and scans the documents for commands that
+// work on the document set without starting a server
+func loadCommandApp(configFile, targetPath string) (*App, error) {
+	a := NewApp()
+	workingDir, err := GetWorkingDirectory()
+	if err != nil {
+		return nil, err
+	}
+	a.WorkingDir = workingDir
+	if err := a.LoadConfig(configFile, targetPath); err != nil {
+		return nil, err
+	}
+	a.Markdown = newMarkdownRenderer(a.Config, a.resolveWikiLink)
+	if err := a.ScanDirectories(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// runInventory implements `dimandocs list` and `dimandocs tree`
+func runInventory(command string, args []string) error {
+	fs := flag.NewFlagSet(command, flag.ExitOnError)
+	configFile := fs.String("config-file", os.Getenv("DIMANDOCS_CONFIG_FILE"), "Path to configuration file (default: dimandocs.json if exists)")
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid format '%s' (use text or json)", *format)
+	}
+
+	a, err := loadCommandApp(*configFile, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if command == "tree" {
+		trees := a.BuildDirectoryTrees()
+		if *format == "json" {
+			nodes := make([]*InventoryNode, len(trees))
+			for i, tree := range trees {
+				nodes[i] = inventoryNode(tree.Root)
+			}
+			return printJSON(nodes)
+		}
+		for _, tree := range trees {
+			fmt.Println(tree.Name)
+			printTree(os.Stdout, tree.Root, "")
+		}
+		return nil
+	}
+
+	var entries []InventoryEntry
+	for _, group := range a.GroupDocumentsByDirectory() {
+		for _, doc := range group.Documents {
+			entries = append(entries, InventoryEntry{Title: doc.Title, Path: doc.RelPath, Source: doc.SourceName, File: doc.Path})
+		}
+	}
+	if *format == "json" {
+		if entries == nil {
+			entries = []InventoryEntry{}
+		}
+		return printJSON(entries)
+	}
+	for _, entry := range entries {
+		fmt.Printf("%s\t%s\t%s\n", entry.Source, entry.Path, entry.Title)
+	}
+	fmt.Fprintf(os.Stderr, "%d documents in %d directories\n", len(entries), len(a.Config.Directories))
+	return nil
+}
+
+// inventoryNode converts a document tree for JSON output
+func inventoryNode(node *TreeNode) *InventoryNode {
+	out := &InventoryNode{Name: node.Name, Path: node.Path}
+	if node.Document != nil {
+		out.Title = node.Document.Title
+	}
+	for _, child := range node.Children {
+		out.Children = append(out.Children, inventoryNode(child))
+	}
+	return out
+}
+
+// printTree prints the children of node with box-drawing connectors, files
+// followed by their title
+func printTree(w io.Writer, node *TreeNode, prefix string) {
+	for i, child := range node.Children {
+		connector, indent := "├── ", "│   "
+		if i == len(node.Children)-1 {
+			connector, indent = "└── ", "    "
+		}
+		if child.IsFile {
+			fmt.Fprintf(w, "%s%s%s  %s\n", prefix, connector, child.Name, child.Document.Title)
+			continue
+		}
+		fmt.Fprintf(w, "%s%s%s/\n", prefix, connector, child.Name)
+		printTree(w, child, prefix+indent)
+	}
+}
+
+// printJSON writes v to stdout as indented JSON
+func printJSON(v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
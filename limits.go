@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// scanLimits are the safety valves of a scan, so pointing dimandocs at "/"
+// or a slow network mount neither hangs nor exhausts memory. Once a limit
+// is reached every walker stops and the documents found so far are used.
+type scanLimits struct {
+	maxFiles int64     // files visited, 0 for no limit
+	maxSize  int64     // total size of the documents found, 0 for no limit
+	deadline time.Time // zero for no limit
+
+	size    atomic.Int64 // of the documents queued so far
+	stopped atomic.Bool
+	once    sync.Once
+}
+
+// newScanLimits returns the limits of a scan starting now
+func (a *App) newScanLimits() *scanLimits {
+	limits := &scanLimits{maxFiles: a.Config.MaxScanFiles, maxSize: a.Config.MaxScanSize}
+	if timeout, err := time.ParseDuration(a.Config.ScanTimeout); err == nil && timeout > 0 {
+		limits.deadline = time.Now().Add(timeout)
+	}
+	return limits
+}
+
+// exceeded reports whether the walkers must stop, before visiting another
+// file. The reason is logged and recorded in progress once.
+func (l *scanLimits) exceeded(progress *ScanProgress) bool {
+	switch {
+	case l.stopped.Load():
+		return true
+	case l.maxFiles > 0 && progress.Walked() >= l.maxFiles:
+		l.stop(progress, fmt.Sprintf("max_scan_files (%d files visited)", l.maxFiles))
+	case !l.deadline.IsZero() && time.Now().After(l.deadline):
+		l.stop(progress, "scan_timeout")
+	default:
+		return false
+	}
+	return true
+}
+
+// add counts a matching file of the given size, reporting false if it
+// would go over max_scan_size
+func (l *scanLimits) add(progress *ScanProgress, size int64) bool {
+	if l.maxSize <= 0 {
+		return true
+	}
+	if l.size.Add(size) > l.maxSize {
+		l.stop(progress, fmt.Sprintf("max_scan_size (%d bytes of documents)", l.maxSize))
+		return false
+	}
+	return true
+}
+
+// stop ends the scan early, warning that documents may be missing
+func (l *scanLimits) stop(progress *ScanProgress, reason string) {
+	l.stopped.Store(true)
+	l.once.Do(func() {
+		progress.limit.Store(&reason)
+		slog.Warn("scan stopped early, some documents are missing", "limit", reason, "visited", progress.Walked(), "matched", progress.Matched())
+	})
+}
+
+// checkScanLimits validates max_scan_files, max_scan_size, scan_timeout and
+// max_download_size
+func (v *configValidator) checkScanLimits(config Config) {
+	if config.MaxScanFiles < 0 {
+		v.add("max_scan_files", "must not be negative")
+	}
+	if config.MaxScanSize < 0 {
+		v.add("max_scan_size", "must not be negative")
+	}
+	if config.MaxDownloadSize < 0 {
+		v.add("max_download_size", "must not be negative")
+	}
+	if config.ScanTimeout != "" {
+		if timeout, err := time.ParseDuration(config.ScanTimeout); err != nil || timeout <= 0 {
+			v.add("scan_timeout", "invalid duration %q (use e.g. \"30s\" or \"5m\")", config.ScanTimeout)
+		}
+	}
+}
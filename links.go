@@ -0,0 +1,364 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+// MarkdownLink is a link or image found in a document
+type MarkdownLink struct {
+	Target string // for wiki links, the page and heading ("Page#heading")
+	Line   int
+	Image  bool
+	Wiki   bool
+}
+
+// BrokenLink is a link whose target does not exist or cannot be reached
+type BrokenLink struct {
+	Document string `json:"document"` // relative path of the document containing the link
+	Line     int    `json:"line"`
+	Target   string `json:"target"`
+	Reason   string `json:"reason"`
+}
+
+// extractLinks parses markdown and returns its links, images, autolinks and
+// wiki links with the line they appear on. Links inside code are not links and are
+// ignored by the parser.
+func (a *App) extractLinks(content string) []MarkdownLink {
+	source := []byte(content)
+	doc := a.Markdown.Parser().Parse(text.NewReader(source))
+
+	var links []MarkdownLink
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		var link MarkdownLink
+		switch node := n.(type) {
+		case *ast.Link:
+			link = MarkdownLink{Target: string(node.Destination)}
+		case *ast.Image:
+			link = MarkdownLink{Target: string(node.Destination), Image: true}
+		case *ast.AutoLink:
+			if node.AutoLinkType != ast.AutoLinkURL {
+				return ast.WalkContinue, nil
+			}
+			link = MarkdownLink{Target: string(node.URL(source))}
+		case *WikiLink:
+			line := bytes.Count(source[:node.Start], []byte("\n")) + 1
+			links = append(links, MarkdownLink{Target: node.Destination(), Line: line, Wiki: true})
+			return ast.WalkContinue, nil
+		default:
+			return ast.WalkContinue, nil
+		}
+		link.Line = nodeLine(n, source)
+		links = append(links, link)
+		return ast.WalkContinue, nil
+	})
+	return links
+}
+
+// nodeLine returns the line of an inline node from the position of its text,
+// or else the first line of the block containing it
+func nodeLine(n ast.Node, source []byte) int {
+	for c := n.FirstChild(); c != nil; c = c.FirstChild() {
+		if t, ok := c.(*ast.Text); ok {
+			return bytes.Count(source[:t.Segment.Start], []byte("\n")) + 1
+		}
+	}
+	for p := n; p != nil; p = p.Parent() {
+		if p.Type() == ast.TypeBlock && p.Lines().Len() > 0 {
+			return bytes.Count(source[:p.Lines().At(0).Start], []byte("\n")) + 1
+		}
+	}
+	return 0
+}
+
+// isExternalLink reports whether a link target has a scheme ("https:",
+// "mailto:") or is protocol relative ("//host/path")
+func isExternalLink(target string) bool {
+	if strings.HasPrefix(target, "//") {
+		return true
+	}
+	u, err := url.Parse(target)
+	return err == nil && u.Scheme != ""
+}
+
+// resolveLink returns the file an internal link of doc points to and its
+// fragment. Relative targets are resolved from the document's directory,
+// targets starting with "/" from its source directory. An empty path means
+// the link points into the document itself ("#section").
+func resolveLink(doc *Document, target string) (path, fragment string) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return filepath.Join(filepath.Dir(doc.Path), filepath.FromSlash(target)), ""
+	}
+	if u.Path == "" {
+		return "", u.Fragment
+	}
+	if strings.HasPrefix(u.Path, "/") {
+		return filepath.Join(doc.SourceDir, filepath.FromSlash(u.Path)), u.Fragment
+	}
+	return filepath.Join(filepath.Dir(doc.Path), filepath.FromSlash(u.Path)), u.Fragment
+}
+
+// LinkCheckOptions controls what checkLinks verifies
+type LinkCheckOptions struct {
+	External bool          // also request http(s) links
+	Timeout  time.Duration // per external request
+	Access   *Access       // only check the documents it can read, all if nil
+}
+
+// LinkReport is the result of checking the links of all documents
+type LinkReport struct {
+	Documents int          `json:"documents"`
+	Links     int          `json:"links"`
+	Broken    []BrokenLink `json:"broken"`
+}
+
+// externalCheckWorkers is the number of external links requested at once
+const externalCheckWorkers = 8
+
+// checkLinks checks the links of every document. Internal links must point
+// to an existing file and, for markdown files, to an existing heading when
+// they have a fragment ("guide.md#setup", "#usage"). Wiki links must name a
+// known document. External links are only requested with opts.External.
+func (a *App) checkLinks(opts LinkCheckOptions) LinkReport {
+	report := LinkReport{Broken: []BrokenLink{}}
+	anchors := make(map[string]map[string]bool) // file -> heading IDs
+	external := make(map[string][]BrokenLink)   // URL -> links to it
+
+	for i := range a.Documents {
+		doc := &a.Documents[i]
+		if !opts.Access.CanRead(doc) {
+			continue
+		}
+		report.Documents++
+		content, err := a.readDocumentContent(doc)
+		if err != nil {
+			continue
+		}
+		anchors[doc.Path] = a.headingAnchors(content)
+
+		for _, link := range a.extractLinks(content) {
+			if link.Target == "" {
+				continue
+			}
+			report.Links++
+			broken := BrokenLink{Document: doc.RelPath, Line: link.Line, Target: link.Target}
+
+			var path, fragment string
+			switch {
+			case link.Wiki:
+				target, frag, ok := a.wikiLinkDocument(link.Target)
+				if !ok {
+					name, _ := splitWikiTarget(link.Target)
+					broken.Reason = fmt.Sprintf("no document named %q", name)
+					report.Broken = append(report.Broken, broken)
+					continue
+				}
+				if target != nil {
+					path = target.Path
+				}
+				fragment = frag
+			case isExternalLink(link.Target):
+				if opts.External && (strings.HasPrefix(link.Target, "http://") || strings.HasPrefix(link.Target, "https://")) {
+					external[link.Target] = append(external[link.Target], broken)
+				}
+				continue
+			default:
+				path, fragment = resolveLink(doc, link.Target)
+				if path != "" {
+					if _, err := os.Stat(path); err != nil {
+						broken.Reason = "file not found"
+						report.Broken = append(report.Broken, broken)
+						continue
+					}
+				}
+			}
+			if path == "" {
+				path = doc.Path
+			}
+			if fragment == "" || !isMarkdownFile(path) {
+				continue
+			}
+			if _, ok := anchors[path]; !ok {
+				data, err := ioutil.ReadFile(path)
+				if err != nil {
+					continue
+				}
+				anchors[path] = a.headingAnchors(string(data))
+			}
+			if !anchors[path][fragment] {
+				broken.Reason = fmt.Sprintf("heading #%s not found", fragment)
+				report.Broken = append(report.Broken, broken)
+			}
+		}
+	}
+
+	if len(external) > 0 {
+		for target, reason := range checkExternalLinks(external, opts.Timeout) {
+			for _, broken := range external[target] {
+				broken.Reason = reason
+				report.Broken = append(report.Broken, broken)
+			}
+		}
+	}
+
+	sort.SliceStable(report.Broken, func(i, j int) bool {
+		if report.Broken[i].Document != report.Broken[j].Document {
+			return report.Broken[i].Document < report.Broken[j].Document
+		}
+		return report.Broken[i].Line < report.Broken[j].Line
+	})
+	return report
+}
+
+// isMarkdownFile reports whether path has a markdown extension
+func isMarkdownFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".md" || ext == ".markdown"
+}
+
+// headingAnchors returns the IDs generated for the headings of markdown
+func (a *App) headingAnchors(content string) map[string]bool {
+	doc := a.Markdown.Parser().Parse(text.NewReader([]byte(content)))
+	ids := make(map[string]bool)
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if heading, ok := n.(*ast.Heading); ok && entering {
+			if id, ok := heading.AttributeString("id"); ok {
+				if b, ok := id.([]byte); ok {
+					ids[string(b)] = true
+				}
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return ids
+}
+
+// checkExternalLinks requests every URL concurrently and returns the reason
+// each broken one failed. HEAD is tried first, falling back to GET for
+// servers that do not support it.
+func checkExternalLinks(links map[string][]BrokenLink, timeout time.Duration) map[string]string {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	client := &http.Client{Timeout: timeout}
+
+	urls := make(chan string)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failed := make(map[string]string)
+	for i := 0; i < externalCheckWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range urls {
+				if reason := checkExternalLink(client, target); reason != "" {
+					mu.Lock()
+					failed[target] = reason
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for target := range links {
+		urls <- target
+	}
+	close(urls)
+	wg.Wait()
+	return failed
+}
+
+// checkExternalLink requests a URL and returns why it is broken, or ""
+func checkExternalLink(client *http.Client, target string) string {
+	var status int
+	var statusText string
+	for _, method := range []string{http.MethodHead, http.MethodGet} {
+		req, err := http.NewRequest(method, target, nil)
+		if err != nil {
+			return fmt.Sprintf("invalid URL: %v", err)
+		}
+		req.Header.Set("User-Agent", "dimandocs-linkcheck/"+Version)
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Sprintf("request failed: %v", err)
+		}
+		resp.Body.Close()
+		status, statusText = resp.StatusCode, resp.Status
+		if status < 400 || (status != http.StatusMethodNotAllowed && status != http.StatusForbidden && status != http.StatusNotImplemented) {
+			break
+		}
+	}
+	if status >= 400 {
+		return "HTTP " + statusText
+	}
+	return ""
+}
+
+// errBrokenLinks makes check-links exit with status 1 when links are broken
+var errBrokenLinks = errors.New("broken links found")
+
+// runCheckLinks implements `dimandocs check-links`
+func runCheckLinks(args []string) error {
+	fs := flag.NewFlagSet("check-links", flag.ExitOnError)
+	configFile := fs.String("config-file", os.Getenv("DIMANDOCS_CONFIG_FILE"), "Path to configuration file (default: dimandocs.json if exists)")
+	external := fs.Bool("external", false, "Also request external http(s) links")
+	timeout := fs.Duration("timeout", 10*time.Second, "Timeout for each external request")
+	format := fs.String("format", "text", "Output format: text or json")
+	fs.Parse(args)
+	if *format != "text" && *format != "json" {
+		return fmt.Errorf("invalid format '%s' (use text or json)", *format)
+	}
+
+	a, err := loadCommandApp(*configFile, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	report := a.checkLinks(LinkCheckOptions{External: *external, Timeout: *timeout})
+	if *format == "json" {
+		if err := printJSON(report); err != nil {
+			return err
+		}
+	} else {
+		for _, broken := range report.Broken {
+			fmt.Printf("%s:%d: %s (%s)\n", broken.Document, broken.Line, broken.Target, broken.Reason)
+		}
+		fmt.Fprintf(os.Stderr, "Checked %d links in %d documents: %d broken\n", report.Links, report.Documents, len(report.Broken))
+	}
+	if len(report.Broken) > 0 {
+		return errBrokenLinks
+	}
+	return nil
+}
+
+// handleLinkCheck checks the links of all documents and returns a LinkReport.
+// External links are requested with ?external=1, each with ?timeout (e.g. "5s").
+func (a *App) handleLinkCheck(w http.ResponseWriter, r *http.Request) {
+	opts := LinkCheckOptions{External: r.URL.Query().Get("external") == "1", Access: a.access(r)}
+	if value := r.URL.Query().Get("timeout"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Invalid timeout: %v", err), http.StatusBadRequest)
+			return
+		}
+		opts.Timeout = timeout
+	}
+	writeJSON(w, http.StatusOK, a.checkLinks(opts))
+}
@@ -1,10 +1,12 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"strings"
 )
 
 var (
@@ -13,28 +15,111 @@ var (
 	BuildTime = "unknown"
 )
 
+// stringList is a flag that can be given several times
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func printUsage() {
 	fmt.Fprintf(os.Stderr, `DimanDocs - A lightweight documentation browser for markdown files
 
 USAGE:
     dimandocs [OPTIONS] [PATH]
+    dimandocs init [--yes] [--format=json|yaml] [--output=<file>] [--title=<title>] [--port=<port>] [--from=<file>] [--force]
+    dimandocs start|restart [OPTIONS] [PATH]
+    dimandocs stop|status
+    dimandocs list|tree [--format=text|json] [--config-file=<file>] [PATH]
+    dimandocs render [--output=<file>] [--standalone] [--template=<file>] [--title=<title>] [--config-file=<file>] <FILE|->
+    dimandocs cache [status|clear|rebuild|path] [--format=text|json] [--config-file=<file>] [PATH]
+    dimandocs check-links [--external] [--timeout=<duration>] [--format=text|json] [--config-file=<file>] [PATH]
+    dimandocs publish --target=confluence|notion [--dry-run] [--force] [--include-restricted] [--config-file=<file>] [PATH]
+    dimandocs service install|uninstall [--name=<name>] [--config-file=<file>] [--system [--user=<user>]] [--print] [-- SERVER OPTIONS]
 
 PATH:
     If PATH is a directory: Browse all markdown files in that directory
     If PATH is a file:      Open browser directly to that file
-    If PATH is omitted:     Use current directory or dimandocs.json config
+    If PATH is omitted:     Use current directory or dimandocs.json/.yaml/.toml config
 
 OPTIONS:
-    --config-file <file>    Path to configuration file (default: dimandocs.json if exists)
+    --config-file <file>    Path to configuration file: JSON, YAML or TOML (default: $DIMANDOCS_CONFIG_FILE,
+                            or dimandocs.json if exists)
     --serve                 Start server without opening browser automatically
-    --cache                 Use cache file (.dimandocs-cache.json) to speed up loading
+    --cache                 Cache the document list in the user cache directory to speed up loading
+                            (see dimandocs cache path)
+    --editable              Allow editing documents from the browser (writes to disk)
+    --port <port>           Port for the web server (overrides config)
+    --title <title>         Title displayed in the web interface (overrides config)
+    --strict-port           Fail if the port is busy instead of using the next free one
+    --ignore <regex>        Ignore paths matching regex, in addition to ignore_patterns (repeatable)
+    --log-level <level>     Log level: debug, info, warn or error (default: info)
+    --log-format <format>   Log format: text or json (default: text)
+    --quiet                 Only log errors and skip the startup banner
+    --verbose               Log debug messages, including every HTTP request
+    --pid-file <file>       Write the PID and port of the server to this file while running
+    --no-browser            Never try to open a browser (xdg-open, open, ...)
+    --container             Container mode: implies --serve and --no-browser, listens on 0.0.0.0
+                            unless host is configured, and exits with an error if the port is taken
+    --dev                   Read templates and assets from ./templates and ./assets on each request,
+                            for theme development (run from the dimandocs source tree)
     --version               Show version information
     --help                  Show this help message
 
+COMMANDS:
+    init                    Generate a config file for the docs found in the current directory
+                            (asks before including each directory unless --yes is given)
+                            or, with --from, from the navigation of a mkdocs.yml or Docusaurus sidebars.js
+    start                   Start the server in the background (writes .dimandocs.pid and .dimandocs.log)
+    stop                    Stop the background server
+    status                  Show whether the background server is running and its URL
+    restart                 Stop and start the background server
+    service install         Install a service running the server for the current directory and config
+                            at boot/logon (systemd user unit, launchd agent or Windows scheduled task;
+                            the Windows task is not a service: it only runs while you are logged on).
+                            --system installs a system-wide unit running as --user (default: $SUDO_USER)
+    service uninstall       Remove the service
+    list                    Print every document found as source, path and title separated by tabs
+    tree                    Print the documents of each directory as a tree, with their titles
+    render                  Convert a markdown file (or stdin) to HTML with the configured markdown
+                            settings, or an OpenAPI spec to its API reference; prints an HTML fragment
+                            unless --standalone or --template is given
+    cache status            Show where the document cache is, its age, document count and version
+    cache clear             Delete the document cache
+    cache rebuild           Scan the directories and write the document cache
+    cache path              Print the path of the document cache
+    check-links             Report links to missing files or headings, and with --external unreachable
+                            URLs; exits with status 1 if any link is broken
+    publish                 Create or update a Confluence or Notion page for each directory and document
+                            (settings under "publish" in the config); only changed pages are updated
+
+    While a server is running for the current directory and config (in the background
+    or in another terminal), "dimandocs [PATH]" opens PATH in it instead of starting
+    another server.
+
 EXAMPLES:
     # Browse current directory with default settings
     dimandocs
 
+    # Create dimandocs.json from the docs/, wiki/ and README files found here
+    dimandocs init
+
+    # See which files the configured patterns pick up
+    dimandocs list
+    dimandocs tree --format=json
+
+    # Convert a file to a complete HTML page, e.g. in CI
+    dimandocs render --standalone --output=guide.html docs/guide.md
+
+    # Publish the docs to Confluence, showing first what would change
+    dimandocs publish --target=confluence --dry-run
+    DIMANDOCS_PUBLISH_CONFLUENCE_TOKEN=... dimandocs publish --target=confluence
+
     # Browse a specific directory
     dimandocs /path/to/docs
 
@@ -43,6 +128,7 @@ EXAMPLES:
 
     # Use custom config file
     dimandocs --config-file=custom.json
+    dimandocs --config-file=custom.yaml
 
     # Start server without opening browser
     dimandocs --serve
@@ -50,11 +136,28 @@ EXAMPLES:
     # Use cache for faster loading (large directories)
     dimandocs --cache
 
+    # Edit documents in the browser and save them back to disk
+    dimandocs --editable
+
+    # Run in the background, then open a file in the running server
+    dimandocs start --cache
+    dimandocs docs/guide.md
+    dimandocs stop
+
+    # Override config values
+    dimandocs --port=9000 --title="Team Docs" --ignore='.*/drafts/.*'
+
     # Combine options
     dimandocs --serve --cache --config-file=config.json /path/to/docs
 
 CONFIGURATION:
     If dimandocs.json exists in the current directory, it will be used automatically.
+    dimandocs.yaml, dimandocs.yml and dimandocs.toml are also detected, in that order.
+
+    Every config key can be overridden with a DIMANDOCS_<KEY> environment variable,
+    e.g. DIMANDOCS_PORT=9000, DIMANDOCS_TITLE="Docs", DIMANDOCS_DIRECTORIES="Guides=./docs,./wiki"
+    or DIMANDOCS_SEARCH_MAX_RESULTS=50. Precedence, lowest to highest:
+    defaults, config file, environment variables, flags, PATH argument.
     Otherwise, DimanDocs will use default settings (browse current directory for .md files).
 
     Default config when no dimandocs.json is found:
@@ -79,13 +182,86 @@ func main() {
 	// Custom usage message
 	flag.Usage = printUsage
 
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "init":
+			if err := runInit(os.Args[2:]); err != nil {
+				fatal("failed to create config", err)
+			}
+			return
+		case "check-links":
+			if err := runCheckLinks(os.Args[2:]); err != nil {
+				if errors.Is(err, errBrokenLinks) {
+					os.Exit(1)
+				}
+				fatal("failed to check links", err)
+			}
+			return
+		case "list", "tree":
+			if err := runInventory(os.Args[1], os.Args[2:]); err != nil {
+				fatal("failed to list documents", err)
+			}
+			return
+		case "render":
+			if err := runRender(os.Args[2:]); err != nil {
+				fatal("failed to render document", err)
+			}
+			return
+		case "publish":
+			if err := runPublish(os.Args[2:]); err != nil {
+				if errors.Is(err, errPublishFailed) {
+					os.Exit(1)
+				}
+				fatal("failed to publish documents", err)
+			}
+			return
+		case "cache":
+			if err := runCacheCommand(os.Args[2:]); err != nil {
+				fatal("cache command failed", err)
+			}
+			return
+		case "service":
+			if err := runServiceCommand(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "dimandocs service: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case "start", "stop", "status", "restart":
+			if err := runDaemonCommand(os.Args[1], os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "dimandocs %s: %v\n", os.Args[1], err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	// Parse command line flags
 	showVersion := flag.Bool("version", false, "Show version information")
 	configFile := flag.String("config-file", "", "Path to configuration file (default: dimandocs.json if exists)")
 	serveMode := flag.Bool("serve", false, "Start server without opening browser")
-	useCache := flag.Bool("cache", false, "Use cache file (.dimandocs-cache.json) to speed up loading")
+	useCache := flag.Bool("cache", false, "Cache the document list in the user cache directory to speed up loading")
+	editable := flag.Bool("editable", false, "Allow editing documents from the browser")
+	port := flag.String("port", "", "Port for the web server (overrides config)")
+	title := flag.String("title", "", "Title displayed in the web interface (overrides config)")
+	strictPort := flag.Bool("strict-port", false, "Fail if the port is busy instead of using the next free one")
+	var ignore stringList
+	flag.Var(&ignore, "ignore", "Regex pattern for paths to ignore, added to the configured ones (repeatable)")
+	logLevel := flag.String("log-level", "info", "Log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", "text", "Log format: text or json")
+	quiet := flag.Bool("quiet", false, "Only log errors and skip the startup banner")
+	verbose := flag.Bool("verbose", false, "Log debug messages, including every HTTP request")
+	pidFile := flag.String("pid-file", "", "Write the PID and port of the server to this file while running")
+	noBrowser := flag.Bool("no-browser", false, "Never try to open a browser")
+	container := flag.Bool("container", false, "Container mode: no browser, no auto-shutdown, listen on 0.0.0.0 and fail if the port is taken")
+	dev := flag.Bool("dev", false, "Read templates and assets from ./templates and ./assets on each request, for theme development")
 	flag.Parse()
 
+	if err := setupLogging(*logLevel, *logFormat, *quiet, *verbose); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(2)
+	}
+
 	// Show version and exit
 	if *showVersion {
 		fmt.Printf("DimanDocs %s\n", Version)
@@ -93,6 +269,11 @@ func main() {
 		os.Exit(0)
 	}
 
+	// The config file can also be given in the environment, e.g. in containers
+	if *configFile == "" {
+		*configFile = os.Getenv("DIMANDOCS_CONFIG_FILE")
+	}
+
 	// Get target path from first positional argument
 	targetPath := ""
 	if flag.NArg() > 0 {
@@ -101,12 +282,47 @@ func main() {
 
 	// Create and initialize application
 	app := NewApp()
+	app.Editable = *editable
+	app.Overrides = ConfigOverrides{Port: *port, Title: *title, IgnorePatterns: ignore, StrictPort: *strictPort}
+
+	// Open the file in a server already running for this directory and
+	// config rather than starting a second one
+	if !*serveMode && !*container && !*dev && *pidFile == "" && handOff(app, *configFile, targetPath) {
+		return
+	}
+
+	if *dev {
+		dir, err := devDir()
+		if err != nil {
+			fatal("cannot use --dev", err)
+		}
+		app.DevDir = dir
+	}
+
+	app.Quiet = *quiet
+	app.PIDFile = *pidFile
+	app.NoBrowser = *noBrowser
+	app.Container = *container
 	if err := app.Initialize(*configFile, targetPath, *useCache); err != nil {
-		log.Fatalf("Failed to initialize application: %v", err)
+		fatal("failed to initialize application", err)
 	}
 
 	// Start the server
 	if err := app.Start(*serveMode); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+		fatal("failed to start server", err)
+	}
+}
+
+// fatal logs err and exits. Config errors are logged one problem per record.
+func fatal(msg string, err error) {
+	var configErr *ConfigError
+	if errors.As(err, &configErr) {
+		slog.Error("invalid configuration", "file", configErr.File, "problems", len(configErr.Problems))
+		for _, p := range configErr.Problems {
+			slog.Error("config problem", "line", p.Line, "field", p.Field, "message", p.Message)
+		}
+	} else {
+		slog.Error(msg, "error", err)
 	}
+	os.Exit(1)
 }
\ No newline at end of file
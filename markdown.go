@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	emoji "github.com/yuin/goldmark-emoji"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// markdownExtensions are the optional extensions listed in markdown.extensions
+var markdownExtensions = map[string]goldmark.Extender{
+	"footnotes":        extension.Footnote,
+	"definition_lists": extension.DefinitionList,
+	"admonitions":      &admonitions{},
+	"emoji":            emoji.Emoji,
+	"figures":          &figures{},
+}
+
+// defaultMarkdownExtensions are enabled when markdown.extensions is empty
+var defaultMarkdownExtensions = []string{"footnotes", "definition_lists", "admonitions", "emoji", "figures"}
+
+// enabledMarkdownExtensions returns the names of the optional extensions to use
+func enabledMarkdownExtensions(config Config) []string {
+	if len(config.Markdown.Extensions) == 0 {
+		return defaultMarkdownExtensions
+	}
+	var names []string
+	for _, name := range config.Markdown.Extensions {
+		if name = strings.ToLower(name); markdownExtensions[name] != nil && indexOf(names, name) < 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// newMarkdownRenderer builds the Goldmark renderer for the given configuration.
+// resolveWikiLink finds the document a [[WikiLink]] points to. options are
+// added to the HTML renderer's, e.g. html.WithXHTML().
+func newMarkdownRenderer(config Config, resolveWikiLink func(target string) (relPath string, ok bool), options ...renderer.Option) goldmark.Markdown {
+	// GitHub Flavored Markdown, with autolinks of bare URLs optional
+	extensions := []goldmark.Extender{
+		extension.Table,
+		extension.Strikethrough,
+		extension.TaskList,
+		&wikiLinks{basePath: config.BasePath, resolve: resolveWikiLink, labelFirst: markdownFlavor(config) == flavorGitLab},
+	}
+	if flavor := markdownFlavor(config); flavor != flavorGitHub {
+		extensions = append(extensions, &flavorExtension{flavor: flavor})
+	}
+	if linkifyEnabled(config) {
+		extensions = append(extensions, extension.Linkify)
+	}
+	if config.Markdown.Typographer {
+		extensions = append(extensions, extension.Typographer)
+	}
+	for _, name := range enabledMarkdownExtensions(config) {
+		extensions = append(extensions, markdownExtensions[name])
+	}
+	if config.Math {
+		extensions = append(extensions, &mathExtension{})
+	}
+	if diagramsEnabled(config) {
+		extensions = append(extensions, &diagrams{renderer: newDiagramRenderer(config.Diagrams)})
+	}
+
+	// Raw HTML is always rendered; unless allow_raw_html is set the output
+	// is run through the sanitizer afterwards
+	options = append([]renderer.Option{html.WithUnsafe(), renderer.WithNodeRenderers(util.Prioritized(newTaskCheckBoxRenderer(), 100))}, options...)
+	if config.Markdown.HardWraps {
+		options = append(options, html.WithHardWraps())
+	}
+	if config.Markdown.XHTML {
+		options = append(options, html.WithXHTML())
+	}
+
+	parserOptions := []parser.Option{
+		parser.WithAutoHeadingID(), // Auto-generate heading IDs
+		parser.WithASTTransformers(util.Prioritized(&lazyImageTransformer{}, 100)),
+	}
+	if config.Markdown.Attributes {
+		parserOptions = append(parserOptions, parser.WithAttribute())
+	}
+
+	return goldmark.New(
+		goldmark.WithExtensions(extensions...),
+		goldmark.WithParserOptions(parserOptions...),
+		goldmark.WithRendererOptions(options...),
+	)
+}
+
+// linkifyEnabled reports whether bare URLs are turned into links
+func linkifyEnabled(config Config) bool {
+	return config.Markdown.Linkify == nil || *config.Markdown.Linkify
+}
+
+// newSanitizer returns the HTML sanitizer policy, or nil if raw HTML is allowed
+func newSanitizer(config Config) *bluemonday.Policy {
+	if config.AllowRawHTML {
+		return nil
+	}
+
+	p := bluemonday.UGCPolicy()
+	// Keep what Goldmark itself generates: heading IDs, code block
+	// languages and GFM task list checkboxes
+	p.AllowAttrs("id").OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#.-]+$`)).OnElements("code")
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("aria-label").Matching(regexp.MustCompile(`^Task$`)).OnElements("input")
+	p.AllowAttrs("loading").Matching(regexp.MustCompile(`^lazy$`)).OnElements("img")
+	// Classes given to headings with {.class}
+	if config.Markdown.Attributes {
+		p.AllowAttrs("class").Matching(regexp.MustCompile(`^[\w -]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	}
+	// Footnotes and admonitions
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^fn(ref\d*)?:\d+$`)).OnElements("sup", "li")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^footnote-(ref|backref)$`)).OnElements("a")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^footnotes$`)).OnElements("div")
+	p.AllowAttrs("role").Matching(regexp.MustCompile(`^doc-(noteref|backlink|endnotes)$`)).OnElements("a", "div")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^admonition admonition-(note|tip|important|warning|caution)$`)).OnElements("div")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^admonition-title$`)).OnElements("p")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^math math-(inline|display)$`)).OnElements("span", "div")
+	// Tables of contents and GitLab's media embeds
+	if markdownFlavor(config) != flavorGitHub {
+		p.AllowAttrs("class").Matching(regexp.MustCompile(`^inline-toc$`)).OnElements("div")
+		p.AllowElements("video", "audio")
+		p.AllowAttrs("src").OnElements("video", "audio")
+		p.AllowAttrs("controls", "title").OnElements("video", "audio")
+		p.AllowAttrs("preload").Matching(regexp.MustCompile(`^metadata$`)).OnElements("video", "audio")
+	}
+	// Wiki links, resolved or not
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^wikilink( wikilink-missing)?$`)).OnElements("a", "span")
+	// Diagrams, rendered as SVG data URIs
+	if diagramsEnabled(config) {
+		p.AllowAttrs("class").Matching(regexp.MustCompile(`^diagram$`)).OnElements("div")
+		p.AllowDataURIImages()
+	}
+	return p
+}
+
+// markdownFingerprint identifies the rendering settings, so cached HTML
+// produced with different settings is not reused. The base path is part of
+// the links generated for wiki links.
+func markdownFingerprint(config Config) string {
+	return fmt.Sprintf("raw_html=%t base_path=%s extensions=%s math=%t variables=%s diagrams=%s hard_wraps=%t typographer=%t xhtml=%t linkify=%t attributes=%t flavor=%s",
+		config.AllowRawHTML, config.BasePath, strings.Join(enabledMarkdownExtensions(config), ","), config.Math, variablesFingerprint(config.Variables),
+		diagramsFingerprint(config.Diagrams), config.Markdown.HardWraps, config.Markdown.Typographer, config.Markdown.XHTML, linkifyEnabled(config), config.Markdown.Attributes,
+		markdownFlavor(config))
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindMathBlock is the node kind of $$...$$ blocks
+var KindMathBlock = ast.NewNodeKind("MathBlock")
+
+// KindMathInline is the node kind of $...$ spans
+var KindMathInline = ast.NewNodeKind("MathInline")
+
+// MathBlock is display math written between $$ lines
+type MathBlock struct {
+	ast.BaseBlock
+	TeX    string
+	closed bool // the formula was on the opening line
+}
+
+// Kind implements ast.Node
+func (n *MathBlock) Kind() ast.NodeKind {
+	return KindMathBlock
+}
+
+// IsRaw implements ast.Node; the content is not parsed as markdown
+func (n *MathBlock) IsRaw() bool {
+	return true
+}
+
+// Dump implements ast.Node
+func (n *MathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": n.TeX}, nil)
+}
+
+// MathInline is inline math written between $ (or $$ for display style)
+type MathInline struct {
+	ast.BaseInline
+	TeX     string
+	Display bool
+}
+
+// Kind implements ast.Node
+func (n *MathInline) Kind() ast.NodeKind {
+	return KindMathInline
+}
+
+// Dump implements ast.Node
+func (n *MathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"TeX": n.TeX}, nil)
+}
+
+// mathBlockParser parses blocks opened and closed by "$$" lines. The
+// formula may also be on the opening line ("$$ x^2 $$").
+type mathBlockParser struct{}
+
+// Trigger implements parser.BlockParser
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Open implements parser.BlockParser
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, _ := reader.PeekLine()
+	trimmed := bytes.TrimSpace(line)
+	if !bytes.HasPrefix(trimmed, []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	node := &MathBlock{}
+	rest := trimmed[2:]
+	if end := bytes.Index(rest, []byte("$$")); end >= 0 {
+		if len(bytes.TrimSpace(rest[end+2:])) > 0 {
+			return nil, parser.NoChildren
+		}
+		node.TeX = string(bytes.TrimSpace(rest[:end]))
+		node.closed = true
+		return node, parser.NoChildren
+	}
+	node.TeX = string(bytes.TrimSpace(rest))
+	return node, parser.NoChildren
+}
+
+// Continue implements parser.BlockParser
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	n := node.(*MathBlock)
+	line, _ := reader.PeekLine()
+	if line == nil || n.closed {
+		return parser.Close
+	}
+	trimmed := bytes.TrimSpace(line)
+	closing := bytes.HasSuffix(trimmed, []byte("$$"))
+	if closing {
+		trimmed = bytes.TrimSpace(trimmed[:len(trimmed)-2])
+	}
+	if len(trimmed) > 0 {
+		if n.TeX != "" {
+			n.TeX += "\n"
+		}
+		n.TeX += string(trimmed)
+	}
+	reader.Advance(len(bytes.TrimRight(line, "\n")))
+	if closing {
+		return parser.Close
+	}
+	return parser.Continue | parser.NoChildren
+}
+
+// Close implements parser.BlockParser
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+// CanInterruptParagraph implements parser.BlockParser
+func (p *mathBlockParser) CanInterruptParagraph() bool {
+	return true
+}
+
+// CanAcceptIndentedLine implements parser.BlockParser
+func (p *mathBlockParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+// mathInlineParser parses $...$ and $$...$$ within a line. To leave prices
+// like "$5 and $10" alone, the opening $ must not be followed by a space and
+// the closing one must not be preceded by a space or followed by a digit.
+type mathInlineParser struct{}
+
+// Trigger implements parser.InlineParser
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse implements parser.InlineParser
+func (p *mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	delim := 1
+	if bytes.HasPrefix(line, []byte("$$")) {
+		delim = 2
+	}
+	if len(line) <= delim || line[delim] == ' ' || line[delim] == '\t' {
+		return nil
+	}
+
+	for i := delim; i < len(line); i++ {
+		switch {
+		case line[i] == '\\':
+			i++ // skip the escaped character, e.g. \$
+		case line[i] == '$':
+			if !bytes.HasPrefix(line[i:], []byte("$$")[:delim]) {
+				return nil
+			}
+			if line[i-1] == ' ' || line[i-1] == '\t' {
+				return nil
+			}
+			if next := i + delim; next < len(line) && line[next] >= '0' && line[next] <= '9' {
+				return nil
+			}
+			block.Advance(i + delim)
+			return &MathInline{TeX: string(line[delim:i]), Display: delim == 2}
+		}
+	}
+	return nil
+}
+
+// mathRenderer renders math for KaTeX: escaped TeX between \( \) or \[ \],
+// which also reads fine when the script is not loaded
+type mathRenderer struct{}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *mathRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMathBlock, r.renderBlock)
+	reg.Register(KindMathInline, r.renderInline)
+}
+
+func (r *mathRenderer) renderBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.WriteString(`<div class="math math-display">\[`)
+		w.Write(util.EscapeHTML([]byte(node.(*MathBlock).TeX)))
+		w.WriteString("\\]</div>\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *mathRenderer) renderInline(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*MathInline)
+	if n.Display {
+		w.WriteString(`<span class="math math-display">\[`)
+		w.Write(util.EscapeHTML([]byte(n.TeX)))
+		w.WriteString(`\]</span>`)
+	} else {
+		w.WriteString(`<span class="math math-inline">\(`)
+		w.Write(util.EscapeHTML([]byte(n.TeX)))
+		w.WriteString(`\)</span>`)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// mathExtension is the goldmark extension adding $...$ and $$...$$ math
+type mathExtension struct{}
+
+// Extend implements goldmark.Extender
+func (e *mathExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 150)),
+		parser.WithInlineParsers(util.Prioritized(&mathInlineParser{}, 150)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&mathRenderer{}, 150)))
+}
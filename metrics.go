@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds, in seconds, of the request duration histogram
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// requestKey identifies a request counter
+type requestKey struct {
+	route  string
+	method string
+	code   int
+}
+
+// latencyHistogram is a cumulative histogram of request durations
+type latencyHistogram struct {
+	counts []uint64 // one per bucket, non-cumulative
+	count  uint64
+	sum    float64
+}
+
+// Metrics collects per-route request counts, status codes and latencies
+type Metrics struct {
+	mu        sync.Mutex
+	started   time.Time
+	requests  map[requestKey]uint64
+	latencies map[string]*latencyHistogram // by route
+}
+
+// NewMetrics creates an empty metrics collector
+func NewMetrics() *Metrics {
+	return &Metrics{
+		started:   time.Now(),
+		requests:  make(map[requestKey]uint64),
+		latencies: make(map[string]*latencyHistogram),
+	}
+}
+
+// Observe records a finished request
+func (m *Metrics) Observe(route, method string, code int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests[requestKey{route: route, method: method, code: code}]++
+
+	h, ok := m.latencies[route]
+	if !ok {
+		h = &latencyHistogram{counts: make([]uint64, len(latencyBuckets))}
+		m.latencies[route] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer, documents int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP dimandocs_http_requests_total Number of HTTP requests by route, method and status code.")
+	fmt.Fprintln(w, "# TYPE dimandocs_http_requests_total counter")
+	keys := make([]requestKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		if keys[i].method != keys[j].method {
+			return keys[i].method < keys[j].method
+		}
+		return keys[i].code < keys[j].code
+	})
+	for _, key := range keys {
+		fmt.Fprintf(w, "dimandocs_http_requests_total{route=%q,method=%q,code=\"%d\"} %d\n",
+			key.route, key.method, key.code, m.requests[key])
+	}
+
+	fmt.Fprintln(w, "# HELP dimandocs_http_request_duration_seconds HTTP request latencies by route.")
+	fmt.Fprintln(w, "# TYPE dimandocs_http_request_duration_seconds histogram")
+	routes := make([]string, 0, len(m.latencies))
+	for route := range m.latencies {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	for _, route := range routes {
+		h := m.latencies[route]
+		var cumulative uint64
+		for i, bound := range latencyBuckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(w, "dimandocs_http_request_duration_seconds_bucket{route=%q,le=%q} %d\n",
+				route, strconv.FormatFloat(bound, 'g', -1, 64), cumulative)
+		}
+		fmt.Fprintf(w, "dimandocs_http_request_duration_seconds_bucket{route=%q,le=\"+Inf\"} %d\n", route, h.count)
+		fmt.Fprintf(w, "dimandocs_http_request_duration_seconds_sum{route=%q} %g\n", route, h.sum)
+		fmt.Fprintf(w, "dimandocs_http_request_duration_seconds_count{route=%q} %d\n", route, h.count)
+	}
+
+	fmt.Fprintln(w, "# HELP dimandocs_documents Number of indexed documents.")
+	fmt.Fprintln(w, "# TYPE dimandocs_documents gauge")
+	fmt.Fprintf(w, "dimandocs_documents %d\n", documents)
+
+	fmt.Fprintln(w, "# HELP dimandocs_uptime_seconds Seconds since the server started.")
+	fmt.Fprintln(w, "# TYPE dimandocs_uptime_seconds gauge")
+	fmt.Fprintf(w, "dimandocs_uptime_seconds %g\n", time.Since(m.started).Seconds())
+}
+
+// handleMetrics serves the request metrics in Prometheus format
+func (a *App) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	a.Metrics.WriteTo(w, len(a.Documents))
+}
+
+// instrument records metrics for every request and writes it to the access
+// log, if one is configured. Requests are grouped by the route pattern that
+// handled them so /doc/a.md and /doc/b.md count as the same route.
+func (a *App) instrument(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		mux.ServeHTTP(rec, r)
+		duration := time.Since(start)
+
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+		a.Metrics.Observe(route, r.Method, rec.status, duration)
+
+		if a.AccessLog != nil {
+			a.AccessLog.Write([]byte(accessLogLine(r, rec, start)))
+		}
+	})
+}
+
+// accessLogLine formats a request in the Combined Log Format
+func accessLogLine(r *http.Request, rec *statusRecorder, start time.Time) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	referer := r.Referer()
+	if referer == "" {
+		referer = "-"
+	}
+	userAgent := r.UserAgent()
+	if userAgent == "" {
+		userAgent = "-"
+	}
+	return fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %d %q %q\n",
+		host, start.Format("02/Jan/2006:15:04:05 -0700"), r.Method, r.URL.RequestURI(), r.Proto,
+		rec.status, rec.bytes, referer, userAgent)
+}
+
+const (
+	defaultAccessLogMaxSize    = 10 // megabytes
+	defaultAccessLogMaxBackups = 5
+)
+
+// RotatingFile is an append-only log file that is rotated when it grows
+// past maxSize: file.log is renamed to file.log.1, file.log.1 to file.log.2
+// and so on, keeping at most maxBackups old files.
+type RotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+}
+
+// OpenRotatingFile opens (or creates) a rotating log file. maxSizeMB and
+// maxBackups use defaults when zero.
+func OpenRotatingFile(path string, maxSizeMB, maxBackups int) (*RotatingFile, error) {
+	if maxSizeMB == 0 {
+		maxSizeMB = defaultAccessLogMaxSize
+	}
+	if maxBackups == 0 {
+		maxBackups = defaultAccessLogMaxBackups
+	}
+	rf := &RotatingFile{path: path, maxSize: int64(maxSizeMB) << 20, maxBackups: maxBackups}
+	if err := rf.open(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+// open opens the current log file for appending
+func (rf *RotatingFile) open() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+	rf.file = file
+	rf.size = info.Size()
+	return nil
+}
+
+// Write appends p to the log file, rotating it first if it would grow too large
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+
+	if rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		if err := rf.rotate(); err != nil {
+			// Requests are still logged, to the file that could not be rotated
+			slog.Warn("failed to rotate log file", "file", rf.path, "error", err)
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, err
+}
+
+// rotate shifts the backups and starts a new log file. If the log file
+// can't be moved or a new one created, the current one is opened again.
+func (rf *RotatingFile) rotate() error {
+	// Windows can't rename open files
+	rf.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", rf.path, rf.maxBackups))
+	for i := rf.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", rf.path, i), fmt.Sprintf("%s.%d", rf.path, i+1))
+	}
+	if err := os.Rename(rf.path, rf.path+".1"); err != nil && !os.IsNotExist(err) {
+		return rf.reopen(fmt.Errorf("failed to rotate log file: %w", err))
+	}
+	if err := rf.open(); err != nil {
+		os.Rename(rf.path+".1", rf.path)
+		return rf.reopen(err)
+	}
+	return nil
+}
+
+// reopen opens the current log file again after rotating it failed with
+// err, which it returns
+func (rf *RotatingFile) reopen(err error) error {
+	if openErr := rf.open(); openErr != nil {
+		return fmt.Errorf("%w (and reopening it: %v)", err, openErr)
+	}
+	return err
+}
+
+// Close closes the log file
+func (rf *RotatingFile) Close() error {
+	rf.mu.Lock()
+	defer rf.mu.Unlock()
+	return rf.file.Close()
+}
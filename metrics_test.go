@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf := &RotatingFile{path: path, maxSize: 10, maxBackups: 2}
+	if err := rf.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	for _, line := range []string{"first\n", "second\n", "third\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{path: "third\n", path + ".1": "second\n", path + ".2": "first\n"} {
+		if data, err := os.ReadFile(name); err != nil || string(data) != want {
+			t.Errorf("%s: got %q (%v), want %q", filepath.Base(name), data, err, want)
+		}
+	}
+}
+
+func TestRotatingFileKeepsLoggingWhenRotationFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	rf := &RotatingFile{path: path, maxSize: 10, maxBackups: 1}
+	if err := rf.open(); err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	// The log file can't be moved onto a directory that isn't empty
+	if err := os.MkdirAll(filepath.Join(path+".1", "keep"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first\n", "second\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data, err := os.ReadFile(path); err != nil || string(data) != "first\nsecond\n" {
+		t.Errorf("got %q (%v), want both lines", data, err)
+	}
+}
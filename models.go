@@ -2,39 +2,298 @@ package main
 
 import (
 	"html/template"
-	"log"
+	"log/slog"
 	"os"
 	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
 )
 
-// DirectoryConfig represents a directory configuration with path, name, and file pattern
+// DirectoryConfig represents a directory configuration with path, name, and file patterns
 type DirectoryConfig struct {
-	Path        string `json:"path"`
-	Name        string `json:"name"`
-	FilePattern string `json:"file_pattern"`
+	Path         string   `json:"path"`
+	Name         string   `json:"name"`
+	FilePattern  string   `json:"file_pattern"`
+	FilePatterns []string `json:"file_patterns,omitempty"` // additional patterns, any of them may match
+	PatternType  string   `json:"pattern_type,omitempty"`  // "regex" (default) or "glob"
+	Version      string   `json:"version,omitempty"`       // version of the doc set named Name, e.g. "v2"
+	Allow        []string `json:"allow,omitempty"`         // users ("alice") and groups ("@docs-team") who can read it, everyone if empty
+
+	// IgnorePatterns skips paths of this directory only, on top of the
+	// global ignore_patterns; globs when PatternType is "glob"
+	IgnorePatterns []string `json:"ignore_patterns,omitempty"`
+
+	// IncludeHidden scans files and directories whose name starts with "."
+	// (skipped by default). MaxDepth limits how deep files are found: 1 is
+	// the directory itself, 2 one level of subdirectories, 0 no limit.
+	IncludeHidden bool `json:"include_hidden,omitempty"`
+	MaxDepth      int  `json:"max_depth,omitempty"`
+
+	// Type is "local" (default), "http" for a zip or tarball at URL, or
+	// "s3" for the objects under an S3 prefix (URL "s3://bucket/prefix").
+	// Remote directories are downloaded to the cache directory, which
+	// becomes their Path, and again every Refresh, e.g. "1h".
+	Type    string `json:"type,omitempty"`
+	URL     string `json:"url,omitempty"`
+	Refresh string `json:"refresh,omitempty"`
+
+	// Nav lists documents (and folders, ending in "/") relative to the
+	// directory in the order the trees show them, before the documents
+	// not listed, e.g. the nav of an imported mkdocs.yml
+	Nav []string `json:"nav,omitempty"`
+
+	// OpenAPIPattern matches the file names of OpenAPI and Swagger specs,
+	// shown as an API reference next to the markdown documents;
+	// defaultOpenAPIPattern when empty, "none" to leave specs out
+	OpenAPIPattern string `json:"openapi_pattern,omitempty"`
 }
 
 // Config represents the application configuration
 type Config struct {
 	Directories    []DirectoryConfig `json:"directories"`
 	Port           string            `json:"port"`
+	Host           string            `json:"host"`        // interface to listen on, all interfaces if empty
+	StrictPort     bool              `json:"strict_port"` // fail if port is busy instead of using the next free one
+	BasePath       string            `json:"base_path"`   // URL prefix when served behind a reverse proxy, e.g. "/docs"
 	Title          string            `json:"title"`
 	IgnorePatterns []string          `json:"ignore_patterns"`
+	ScanWorkers    int               `json:"scan_workers"`
+
+	// DefaultLanguage is the language of documents without a language
+	// suffix or directory ("README.md" next to "README.es.md")
+	DefaultLanguage string `json:"default_language"`
+
+	// RespectGitignore skips paths excluded by .gitignore files found while
+	// scanning (default true); .dimandocsignore files are always honored
+	RespectGitignore *bool `json:"respect_gitignore"`
+
+	// FollowSymlinks walks into symbolic links to directories while
+	// scanning. Directories and files reached through more than one path
+	// are scanned once, and link cycles are skipped.
+	FollowSymlinks bool `json:"follow_symlinks"`
+
+	// MaxFileSize limits the size in bytes of documents (0 means no limit).
+	// Larger files are skipped, or truncated if TruncateLargeFiles is set.
+	MaxFileSize        int64 `json:"max_file_size"`
+	TruncateLargeFiles bool  `json:"truncate_large_files"`
+
+	// MaxScanFiles, MaxScanSize and ScanTimeout stop a scan that visits
+	// more files, finds more bytes of documents or walks for longer than
+	// this, e.g. "2m" (0 or empty for no limit); documents found so far
+	// are kept
+	MaxScanFiles int64  `json:"max_scan_files"`
+	MaxScanSize  int64  `json:"max_scan_size"`
+	ScanTimeout  string `json:"scan_timeout"`
+
+	// MaxDownloadSize limits the bytes downloaded, and extracted from an
+	// archive, for each remote directory (0 uses defaultMaxDownloadSize)
+	MaxDownloadSize int64 `json:"max_download_size"`
+
+	// RenderCacheSize is the number of rendered documents kept in memory
+	// (0 uses the default, negative disables caching). RenderCacheDir
+	// optionally persists rendered HTML to disk.
+	RenderCacheSize int    `json:"render_cache_size"`
+	RenderCacheDir  string `json:"render_cache_dir"`
+
+	// Prerender renders every document after each scan, in parallel, and
+	// keeps them all in memory so pages load without rendering
+	Prerender bool `json:"prerender"`
+
+	// PageSize splits documents larger than this many kilobytes into pages
+	// at their top-level headings (0 uses the default, negative disables
+	// pagination)
+	PageSize int `json:"page_size"`
+
+	// TableRows is how many rows of CSV and TSV documents are shown (0 uses
+	// the default, negative shows all of them)
+	TableRows int `json:"table_rows"`
+
+	// CacheFormat is the format of the document cache used with --cache:
+	// "json" (default) or "gob", a compact binary format for large corpora
+	CacheFormat string `json:"cache_format"`
+
+	// RescanInterval re-scans the directories periodically, e.g. "5m"
+	// (empty disables it). RescanMode is "incremental" (default), which
+	// only processes changed files, or "full".
+	RescanInterval string `json:"rescan_interval"`
+	RescanMode     string `json:"rescan_mode"`
+
+	// SlugURLs gives every document a permalink, /d/{slug}, from its
+	// frontmatter "slug" or title, that keeps working when its file moves
+	SlugURLs bool `json:"slug_urls"`
+
+	// StaleAfter flags documents not updated for longer than this, e.g.
+	// "180d" (by their last git commit, or modification time if untracked)
+	StaleAfter string `json:"stale_after"`
+
+	Search SearchConfig `json:"search"`
+
+	Notify NotifyConfig `json:"notify"`
+
+	Publish PublishConfig `json:"publish"`
+
+	Auth AuthConfig `json:"auth"`
+
+	// AdminToken and AdminUsers (user names or "@group") give access to the
+	// admin API under /admin/. Without either, only requests from this
+	// machine can use it.
+	AdminToken string   `json:"admin_token"`
+	AdminUsers []string `json:"admin_users"`
+
+	Markdown MarkdownConfig `json:"markdown"`
+
+	Diagrams DiagramsConfig `json:"diagrams"`
+
+	Overview OverviewConfig `json:"overview"`
+
+	// Math renders $...$ and $$...$$ formulas with KaTeX, loaded from a CDN
+	Math bool `json:"math"`
+
+	// Annotations lets readers leave comments on headings or line ranges of
+	// documents, shared by everyone using the server
+	Annotations bool `json:"annotations"`
+
+	// TreeSort orders the document tree: "alphabetical" (default) or
+	// "order" (frontmatter order first). DirectoriesFirst lists folders
+	// before files.
+	TreeSort         string `json:"tree_sort"`
+	DirectoriesFirst bool   `json:"directories_first"`
+
+	// Variables are substituted for {{var.name}} placeholders in documents
+	Variables map[string]string `json:"variables"`
+
+	// AllowRawHTML renders HTML embedded in markdown as-is. When false
+	// (the default) rendered documents are sanitized.
+	AllowRawHTML bool `json:"allow_raw_html"`
+
+	// StaticDir is an optional directory served under /static/, taking
+	// precedence over the assets embedded in the binary
+	StaticDir string `json:"static_dir"`
+
+	// EditorCommand is the command used by the Edit button, with {file}
+	// and {line} placeholders (defaults to $VISUAL, $EDITOR or VS Code)
+	EditorCommand string `json:"editor_command"`
+
+	// AccessLog is an optional file where requests are logged in the
+	// Combined Log Format, rotated once it reaches AccessLogMaxSize megabytes
+	AccessLog           string `json:"access_log"`
+	AccessLogMaxSize    int    `json:"access_log_max_size"`
+	AccessLogMaxBackups int    `json:"access_log_max_backups"`
+}
+
+// ConfigOverrides holds config values given as command line flags, which
+// take precedence over the config file and environment variables
+type ConfigOverrides struct {
+	Port           string   // --port
+	Title          string   // --title
+	IgnorePatterns []string // --ignore, added to the configured patterns
+	StrictPort     bool     // --strict-port
+}
+
+// SearchConfig controls what /api/search looks at and how much it returns
+type SearchConfig struct {
+	MaxResults    int      `json:"max_results"`    // upper bound for results per request (0 uses the default)
+	Fields        []string `json:"fields"`         // fields searched by unqualified terms
+	CaseSensitive bool     `json:"case_sensitive"` // match case exactly
+}
+
+// NotifyConfig posts documents added, changed or removed by re-scans to a
+// chat webhook
+type NotifyConfig struct {
+	WebhookURL string `json:"webhook_url"` // Slack or Teams incoming webhook, or any URL taking JSON
+	Format     string `json:"format"`      // "slack" (default), "teams" or "json"
+	URL        string `json:"url"`         // address readers open, for links (default: the local server)
+	Delay      string `json:"delay"`       // changes are collected this long before posting (default "1m")
+}
+
+// DiagramsConfig configures how ```plantuml and ```dot code blocks are
+// rendered to SVG: by a command reading the diagram on stdin and writing
+// SVG, or else by a Kroki server
+type DiagramsConfig struct {
+	PlantUML string `json:"plantuml"`  // e.g. "plantuml -tsvg -pipe"
+	Graphviz string `json:"graphviz"`  // e.g. "dot -Tsvg"
+	Server   string `json:"server"`    // Kroki server, e.g. "https://kroki.io"
+	Timeout  string `json:"timeout"`   // per diagram (default "10s")
+	CacheDir string `json:"cache_dir"` // rendered diagrams are also kept here, to survive restarts
+}
+
+// PublishConfig configures where `dimandocs publish` pushes the documents
+type PublishConfig struct {
+	Confluence ConfluenceConfig `json:"confluence"`
+	Notion     NotionConfig     `json:"notion"`
+}
+
+// ConfluenceConfig is a Confluence space documents are published to, as a
+// page per directory and document
+type ConfluenceConfig struct {
+	URL      string `json:"url"`       // site address, e.g. "https://example.atlassian.net/wiki"
+	Space    string `json:"space"`     // space key
+	User     string `json:"user"`      // account email for Confluence Cloud; empty to send token as a personal access token
+	Token    string `json:"token"`     // API token or personal access token
+	ParentID string `json:"parent_id"` // page the sources are published under (default: the space root)
+}
+
+// NotionConfig is a Notion database documents are published to, as a page
+// per directory and document
+type NotionConfig struct {
+	Token      string `json:"token"`       // internal integration secret
+	DatabaseID string `json:"database_id"` // database shared with the integration
+}
+
+// AuthConfig identifies the users of a shared server, for the allow lists of
+// directories. Users log in with HTTP basic auth or are identified by an
+// authenticating reverse proxy.
+type AuthConfig struct {
+	Users        map[string]string   `json:"users"`         // basic auth user -> password, plain or "sha256:<hex>"
+	Groups       map[string][]string `json:"groups"`        // group -> user names
+	UserHeader   string              `json:"user_header"`   // header with the user name set by the proxy, e.g. "X-Forwarded-User"
+	GroupsHeader string              `json:"groups_header"` // header with the user's comma separated groups set by the proxy
+	Required     bool                `json:"required"`      // reject anonymous requests
+}
+
+// OverviewConfig controls how the overview of a document is extracted
+type OverviewConfig struct {
+	Headings       []string `json:"headings"`        // sections holding the overview (default "Overview")
+	FirstParagraph bool     `json:"first_paragraph"` // fall back to the first paragraph after the title
+	MaxLength      int      `json:"max_length"`      // characters kept, 0 for no limit
+}
+
+// MarkdownConfig controls how documents are rendered
+type MarkdownConfig struct {
+	Extensions  []string `json:"extensions"`  // optional extensions to enable (all when empty)
+	HardWraps   bool     `json:"hard_wraps"`  // line breaks within paragraphs are kept, as GitLab shows them
+	Typographer bool     `json:"typographer"` // smart quotes, dashes and ellipses
+	XHTML       bool     `json:"xhtml"`       // self-closing tags such as <br />
+	Linkify     *bool    `json:"linkify"`     // bare URLs become links (default true)
+	Attributes  bool     `json:"attributes"`  // {#id .class} after a heading sets its ID and classes
+	Flavor      string   `json:"flavor"`      // "github" (default), "gitlab" or "bitbucket"
 }
 
 // Document represents a parsed markdown document
 type Document struct {
-	Title       string
-	Path        string
-	Content     string
-	RelPath     string
-	DirName     string
-	SourceDir   string
-	SourceName  string
-	AbsPath     string
-	Overview    string
+	Title      string
+	Path       string
+	Content    string
+	RelPath    string
+	DirName    string
+	SourceDir  string
+	SourceName string
+	AbsPath    string
+	Overview   string
+	Size       int64
+	Tags       []string
+	Tasks      TaskProgress // task list items, counted in the first 64 KB like the title
+	Words      int          // words of the whole file, without frontmatter
+	Language   string       // from the file or directory name, "" if not marked
+	Version    string       // "" for the default version of its doc set
+	Order      int          // frontmatter "order", 0 if unset
+	ModTime    time.Time    // modification time when scanned
+	Hash       string       // of the first 64 KB, to recognize moved files
+	Slug       string       // frontmatter "slug", "" if unset (see buildSlugs)
 }
 
 // DirectoryGroup represents a group of documents from the same directory
@@ -45,14 +304,60 @@ type DirectoryGroup struct {
 
 // App represents the main application
 type App struct {
-	Config         Config
-	Documents      []Document
-	IgnoreRegexes  []*regexp.Regexp
-	FileRegexes    map[string]*regexp.Regexp
-	WorkingDir     string
-	TargetFile     string // Specific file to open in browser (if provided)
-	UseCache       bool   // Whether to use cache file
-	Clients        *ClientTracker
+	Config        Config
+	Documents     []Document
+	Versions      map[string][]Document // documents of non-default versions, by version
+	IgnoreRegexes []*regexp.Regexp
+	FileMatchers  map[string]*FileMatcher
+	WorkingDir    string
+	TargetFile    string // Specific file to open in browser (if provided)
+	TargetPath    string // PATH argument, kept for config reloads
+	UseCache      bool   // Whether to use cache file
+	Clients       *ClientTracker
+	Scan          *ScanProgress // Progress of the most recent directory scan
+	Renders       *RenderCache  // Cache of rendered document HTML
+	Editable      bool          // Whether documents can be edited from the browser
+	DevDir        string        // --dev: templates and assets are read from here on each request
+	Overrides     ConfigOverrides
+	Quiet         bool // Skip the startup banner (--quiet)
+	Metrics       *Metrics
+	AccessLog     *RotatingFile // nil unless access_log is configured
+	History       *History      // recently viewed documents and favorites per browser
+	Views         *ViewCounter  // number of views of each document
+	Moves         *MoveTracker  // documents that moved between scans
+	Links         *LinkGraph    // links between documents, built after scanning
+	PIDFile       string        // Instance info is written here while running (--pid-file)
+	ConfigFile    string        // Absolute path of the loaded config file, empty for defaults
+	Instance      InstanceInfo  // Identifies this server to other invocations
+	NoBrowser     bool          // Never try to open a browser (--no-browser)
+	Container     bool          // Container mode (--container): see Start
+	LocalOnly     bool          // The server only listens on loopback addresses (see Start)
+	Markdown      goldmark.Markdown
+	Sanitizer     *bluemonday.Policy // nil when raw HTML is allowed
+	Notifier      *Notifier          // nil unless notify.webhook_url is configured
+	Annotations   *AnnotationStore   // nil unless annotations are enabled
+
+	// docsMu is held for reading while a request is handled (not while its
+	// response is sent, see withDocumentsLock) and for
+	// writing while re-scanned or edited documents are swapped in; rescanMu
+	// keeps re-scans from overlapping
+	docsMu   sync.RWMutex
+	rescanMu sync.Mutex
+	scanMu   sync.Mutex // guards Scan, which is read while scanning
+	editMu   sync.Mutex // serializes writes of documents from the browser
+
+	rescans  rescanJobs    // re-scans started with POST /api/rescan
+	indexing indexingState // first scan, in the background
+
+	templates templateCache // parsed page templates
+
+	commits commitDates // last commit dates for freshness checks
+	renames gitRenames  // renames in git, to redirect moved documents
+	slugs   slugIndex   // permalinks of the documents (slug_urls)
+
+	remotes remoteSources // when remote directories were downloaded
+
+	preferencesKey []byte // signs the preferences cookies
 }
 
 const shutdownGrace = 5 * time.Second
@@ -62,7 +367,8 @@ type ClientTracker struct {
 	mu            sync.Mutex
 	count         int
 	shutdownTimer *time.Timer
-	serve         bool // if true, never auto-shutdown
+	serve         bool   // if true, never auto-shutdown
+	beforeExit    func() // saves state before an auto-shutdown
 }
 
 // NewClientTracker creates a new client tracker
@@ -79,7 +385,7 @@ func (ct *ClientTracker) Add() {
 		ct.shutdownTimer.Stop()
 		ct.shutdownTimer = nil
 	}
-	log.Printf("Client connected (%d active)", ct.count)
+	slog.Debug("client connected", "active", ct.count)
 }
 
 // Remove unregisters a disconnected client
@@ -90,14 +396,17 @@ func (ct *ClientTracker) Remove() {
 	if ct.count < 0 {
 		ct.count = 0
 	}
-	log.Printf("Client disconnected (%d active)", ct.count)
+	slog.Debug("client disconnected", "active", ct.count)
 	if ct.count == 0 && !ct.serve {
 		ct.shutdownTimer = time.AfterFunc(shutdownGrace, func() {
 			ct.mu.Lock()
 			c := ct.count
 			ct.mu.Unlock()
 			if c == 0 {
-				log.Println("No clients connected, shutting down")
+				slog.Info("no clients connected, shutting down")
+				if ct.beforeExit != nil {
+					ct.beforeExit()
+				}
 				os.Exit(0)
 			}
 		})
@@ -111,22 +420,131 @@ func (ct *ClientTracker) Count() int {
 	return ct.count
 }
 
+// ScanProgress tracks the progress of a directory scan
+type ScanProgress struct {
+	walked    atomic.Int64 // files visited by the walkers
+	matched   atomic.Int64 // files matching a file pattern
+	processed atomic.Int64 // matching files already processed
+	reused    atomic.Int64 // unchanged files taken from the previous scan
+
+	limit atomic.Pointer[string] // limit that stopped the scan early
+}
+
+// Walked returns the number of files visited so far
+func (sp *ScanProgress) Walked() int64 { return sp.walked.Load() }
+
+// Matched returns the number of files matching a file pattern so far
+func (sp *ScanProgress) Matched() int64 { return sp.matched.Load() }
+
+// Processed returns the number of matching files already processed
+func (sp *ScanProgress) Processed() int64 { return sp.processed.Load() }
+
+// Reused returns the number of unchanged files taken from the previous scan
+func (sp *ScanProgress) Reused() int64 { return sp.reused.Load() }
+
+// Limit returns the limit that stopped the scan early, or ""
+func (sp *ScanProgress) Limit() string {
+	if limit := sp.limit.Load(); limit != nil {
+		return *limit
+	}
+	return ""
+}
+
+// report logs the scan progress periodically until the returned func is called
+func (sp *ScanProgress) report(interval time.Duration) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				slog.Info("scanning", "visited", sp.Walked(), "processed", sp.Processed(), "matched", sp.Matched())
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// scanJob is a matching file queued for processing
+type scanJob struct {
+	dirIndex   int // index of the directory in the config
+	seq        int // discovery order within the directory
+	path       string
+	rootDir    string
+	sourceName string
+	size       int64
+	modTime    time.Time
+}
+
+// scanResult is the outcome of processing a scanJob
+type scanResult struct {
+	job scanJob
+	doc Document
+	ok  bool
+}
+
 // CachedDocument represents a document in cache (without content)
 type CachedDocument struct {
+	Title      string       `json:"title"`
+	Path       string       `json:"path"`
+	RelPath    string       `json:"rel_path"`
+	DirName    string       `json:"dir_name"`
+	SourceDir  string       `json:"source_dir"`
+	SourceName string       `json:"source_name"`
+	AbsPath    string       `json:"abs_path"`
+	Overview   string       `json:"overview"`
+	Size       int64        `json:"size"`
+	Tags       []string     `json:"tags,omitempty"`
+	Tasks      TaskProgress `json:"tasks"`
+	Words      int          `json:"words"`
+	Language   string       `json:"language,omitempty"`
+	Order      int          `json:"order,omitempty"`
+	ModTime    time.Time    `json:"mod_time"`
+	Hash       string       `json:"hash,omitempty"`
+	Slug       string       `json:"slug,omitempty"`
+}
+
+// CacheData represents the cached document data
+type CacheData struct {
+	Documents   []CachedDocument `json:"documents"`
+	Version     string           `json:"version"`
+	Fingerprint string           `json:"fingerprint"` // cacheFingerprint of the config that produced it
+}
+
+// QuickOpenResult is a fuzzy match returned by /api/quickopen
+type QuickOpenResult struct {
 	Title      string `json:"title"`
-	Path       string `json:"path"`
 	RelPath    string `json:"rel_path"`
-	DirName    string `json:"dir_name"`
-	SourceDir  string `json:"source_dir"`
+	URL        string `json:"url"` // escaped document URL, without the base path
 	SourceName string `json:"source_name"`
-	AbsPath    string `json:"abs_path"`
-	Overview   string `json:"overview"`
+	Score      int    `json:"score"`
 }
 
-// CacheData represents the cached document data
-type CacheData struct {
-	Documents []CachedDocument `json:"documents"`
-	Version   string           `json:"version"`
+// SearchResult is a document matching a /api/search query. It deliberately
+// carries no document content, only a short snippet around the match.
+type SearchResult struct {
+	Title   string `json:"title"`
+	Path    string `json:"path"` // RelPath of the document
+	URL     string `json:"url"`  // escaped document URL, without the base path
+	Snippet string `json:"snippet"`
+	Score   int    `json:"score"`
+	Section string `json:"section,omitempty"` // headings of the matching section, e.g. "Install > Linux"
+	Anchor  string `json:"anchor,omitempty"`  // heading ID of the section with the match
+	Page    int    `json:"page,omitempty"`    // page of a paginated document with the match
+
+	matchAt int // offset of the match in the rendered text of the page, -1 if not known
+}
+
+// DocumentSource is the markdown source of a document, as used by the browser editor
+type DocumentSource struct {
+	Path        string `json:"path"`
+	Content     string `json:"content"`
+	Hash        string `json:"hash"`
+	Words       int    `json:"words,omitempty"`
+	ReadingTime int    `json:"reading_time,omitempty"` // minutes
 }
 
 // IndexData represents data for the index template
@@ -135,6 +553,23 @@ type IndexData struct {
 	Groups         []DirectoryGroup
 	Trees          []DirectoryTree
 	TotalDocuments int
+	Recent         []DocumentLink // recently viewed by this browser
+	Favorites      []DocumentLink // starred by this browser
+	RecentSearches []string       // queries of this browser, most recent first
+	SavedSearches  []SavedSearch  // searches saved by this browser
+	MostViewed     []DocumentViews
+	User           string // authenticated user, "" if anonymous
+	Login          bool   // anonymous users can log in with basic auth
+	Admin          bool   // the user can use the admin API, e.g. reload
+	Indexing       bool   // the first scan is still running
+	ScanLimit      string // limit that stopped the last scan early
+	Prefs          PreferencesView
+}
+
+// DocumentLink is a document listed by path and title
+type DocumentLink struct {
+	Path  string `json:"path"`
+	Title string `json:"title"`
 }
 
 // DocumentData represents data for the document template
@@ -145,7 +580,59 @@ type DocumentData struct {
 	AbsPath    string
 	Content    template.HTML
 	Trees      []DirectoryTree
-	CurrentDoc string // RelPath of the current document for highlighting
+	CurrentDoc string         // RelPath of the current document for highlighting
+	PrintMode  bool           // Render without navigation chrome (?print=1)
+	Editable   bool           // Show the in-browser editor
+	CanOpen    bool           // Show the Edit button opening the local editor
+	Favorite   bool           // Starred by this browser
+	Backlinks  []DocumentLink // Documents linking to this one
+	Math       bool           // Load KaTeX to render formulas
+	Annotate   bool           // Show comments and let readers add them
+	Table      bool           // Load the script sorting the columns of a CSV or TSV table
+	Tasks      TaskProgress   // Task list completion
+	Language   string         // Language of this document
+	Admin      bool           // Show the Reload button (admin API)
+	Prefs      PreferencesView
+
+	// Words and the estimated ReadingTime in minutes are shown under the
+	// title
+	Words       int
+	ReadingTime int
+
+	// Stale is set when the document was not updated for longer than
+	// stale_after
+	Stale *StaleDocument
+
+	// Description (the overview), SiteName and the absolute URL of the
+	// page fill the meta description and Open Graph / Twitter card tags
+	Description string
+	SiteName    string
+	URL         string
+	Permalink   string // /d/{slug} with slug_urls, without the base path
+
+	// Translations lists the document in every language, nil if it has none
+	Translations []Translation
+	// Versions lists the document in every version of its doc set, nil if
+	// the set has a single version; Version is set for non-default versions
+	Versions []DocumentVersion
+	Version  string
+
+	// Pages lists the pages of a document larger than page_size (nil if
+	// it fits in one), with the neighbours of the current page
+	Page     int // requested page, for task toggles
+	Pages    []DocumentPage
+	PrevPage *DocumentPage
+	NextPage *DocumentPage
+	// PageAnchors maps heading ids on the other pages to their page, so
+	// links to them can go to the right page
+	PageAnchors map[string]int
+}
+
+// DocumentPage is a page of a paginated document
+type DocumentPage struct {
+	Number  int
+	Title   string // first heading on the page
+	Current bool
 }
 
 // TreeNode represents a node in the directory tree
@@ -156,10 +643,11 @@ type TreeNode struct {
 	Document *Document
 	Children []*TreeNode
 	IsOpen   bool
+	Index    *Document // landing page of a directory (its README.md or index.md)
 }
 
 // DirectoryTree represents a tree of documents grouped by directory
 type DirectoryTree struct {
 	Name string
 	Root *TreeNode
-}
\ No newline at end of file
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// movesFileName stores the documents seen moving between scans, in the
+	// state directory (see statePath)
+	movesFileName = ".dimandocs-moves.json"
+
+	// gitRenamesTTL is how long the renames read from git are used before
+	// git is asked again
+	gitRenamesTTL = 5 * time.Minute
+
+	// maxMoveHops bounds how many moves are followed to find where a
+	// document is now
+	maxMoveHops = 10
+)
+
+// MoveTracker remembers documents that moved, by their previous RelPath, so
+// links to their old URL can be redirected. Moves are detected when a
+// re-scan finds a removed and an added file with the same content, and are
+// written to a file so they survive restarts.
+type MoveTracker struct {
+	mu    sync.Mutex
+	path  string
+	moves map[string]string // previous RelPath -> RelPath it moved to
+}
+
+// LoadMoves reads the moves file, starting empty if it does not exist
+func LoadMoves(path string) *MoveTracker {
+	mt := &MoveTracker{path: path, moves: make(map[string]string)}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read moved documents", "file", path, "error", err)
+		}
+		return mt
+	}
+	if err := json.Unmarshal(data, &mt.moves); err != nil {
+		slog.Warn("failed to parse moved documents, starting empty", "file", path, "error", err)
+		mt.moves = make(map[string]string)
+	}
+	return mt
+}
+
+// Record remembers that the document at from moved to to, and saves the
+// moves
+func (mt *MoveTracker) Record(from, to string) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	mt.moves[from] = to
+	delete(mt.moves, to) // a document is there again
+	data, err := json.MarshalIndent(mt.moves, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(mt.path, data, 0644)
+	}
+	if err != nil {
+		slog.Warn("failed to save moved documents", "file", mt.path, "error", err)
+	}
+}
+
+// Get returns where the document at relPath moved to
+func (mt *MoveTracker) Get(relPath string) (string, bool) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+	to, ok := mt.moves[relPath]
+	return to, ok
+}
+
+// trackMoves records the documents of the default version that were
+// removed between two scans while a file with the same content (the same
+// size and hash of the first 64 KB) was added. Ambiguous matches are skipped.
+func (a *App) trackMoves(previous, docs []Document) {
+	type key struct {
+		hash string
+		size int64
+	}
+	current := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		if doc.Version == "" {
+			current[doc.RelPath] = true
+		}
+	}
+	removed := make(map[key][]string)
+	before := make(map[string]bool, len(previous))
+	for _, doc := range previous {
+		if doc.Version != "" {
+			continue
+		}
+		before[doc.RelPath] = true
+		if !current[doc.RelPath] && doc.Hash != "" {
+			k := key{doc.Hash, doc.Size}
+			removed[k] = append(removed[k], doc.RelPath)
+		}
+	}
+	added := make(map[key][]string)
+	for _, doc := range docs {
+		if doc.Version == "" && !before[doc.RelPath] && doc.Hash != "" {
+			k := key{doc.Hash, doc.Size}
+			added[k] = append(added[k], doc.RelPath)
+		}
+	}
+	for k, from := range removed {
+		if to := added[k]; len(from) == 1 && len(to) == 1 {
+			a.Moves.Record(from[0], to[0])
+			slog.Info("document moved", "from", from[0], "to", to[0])
+		}
+	}
+}
+
+// gitRenames caches the renames found in the git history of the
+// configured directories
+type gitRenames struct {
+	mu      sync.Mutex
+	read    time.Time
+	renames map[string]string // RelPath -> RelPath of its most recent rename
+}
+
+// gitMoves returns the files of the configured directories renamed in git,
+// reading them again once they are older than gitRenamesTTL
+func (a *App) gitMoves() map[string]string {
+	a.renames.mu.Lock()
+	defer a.renames.mu.Unlock()
+	if a.renames.renames != nil && time.Since(a.renames.read) < gitRenamesTTL {
+		return a.renames.renames
+	}
+
+	renames := make(map[string]string)
+	if _, err := exec.LookPath("git"); err == nil {
+		for _, dir := range a.Config.Directories {
+			if err := readGitRenames(dir.Path, renames); err != nil {
+				slog.Debug("no git history for directory", "path", dir.Path, "error", err)
+			}
+		}
+	}
+	a.renames.renames, a.renames.read = renames, time.Now()
+	return renames
+}
+
+// readGitRenames adds the files under dir renamed in the history of the git
+// repository dir is in to renames, by their path relative to dir. Only the
+// most recent rename of a path is kept.
+func readGitRenames(dir string, renames map[string]string) error {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	if abs, err = filepath.EvalSymlinks(abs); err != nil {
+		return err
+	}
+	out, err := exec.Command("git", "-C", abs, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return err
+	}
+	top := strings.TrimSpace(string(out))
+	rel, err := filepath.Rel(top, abs)
+	if err != nil {
+		return err
+	}
+
+	// Renames are listed newest first as "R<similarity>\t<from>\t<to>",
+	// relative to the top of the repository
+	out, err = exec.Command("git", "-C", top, "-c", "core.quotePath=false", "log",
+		"--format=", "--name-status", "--diff-filter=R", "-M", "--", filepath.ToSlash(rel)).Output()
+	if err != nil {
+		return err
+	}
+	relTo := func(path string) (string, bool) {
+		relPath, err := filepath.Rel(abs, filepath.Join(top, filepath.FromSlash(path)))
+		if err != nil || strings.HasPrefix(relPath, "..") {
+			return "", false
+		}
+		return filepath.ToSlash(relPath), true
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 || !strings.HasPrefix(fields[0], "R") {
+			continue
+		}
+		from, ok := relTo(fields[1])
+		to, ok2 := relTo(fields[2])
+		if !ok || !ok2 {
+			continue
+		}
+		if _, seen := renames[from]; !seen {
+			renames[from] = to
+		}
+	}
+	return scanner.Err()
+}
+
+// movedDocument returns the document readable by r that the document at
+// relPath moved to, following moves seen between scans and renames in git,
+// or nil
+func (a *App) movedDocument(r *http.Request, relPath string) *Document {
+	var renames map[string]string
+	for hop := 0; hop < maxMoveHops; hop++ {
+		to, ok := a.Moves.Get(relPath)
+		if !ok {
+			if renames == nil {
+				renames = a.gitMoves()
+			}
+			if to, ok = renames[relPath]; !ok {
+				return nil
+			}
+		}
+		if doc := a.readableDocument(r, to); doc != nil {
+			return doc
+		}
+		relPath = to
+	}
+	return nil
+}
+
+// redirectMoved redirects a request for the missing document at relPath to
+// where it moved, keeping the query. It reports false if it did not move.
+func (a *App) redirectMoved(w http.ResponseWriter, r *http.Request, relPath string) bool {
+	doc := a.movedDocument(r, relPath)
+	if doc == nil {
+		return false
+	}
+	target := a.Config.BasePath + docURL(doc.RelPath)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+	return true
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// docusaurusNumberPrefix is the number prefix Docusaurus strips from file
+// and folder names to order them, as in "01-intro.md"
+var docusaurusNumberPrefix = regexp.MustCompile(`^\d+[-_. ]+`)
+
+// importedNav is the site read by `dimandocs init --from`
+type importedNav struct {
+	Title     string
+	Directory DirectoryConfig
+	Missing   []string // nav entries whose document was not found
+}
+
+// importNav reads the navigation of a mkdocs.yml or a Docusaurus sidebars
+// file into a directory whose nav keeps the curated order. Paths are made
+// relative to workingDir.
+func importNav(file, workingDir string) (*importedNav, error) {
+	var (
+		imported *importedNav
+		docsDir  string
+		err      error
+	)
+	switch ext := strings.ToLower(filepath.Ext(file)); ext {
+	case ".yml", ".yaml":
+		imported, docsDir, err = importMkdocs(file)
+	case ".js", ".cjs", ".mjs", ".ts":
+		imported, docsDir, err = importDocusaurus(file)
+	default:
+		return nil, fmt.Errorf("unsupported file '%s' (use a mkdocs.yml or a Docusaurus sidebars.js)", file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	absDocsDir, err := filepath.Abs(docsDir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(absDocsDir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("documentation directory %s not found", docsDir)
+	}
+	relDocsDir, err := filepath.Rel(workingDir, absDocsDir)
+	if err != nil {
+		relDocsDir = absDocsDir
+	}
+	relDocsDir = filepath.ToSlash(relDocsDir)
+	switch {
+	case relDocsDir == ".":
+		relDocsDir = "./"
+	case relDocsDir != ".." && !strings.HasPrefix(relDocsDir, "../") && !filepath.IsAbs(relDocsDir):
+		relDocsDir = "./" + relDocsDir
+	}
+	imported.Directory.Path = relDocsDir
+	if imported.Directory.Name == "" {
+		imported.Directory.Name = titleCase(filepath.Base(absDocsDir))
+	}
+	return imported, nil
+}
+
+// importMkdocs reads the site_name, docs_dir and nav of a mkdocs.yml. The
+// file is read as a YAML tree, since mkdocs configs often use Python tags
+// (!!python/name:...) that cannot be decoded.
+func importMkdocs(file string) (*importedNav, string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, "", fmt.Errorf("invalid %s: %w", file, err)
+	}
+	if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, "", fmt.Errorf("invalid %s: not a mkdocs config", file)
+	}
+
+	imported := &importedNav{Directory: DirectoryConfig{FilePattern: `\.md$`}}
+	docsDir := "docs"
+	var nav *yaml.Node
+	mapping := root.Content[0]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		value := mapping.Content[i+1]
+		switch mapping.Content[i].Value {
+		case "site_name":
+			imported.Title = value.Value
+			imported.Directory.Name = value.Value
+		case "docs_dir":
+			docsDir = value.Value
+		case "nav":
+			nav = value
+		}
+	}
+	docsDir = filepath.Join(filepath.Dir(file), filepath.FromSlash(docsDir))
+
+	var entries []string
+	if nav != nil {
+		mkdocsNavEntries(nav, &entries)
+	}
+	for _, entry := range entries {
+		entry = strings.Trim(path.Clean("/"+entry), "/")
+		if _, err := os.Stat(filepath.Join(docsDir, filepath.FromSlash(entry))); err != nil {
+			imported.Missing = append(imported.Missing, entry)
+			continue
+		}
+		if indexOf(imported.Directory.Nav, entry) < 0 {
+			imported.Directory.Nav = append(imported.Directory.Nav, entry)
+		}
+	}
+	return imported, docsDir, nil
+}
+
+// mkdocsNavEntries appends the pages of a mkdocs nav in order. Items are
+// "page.md", "Title: page.md" or "Section: [items]"; links to other sites
+// are left out.
+func mkdocsNavEntries(node *yaml.Node, entries *[]string) {
+	switch node.Kind {
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			mkdocsNavEntries(item, entries)
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			mkdocsNavEntries(node.Content[i], entries)
+		}
+	case yaml.ScalarNode:
+		if node.Value != "" && !isExternalLink(node.Value) {
+			*entries = append(*entries, node.Value)
+		}
+	}
+}
+
+// importDocusaurus reads the doc IDs of a Docusaurus sidebars file, in
+// order, and maps them to the files of the docs directory next to it. IDs
+// are paths without extension and number prefixes, or the frontmatter id
+// of the file. Autogenerated sidebar sections keep the default order.
+func importDocusaurus(file string) (*importedNav, string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, "", err
+	}
+	docsDir := filepath.Join(filepath.Dir(file), "docs")
+	files, err := docusaurusDocIDs(docsDir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	imported := &importedNav{Directory: DirectoryConfig{FilePattern: `\.mdx?$`}}
+	for _, id := range sidebarDocIDs(string(data)) {
+		relPath, ok := files[id]
+		if !ok {
+			imported.Missing = append(imported.Missing, id)
+			continue
+		}
+		if indexOf(imported.Directory.Nav, relPath) < 0 {
+			imported.Directory.Nav = append(imported.Directory.Nav, relPath)
+		}
+	}
+	return imported, docsDir, nil
+}
+
+// docusaurusDocIDs returns the documents of a Docusaurus docs directory by
+// doc ID
+func docusaurusDocIDs(docsDir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.Walk(docsDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(p))
+		if info.IsDir() || (ext != ".md" && ext != ".mdx") {
+			return nil
+		}
+		relPath, err := filepath.Rel(docsDir, p)
+		if err != nil {
+			return nil
+		}
+		relPath = filepath.ToSlash(relPath)
+
+		segments := strings.Split(strings.TrimSuffix(relPath, path.Ext(relPath)), "/")
+		for i, segment := range segments {
+			segments[i] = docusaurusNumberPrefix.ReplaceAllString(segment, "")
+		}
+		if content, err := ioutil.ReadFile(p); err == nil {
+			if id := parseFrontmatter(string(content))["id"]; len(id) > 0 && id[0] != "" {
+				segments[len(segments)-1] = id[0]
+			}
+		}
+		files[strings.Join(segments, "/")] = relPath
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", docsDir, err)
+	}
+	return files, nil
+}
+
+// sidebarDocIDs returns the doc IDs of a sidebars file in order: strings
+// that are items of an array ('intro', or the items of a category) and
+// the values of id keys ({type: 'doc', id: 'intro'}, category links). The
+// JavaScript is only tokenized, not run.
+func sidebarDocIDs(source string) []string {
+	tokens := jsTokens(source)
+	var ids []string
+	var brackets []string
+	for i, token := range tokens {
+		switch {
+		case token == "[" || token == "{" || token == "(":
+			brackets = append(brackets, token)
+		case token == "]" || token == "}" || token == ")":
+			if len(brackets) > 0 {
+				brackets = brackets[:len(brackets)-1]
+			}
+		case len(token) >= 2 && (token[0] == '\'' || token[0] == '"' || token[0] == '`'):
+			if len(brackets) == 0 {
+				continue
+			}
+			value := token[1 : len(token)-1]
+			next := ""
+			if i+1 < len(tokens) {
+				next = tokens[i+1]
+			}
+			switch brackets[len(brackets)-1] {
+			case "[":
+				if next != ":" {
+					ids = append(ids, value)
+				}
+			case "{":
+				if i >= 2 && tokens[i-1] == ":" && strings.Trim(tokens[i-2], `'"`) == "id" {
+					ids = append(ids, value)
+				}
+			}
+		}
+	}
+	return ids
+}
+
+// jsTokens splits JavaScript source into identifiers, numbers, string
+// literals (with their quotes, escapes left as is) and punctuation,
+// skipping comments
+func jsTokens(source string) []string {
+	var tokens []string
+	for i := 0; i < len(source); {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case strings.HasPrefix(source[i:], "//"):
+			end := strings.IndexByte(source[i:], '\n')
+			if end < 0 {
+				return tokens
+			}
+			i += end
+		case strings.HasPrefix(source[i:], "/*"):
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				return tokens
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(source) && source[j] != c {
+				if source[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(source) {
+				return append(tokens, source[i:]+string(c))
+			}
+			tokens = append(tokens, source[i:j+1])
+			i = j + 1
+		case c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+			j := i + 1
+			for j < len(source) && (source[j] == '_' || source[j] == '$' || source[j] == '.' || source[j] >= '0' && source[j] <= '9' ||
+				source[j] >= 'a' && source[j] <= 'z' || source[j] >= 'A' && source[j] <= 'Z') {
+				j++
+			}
+			tokens = append(tokens, source[i:j])
+			i = j
+		default:
+			tokens = append(tokens, string(c))
+			i++
+		}
+	}
+	return tokens
+}
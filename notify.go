@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Webhook payload formats (notify.format)
+const (
+	notifyFormatSlack = "slack"
+	notifyFormatTeams = "teams"
+	notifyFormatJSON  = "json"
+)
+
+var notifyFormats = map[string]bool{notifyFormatSlack: true, notifyFormatTeams: true, notifyFormatJSON: true}
+
+const (
+	// defaultNotifyDelay is how long changes are collected before posting
+	defaultNotifyDelay = time.Minute
+
+	// notifyListLimit is the most documents of each kind listed in a
+	// Slack or Teams message
+	notifyListLimit = 20
+)
+
+// Kinds of DocumentChange
+const (
+	changeAdded   = "added"
+	changeChanged = "changed"
+	changeRemoved = "removed"
+)
+
+// DocumentChange is a document added, changed or removed between scans
+type DocumentChange struct {
+	Kind  string `json:"kind"`
+	Title string `json:"title"`
+	Path  string `json:"path"` // RelPath of the document
+	URL   string `json:"url"`
+
+	link string // URL path below the base path, turned into URL when posting
+}
+
+// diffDocuments returns the changes from old to docs. Documents are matched
+// by file; they changed if their size or modification time did (documents
+// loaded from the cache have no modification time, only size counts then).
+func diffDocuments(old, docs []Document) []DocumentChange {
+	before := make(map[string]Document, len(old))
+	for _, doc := range old {
+		before[doc.Path] = doc
+	}
+
+	var changes []DocumentChange
+	for _, doc := range docs {
+		prev, ok := before[doc.Path]
+		delete(before, doc.Path)
+		switch {
+		case !ok:
+			changes = append(changes, documentChange(changeAdded, doc))
+		case prev.Size != doc.Size || (!prev.ModTime.IsZero() && !prev.ModTime.Equal(doc.ModTime)):
+			changes = append(changes, documentChange(changeChanged, doc))
+		}
+	}
+	for _, doc := range before {
+		changes = append(changes, documentChange(changeRemoved, doc))
+	}
+	return changes
+}
+
+// documentChange describes a change of doc
+func documentChange(kind string, doc Document) DocumentChange {
+	link := docURL(doc.RelPath)
+	if doc.Version != "" {
+		link = "/" + doc.Version + link
+	}
+	return DocumentChange{Kind: kind, Title: doc.Title, Path: doc.RelPath, link: link}
+}
+
+// Notifier posts document changes to a webhook. Changes are collected for
+// notify.delay after the first one and posted together, so a burst of edits
+// (or a branch checkout) produces a single message.
+type Notifier struct {
+	config  NotifyConfig
+	site    string        // name of the docs in messages
+	baseURL func() string // URL the document links are relative to
+	delay   time.Duration
+	client  *http.Client
+
+	mu      sync.Mutex
+	pending map[string]DocumentChange // by link
+	timer   *time.Timer
+}
+
+// NewNotifier creates a notifier for the configured webhook. baseURL is
+// called when posting, so it can depend on the port the server got.
+func NewNotifier(config NotifyConfig, site string, baseURL func() string) *Notifier {
+	delay := defaultNotifyDelay
+	if config.Delay != "" {
+		if d, err := time.ParseDuration(config.Delay); err == nil {
+			delay = d
+		}
+	}
+	return &Notifier{
+		config:  config,
+		site:    site,
+		baseURL: baseURL,
+		delay:   delay,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		pending: make(map[string]DocumentChange),
+	}
+}
+
+// Record queues changes, merging them with pending changes of the same
+// documents: a document added and then removed is dropped, one removed and
+// added again counts as changed
+func (n *Notifier) Record(changes []DocumentChange) {
+	if n == nil || len(changes) == 0 {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, change := range changes {
+		key := change.link
+		prev, ok := n.pending[key]
+		switch {
+		case !ok:
+			n.pending[key] = change
+		case prev.Kind == changeAdded && change.Kind == changeRemoved:
+			delete(n.pending, key)
+		case prev.Kind == changeAdded:
+			prev.Title = change.Title
+			n.pending[key] = prev
+		case prev.Kind == changeRemoved && change.Kind == changeAdded:
+			change.Kind = changeChanged
+			n.pending[key] = change
+		default:
+			n.pending[key] = change
+		}
+	}
+	if n.timer == nil && len(n.pending) > 0 {
+		n.timer = time.AfterFunc(n.delay, n.flush)
+	}
+}
+
+// flush posts the pending changes
+func (n *Notifier) flush() {
+	n.mu.Lock()
+	changes := make([]DocumentChange, 0, len(n.pending))
+	for _, change := range n.pending {
+		changes = append(changes, change)
+	}
+	n.pending = make(map[string]DocumentChange)
+	n.timer = nil
+	n.mu.Unlock()
+	if len(changes) == 0 {
+		return
+	}
+
+	base := strings.TrimSuffix(n.baseURL(), "/")
+	for i := range changes {
+		changes[i].URL = base + changes[i].link
+	}
+	kindOrder := map[string]int{changeAdded: 0, changeChanged: 1, changeRemoved: 2}
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Kind != changes[j].Kind {
+			return kindOrder[changes[i].Kind] < kindOrder[changes[j].Kind]
+		}
+		return strings.ToLower(changes[i].Title) < strings.ToLower(changes[j].Title)
+	})
+
+	body, err := json.Marshal(n.payload(changes))
+	if err != nil {
+		slog.Error("failed to build webhook payload", "error", err)
+		return
+	}
+	resp, err := n.client.Post(n.config.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("failed to post document changes", "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		slog.Warn("webhook rejected document changes", "status", resp.Status)
+		return
+	}
+	slog.Info("posted document changes", "changes", len(changes))
+}
+
+// payload returns the webhook body for changes in the configured format
+func (n *Notifier) payload(changes []DocumentChange) interface{} {
+	counts := make(map[string]int)
+	for _, change := range changes {
+		counts[change.Kind]++
+	}
+	var parts []string
+	for _, kind := range []string{changeAdded, changeChanged, changeRemoved} {
+		if counts[kind] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+		}
+	}
+	summary := fmt.Sprintf("%s updated: %s", n.site, strings.Join(parts, ", "))
+
+	switch n.config.Format {
+	case notifyFormatJSON:
+		return map[string]interface{}{"site": n.site, "summary": summary, "changes": changes}
+	case notifyFormatTeams:
+		// Legacy connector card, accepted by Teams incoming webhooks
+		return map[string]interface{}{
+			"@type":    "MessageCard",
+			"@context": "https://schema.org/extensions",
+			"summary":  summary,
+			"title":    summary,
+			"text": strings.Join(changeLines(changes, func(c DocumentChange) string {
+				if c.Kind == changeRemoved {
+					return c.Title
+				}
+				return fmt.Sprintf("[%s](%s)", c.Title, c.URL)
+			}), "\n\n"),
+		}
+	default:
+		lines := changeLines(changes, func(c DocumentChange) string {
+			if c.Kind == changeRemoved {
+				return slackEscape(c.Title)
+			}
+			return fmt.Sprintf("<%s|%s>", c.URL, slackEscape(c.Title))
+		})
+		return map[string]string{"text": "*" + slackEscape(summary) + "*\n" + strings.Join(lines, "\n")}
+	}
+}
+
+// changeLines lists changes one per line ("Added: <title>"), at most
+// notifyListLimit of each kind
+func changeLines(changes []DocumentChange, link func(DocumentChange) string) []string {
+	var lines []string
+	listed := make(map[string]int)
+	for _, change := range changes {
+		listed[change.Kind]++
+		if listed[change.Kind] <= notifyListLimit {
+			lines = append(lines, fmt.Sprintf("%s%s: %s", strings.ToUpper(change.Kind[:1]), change.Kind[1:], link(change)))
+		}
+	}
+	for _, kind := range []string{changeAdded, changeChanged, changeRemoved} {
+		if more := listed[kind] - notifyListLimit; more > 0 {
+			lines = append(lines, fmt.Sprintf("...and %d more %s", more, kind))
+		}
+	}
+	return lines
+}
+
+// slackEscape escapes the characters Slack treats as markup in text
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// checkNotify validates the notify settings
+func (v *configValidator) checkNotify(config NotifyConfig) {
+	if config.WebhookURL != "" {
+		if u, err := url.Parse(config.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("notify.webhook_url", "invalid webhook URL %q (use an http:// or https:// URL)", config.WebhookURL)
+		}
+	}
+	if config.Format != "" && !notifyFormats[config.Format] {
+		v.add("notify.format", "invalid format %q (valid values: slack, teams, json)", config.Format)
+	}
+	if config.Delay != "" {
+		if _, err := time.ParseDuration(config.Delay); err != nil {
+			v.add("notify.delay", "invalid duration %q (use e.g. \"30s\" or \"5m\")", config.Delay)
+		}
+	}
+	if config.URL != "" {
+		if u, err := url.Parse(config.URL); err != nil || u.Scheme == "" || u.Host == "" {
+			v.add("notify.url", "invalid URL %q (use the address readers open, e.g. \"https://docs.example.com\")", config.URL)
+		}
+	}
+}
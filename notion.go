@@ -0,0 +1,598 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/text"
+)
+
+const (
+	// notionVersion is the version of the Notion API requests are made for
+	notionVersion = "2022-06-28"
+
+	// notionTextLimit is the longest text of a rich text object
+	notionTextLimit = 2000
+
+	// notionBatchSize is the number of blocks appended to a page at once
+	notionBatchSize = 100
+
+	// notionMaxDepth is the nesting of blocks Notion takes in a request;
+	// blocks nested deeper are appended after their parent
+	notionMaxDepth = 2
+)
+
+// notionAPI is the address of the Notion API
+var notionAPI = "https://api.notion.com/v1"
+
+// notionLanguages are the code block languages Notion knows
+var notionLanguages = strings.Split("abap,arduino,bash,basic,c,clojure,coffeescript,c++,c#,css,dart,diff,docker,elixir,elm,erlang,"+
+	"flow,fortran,f#,gherkin,glsl,go,graphql,groovy,haskell,html,java,javascript,json,julia,kotlin,latex,less,lisp,livescript,"+
+	"lua,makefile,markdown,markup,matlab,mermaid,nix,objective-c,ocaml,pascal,perl,php,plain text,powershell,prolog,protobuf,"+
+	"python,r,reason,ruby,rust,sass,scala,scheme,scss,shell,sql,swift,typescript,vb.net,verilog,vhdl,visual basic,webassembly,"+
+	"xml,yaml", ",")
+
+// notionLanguageAliases maps common code block languages to Notion's names
+var notionLanguageAliases = map[string]string{
+	"sh": "shell", "zsh": "shell", "console": "shell", "js": "javascript", "ts": "typescript", "py": "python",
+	"rb": "ruby", "rs": "rust", "kt": "kotlin", "yml": "yaml", "golang": "go", "cpp": "c++", "cs": "c#",
+	"csharp": "c#", "dockerfile": "docker", "md": "markdown", "make": "makefile", "proto": "protobuf",
+	"tex": "latex", "ps1": "powershell", "text": "plain text", "txt": "plain text",
+}
+
+// notionCallouts are the icons of admonitions
+var notionCallouts = map[string]string{
+	"note": "ℹ️", "tip": "💡", "important": "❗", "warning": "⚠️", "caution": "🛑",
+}
+
+// notionTarget publishes to a Notion database, a page per directory and
+// document. Pages are nested with the database's sub-items relation
+// ("Parent item") if it has one, and keep their path in a "Path" text
+// property if there is one. Documents are converted to Notion blocks.
+type notionTarget struct {
+	p          *publisher
+	config     NotionConfig
+	titleProp  string // name of the title property
+	pathProp   string // name of the "Path" text property, "" if none
+	parentProp string // name of the relation to the parent page, "" if none
+}
+
+// notionBlock is a block of a page, as sent to the API
+type notionBlock map[string]interface{}
+
+// newNotionTarget returns the target configured in publish.notion, reading
+// the properties of the database
+func newNotionTarget(p *publisher) (*notionTarget, error) {
+	config := p.app.Config.Publish.Notion
+	if err := missingPublishSettings(map[string]string{
+		"publish.notion.token":       config.Token,
+		"publish.notion.database_id": config.DatabaseID,
+	}); err != nil {
+		return nil, err
+	}
+	n := &notionTarget{p: p, config: config}
+
+	var database struct {
+		Properties map[string]struct {
+			Type     string `json:"type"`
+			Relation struct {
+				DatabaseID string `json:"database_id"`
+			} `json:"relation"`
+		} `json:"properties"`
+	}
+	if err := n.request(http.MethodGet, "/databases/"+url.PathEscape(config.DatabaseID), nil, &database); err != nil {
+		if errors.Is(err, errPageNotFound) {
+			return nil, fmt.Errorf("database %s not found, or not shared with the integration", config.DatabaseID)
+		}
+		return nil, err
+	}
+	for name, property := range database.Properties {
+		switch {
+		case property.Type == "title":
+			n.titleProp = name
+		case property.Type == "rich_text" && strings.EqualFold(name, "Path"):
+			n.pathProp = name
+		case property.Type == "relation" && (name == "Parent item" || name == "Parent") && notionID(property.Relation.DatabaseID) == notionID(config.DatabaseID):
+			n.parentProp = name
+		}
+	}
+	if n.titleProp == "" {
+		return nil, fmt.Errorf("database %s has no title property", config.DatabaseID)
+	}
+	return n, nil
+}
+
+// notionID returns a Notion ID without dashes, as used in page URLs
+func notionID(id string) string {
+	return strings.ReplaceAll(id, "-", "")
+}
+
+// request sends a request to the Notion API
+func (n *notionTarget) request(method, path string, body, result interface{}) error {
+	req, err := newJSONRequest(method, notionAPI+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+n.config.Token)
+	req.Header.Set("Notion-Version", notionVersion)
+	return publishRequest(req, result)
+}
+
+// properties returns the database properties of a page
+func (n *notionTarget) properties(page *publishPage, parentID string) map[string]interface{} {
+	properties := map[string]interface{}{
+		n.titleProp: map[string]interface{}{"title": notionPlainText(page.Title)},
+	}
+	if n.pathProp != "" {
+		properties[n.pathProp] = map[string]interface{}{"rich_text": notionPlainText(page.Key)}
+	}
+	if n.parentProp != "" {
+		relation := []map[string]string{}
+		if parentID != "" {
+			relation = append(relation, map[string]string{"id": parentID})
+		}
+		properties[n.parentProp] = map[string]interface{}{"relation": relation}
+	}
+	return properties
+}
+
+// find implements publishTarget, by the Path property
+func (n *notionTarget) find(page *publishPage) (string, error) {
+	if n.pathProp == "" {
+		return "", nil
+	}
+	query := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"property":  n.pathProp,
+			"rich_text": map[string]string{"equals": page.Key},
+		},
+	}
+	var result struct {
+		Results []struct {
+			ID string `json:"id"`
+		} `json:"results"`
+	}
+	if err := n.request(http.MethodPost, "/databases/"+url.PathEscape(n.config.DatabaseID)+"/query", query, &result); err != nil {
+		return "", err
+	}
+	if len(result.Results) == 0 {
+		return "", nil
+	}
+	return result.Results[0].ID, nil
+}
+
+// create implements publishTarget
+func (n *notionTarget) create(page *publishPage, parentID string) (string, error) {
+	body := map[string]interface{}{
+		"parent":     map[string]string{"database_id": n.config.DatabaseID},
+		"properties": n.properties(page, parentID),
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := n.request(http.MethodPost, "/pages", body, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// update implements publishTarget, replacing the blocks of the page
+func (n *notionTarget) update(page *publishPage, parentID string) error {
+	var current struct {
+		Archived bool `json:"archived"`
+	}
+	if err := n.request(http.MethodGet, "/pages/"+url.PathEscape(page.id), nil, &current); err != nil {
+		return err
+	}
+	if current.Archived {
+		// Deleted pages stay in the trash for a while
+		return errPageNotFound
+	}
+	blocks, err := n.blocks(page)
+	if err != nil {
+		return err
+	}
+	if err := n.request(http.MethodPatch, "/pages/"+url.PathEscape(page.id), map[string]interface{}{"properties": n.properties(page, parentID)}, nil); err != nil {
+		return err
+	}
+
+	path := "/blocks/" + url.PathEscape(page.id) + "/children"
+	var old []string
+	cursor := ""
+	for {
+		query := url.Values{"page_size": {"100"}}
+		if cursor != "" {
+			query.Set("start_cursor", cursor)
+		}
+		var children struct {
+			Results []struct {
+				ID string `json:"id"`
+			} `json:"results"`
+			HasMore    bool   `json:"has_more"`
+			NextCursor string `json:"next_cursor"`
+		}
+		if err := n.request(http.MethodGet, path+"?"+query.Encode(), nil, &children); err != nil {
+			return err
+		}
+		for _, child := range children.Results {
+			old = append(old, child.ID)
+		}
+		if !children.HasMore || children.NextCursor == "" {
+			break
+		}
+		cursor = children.NextCursor
+	}
+	for _, id := range old {
+		if err := n.request(http.MethodDelete, "/blocks/"+url.PathEscape(id), nil, nil); err != nil && !errors.Is(err, errPageNotFound) {
+			return err
+		}
+	}
+	for start := 0; start < len(blocks); start += notionBatchSize {
+		end := min(start+notionBatchSize, len(blocks))
+		if err := n.request(http.MethodPatch, path, map[string]interface{}{"children": blocks[start:end]}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// blocks converts the content of a page to blocks. Directories without an
+// index document have none; their pages are listed as sub-items.
+func (n *notionTarget) blocks(page *publishPage) ([]notionBlock, error) {
+	content, err := n.p.pageContent(page)
+	if err != nil || page.Doc == nil {
+		return nil, err
+	}
+	source := []byte(content)
+	root := n.p.app.Markdown.Parser().Parse(text.NewReader(source))
+	c := &notionConverter{n: n, doc: page.Doc, source: source}
+	return c.blocks(root, 0), nil
+}
+
+// notionConverter converts the markdown of a document to Notion blocks
+type notionConverter struct {
+	n      *notionTarget
+	doc    *Document
+	source []byte
+}
+
+// notionStyle is the formatting of a run of text
+type notionStyle struct {
+	bold, italic, strikethrough, code bool
+	link                              string
+}
+
+// notionText is a run of text with one style
+type notionText struct {
+	text  string
+	style notionStyle
+}
+
+// blocks converts the block children of node, at the given nesting depth
+func (c *notionConverter) blocks(node ast.Node, depth int) []notionBlock {
+	var blocks []notionBlock
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		blocks = append(blocks, c.block(child, depth)...)
+	}
+	return blocks
+}
+
+// block converts a block node. Blocks Notion has no equivalent for become
+// paragraphs of their text; HTML is left out.
+func (c *notionConverter) block(node ast.Node, depth int) []notionBlock {
+	switch node := node.(type) {
+	case *ast.Heading:
+		return []notionBlock{notionTextBlock(fmt.Sprintf("heading_%d", min(node.Level, 3)), c.richText(node))}
+	case *ast.Paragraph, *ast.TextBlock:
+		if image := c.soleImage(node); image != nil {
+			return []notionBlock{image}
+		}
+		return []notionBlock{notionTextBlock("paragraph", c.richText(node))}
+	case *TableOfContents:
+		return []notionBlock{{"type": "table_of_contents", "table_of_contents": map[string]interface{}{}}}
+	case *Figure:
+		if image := c.soleImage(node); image != nil {
+			image["image"].(map[string]interface{})["caption"] = notionPlainText(node.Caption)
+			return []notionBlock{image}
+		}
+		return []notionBlock{notionTextBlock("paragraph", c.richText(node))}
+	case *ast.List:
+		return c.listItems(node, depth)
+	case *ast.FencedCodeBlock:
+		return []notionBlock{c.codeBlock(string(node.Language(c.source)), node)}
+	case *ast.CodeBlock:
+		return []notionBlock{c.codeBlock("", node)}
+	case *Diagram:
+		return []notionBlock{c.codeBlock(node.Language, node)}
+	case *ast.Blockquote:
+		return c.withChildren(notionTextBlock("quote", nil), "quote", c.blocks(node, depth+1), depth)
+	case *Admonition:
+		block := notionTextBlock("callout", []notionText{{text: strings.ToUpper(node.AdmonitionType[:1]) + node.AdmonitionType[1:], style: notionStyle{bold: true}}})
+		block["callout"].(map[string]interface{})["icon"] = map[string]string{"type": "emoji", "emoji": notionCallouts[node.AdmonitionType]}
+		return c.withChildren(block, "callout", c.blocks(node, depth+1), depth)
+	case *ast.ThematicBreak:
+		return []notionBlock{{"type": "divider", "divider": map[string]interface{}{}}}
+	case *MathBlock:
+		return []notionBlock{{"type": "equation", "equation": map[string]string{"expression": node.TeX}}}
+	case *extast.Table:
+		if depth < notionMaxDepth {
+			return []notionBlock{c.table(node)}
+		}
+	case *ast.HTMLBlock:
+		return nil
+	}
+	if node.Type() == ast.TypeBlock && node.Lines().Len() == 0 && node.HasChildren() {
+		// Containers such as footnote lists
+		return c.blocks(node, depth)
+	}
+	var lines strings.Builder
+	for i := 0; i < node.Lines().Len(); i++ {
+		line := node.Lines().At(i)
+		lines.Write(line.Value(c.source))
+	}
+	if text := strings.TrimSpace(lines.String()); text != "" {
+		return []notionBlock{notionTextBlock("paragraph", []notionText{{text: text}})}
+	}
+	return nil
+}
+
+// withChildren sets the children of a block, or appends them after it when
+// nested deeper than Notion takes
+func (c *notionConverter) withChildren(block notionBlock, kind string, children []notionBlock, depth int) []notionBlock {
+	if len(children) == 0 {
+		return []notionBlock{block}
+	}
+	if depth < notionMaxDepth {
+		block[kind].(map[string]interface{})["children"] = children
+		return []notionBlock{block}
+	}
+	return append([]notionBlock{block}, children...)
+}
+
+// listItems converts the items of a list; task list items become to-dos
+func (c *notionConverter) listItems(list *ast.List, depth int) []notionBlock {
+	kind := "bulleted_list_item"
+	if list.IsOrdered() {
+		kind = "numbered_list_item"
+	}
+	var blocks []notionBlock
+	for item := list.FirstChild(); item != nil; item = item.NextSibling() {
+		var text []notionText
+		first := item.FirstChild()
+		if first != nil && (first.Kind() == ast.KindTextBlock || first.Kind() == ast.KindParagraph) {
+			text = c.richText(first)
+		} else {
+			first = nil
+		}
+
+		itemKind := kind
+		block := notionTextBlock(kind, text)
+		if first != nil {
+			if checkbox, ok := first.FirstChild().(*extast.TaskCheckBox); ok {
+				itemKind = "to_do"
+				block = notionTextBlock(itemKind, text)
+				block[itemKind].(map[string]interface{})["checked"] = checkbox.IsChecked
+			}
+		}
+
+		var children []notionBlock
+		for child := item.FirstChild(); child != nil; child = child.NextSibling() {
+			if child != first {
+				children = append(children, c.block(child, depth+1)...)
+			}
+		}
+		blocks = append(blocks, c.withChildren(block, itemKind, children, depth)...)
+	}
+	return blocks
+}
+
+// codeBlock converts a code block, with its language if Notion knows it
+func (c *notionConverter) codeBlock(language string, node ast.Node) notionBlock {
+	var code strings.Builder
+	for i := 0; i < node.Lines().Len(); i++ {
+		line := node.Lines().At(i)
+		code.Write(line.Value(c.source))
+	}
+	language = strings.ToLower(language)
+	if alias, ok := notionLanguageAliases[language]; ok {
+		language = alias
+	}
+	if indexOf(notionLanguages, language) < 0 {
+		language = "plain text"
+	}
+	return notionBlock{
+		"type": "code",
+		"code": map[string]interface{}{
+			"rich_text": notionPlainText(strings.TrimSuffix(code.String(), "\n")),
+			"language":  language,
+		},
+	}
+}
+
+// table converts a table; the first row is the header
+func (c *notionConverter) table(table *extast.Table) notionBlock {
+	width := len(table.Alignments)
+	var rows []notionBlock
+	for row := table.FirstChild(); row != nil; row = row.NextSibling() {
+		cells := make([]interface{}, 0, width)
+		for cell := row.FirstChild(); cell != nil && len(cells) < width; cell = cell.NextSibling() {
+			cells = append(cells, notionRichText(c.richText(cell)))
+		}
+		for len(cells) < width {
+			cells = append(cells, []interface{}{})
+		}
+		rows = append(rows, notionBlock{"type": "table_row", "table_row": map[string]interface{}{"cells": cells}})
+	}
+	return notionBlock{
+		"type": "table",
+		"table": map[string]interface{}{
+			"table_width":       width,
+			"has_column_header": true,
+			"has_row_header":    false,
+			"children":          rows,
+		},
+	}
+}
+
+// soleImage returns an image block for a paragraph holding only an image
+// with an absolute URL, nil otherwise. Relative images are not uploaded.
+func (c *notionConverter) soleImage(node ast.Node) notionBlock {
+	image, ok := node.FirstChild().(*ast.Image)
+	if !ok || image.NextSibling() != nil {
+		return nil
+	}
+	destination := string(image.Destination)
+	if !strings.HasPrefix(destination, "https://") && !strings.HasPrefix(destination, "http://") {
+		return nil
+	}
+	return notionBlock{
+		"type":  "image",
+		"image": map[string]interface{}{"type": "external", "external": map[string]string{"url": destination}},
+	}
+}
+
+// richText converts the inline children of node
+func (c *notionConverter) richText(node ast.Node) []notionText {
+	var texts []notionText
+	c.inline(node, notionStyle{}, &texts)
+	return texts
+}
+
+// inline appends the text of the inline children of node, with style
+func (c *notionConverter) inline(node ast.Node, style notionStyle, texts *[]notionText) {
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		childStyle := style
+		switch child := child.(type) {
+		case *ast.Text:
+			value := string(child.Segment.Value(c.source))
+			if child.HardLineBreak() || (child.SoftLineBreak() && c.n.p.app.Config.Markdown.HardWraps) {
+				value += "\n"
+			} else if child.SoftLineBreak() {
+				value += " "
+			}
+			appendNotionText(texts, value, style)
+			continue
+		case *ast.String:
+			// The typographer's quotes and dashes are HTML entities
+			appendNotionText(texts, html.UnescapeString(string(child.Value)), style)
+			continue
+		case *ast.CodeSpan:
+			childStyle.code = true
+		case *ast.Emphasis:
+			if child.Level >= 2 {
+				childStyle.bold = true
+			} else {
+				childStyle.italic = true
+			}
+		case *extast.Strikethrough:
+			childStyle.strikethrough = true
+		case *ast.Link:
+			childStyle.link = c.linkURL(string(child.Destination))
+		case *ast.AutoLink:
+			value := string(child.URL(c.source))
+			childStyle.link = c.linkURL(value)
+			appendNotionText(texts, string(child.Label(c.source)), childStyle)
+			continue
+		case *ast.Image:
+			if destination := string(child.Destination); strings.HasPrefix(destination, "https://") || strings.HasPrefix(destination, "http://") {
+				childStyle.link = destination
+			}
+		case *MediaEmbed:
+			childStyle.link = c.linkURL(string(child.Destination))
+		case *WikiLink:
+			if relPath, ok := c.n.p.app.resolveWikiLink(child.Target); ok {
+				if target := lookupDocument(c.n.p.app.Documents, relPath); target != nil {
+					childStyle.link = c.pageURL(c.n.p.pages[target.Path])
+				}
+			}
+			appendNotionText(texts, child.Caption(), childStyle)
+			continue
+		case *MathInline:
+			appendNotionText(texts, child.TeX, notionStyle{code: true})
+			continue
+		case *extast.TaskCheckBox, *ast.RawHTML:
+			continue
+		}
+		c.inline(child, childStyle, texts)
+	}
+}
+
+// linkURL returns the URL a link points to in Notion: the page of a
+// published document, or an http(s) URL. Other links become plain text.
+func (c *notionConverter) linkURL(destination string) string {
+	if page := c.n.p.linkedPage(c.doc, destination); page != nil {
+		return c.pageURL(page)
+	}
+	if strings.HasPrefix(destination, "https://") || strings.HasPrefix(destination, "http://") || strings.HasPrefix(destination, "mailto:") {
+		return destination
+	}
+	return ""
+}
+
+// pageURL returns the URL of a published page, "" if it has none
+func (c *notionConverter) pageURL(page *publishPage) string {
+	if page == nil || page.id == "" {
+		return ""
+	}
+	return "https://www.notion.so/" + notionID(page.id)
+}
+
+// appendNotionText appends text to texts, merging it with the last run if
+// it has the same style
+func appendNotionText(texts *[]notionText, value string, style notionStyle) {
+	if value == "" {
+		return
+	}
+	if last := len(*texts) - 1; last >= 0 && (*texts)[last].style == style {
+		(*texts)[last].text += value
+		return
+	}
+	*texts = append(*texts, notionText{text: value, style: style})
+}
+
+// notionRichText returns texts as rich text objects, splitting text longer
+// than Notion takes
+func notionRichText(texts []notionText) []interface{} {
+	objects := []interface{}{}
+	for _, t := range texts {
+		for value := t.text; value != ""; {
+			chunk := value
+			if utf8.RuneCountInString(chunk) > notionTextLimit {
+				chunk = string([]rune(chunk)[:notionTextLimit])
+			}
+			value = value[len(chunk):]
+			content := map[string]interface{}{"content": chunk}
+			if t.style.link != "" {
+				content["link"] = map[string]string{"url": t.style.link}
+			}
+			objects = append(objects, map[string]interface{}{
+				"type": "text",
+				"text": content,
+				"annotations": map[string]bool{
+					"bold":          t.style.bold,
+					"italic":        t.style.italic,
+					"strikethrough": t.style.strikethrough,
+					"code":          t.style.code,
+				},
+			})
+		}
+	}
+	return objects
+}
+
+// notionPlainText returns unformatted text as rich text objects
+func notionPlainText(value string) []interface{} {
+	return notionRichText([]notionText{{text: value}})
+}
+
+// notionTextBlock returns a block of the given type with text
+func notionTextBlock(kind string, texts []notionText) notionBlock {
+	return notionBlock{"type": kind, kind: map[string]interface{}{"rich_text": notionRichText(texts)}}
+}
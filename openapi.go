@@ -0,0 +1,768 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultOpenAPIPattern matches the file names of OpenAPI and Swagger specs
+// when a directory has no openapi_pattern
+const defaultOpenAPIPattern = `^(?i)(openapi|swagger)\.(ya?ml|json)$`
+
+// apiMethods are the operations of an OpenAPI path item
+var apiMethods = map[string]bool{
+	"get": true, "put": true, "post": true, "delete": true,
+	"options": true, "head": true, "patch": true, "trace": true,
+}
+
+// isOpenAPIFile reports whether a document is an API spec rather than
+// markdown. Only openapi_pattern brings YAML and JSON files into a scan.
+func isOpenAPIFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// apiReference is an OpenAPI 3 or Swagger 2 spec as its reference page
+// shows it
+type apiReference struct {
+	Title       string
+	Version     string
+	Spec        string // "OpenAPI 3.0.3", "Swagger 2.0"
+	Description template.HTML
+	Servers     []apiServer
+	Groups      []apiGroup
+	Schemas     []apiSchema
+}
+
+type apiServer struct {
+	URL         string
+	Description string
+}
+
+// apiGroup holds the operations of a tag, in the order of the spec
+type apiGroup struct {
+	Name        string
+	Description template.HTML
+	Operations  []apiOperation
+}
+
+type apiOperation struct {
+	ID          string // anchor of the operation
+	Method      string
+	Path        string
+	Summary     string
+	Description template.HTML
+	Deprecated  bool
+	Security    []string
+	Parameters  []apiField
+	RequestBody *apiBody
+	Responses   []apiResponse
+}
+
+// apiField is a parameter, header or schema property
+type apiField struct {
+	Name        string
+	In          string // "path", "query", "header" or "cookie" for parameters
+	Type        template.HTML
+	Required    bool
+	Description template.HTML
+}
+
+type apiBody struct {
+	Description template.HTML
+	Required    bool
+	Content     []apiMedia
+}
+
+// apiMedia is the schema of a body in one media type
+type apiMedia struct {
+	Type    string
+	Schema  template.HTML
+	Fields  []apiField // properties of an inline object schema
+	Example string
+}
+
+type apiResponse struct {
+	Status      string
+	Description template.HTML
+	Headers     []apiField
+	Content     []apiMedia
+}
+
+type apiSchema struct {
+	ID          string
+	Name        string
+	Type        template.HTML
+	Description template.HTML
+	Fields      []apiField
+}
+
+// apiSpec reads a parsed spec for its reference page
+type apiSpec struct {
+	app          *App
+	root         *yaml.Node
+	swagger      bool
+	schemaPrefix string // "#/components/schemas/" or "#/definitions/"
+	ids          map[string]int
+}
+
+// renderOpenAPICached renders an API spec, reusing the cached HTML stored
+// under key if the spec and rendering settings have not changed
+func (a *App) renderOpenAPICached(key, content string) ([]byte, error) {
+	hash := contentHash("openapi\n" + markdownFingerprint(a.Config) + "\n" + content)
+	if html, ok := a.Renders.Get(key, hash); ok {
+		return html, nil
+	}
+
+	html, err := a.renderOpenAPI(content)
+	if err != nil {
+		return nil, err
+	}
+	a.Renders.Put(key, hash, html)
+	return html, nil
+}
+
+// renderOpenAPI renders an OpenAPI 3 or Swagger 2 spec, in YAML or JSON, as
+// an API reference: its servers, the operations grouped by tag with their
+// parameters, request bodies and responses, and the schemas. Descriptions
+// are markdown. A spec that cannot be read is shown as source, with the
+// error.
+func (a *App) renderOpenAPI(content string) ([]byte, error) {
+	reference, err := a.apiReference([]byte(content))
+	if err != nil {
+		return []byte(`<div class="admonition admonition-warning">` + "\n" +
+			`<p class="admonition-title">Invalid API spec</p>` + "\n" +
+			`<p>` + html.EscapeString(err.Error()) + "</p>\n</div>\n" +
+			`<pre><code>` + html.EscapeString(content) + "</code></pre>\n"), nil
+	}
+
+	tmpl, err := a.parseTemplates("templates/openapi.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, reference); err != nil {
+		return nil, fmt.Errorf("failed to render API reference: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// parseOpenAPI parses a spec and tells whether it is Swagger 2
+func parseOpenAPI(content []byte) (*yaml.Node, bool, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, false, err
+	}
+	root := yamlAlias(&doc)
+	switch {
+	case yamlString(root, "openapi") != "":
+		return root, false, nil
+	case yamlString(root, "swagger") != "":
+		return root, true, nil
+	}
+	return nil, false, fmt.Errorf("not an OpenAPI or Swagger document")
+}
+
+// openAPIInfo returns the title and description of a spec, "" if it cannot
+// be read
+func openAPIInfo(content []byte) (string, string) {
+	root, _, err := parseOpenAPI(content)
+	if err != nil {
+		return "", ""
+	}
+	info := yamlValue(root, "info")
+	return yamlString(info, "title"), yamlString(info, "description")
+}
+
+// openAPISummary returns the title and overview of the spec at path. The
+// whole file is read, since a spec cut at metadataReadLimit cannot be
+// parsed.
+func (a *App) openAPISummary(path, fallback string) (string, string) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fallback, ""
+	}
+	title, description := openAPIInfo(content)
+	if title == "" {
+		title = fallback
+	}
+	overview := extractOverview(description, a.Config.Overview)
+	return substituteVariables(title, a.Config.Variables), substituteVariables(overview, a.Config.Variables)
+}
+
+// apiReference reads a spec into its reference page
+func (a *App) apiReference(content []byte) (*apiReference, error) {
+	root, swagger, err := parseOpenAPI(content)
+	if err != nil {
+		return nil, err
+	}
+	s := &apiSpec{app: a, root: root, swagger: swagger, schemaPrefix: "#/components/schemas/", ids: make(map[string]int)}
+	if swagger {
+		s.schemaPrefix = "#/definitions/"
+	}
+
+	info := yamlValue(root, "info")
+	reference := &apiReference{
+		Title:       yamlString(info, "title"),
+		Version:     yamlString(info, "version"),
+		Spec:        "OpenAPI " + yamlString(root, "openapi"),
+		Description: s.markdown(yamlString(info, "description")),
+		Servers:     s.servers(),
+		Groups:      s.groups(),
+	}
+	if swagger {
+		reference.Spec = "Swagger " + yamlString(root, "swagger")
+	}
+	if reference.Title == "" {
+		reference.Title = "API Reference"
+	}
+
+	schemas := yamlValue(yamlValue(root, "components"), "schemas")
+	if swagger {
+		schemas = yamlValue(root, "definitions")
+	}
+	yamlEach(schemas, func(name string, schema *yaml.Node) {
+		reference.Schemas = append(reference.Schemas, apiSchema{
+			ID:          schemaID(name),
+			Name:        name,
+			Type:        s.schemaType(schema, 0),
+			Description: s.markdown(yamlString(schema, "description")),
+			Fields:      s.fields(schema, 0),
+		})
+	})
+	return reference, nil
+}
+
+// servers returns the servers of the API, made of host, basePath and the
+// first scheme for Swagger 2
+func (s *apiSpec) servers() []apiServer {
+	if s.swagger {
+		host, basePath := yamlString(s.root, "host"), yamlString(s.root, "basePath")
+		if host == "" && basePath == "" {
+			return nil
+		}
+		serverURL := basePath
+		if host != "" {
+			scheme := "https"
+			if schemes := yamlValue(s.root, "schemes"); schemes != nil && schemes.Kind == yaml.SequenceNode && len(schemes.Content) > 0 {
+				scheme = schemes.Content[0].Value
+			}
+			serverURL = scheme + "://" + host + basePath
+		}
+		return []apiServer{{URL: serverURL}}
+	}
+
+	var servers []apiServer
+	yamlEachItem(yamlValue(s.root, "servers"), func(server *yaml.Node) {
+		servers = append(servers, apiServer{URL: yamlString(server, "url"), Description: yamlString(server, "description")})
+	})
+	return servers
+}
+
+// groups returns the operations grouped by their first tag: the tags
+// listed at the top of the spec first, then the others as they appear.
+// Untagged operations come last.
+func (s *apiSpec) groups() []apiGroup {
+	var groups []apiGroup
+	index := make(map[string]int)
+	group := func(name string) *apiGroup {
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, apiGroup{Name: name})
+		}
+		return &groups[i]
+	}
+	yamlEachItem(yamlValue(s.root, "tags"), func(tag *yaml.Node) {
+		if name := yamlString(tag, "name"); name != "" {
+			group(name).Description = s.markdown(yamlString(tag, "description"))
+		}
+	})
+
+	var untagged []apiOperation
+	yamlEach(yamlValue(s.root, "paths"), func(path string, item *yaml.Node) {
+		item = s.resolve(item)
+		yamlEach(item, func(method string, operation *yaml.Node) {
+			if !apiMethods[method] {
+				return
+			}
+			op := s.operation(path, method, item, operation)
+			tags := yamlValue(operation, "tags")
+			if tags == nil || tags.Kind != yaml.SequenceNode || len(tags.Content) == 0 {
+				untagged = append(untagged, op)
+				return
+			}
+			g := group(tags.Content[0].Value)
+			g.Operations = append(g.Operations, op)
+		})
+	})
+
+	// Tags without operations are left out
+	used := groups[:0]
+	for _, g := range groups {
+		if len(g.Operations) > 0 {
+			used = append(used, g)
+		}
+	}
+	if len(untagged) > 0 {
+		name := "Operations"
+		if len(used) > 0 {
+			name = "Other operations"
+		}
+		used = append(used, apiGroup{Name: name, Operations: untagged})
+	}
+	return used
+}
+
+// operation reads an operation of a path item
+func (s *apiSpec) operation(path, method string, item, operation *yaml.Node) apiOperation {
+	id := yamlString(operation, "operationId")
+	if id == "" {
+		id = method + " " + path
+	}
+	op := apiOperation{
+		ID:          s.uniqueID("operation-" + anchorSlug(id)),
+		Method:      strings.ToUpper(method),
+		Path:        path,
+		Summary:     yamlString(operation, "summary"),
+		Description: s.markdown(yamlString(operation, "description")),
+		Deprecated:  yamlString(operation, "deprecated") == "true",
+		Security:    s.security(operation),
+		RequestBody: s.requestBody(operation),
+	}
+	params, body := s.parameters(item, operation)
+	op.Parameters = params
+	if body != nil {
+		op.RequestBody = body
+	}
+
+	yamlEach(yamlValue(operation, "responses"), func(status string, response *yaml.Node) {
+		response = s.resolve(response)
+		r := apiResponse{Status: status, Description: s.markdown(yamlString(response, "description"))}
+		yamlEach(yamlValue(response, "headers"), func(name string, header *yaml.Node) {
+			header = s.resolve(header)
+			r.Headers = append(r.Headers, apiField{Name: name, Type: s.schemaType(paramSchema(header), 0), Description: s.markdown(yamlString(header, "description"))})
+		})
+		if s.swagger {
+			if schema := yamlValue(response, "schema"); schema != nil {
+				for _, mediaType := range s.mediaTypes(operation, "produces") {
+					media := s.media(mediaType, schema)
+					media.Example = formatExample(yamlValue(yamlValue(response, "examples"), mediaType))
+					r.Content = append(r.Content, media)
+				}
+			}
+		} else {
+			r.Content = s.content(yamlValue(response, "content"))
+		}
+		op.Responses = append(op.Responses, r)
+	})
+	return op
+}
+
+// parameters returns the parameters of an operation, with the ones of its
+// path item it does not override. Swagger 2 body and form parameters make
+// up the request body instead.
+func (s *apiSpec) parameters(item, operation *yaml.Node) ([]apiField, *apiBody) {
+	var params []*yaml.Node
+	index := make(map[string]int)
+	for _, list := range []*yaml.Node{yamlValue(item, "parameters"), yamlValue(operation, "parameters")} {
+		yamlEachItem(list, func(param *yaml.Node) {
+			param = s.resolve(param)
+			key := yamlString(param, "in") + ":" + yamlString(param, "name")
+			if i, ok := index[key]; ok {
+				params[i] = param
+				return
+			}
+			index[key] = len(params)
+			params = append(params, param)
+		})
+	}
+
+	var fields, form []apiField
+	var body *apiBody
+	for _, param := range params {
+		field := apiField{
+			Name:        yamlString(param, "name"),
+			In:          yamlString(param, "in"),
+			Type:        s.schemaType(paramSchema(param), 0),
+			Required:    yamlString(param, "required") == "true",
+			Description: s.markdown(yamlString(param, "description")),
+		}
+		switch {
+		case s.swagger && field.In == "body":
+			body = &apiBody{Description: field.Description, Required: field.Required}
+			for _, mediaType := range s.mediaTypes(operation, "consumes") {
+				body.Content = append(body.Content, s.media(mediaType, yamlValue(param, "schema")))
+			}
+		case s.swagger && field.In == "formData":
+			field.In = ""
+			form = append(form, field)
+		default:
+			fields = append(fields, field)
+		}
+	}
+	if len(form) > 0 {
+		mediaType := "application/x-www-form-urlencoded"
+		for _, consumes := range s.mediaTypes(operation, "consumes") {
+			if consumes == "multipart/form-data" {
+				mediaType = consumes
+			}
+		}
+		body = &apiBody{Content: []apiMedia{{Type: mediaType, Schema: "object", Fields: form}}}
+	}
+	return fields, body
+}
+
+// paramSchema returns the schema of a parameter or header, which Swagger 2
+// writes on the parameter itself
+func paramSchema(param *yaml.Node) *yaml.Node {
+	if schema := yamlValue(param, "schema"); schema != nil {
+		return schema
+	}
+	return param
+}
+
+// requestBody returns the OpenAPI 3 request body of an operation
+func (s *apiSpec) requestBody(operation *yaml.Node) *apiBody {
+	body := s.resolve(yamlValue(operation, "requestBody"))
+	if body == nil {
+		return nil
+	}
+	return &apiBody{
+		Description: s.markdown(yamlString(body, "description")),
+		Required:    yamlString(body, "required") == "true",
+		Content:     s.content(yamlValue(body, "content")),
+	}
+}
+
+// content returns the media types of an OpenAPI 3 body
+func (s *apiSpec) content(content *yaml.Node) []apiMedia {
+	var media []apiMedia
+	yamlEach(content, func(mediaType string, value *yaml.Node) {
+		m := s.media(mediaType, yamlValue(value, "schema"))
+		m.Example = formatExample(yamlValue(value, "example"))
+		if m.Example == "" {
+			// The first of the named examples
+			if examples := yamlValue(value, "examples"); examples != nil && examples.Kind == yaml.MappingNode && len(examples.Content) >= 2 {
+				m.Example = formatExample(yamlValue(s.resolve(examples.Content[1]), "value"))
+			}
+		}
+		if m.Example == "" {
+			m.Example = formatExample(yamlValue(s.resolve(yamlValue(value, "schema")), "example"))
+		}
+		media = append(media, m)
+	})
+	return media
+}
+
+// media describes a body of a media type with its schema
+func (s *apiSpec) media(mediaType string, schema *yaml.Node) apiMedia {
+	return apiMedia{Type: mediaType, Schema: s.schemaType(schema, 0), Fields: s.fields(schema, 0)}
+}
+
+// mediaTypes returns the consumes or produces of a Swagger 2 operation,
+// falling back to the ones of the spec and to JSON
+func (s *apiSpec) mediaTypes(operation *yaml.Node, key string) []string {
+	for _, node := range []*yaml.Node{yamlValue(operation, key), yamlValue(s.root, key)} {
+		var types []string
+		yamlEachItem(node, func(item *yaml.Node) {
+			types = append(types, item.Value)
+		})
+		if len(types) > 0 {
+			return types
+		}
+	}
+	return []string{"application/json"}
+}
+
+// security returns the names of the security schemes of an operation
+func (s *apiSpec) security(operation *yaml.Node) []string {
+	requirements := yamlValue(operation, "security")
+	if requirements == nil {
+		requirements = yamlValue(s.root, "security")
+	}
+	var names []string
+	yamlEachItem(requirements, func(requirement *yaml.Node) {
+		var schemes []string
+		yamlEach(requirement, func(name string, _ *yaml.Node) {
+			schemes = append(schemes, name)
+		})
+		if len(schemes) > 0 {
+			names = append(names, strings.Join(schemes, " + "))
+		}
+	})
+	return names
+}
+
+// schemaType describes the type of a schema in a few words, with links to
+// the named schemas it refers to
+func (s *apiSpec) schemaType(schema *yaml.Node, depth int) template.HTML {
+	schema = yamlAlias(schema)
+	if schema == nil {
+		return ""
+	}
+	if depth > 5 {
+		return "…"
+	}
+	if ref := yamlString(schema, "$ref"); ref != "" {
+		if name, ok := strings.CutPrefix(ref, s.schemaPrefix); ok {
+			return template.HTML(`<a href="#` + schemaID(name) + `">` + html.EscapeString(name) + `</a>`)
+		}
+		return s.schemaType(s.resolve(schema), depth+1)
+	}
+
+	for _, combinator := range []struct{ key, label string }{{"oneOf", "one of"}, {"anyOf", "any of"}, {"allOf", "all of"}} {
+		list := yamlValue(schema, combinator.key)
+		if list == nil || list.Kind != yaml.SequenceNode {
+			continue
+		}
+		var parts []string
+		for _, item := range list.Content {
+			parts = append(parts, string(s.schemaType(item, depth+1)))
+		}
+		return template.HTML(combinator.label + " " + strings.Join(parts, ", "))
+	}
+
+	typ := yamlString(schema, "type")
+	if types := yamlValue(schema, "type"); types != nil && types.Kind == yaml.SequenceNode {
+		// OpenAPI 3.1 lists the types, "null" for nullable ones
+		var names []string
+		yamlEachItem(types, func(item *yaml.Node) {
+			names = append(names, item.Value)
+		})
+		typ = strings.Join(names, " | ")
+	}
+	switch {
+	case typ == "array":
+		return "array of " + s.schemaType(yamlValue(schema, "items"), depth+1)
+	case (typ == "object" || typ == "") && yamlValue(schema, "properties") == nil && yamlValue(schema, "additionalProperties") != nil:
+		if values := yamlValue(schema, "additionalProperties"); values.Kind == yaml.MappingNode {
+			return "map of " + s.schemaType(values, depth+1)
+		}
+		typ = "object"
+	case typ == "" && yamlValue(schema, "properties") != nil:
+		typ = "object"
+	case typ == "":
+		typ = "any"
+	}
+
+	text := html.EscapeString(typ)
+	if format := yamlString(schema, "format"); format != "" {
+		text += " (" + html.EscapeString(format) + ")"
+	}
+	var values []string
+	yamlEachItem(yamlValue(schema, "enum"), func(item *yaml.Node) {
+		values = append(values, "<code>"+html.EscapeString(item.Value)+"</code>")
+	})
+	if len(values) > 0 {
+		text += ": " + strings.Join(values, ", ")
+	}
+	if yamlString(schema, "nullable") == "true" {
+		text += ", nullable"
+	}
+	return template.HTML(text)
+}
+
+// fields returns the properties of an inline object schema, with those of
+// the inline schemas it is all of. Named schemas are described once, in
+// the schemas section.
+func (s *apiSpec) fields(schema *yaml.Node, depth int) []apiField {
+	schema = yamlAlias(schema)
+	if schema == nil || yamlString(schema, "$ref") != "" || depth > 5 {
+		return nil
+	}
+	if yamlString(schema, "type") == "array" {
+		return s.fields(yamlValue(schema, "items"), depth+1)
+	}
+
+	required := make(map[string]bool)
+	yamlEachItem(yamlValue(schema, "required"), func(item *yaml.Node) {
+		required[item.Value] = true
+	})
+	var fields []apiField
+	yamlEach(yamlValue(schema, "properties"), func(name string, property *yaml.Node) {
+		fields = append(fields, apiField{
+			Name:        name,
+			Type:        s.schemaType(property, 0),
+			Required:    required[name],
+			Description: s.markdown(yamlString(property, "description")),
+		})
+	})
+	yamlEachItem(yamlValue(schema, "allOf"), func(item *yaml.Node) {
+		fields = append(fields, s.fields(item, depth+1)...)
+	})
+	return fields
+}
+
+// markdown renders a description
+func (s *apiSpec) markdown(description string) template.HTML {
+	if strings.TrimSpace(description) == "" {
+		return ""
+	}
+	rendered, err := s.app.renderMarkdown(description)
+	if err != nil {
+		return template.HTML("<p>" + html.EscapeString(description) + "</p>")
+	}
+	return template.HTML(rendered)
+}
+
+// uniqueID returns id, with a number if it was already given out
+func (s *apiSpec) uniqueID(id string) string {
+	s.ids[id]++
+	if n := s.ids[id]; n > 1 {
+		return fmt.Sprintf("%s-%d", id, n)
+	}
+	return id
+}
+
+// resolve follows the $ref of node to the part of the spec it points to.
+// References to other files are not followed.
+func (s *apiSpec) resolve(node *yaml.Node) *yaml.Node {
+	node = yamlAlias(node)
+	// Chains of references, but not cycles
+	for i := 0; i < 10 && node != nil; i++ {
+		ref := yamlString(node, "$ref")
+		if ref == "" {
+			return node
+		}
+		node = s.lookup(ref)
+	}
+	return node
+}
+
+// lookup returns the node at a local JSON pointer like
+// "#/components/schemas/Pet", nil if there is none
+func (s *apiSpec) lookup(ref string) *yaml.Node {
+	pointer, ok := strings.CutPrefix(ref, "#/")
+	if !ok {
+		return nil
+	}
+	node := s.root
+	for _, token := range strings.Split(pointer, "/") {
+		if unescaped, err := url.PathUnescape(token); err == nil {
+			token = unescaped
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		if node = yamlValue(node, token); node == nil {
+			return nil
+		}
+	}
+	return node
+}
+
+// formatExample returns an example as indented JSON, or as is for text
+func formatExample(node *yaml.Node) string {
+	node = yamlAlias(node)
+	if node == nil {
+		return ""
+	}
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!str" {
+		return node.Value
+	}
+	var value interface{}
+	if err := node.Decode(&value); err != nil {
+		return ""
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// schemaID returns the anchor of a named schema
+func schemaID(name string) string {
+	return "schema-" + anchorSlug(name)
+}
+
+// anchorSlug lowercases s and turns what is not a letter or digit into
+// dashes, for anchors
+func anchorSlug(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// yamlAlias returns the node an alias or a document stands for
+func yamlAlias(node *yaml.Node) *yaml.Node {
+	for node != nil {
+		switch {
+		case node.Kind == yaml.AliasNode:
+			node = node.Alias
+		case node.Kind == yaml.DocumentNode && len(node.Content) > 0:
+			node = node.Content[0]
+		default:
+			return node
+		}
+	}
+	return nil
+}
+
+// yamlValue returns the value of key in a mapping, nil if it has none
+func yamlValue(node *yaml.Node, key string) *yaml.Node {
+	node = yamlAlias(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return yamlAlias(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// yamlString returns the scalar value of key in a mapping, "" if missing
+func yamlString(node *yaml.Node, key string) string {
+	value := yamlValue(node, key)
+	if value == nil || value.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return value.Value
+}
+
+// yamlEach calls fn with the entries of a mapping in order
+func yamlEach(node *yaml.Node, fn func(key string, value *yaml.Node)) {
+	node = yamlAlias(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		fn(node.Content[i].Value, yamlAlias(node.Content[i+1]))
+	}
+}
+
+// yamlEachItem calls fn with the items of a sequence in order
+func yamlEachItem(node *yaml.Node, fn func(item *yaml.Node)) {
+	node = yamlAlias(node)
+	if node == nil || node.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, item := range node.Content {
+		fn(yamlAlias(item))
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// openSearchDescription is the OpenSearch descriptor served at /opensearch.xml
+type openSearchDescription struct {
+	XMLName       xml.Name        `xml:"http://a9.com/-/spec/opensearch/1.1/ OpenSearchDescription"`
+	ShortName     string          `xml:"ShortName"`
+	Description   string          `xml:"Description"`
+	InputEncoding string          `xml:"InputEncoding"`
+	Image         openSearchImage `xml:"Image"`
+	URLs          []openSearchURL `xml:"Url"`
+}
+
+type openSearchImage struct {
+	Type   string `xml:"type,attr"`
+	Width  int    `xml:"width,attr"`
+	Height int    `xml:"height,attr"`
+	URL    string `xml:",chardata"`
+}
+
+type openSearchURL struct {
+	Type     string `xml:"type,attr"`
+	Method   string `xml:"method,attr"`
+	Template string `xml:"template,attr"`
+}
+
+// requestOrigin returns the scheme and host the request was made to,
+// honoring X-Forwarded-Proto from a reverse proxy
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto == "http" || proto == "https" {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+// handleOpenSearch serves the OpenSearch descriptor that lets browsers add
+// dimandocs as a search engine
+func (a *App) handleOpenSearch(w http.ResponseWriter, r *http.Request) {
+	base := requestOrigin(r) + a.Config.BasePath
+	name := a.Config.Title
+	if name == "" {
+		name = "DimanDocs"
+	}
+
+	desc := openSearchDescription{
+		ShortName:     name,
+		Description:   fmt.Sprintf("Search %s", name),
+		InputEncoding: "UTF-8",
+		Image:         openSearchImage{Type: "image/svg+xml", Width: 16, Height: 16, URL: base + "/static/favicon.svg"},
+		URLs: []openSearchURL{
+			{Type: "text/html", Method: "get", Template: base + "/search?q={searchTerms}"},
+			{Type: "application/x-suggestions+json", Method: "get", Template: base + "/api/suggest?q={searchTerms}"},
+		},
+	}
+
+	data, err := xml.MarshalIndent(desc, "", "  ")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode descriptor: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/opensearchdescription+xml")
+	serveCached(w, r, "", time.Time{}, append([]byte(xml.Header), data...))
+}
+
+// handleSuggest returns title suggestions for the browser address bar, in
+// the OpenSearch suggestions format: [query, [titles], [descriptions], [URLs]]
+func (a *App) handleSuggest(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	titles, descriptions, urls := []string{}, []string{}, []string{}
+	if query != "" {
+		base := requestOrigin(r) + a.Config.BasePath
+		for _, match := range a.quickOpen(a.access(r), query, 10) {
+			titles = append(titles, match.Title)
+			descriptions = append(descriptions, match.RelPath)
+			urls = append(urls, base+match.URL)
+		}
+	}
+	writeJSON(w, http.StatusOK, []interface{}{query, titles, descriptions, urls})
+}
+
+// SearchPageData is the data of the /search results page
+type SearchPageData struct {
+	Title   string // app title
+	Query   string
+	Error   string         // invalid query
+	Results []SearchResult // best first, at most search.max_results
+	Total   int            // number of matches
+}
+
+// handleSearchPage shows search results as a page, best matches first, for
+// browser search engine integration
+func (a *App) handleSearchPage(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := a.parseTemplates("templates/results.html", "templates/a11y.html")
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	data := SearchPageData{Title: a.Config.Title, Query: strings.TrimSpace(r.URL.Query().Get("q"))}
+	query, err := parseSearchQuery(data.Query, a.Config.Search)
+	if err != nil {
+		data.Error = err.Error()
+	} else if !query.Empty() {
+		if utf8.RuneCountInString(data.Query) <= maxSearchQuery {
+			a.History.Searched(a.clientID(w, r), data.Query)
+		}
+		data.Results = a.search(a.access(r), query, "")
+		maxResults := a.Config.Search.MaxResults
+		if maxResults <= 0 {
+			maxResults = defaultSearchMaxResults
+		}
+		data.Total = len(data.Results)
+		if len(data.Results) > maxResults {
+			data.Results = data.Results[:maxResults]
+		}
+		a.linkSections(data.Results, query)
+	}
+	servePage(w, r, tmpl, data)
+}
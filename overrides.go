@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// envPrefix is the prefix of environment variables overriding config keys,
+// e.g. DIMANDOCS_PORT for "port" or DIMANDOCS_SEARCH_MAX_RESULTS for
+// "search.max_results"
+const envPrefix = "DIMANDOCS_"
+
+// applyEnvOverrides sets config values from DIMANDOCS_* environment variables.
+// It returns the overridden fields.
+func applyEnvOverrides(config *Config) ([]string, error) {
+	return applyEnvToStruct(reflect.ValueOf(config).Elem(), envPrefix, "")
+}
+
+// applyEnvToStruct applies environment overrides to the fields of a struct
+func applyEnvToStruct(v reflect.Value, prefix, field string) ([]string, error) {
+	var overridden []string
+	for name, f := range jsonFields(v.Type()) {
+		key := prefix + strings.ToUpper(name)
+		sub := joinField(field, name)
+		fv := v.FieldByIndex(f.Index)
+
+		if fv.Kind() == reflect.Struct {
+			fields, err := applyEnvToStruct(fv, key+"_", sub)
+			if err != nil {
+				return nil, err
+			}
+			overridden = append(overridden, fields...)
+			continue
+		}
+
+		value, ok := os.LookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := setFromString(fv, value); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", key, err)
+		}
+		overridden = append(overridden, sub)
+	}
+	return overridden, nil
+}
+
+// setFromString parses value into v according to its type. Lists are either
+// a JSON array or comma separated, maps a JSON object or comma separated
+// name=value pairs; directories use parseDirectories.
+func setFromString(v reflect.Value, value string) error {
+	switch v.Interface().(type) {
+	case []DirectoryConfig:
+		dirs, err := parseDirectories(value)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(dirs))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("expected a number, got %q", value)
+		}
+		v.SetInt(n)
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := setFromString(elem.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Slice:
+		var list []string
+		if strings.HasPrefix(strings.TrimSpace(value), "[") {
+			if err := json.Unmarshal([]byte(value), &list); err != nil {
+				return fmt.Errorf("invalid JSON array: %w", err)
+			}
+		} else {
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	case reflect.Map:
+		if v.Type().Elem().Kind() != reflect.String {
+			// Maps of lists (auth.groups) only as a JSON object
+			m := reflect.New(v.Type())
+			if err := json.Unmarshal([]byte(value), m.Interface()); err != nil {
+				return fmt.Errorf("invalid JSON object: %w", err)
+			}
+			v.Set(m.Elem())
+			return nil
+		}
+		vars := make(map[string]string)
+		if strings.HasPrefix(strings.TrimSpace(value), "{") {
+			if err := json.Unmarshal([]byte(value), &vars); err != nil {
+				return fmt.Errorf("invalid JSON object: %w", err)
+			}
+		} else {
+			for _, item := range strings.Split(value, ",") {
+				name, val, ok := strings.Cut(item, "=")
+				if !ok {
+					return fmt.Errorf("expected name=value, got %q", item)
+				}
+				vars[strings.TrimSpace(name)] = strings.TrimSpace(val)
+			}
+		}
+		v.Set(reflect.ValueOf(vars))
+	default:
+		return fmt.Errorf("cannot be set from the environment")
+	}
+	return nil
+}
+
+// parseDirectories parses a directories override: either a JSON array of
+// directory objects, or comma separated paths, each optionally prefixed with
+// a display name ("Guides=./docs,./wiki"). Paths use the default .md pattern.
+func parseDirectories(value string) ([]DirectoryConfig, error) {
+	var dirs []DirectoryConfig
+	if strings.HasPrefix(strings.TrimSpace(value), "[") {
+		if err := json.Unmarshal([]byte(value), &dirs); err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %w", err)
+		}
+		return dirs, nil
+	}
+
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		dir := DirectoryConfig{Path: item, Name: "Documents", FilePattern: "\\.md$"}
+		if idx := strings.Index(item, "="); idx > 0 {
+			dir.Name = strings.TrimSpace(item[:idx])
+			dir.Path = strings.TrimSpace(item[idx+1:])
+		}
+		dirs = append(dirs, dir)
+	}
+	return dirs, nil
+}
+
+// applyFlagOverrides sets config values from command line flags. It returns
+// the overridden fields.
+func applyFlagOverrides(config *Config, overrides ConfigOverrides) []string {
+	var overridden []string
+	if overrides.Port != "" {
+		config.Port = overrides.Port
+		overridden = append(overridden, "port")
+	}
+	if overrides.Title != "" {
+		config.Title = overrides.Title
+		overridden = append(overridden, "title")
+	}
+	if overrides.StrictPort {
+		config.StrictPort = true
+		overridden = append(overridden, "strict_port")
+	}
+	if len(overrides.IgnorePatterns) > 0 {
+		config.IgnorePatterns = append(config.IgnorePatterns, overrides.IgnorePatterns...)
+	}
+	return overridden
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// defaultOverviewHeadings are the sections whose first paragraph is the
+// overview of a document when overview.headings is not set
+var defaultOverviewHeadings = []string{"Overview"}
+
+// headingPattern matches an ATX heading and captures its text
+var headingPattern = regexp.MustCompile(`^#{1,6}\s+(.*?)(?:\s+#+)?$`)
+
+// nonProsePattern matches the first line of blocks that are not prose:
+// lists, tables, quotes, HTML, images, badges and footnote definitions
+var nonProsePattern = regexp.MustCompile(`^(?:[-*+]|\d+[.)]\s|[|<>]|!\[|\[!\[|\[\^)`)
+
+// extractOverview returns the overview of a document: its frontmatter
+// description, else the first paragraph of an overview section, else (with
+// overview.first_paragraph) the first paragraph after the title. It is cut
+// to overview.max_length characters.
+func extractOverview(content string, config OverviewConfig) string {
+	if description := parseFrontmatter(content)["description"]; len(description) > 0 {
+		return truncateOverview(strings.Join(description, ", "), config.MaxLength)
+	}
+
+	headings := config.Headings
+	if len(headings) == 0 {
+		headings = defaultOverviewHeadings
+	}
+	lines := strings.Split(removeFrontmatter(content), "\n")
+	for i, line := range lines {
+		m := headingPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if m == nil {
+			continue
+		}
+		for _, heading := range headings {
+			if !strings.EqualFold(m[1], strings.TrimSpace(heading)) {
+				continue
+			}
+			if paragraph := firstParagraph(lines[i+1:], true); paragraph != "" {
+				return truncateOverview(paragraph, config.MaxLength)
+			}
+		}
+	}
+
+	if !config.FirstParagraph {
+		return ""
+	}
+	for i, line := range lines {
+		if strings.HasPrefix(line, "# ") {
+			lines = lines[i+1:]
+			break
+		}
+	}
+	return truncateOverview(firstParagraph(lines, false), config.MaxLength)
+}
+
+// firstParagraph returns the first paragraph of lines, joined into one line.
+// In a section the paragraph is the first block before the next heading;
+// otherwise headings, code blocks and non-prose blocks are skipped.
+func firstParagraph(lines []string, inSection bool) string {
+	var paragraph []string
+	fence, skipping := "", false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+		case trimmed == "":
+			if len(paragraph) > 0 {
+				return strings.Join(paragraph, " ")
+			}
+			skipping = false
+		case strings.HasPrefix(trimmed, "#"):
+			if len(paragraph) > 0 || inSection {
+				return strings.Join(paragraph, " ")
+			}
+		case len(paragraph) > 0 || inSection:
+			paragraph = append(paragraph, trimmed)
+		case skipping:
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+		case nonProsePattern.MatchString(trimmed):
+			skipping = true
+		default:
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	return strings.Join(paragraph, " ")
+}
+
+// truncateOverview cuts text to at most max characters at a word boundary,
+// marking the cut with an ellipsis; max <= 0 keeps the whole text
+func truncateOverview(text string, max int) string {
+	if max <= 0 || utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	runes := []rune(text)
+	cut := string(runes[:max])
+	if !unicode.IsSpace(runes[max]) {
+		if i := strings.LastIndexAny(cut, " \t"); i > 0 {
+			cut = cut[:i]
+		}
+	}
+	return strings.TrimRight(cut, " ,;:.") + "…"
+}
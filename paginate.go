@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// defaultPageSize is the page size, in kilobytes, used when page_size is 0
+const defaultPageSize = 256
+
+// pageSizeBytes returns the configured page size in bytes, or 0 if large
+// documents are not paginated
+func (a *App) pageSizeBytes() int {
+	switch {
+	case a.Config.PageSize < 0:
+		return 0
+	case a.Config.PageSize == 0:
+		return defaultPageSize << 10
+	}
+	return a.Config.PageSize << 10
+}
+
+// splitPages splits markdown larger than pageSize into pages of roughly
+// pageSize bytes. Pages only break before top-level headings, the smallest
+// heading level used at least twice, so a single title heading does not
+// prevent splitting by chapter. Frontmatter stays on the first page. Content
+// without such headings is returned as a single page.
+func splitPages(content string, pageSize int) []string {
+	if pageSize <= 0 || len(content) <= pageSize {
+		return []string{content}
+	}
+
+	body := removeFrontmatter(content)
+	offset := len(content) - len(body)
+	headings := markdownHeadings(body)
+
+	counts := make(map[int]int)
+	for _, h := range headings {
+		counts[h.level]++
+	}
+	level := 0
+	for l := 1; l <= 6; l++ {
+		if counts[l] >= 2 {
+			level = l
+			break
+		}
+	}
+	if level == 0 {
+		return []string{content}
+	}
+
+	// Sections start at each top-level heading; text before the first one
+	// belongs to the first section
+	var sections []string
+	start := 0
+	for _, h := range headings {
+		if h.level != level || h.offset == 0 {
+			continue
+		}
+		sections = append(sections, content[start:offset+h.offset])
+		start = offset + h.offset
+	}
+	sections = append(sections, content[start:])
+
+	var pages []string
+	var current strings.Builder
+	for _, section := range sections {
+		if current.Len() > 0 && current.Len()+len(section) > pageSize {
+			pages = append(pages, current.String())
+			current.Reset()
+		}
+		current.WriteString(section)
+	}
+	return append(pages, current.String())
+}
+
+// markdownHeading is an ATX heading ("## Title") found in markdown
+type markdownHeading struct {
+	level  int
+	text   string
+	offset int // byte offset of the heading line
+}
+
+// markdownHeadings returns the ATX headings of markdown, skipping fenced
+// code blocks
+func markdownHeadings(content string) []markdownHeading {
+	var headings []markdownHeading
+	fence := ""
+	offset := 0
+	for _, line := range strings.SplitAfter(content, "\n") {
+		lineOffset := offset
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		// Up to three spaces of indentation, otherwise it is a code block
+		if strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t") {
+			continue
+		}
+		level := 0
+		for level < len(trimmed) && trimmed[level] == '#' {
+			level++
+		}
+		if level == 0 || level > 6 || (level < len(trimmed) && trimmed[level] != ' ' && trimmed[level] != '\t') {
+			continue
+		}
+		text := strings.TrimSpace(strings.TrimRight(strings.TrimSpace(trimmed[level:]), "#"))
+		headings = append(headings, markdownHeading{level: level, text: text, offset: lineOffset})
+	}
+	return headings
+}
+
+// linkDefinition matches the first line of a link reference definition
+// ("[label]: url") or a footnote definition ("[^label]: text")
+var linkDefinition = regexp.MustCompile(`^ {0,3}\[(\^?)[^\]]+\]:`)
+
+// markdownDefinitions returns the link reference and footnote definitions of
+// markdown, skipping fenced code blocks. Footnote definitions keep their
+// indented continuation lines.
+func markdownDefinitions(content string) string {
+	var definitions strings.Builder
+	fence := ""
+	footnote := false
+	var blank strings.Builder // blank lines that may be inside a footnote
+	for _, line := range strings.SplitAfter(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if footnote {
+			switch {
+			case trimmed == "":
+				blank.WriteString(line)
+				continue
+			case strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t"):
+				definitions.WriteString(blank.String())
+				definitions.WriteString(withNewline(line))
+				blank.Reset()
+				continue
+			}
+			footnote = false
+			blank.Reset()
+		}
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		if m := linkDefinition.FindStringSubmatch(line); m != nil {
+			definitions.WriteString(withNewline(line))
+			footnote = m[1] != ""
+		}
+	}
+	return definitions.String()
+}
+
+// withNewline returns line ending with a newline
+func withNewline(line string) string {
+	if strings.HasSuffix(line, "\n") {
+		return line
+	}
+	return line + "\n"
+}
+
+// pageSources returns the markdown rendered for each page: the page followed
+// by the link reference and footnote definitions of the other pages, so
+// references to them resolve on every page
+func pageSources(pages []string) []string {
+	definitions := make([]string, len(pages))
+	for i, page := range pages {
+		definitions[i] = markdownDefinitions(page)
+	}
+	sources := make([]string, len(pages))
+	for i, page := range pages {
+		var source strings.Builder
+		source.WriteString(page)
+		for j, d := range definitions {
+			if j != i && d != "" {
+				source.WriteString("\n\n")
+				source.WriteString(d)
+			}
+		}
+		sources[i] = source.String()
+	}
+	return sources
+}
+
+// headingIDAttr matches the id of a rendered heading
+var headingIDAttr = regexp.MustCompile(`<h[1-6][^>]*\sid="([^"]*)"`)
+
+// pageAnchors maps the heading ids of the pages of a document, other than
+// current, to their page number, so links to a heading on another page can
+// be sent there. The first page with an id wins.
+func (a *App) pageAnchors(path string, sources []string, current int) (map[string]int, error) {
+	anchors := make(map[string]int)
+	onCurrent := make(map[string]bool)
+	for i, source := range sources {
+		rendered, err := a.renderCached(pageCacheKey(path, i+1), source)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range headingIDAttr.FindAllStringSubmatch(string(rendered), -1) {
+			id := html.UnescapeString(m[1])
+			if i+1 == current {
+				onCurrent[id] = true
+			} else if _, ok := anchors[id]; !ok {
+				anchors[id] = i + 1
+			}
+		}
+	}
+	for id := range onCurrent {
+		delete(anchors, id)
+	}
+	return anchors, nil
+}
+
+// pageTitle returns the first heading of a page, for page navigation
+func pageTitle(page string, number int) string {
+	for _, h := range markdownHeadings(removeFrontmatter(page)) {
+		if h.text != "" {
+			return h.text
+		}
+	}
+	return fmt.Sprintf("Page %d", number)
+}
+
+// documentPages lists the pages of a paginated document for navigation,
+// marking the current one. It returns nil for a single page.
+func documentPages(pages []string, current int) []DocumentPage {
+	if len(pages) < 2 {
+		return nil
+	}
+	list := make([]DocumentPage, len(pages))
+	for i, page := range pages {
+		list[i] = DocumentPage{Number: i + 1, Title: pageTitle(page, i+1), Current: i+1 == current}
+	}
+	return list
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPagesKeepDefinitions(t *testing.T) {
+	filler := strings.Repeat("Filler text.\n", 100)
+	content := "# One\n\nSee [the site][site] and the note[^note].\n\n" + filler +
+		"\n# Two\n\n## Setup\n\n```\n[fenced]: http://fenced.example.com\n```\n\n" + filler +
+		"\n[site]: https://example.com\n[^note]: The note,\n    on two lines.\n"
+	a := newTestApp(t, map[string]string{"big.md": content})
+	a.Config.PageSize = 1
+	pages := splitPages(content, a.pageSizeBytes())
+	if len(pages) != 2 {
+		t.Fatalf("got %d pages", len(pages))
+	}
+
+	sources := pageSources(pages)
+	html, err := a.renderCached(pageCacheKey("big.md", 1), sources[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`href="https://example.com"`, "on two lines.", `class="footnote-ref"`} {
+		if !strings.Contains(string(html), want) {
+			t.Errorf("first page lacks %q:\n%s", want, html)
+		}
+	}
+	if strings.Contains(sources[0], "fenced.example.com") {
+		t.Error("definition in a code block carried to another page")
+	}
+
+	anchors, err := a.pageAnchors("big.md", sources, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if anchors["setup"] != 2 || anchors["two"] != 2 {
+		t.Errorf("anchors = %v", anchors)
+	}
+	if _, ok := anchors["one"]; ok {
+		t.Error("heading on the current page mapped to another page")
+	}
+
+	// The page lists the headings on other pages for fragment links
+	w := httptest.NewRecorder()
+	a.handleDocument(w, httptest.NewRequest(http.MethodGet, "/doc/big.md", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d", w.Code)
+	}
+	if body := w.Body.String(); !strings.Contains(body, `"setup":2`) {
+		t.Errorf("page anchors missing from the page")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// escapePath escapes each segment of a slash-separated path for a URL, so
+// names with spaces, "#", "?", "%" or non-ASCII characters survive. Route
+// handlers get the path unescaped from net/http.
+func escapePath(p string) string {
+	return (&url.URL{Path: p}).EscapedPath()
+}
+
+// docURL returns the URL of the document at relPath, without the base path
+func docURL(relPath string) string {
+	return "/doc/" + escapePath(relPath)
+}
+
+// cleanTargetPath undoes what Windows shells do to the PATH argument (see
+// windowsTargetPath). Paths are returned unchanged on other systems.
+func cleanTargetPath(p string) string {
+	if runtime.GOOS != "windows" {
+		return p
+	}
+	return windowsTargetPath(p, func(path string) bool {
+		_, err := os.Stat(path)
+		return err == nil
+	})
+}
+
+// windowsTargetPath cleans a PATH argument given on Windows: a quoted
+// directory ending in a backslash ("C:\My Docs\") arrives with a trailing
+// quote, and Git Bash passes drive paths as "/c/Users/...". Existing paths
+// are kept as they are, and drive letters and UNC paths
+// (\\server\share\docs) are left to filepath.Abs.
+func windowsTargetPath(p string, exists func(string) bool) string {
+	p = strings.TrimRight(p, `"`)
+	if exists(p) {
+		return p
+	}
+	if len(p) >= 2 && p[0] == '/' && isDriveLetter(p[1]) && (len(p) == 2 || p[2] == '/') {
+		return strings.ToUpper(p[1:2]) + ":" + strings.ReplaceAll("/"+strings.TrimPrefix(p[2:], "/"), "/", `\`)
+	}
+	return p
+}
+
+// isDriveLetter reports whether c can name a Windows drive
+func isDriveLetter(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// samePath reports whether two absolute paths are spelled the same, once
+// cleaned. Windows paths are compared ignoring case.
+func samePath(a, b string) bool {
+	return pathsEqual(filepath.Clean(a), filepath.Clean(b), runtime.GOOS == "windows")
+}
+
+// pathsEqual compares two cleaned paths, ignoring case if foldCase
+func pathsEqual(a, b string, foldCase bool) bool {
+	if foldCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// oddNames are document paths needing escaping in URLs
+var oddNames = []string{
+	"my notes.md",
+	"c#/sharp #1.md",
+	"what?.md",
+	"100%.md",
+	"a+b.md",
+	"café/naïve résumé.md",
+	"日本語/ドキュメント.md",
+	"mixed %20 & ?x=1#y.md",
+}
+
+func TestEscapePathRoundTrip(t *testing.T) {
+	for _, name := range oddNames {
+		escaped := escapePath(name)
+		if strings.ContainsAny(escaped, " #?") {
+			t.Errorf("escapePath(%q) = %q, has characters ending the path", name, escaped)
+		}
+		if got, err := url.PathUnescape(escaped); err != nil || got != name {
+			t.Errorf("escapePath(%q) = %q, unescapes to %q (%v)", name, escaped, got, err)
+		}
+		u, err := url.Parse(docURL(name))
+		if err != nil {
+			t.Errorf("docURL(%q) = %q: %v", name, docURL(name), err)
+			continue
+		}
+		if u.Path != "/doc/"+name || u.RawQuery != "" || u.Fragment != "" {
+			t.Errorf("docURL(%q) parses to path %q, query %q, fragment %q", name, u.Path, u.RawQuery, u.Fragment)
+		}
+	}
+}
+
+func TestDocURLReachesDocument(t *testing.T) {
+	files := make(map[string]string)
+	for i, name := range oddNames {
+		files[name] = "# Title " + string(rune('A'+i)) + "\n\nBody.\n"
+	}
+	a := newTestApp(t, files)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/doc/", a.handleDocument)
+
+	for i, name := range oddNames {
+		target := docURL(name) + "?page=1"
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("GET %s = %d: %s", target, rec.Code, rec.Body)
+			continue
+		}
+		if want := "Title " + string(rune('A'+i)); !strings.Contains(html.UnescapeString(rec.Body.String()), want) {
+			t.Errorf("GET %s did not serve %q", target, name)
+		}
+	}
+}
+
+func TestWindowsTargetPath(t *testing.T) {
+	existing := map[string]bool{`C:\Docs"quoted`: true, "/c": true}
+	exists := func(p string) bool { return existing[p] }
+
+	tests := []struct {
+		in, want string
+	}{
+		{`C:\Users\me\docs`, `C:\Users\me\docs`},
+		{`c:\Users\me\docs\`, `c:\Users\me\docs\`},
+		{`C:\My Docs\"`, `C:\My Docs\`},
+		{`C:\My Docs""`, `C:\My Docs`},
+		{"/c/Users/me/docs", `C:\Users\me\docs`},
+		{"/d/", `D:\`},
+		{"/d", `D:\`},
+		{"/c", "/c"}, // an existing directory named c
+		{"/cd/docs", "/cd/docs"},
+		{"/1/docs", "/1/docs"},
+		{`\\server\share\docs`, `\\server\share\docs`},
+		{`\\server\share\docs\"`, `\\server\share\docs\`},
+		{"//server/share/docs", "//server/share/docs"},
+		{`docs\guide`, `docs\guide`},
+		{`C:\Docs"quoted`, `C:\Docs"quoted`},
+	}
+	for _, tt := range tests {
+		if got := windowsTargetPath(tt.in, exists); got != tt.want {
+			t.Errorf("windowsTargetPath(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestPathsEqual(t *testing.T) {
+	if !pathsEqual(`C:\Docs\Guide.md`, `c:\docs\guide.md`, true) {
+		t.Error("Windows paths differing in case are not equal")
+	}
+	if pathsEqual("/docs/Guide.md", "/docs/guide.md", false) {
+		t.Error("paths differing in case are equal on a case-sensitive system")
+	}
+	if !samePath("/docs/./guide/../guide.md", "/docs/guide.md") {
+		t.Error("samePath does not clean paths")
+	}
+}
+
+func TestGetFileURL(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide/setup.md": "# Setup\n", "other/setup.md": "# Other\n"})
+	docs := a.Config.Directories[0].Path
+
+	target := filepath.Join(docs, "guide", "..", "guide", "setup.md")
+	if got, err := a.getFileURL(target); err != nil || got != "/doc/guide/setup.md" {
+		t.Errorf("getFileURL(%q) = %q, %v", target, got, err)
+	}
+
+	// Another spelling of the path, through a link to the directory
+	link := filepath.Join(t.TempDir(), "linked")
+	if err := os.Symlink(docs, link); err == nil {
+		target = filepath.Join(link, "other", "setup.md")
+		if got, err := a.getFileURL(target); err != nil || got != "/doc/other/setup.md" {
+			t.Errorf("getFileURL(%q) = %q, %v", target, got, err)
+		}
+	}
+
+	if _, err := a.getFileURL(filepath.Join(docs, "missing.md")); err == nil {
+		t.Error("getFileURL found a missing file")
+	}
+}
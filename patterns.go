@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// defaultFilePattern matches README.md files when a directory has no patterns
+const defaultFilePattern = "^(?i)(readme\\.md)$"
+
+// FileMatcher decides which files of a configured directory are documents.
+// A file is a document if any of its patterns matches (OR semantics).
+type FileMatcher struct {
+	names []*regexp.Regexp // matched against the file name
+	paths []*regexp.Regexp // matched against the slash-separated path relative to the directory
+
+	// ignore_patterns of the directory, with the same split for globs;
+	// regexes are matched against the path as walked, like global ones
+	ignoreNames   []*regexp.Regexp
+	ignoreRel     []*regexp.Regexp
+	ignoreRegexes []*regexp.Regexp
+
+	includeHidden bool
+	maxDepth      int
+
+	openAPI *regexp.Regexp // file names of API specs, nil for none
+}
+
+// Match reports whether the file at relPath (relative to the directory, with
+// forward slashes) is a document or an API spec
+func (m *FileMatcher) Match(relPath string) bool {
+	name := path.Base(relPath)
+	for _, re := range m.names {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	for _, re := range m.paths {
+		if re.MatchString(relPath) {
+			return true
+		}
+	}
+	return m.openAPI != nil && m.openAPI.MatchString(name)
+}
+
+// Ignored reports whether a file or directory is excluded by the
+// directory's ignore_patterns, include_hidden or max_depth. walked is the
+// path as walked and relPath the slash-separated path relative to the
+// directory.
+func (m *FileMatcher) Ignored(walked, relPath string, isDir bool) bool {
+	if !m.includeHidden && strings.HasPrefix(path.Base(relPath), ".") {
+		return true
+	}
+	if m.maxDepth > 0 {
+		// Files of a directory at the limit would be too deep
+		depth := strings.Count(relPath, "/") + 1
+		if depth > m.maxDepth || isDir && depth >= m.maxDepth {
+			return true
+		}
+	}
+
+	walked = filepath.ToSlash(walked)
+	for _, re := range m.ignoreRegexes {
+		if re.MatchString(walked) {
+			return true
+		}
+	}
+	name := path.Base(relPath)
+	for _, re := range m.ignoreNames {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	for _, re := range m.ignoreRel {
+		// "archive/**" also skips the "archive" directory itself
+		if re.MatchString(relPath) || isDir && re.MatchString(relPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// newFileMatcher compiles the file patterns of a directory configuration.
+// Regex patterns are matched against file names, as they always have been.
+// Glob patterns containing a "/" are matched against the relative path,
+// other globs against the file name.
+func newFileMatcher(dirConfig DirectoryConfig) (*FileMatcher, error) {
+	var patterns []string
+	if dirConfig.FilePattern != "" {
+		patterns = append(patterns, dirConfig.FilePattern)
+	}
+	patterns = append(patterns, dirConfig.FilePatterns...)
+
+	patternType := strings.ToLower(dirConfig.PatternType)
+	if len(patterns) == 0 {
+		patterns = []string{defaultFilePattern}
+		patternType = "regex"
+	}
+
+	m := &FileMatcher{includeHidden: dirConfig.IncludeHidden, maxDepth: dirConfig.MaxDepth}
+	if dirConfig.OpenAPIPattern != "none" {
+		pattern := dirConfig.OpenAPIPattern
+		if pattern == "" {
+			pattern = defaultOpenAPIPattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile openapi pattern '%s' for directory '%s': %w", pattern, dirConfig.Path, err)
+		}
+		m.openAPI = re
+	}
+	for _, pattern := range patterns {
+		switch patternType {
+		case "", "regex":
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile file pattern '%s' for directory '%s': %w", pattern, dirConfig.Path, err)
+			}
+			m.names = append(m.names, re)
+		case "glob":
+			re, err := globToRegexp(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile glob pattern '%s' for directory '%s': %w", pattern, dirConfig.Path, err)
+			}
+			if strings.Contains(strings.TrimPrefix(pattern, "/"), "/") {
+				m.paths = append(m.paths, re)
+			} else {
+				m.names = append(m.names, re)
+			}
+		default:
+			return nil, fmt.Errorf("invalid pattern_type '%s' for directory '%s' (use \"regex\" or \"glob\")", dirConfig.PatternType, dirConfig.Path)
+		}
+	}
+
+	// Ignore patterns follow pattern_type too, even without file patterns
+	for _, pattern := range dirConfig.IgnorePatterns {
+		if strings.EqualFold(dirConfig.PatternType, "glob") {
+			re, err := globToRegexp(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile ignore pattern '%s' for directory '%s': %w", pattern, dirConfig.Path, err)
+			}
+			if strings.Contains(strings.TrimPrefix(pattern, "/"), "/") {
+				m.ignoreRel = append(m.ignoreRel, re)
+			} else {
+				m.ignoreNames = append(m.ignoreNames, re)
+			}
+			continue
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile ignore pattern '%s' for directory '%s': %w", pattern, dirConfig.Path, err)
+		}
+		m.ignoreRegexes = append(m.ignoreRegexes, re)
+	}
+	return m, nil
+}
+
+// globToRegexp converts a glob pattern to an anchored regular expression.
+// Supported syntax: "*" (anything but "/"), "?" (one character but "/"),
+// "**" (any number of directories), "[abc]" character classes and
+// "{a,b}" alternatives.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	glob = strings.TrimPrefix(glob, "/")
+
+	var b strings.Builder
+	b.WriteString("^")
+	inBraces := false
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// "**/" matches zero or more directories
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end
+		case '{':
+			inBraces = true
+			b.WriteString("(?:")
+		case '}':
+			if !inBraces {
+				b.WriteString(regexp.QuoteMeta("}"))
+				continue
+			}
+			inBraces = false
+			b.WriteString(")")
+		case ',':
+			if inBraces {
+				b.WriteString("|")
+			} else {
+				b.WriteString(",")
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	if inBraces {
+		return nil, fmt.Errorf("unterminated '{'")
+	}
+	b.WriteString("$")
+
+	return regexp.Compile(b.String())
+}
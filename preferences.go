@@ -0,0 +1,284 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// preferencesSecretFileName keeps the key signing preference cookies in
+	// the state directory (see statePath), so they stay valid across restarts
+	preferencesSecretFileName = ".dimandocs-secret"
+
+	// preferencesCookieName holds the UI preferences of a browser
+	preferencesCookieName = "dimandocs_prefs"
+)
+
+// Preferences are the UI settings of a browser, kept in a signed cookie so
+// pages are rendered with them without any server-side session
+type Preferences struct {
+	Theme         string `json:"theme"`          // "auto", "light", "dark", "contrast"
+	FontSize      string `json:"font_size"`      // "small", "medium", "large"
+	TreeDensity   string `json:"tree_density"`   // "comfortable", "compact"
+	DefaultSource string `json:"default_source"` // directory listed first, "" for the config order
+}
+
+// The values each preference accepts, the first being the default
+var (
+	preferenceThemes      = []string{"auto", "light", "dark", "contrast"}
+	preferenceFontSizes   = []string{"medium", "small", "large"}
+	preferenceTreeDensity = []string{"comfortable", "compact"}
+)
+
+// defaultPreferences are the preferences of a browser that has set none
+func defaultPreferences() Preferences {
+	return Preferences{Theme: preferenceThemes[0], FontSize: preferenceFontSizes[0], TreeDensity: preferenceTreeDensity[0]}
+}
+
+// Class returns the classes applying the preferences to the <html> of a
+// page (see assets/preferences.css). The "auto" theme is resolved by the
+// page itself, from the browser's color scheme.
+func (p Preferences) Class() string {
+	classes := []string{"font-" + p.FontSize, "tree-" + p.TreeDensity}
+	switch p.Theme {
+	case "dark":
+		classes = append(classes, "theme-dark")
+	case "contrast":
+		classes = append(classes, "theme-contrast")
+	}
+	return strings.Join(classes, " ")
+}
+
+// validate checks the preferences against the values they accept and the
+// configured directories
+func (p Preferences) validate(dirs []DirectoryConfig) error {
+	for _, check := range []struct {
+		name, value string
+		allowed     []string
+	}{
+		{"theme", p.Theme, preferenceThemes},
+		{"font_size", p.FontSize, preferenceFontSizes},
+		{"tree_density", p.TreeDensity, preferenceTreeDensity},
+	} {
+		if indexOf(check.allowed, check.value) < 0 {
+			return fmt.Errorf("%s must be one of %s", check.name, strings.Join(check.allowed, ", "))
+		}
+	}
+	if p.DefaultSource != "" && !knownSource(dirs, p.DefaultSource) {
+		return fmt.Errorf("default_source %q is not a configured directory", p.DefaultSource)
+	}
+	return nil
+}
+
+// knownSource reports whether name is the name of a configured directory
+func knownSource(dirs []DirectoryConfig, name string) bool {
+	for _, dir := range dirs {
+		if dir.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PreferencesView is what the pages need to apply the preferences of a
+// browser and show its preferences menu
+type PreferencesView struct {
+	Preferences
+	Sources []string // the directories the browser can choose as default source
+	Return  string   // the page the preferences menu returns to
+}
+
+// loadPreferencesKey reads the key signing preference cookies, creating it
+// on first use. If it can't be saved, a key for this run is used and
+// preferences are reset on restart.
+func loadPreferencesKey(path string) []byte {
+	if data, err := ioutil.ReadFile(path); err == nil {
+		if key, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) >= 32 {
+			return key
+		}
+		slog.Warn("invalid preferences key, creating a new one", "file", path)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		slog.Warn("failed to create preferences key", "error", err)
+		return key
+	}
+	if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		slog.Warn("failed to save preferences key", "file", path, "error", err)
+	}
+	return key
+}
+
+// signPreferences encodes preferences as a cookie value: the JSON and its
+// HMAC, both base64
+func signPreferences(key []byte, p Preferences) string {
+	data, _ := json.Marshal(p)
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return base64.RawURLEncoding.EncodeToString(data) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyPreferences decodes a cookie value made by signPreferences. ok is
+// false if it was not signed with key.
+func verifyPreferences(key []byte, value string) (p Preferences, ok bool) {
+	payload, signature, found := strings.Cut(value, ".")
+	if !found {
+		return p, false
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return p, false
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return p, false
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return p, false
+	}
+	p = defaultPreferences()
+	if err := json.Unmarshal(data, &p); err != nil {
+		return p, false
+	}
+	return p, true
+}
+
+// preferences returns the preferences of the browser making r, the
+// defaults if it has none or its cookie is invalid. Values that are no
+// longer valid, e.g. a directory removed from the config, are reset.
+func (a *App) preferences(r *http.Request) Preferences {
+	defaults := defaultPreferences()
+	cookie, err := r.Cookie(preferencesCookieName)
+	if err != nil {
+		return defaults
+	}
+	p, ok := verifyPreferences(a.preferencesKey, cookie.Value)
+	if !ok {
+		return defaults
+	}
+	if indexOf(preferenceThemes, p.Theme) < 0 {
+		p.Theme = defaults.Theme
+	}
+	if indexOf(preferenceFontSizes, p.FontSize) < 0 {
+		p.FontSize = defaults.FontSize
+	}
+	if indexOf(preferenceTreeDensity, p.TreeDensity) < 0 {
+		p.TreeDensity = defaults.TreeDensity
+	}
+	if !knownSource(a.Config.Directories, p.DefaultSource) {
+		p.DefaultSource = ""
+	}
+	return p
+}
+
+// preferencesView returns the preferences of the browser making r for a
+// page showing trees, which the menu on the page returns to
+func (a *App) preferencesView(r *http.Request, trees []DirectoryTree) PreferencesView {
+	view := PreferencesView{Preferences: a.preferences(r), Return: a.Config.BasePath + r.URL.RequestURI()}
+	for _, tree := range trees {
+		view.Sources = append(view.Sources, tree.Name)
+	}
+	return view
+}
+
+// setPreferencesCookie stores preferences in the browser for a year
+func (a *App) setPreferencesCookie(w http.ResponseWriter, p Preferences) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     preferencesCookieName,
+		Value:    signPreferences(a.preferencesKey, p),
+		Path:     a.Config.BasePath + "/",
+		MaxAge:   365 * 24 * 60 * 60,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// handlePreferences reads (GET), changes (POST) or resets (DELETE) the
+// preferences of the requesting browser. A JSON body changes the fields it
+// has; a form post (from the preferences menu of the pages) changes the
+// fields it has and redirects back to the page in its "return" field.
+func (a *App) handlePreferences(w http.ResponseWriter, r *http.Request) {
+	p := a.preferences(r)
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		form := !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+		if form {
+			if err := r.ParseForm(); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+				return
+			}
+			for field, value := range map[string]*string{
+				"theme":          &p.Theme,
+				"font_size":      &p.FontSize,
+				"tree_density":   &p.TreeDensity,
+				"default_source": &p.DefaultSource,
+			} {
+				if values, ok := r.PostForm[field]; ok {
+					*value = strings.TrimSpace(values[0])
+				}
+			}
+		} else if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if err := p.validate(a.Config.Directories); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.setPreferencesCookie(w, p)
+		if form {
+			http.Redirect(w, r, a.preferencesReturn(r.PostForm.Get("return")), http.StatusSeeOther)
+			return
+		}
+	case http.MethodDelete:
+		http.SetCookie(w, &http.Cookie{Name: preferencesCookieName, Path: a.Config.BasePath + "/", MaxAge: -1})
+		p = defaultPreferences()
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, http.StatusOK, p)
+}
+
+// preferencesReturn returns the page to go back to after the preferences
+// form, only allowing paths on this server
+func (a *App) preferencesReturn(target string) string {
+	u, err := url.Parse(target)
+	if err != nil || u.Scheme != "" || u.Host != "" || !strings.HasPrefix(u.Path, "/") || strings.HasPrefix(u.Path, "//") {
+		return a.Config.BasePath + "/"
+	}
+	return u.RequestURI()
+}
+
+// preferredFirst moves the trees of the preferred default source to the
+// front, keeping the order of the others
+func preferredFirst(trees []DirectoryTree, source string) []DirectoryTree {
+	if source == "" {
+		return trees
+	}
+	sorted := make([]DirectoryTree, 0, len(trees))
+	for _, tree := range trees {
+		if tree.Name == source {
+			sorted = append(sorted, tree)
+		}
+	}
+	for _, tree := range trees {
+		if tree.Name != source {
+			sorted = append(sorted, tree)
+		}
+	}
+	return sorted
+}
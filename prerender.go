@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// renderCacheSize returns the number of rendered documents kept in memory:
+// render_cache_size, or all of them with prerender
+func (a *App) renderCacheSize() int {
+	if a.Config.Prerender && a.Config.RenderCacheSize >= 0 {
+		return math.MaxInt
+	}
+	return a.Config.RenderCacheSize
+}
+
+// prerenderDocuments renders docs into the render cache with a bounded pool
+// of workers (scan_workers), each page of documents larger than page_size
+// separately, so their pages load without rendering. Only with prerender.
+func (a *App) prerenderDocuments(docs []Document) {
+	if !a.Config.Prerender || len(docs) == 0 {
+		return
+	}
+	workers := a.Config.ScanWorkers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	start := time.Now()
+	jobs := make(chan *Document, workers*4)
+	var rendered, failed atomic.Int64
+	var pool sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		pool.Add(1)
+		go func() {
+			defer pool.Done()
+			for doc := range jobs {
+				pages, err := a.prerenderDocument(doc)
+				if err != nil {
+					slog.Warn("failed to pre-render document", "path", doc.Path, "error", err)
+					failed.Add(1)
+					continue
+				}
+				rendered.Add(int64(pages))
+			}
+		}()
+	}
+	for i := range docs {
+		jobs <- &docs[i]
+	}
+	close(jobs)
+	pool.Wait()
+
+	slog.Info("documents pre-rendered", "documents", len(docs)-int(failed.Load()), "pages", rendered.Load(), "failed", failed.Load(), "duration", time.Since(start).Round(time.Millisecond))
+}
+
+// prerenderDocument renders a document as its page would, and returns the
+// number of pages rendered
+func (a *App) prerenderDocument(doc *Document) (int, error) {
+	content, err := a.readDocumentContent(doc)
+	if err != nil {
+		return 0, err
+	}
+	if _, ok, err := a.renderWhole(doc, content); ok {
+		return 1, err
+	}
+	pages := splitPages(content, a.pageSizeBytes())
+	if len(pages) == 1 {
+		_, err := a.renderCached(doc.Path, content)
+		return 1, err
+	}
+	for i, source := range pageSources(pages) {
+		if _, err := a.renderCached(pageCacheKey(doc.Path, i+1), source); err != nil {
+			return i, err
+		}
+	}
+	return len(pages), nil
+}
@@ -0,0 +1,498 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// publishStateFile remembers the pages created by `dimandocs publish`,
+	// in the working directory, so later runs update them instead of
+	// creating new ones
+	publishStateFile = ".dimandocs-publish.json"
+
+	// Targets of `dimandocs publish`
+	publishConfluence = "confluence"
+	publishNotion     = "notion"
+)
+
+// publishClient sends the requests of `dimandocs publish`
+var publishClient = &http.Client{Timeout: time.Minute}
+
+// errPageNotFound is returned by a publishTarget for a page deleted since it
+// was published
+var errPageNotFound = errors.New("page not found")
+
+// errPublishFailed makes publish exit with status 1 when a page could not be
+// published
+var errPublishFailed = errors.New("some pages were not published")
+
+// publishPage is a page to publish: a directory, whose content is its
+// README.md or index.md if it has one, or a document
+type publishPage struct {
+	Key      string    // source name and path, identifies the page across runs
+	Title    string    // unique among the pages published
+	Doc      *Document // nil for directories without an index document
+	Children []*publishPage
+
+	id      string // of the published page, once it exists
+	created bool   // by this run
+}
+
+// publishedPage is a page of the state file
+type publishedPage struct {
+	ID   string `json:"id"`
+	Hash string `json:"hash"` // of the title, parent and content last published
+}
+
+// publishTarget is a site the pages are published to
+type publishTarget interface {
+	// find returns the ID of a page published for page by an earlier run
+	// whose state was lost, "" if there is none
+	find(page *publishPage) (string, error)
+	// create creates an empty page under parentID ("" for the top level)
+	// and returns its ID
+	create(page *publishPage, parentID string) (string, error)
+	// update sets the title, parent and content of a page created before,
+	// returning errPageNotFound if it was deleted since
+	update(page *publishPage, parentID string) error
+}
+
+// publisher publishes the pages to a target, creating the pages missing
+// first so that every document can link to any other
+type publisher struct {
+	app    *App
+	target publishTarget // nil for a dry run
+	state  map[string]publishedPage
+	pages  map[string]*publishPage // by document path, to resolve links
+	force  bool                    // update pages that did not change
+	out    io.Writer
+
+	created, updated, unchanged, failed int
+}
+
+// runPublish implements `dimandocs publish`
+func runPublish(args []string) error {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	configFile := fs.String("config-file", os.Getenv("DIMANDOCS_CONFIG_FILE"), "Path to configuration file (default: dimandocs.json if exists)")
+	targetName := fs.String("target", "", "Where to publish: confluence or notion")
+	dryRun := fs.Bool("dry-run", false, "Print the pages that would be created or updated without publishing")
+	force := fs.Bool("force", false, "Update every page, even those that did not change")
+	includeRestricted := fs.Bool("include-restricted", false, "Also publish directories with an allow list")
+	fs.Parse(args)
+	if *targetName != publishConfluence && *targetName != publishNotion {
+		return fmt.Errorf("invalid target '%s' (use confluence or notion)", *targetName)
+	}
+
+	a, err := loadCommandApp(*configFile, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	a.Sanitizer = newSanitizer(a.Config)
+
+	states, err := loadPublishState()
+	if err != nil {
+		return err
+	}
+	if states[*targetName] == nil {
+		states[*targetName] = make(map[string]publishedPage)
+	}
+	p := &publisher{app: a, state: states[*targetName], force: *force, out: os.Stdout}
+	pages := a.publishPages(*includeRestricted)
+	p.indexPages(pages)
+
+	if *dryRun {
+		p.plan(pages, "")
+		fmt.Fprintf(os.Stderr, "Dry run: %d to create, %d to update, %d unchanged\n", p.created, p.updated, p.unchanged)
+		return nil
+	}
+
+	if *targetName == publishConfluence {
+		p.target, err = newConfluenceTarget(p)
+	} else {
+		p.target, err = newNotionTarget(p)
+	}
+	if err != nil {
+		return err
+	}
+	p.createPages(pages, "")
+	p.updatePages(pages, "")
+	p.reportRemoved(pages)
+	if err := savePublishState(states); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Published to %s: %d created, %d updated, %d unchanged, %d failed\n", *targetName, p.created, p.updated, p.unchanged, p.failed)
+	if p.failed > 0 {
+		return errPublishFailed
+	}
+	return nil
+}
+
+// publishPages returns the pages to publish: a page per source, with a page
+// per subdirectory and document below it. Sources with an allow list are
+// left out unless includeRestricted is set.
+func (a *App) publishPages(includeRestricted bool) []*publishPage {
+	restricted := make(map[string]bool)
+	for _, dir := range a.Config.Directories {
+		if len(dir.Allow) > 0 {
+			restricted[dir.Name] = true
+		}
+	}
+
+	var pages []*publishPage
+	for _, tree := range a.BuildDirectoryTrees() {
+		if restricted[tree.Name] && !includeRestricted {
+			slog.Info("skipping directory with an allow list", "directory", tree.Name)
+			continue
+		}
+		pages = append(pages, folderPage(tree.Root, tree.Name, tree.Name))
+	}
+	uniqueTitles(pages)
+	return pages
+}
+
+// folderPage returns the page of a directory node and the pages below it.
+// The directory's index document is its content rather than a page.
+func folderPage(node *TreeNode, key, title string) *publishPage {
+	page := &publishPage{Key: key, Title: title, Doc: folderIndex(node)}
+	for _, child := range node.Children {
+		childKey := key + "/" + child.Name
+		switch {
+		case !child.IsFile:
+			page.Children = append(page.Children, folderPage(child, childKey, child.Name))
+		case child.Document != page.Doc:
+			page.Children = append(page.Children, &publishPage{Key: childKey, Title: child.Document.Title, Doc: child.Document})
+		}
+	}
+	return page
+}
+
+// uniqueTitles adds the key to the title of pages whose title is taken by
+// an earlier page, since Confluence requires titles unique in a space
+func uniqueTitles(pages []*publishPage) {
+	taken := make(map[string]bool)
+	var walk func(pages []*publishPage)
+	walk = func(pages []*publishPage) {
+		for _, page := range pages {
+			if taken[strings.ToLower(page.Title)] {
+				page.Title += " (" + page.Key + ")"
+			}
+			taken[strings.ToLower(page.Title)] = true
+			walk(page.Children)
+		}
+	}
+	walk(pages)
+}
+
+// indexPages records the page of each document, for linkedPage
+func (p *publisher) indexPages(pages []*publishPage) {
+	if p.pages == nil {
+		p.pages = make(map[string]*publishPage)
+	}
+	for _, page := range pages {
+		if page.Doc != nil {
+			p.pages[page.Doc.Path] = page
+		}
+		p.indexPages(page.Children)
+	}
+}
+
+// linkedPage returns the page a link of doc points to, nil for links to
+// anything that is not published
+func (p *publisher) linkedPage(doc *Document, href string) *publishPage {
+	if href == "" || isExternalLink(href) {
+		return nil
+	}
+	if rest, ok := strings.CutPrefix(href, p.app.Config.BasePath+"/doc/"); ok {
+		// Wiki links point to the document's URL
+		u, err := url.Parse(rest)
+		if err != nil {
+			return nil
+		}
+		if target := lookupDocument(p.app.Documents, u.Path); target != nil {
+			return p.pages[target.Path]
+		}
+		return nil
+	}
+	path, _ := resolveLink(doc, href)
+	if path == "" {
+		return nil
+	}
+	return p.pages[path]
+}
+
+// pageContent returns the markdown of a page as it is rendered, "" for
+// directories without an index document
+func (p *publisher) pageContent(page *publishPage) (string, error) {
+	if page.Doc == nil {
+		return "", nil
+	}
+	return p.app.documentMarkdown(page.Doc)
+}
+
+// pageHash identifies what is published for a page, to skip pages that did
+// not change since the last run
+func (p *publisher) pageHash(page *publishPage, parentID string) (string, error) {
+	content, err := p.pageContent(page)
+	if err != nil {
+		return "", err
+	}
+	return contentHash(page.Title + "\x00" + parentID + "\x00" + content), nil
+}
+
+// plan prints what publishing would do, by the state of the last run.
+// parentKey is the key of the parent of pages, "" for the top level.
+func (p *publisher) plan(pages []*publishPage, parentKey string) {
+	for _, page := range pages {
+		published, ok := p.state[page.Key]
+		if !ok {
+			p.created++
+			fmt.Fprintf(p.out, "create     %s\n", page.Key)
+		} else if hash, err := p.pageHash(page, p.state[parentKey].ID); err != nil || p.force || hash != published.Hash {
+			p.updated++
+			fmt.Fprintf(p.out, "update     %s\n", page.Key)
+		} else {
+			p.unchanged++
+		}
+		p.plan(page.Children, page.Key)
+	}
+}
+
+// createPages creates the pages that do not exist yet, parents first. The
+// children of a page that could not be created are skipped.
+func (p *publisher) createPages(pages []*publishPage, parentID string) {
+	for _, page := range pages {
+		if err := p.createPage(page, parentID); err != nil {
+			p.fail(page, err)
+			continue
+		}
+		p.createPages(page.Children, page.id)
+	}
+}
+
+// createPage sets the ID of page, creating it unless it was published before
+func (p *publisher) createPage(page *publishPage, parentID string) error {
+	if published, ok := p.state[page.Key]; ok {
+		page.id = published.ID
+		return nil
+	}
+	id, err := p.target.find(page)
+	if err != nil {
+		return err
+	}
+	if id == "" {
+		if id, err = p.target.create(page, parentID); err != nil {
+			return err
+		}
+		page.created = true
+		p.created++
+		fmt.Fprintf(p.out, "created    %s\n", page.Key)
+	}
+	page.id = id
+	// Without a hash updatePages fills in the content
+	p.state[page.Key] = publishedPage{ID: id}
+	return nil
+}
+
+// updatePages updates the title, parent and content of the pages that
+// changed since they were last published
+func (p *publisher) updatePages(pages []*publishPage, parentID string) {
+	for _, page := range pages {
+		if page.id == "" {
+			continue
+		}
+		p.updatePage(page, parentID)
+		p.updatePages(page.Children, page.id)
+	}
+}
+
+// updatePage updates a page if it changed, creating it again if it was
+// deleted since the last run
+func (p *publisher) updatePage(page *publishPage, parentID string) {
+	hash, err := p.pageHash(page, parentID)
+	if err != nil {
+		p.fail(page, err)
+		return
+	}
+	published := p.state[page.Key]
+	if !p.force && hash == published.Hash {
+		p.unchanged++
+		return
+	}
+
+	err = p.target.update(page, parentID)
+	if errors.Is(err, errPageNotFound) {
+		slog.Warn("published page was deleted, creating it again", "page", page.Key, "id", page.id)
+		if page.id, err = p.target.create(page, parentID); err == nil {
+			page.created = true
+			p.created++
+			fmt.Fprintf(p.out, "created    %s\n", page.Key)
+			err = p.target.update(page, parentID)
+		}
+	}
+	if err != nil {
+		p.fail(page, err)
+		if page.id != published.ID {
+			p.state[page.Key] = publishedPage{ID: page.id}
+		}
+		return
+	}
+	p.state[page.Key] = publishedPage{ID: page.id, Hash: hash}
+	if !page.created {
+		p.updated++
+		fmt.Fprintf(p.out, "updated    %s\n", page.Key)
+	}
+}
+
+// fail reports a page that could not be published
+func (p *publisher) fail(page *publishPage, err error) {
+	p.failed++
+	fmt.Fprintf(os.Stderr, "%s: %v\n", page.Key, err)
+}
+
+// reportRemoved lists the pages published before for documents that are
+// gone. They are left in place, and reused if the documents come back.
+func (p *publisher) reportRemoved(pages []*publishPage) {
+	current := make(map[string]bool)
+	var walk func(pages []*publishPage)
+	walk = func(pages []*publishPage) {
+		for _, page := range pages {
+			current[page.Key] = true
+			walk(page.Children)
+		}
+	}
+	walk(pages)
+
+	var removed []string
+	for key := range p.state {
+		if !current[key] {
+			removed = append(removed, key)
+		}
+	}
+	sort.Strings(removed)
+	for _, key := range removed {
+		fmt.Fprintf(p.out, "not found  %s (page %s left in place)\n", key, p.state[key].ID)
+	}
+}
+
+// loadPublishState reads the state file: the published pages of each
+// target by key
+func loadPublishState() (map[string]map[string]publishedPage, error) {
+	states := make(map[string]map[string]publishedPage)
+	data, err := ioutil.ReadFile(publishStateFile)
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &states); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", publishStateFile, err)
+	}
+	return states, nil
+}
+
+// savePublishState writes the state file
+func savePublishState(states map[string]map[string]publishedPage) error {
+	data, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(publishStateFile, data, 0644)
+}
+
+// publishRequest sends a request of a publish target, decoding the JSON
+// response into result unless nil. 404 responses return errPageNotFound,
+// other errors include the message of the response.
+func publishRequest(req *http.Request, result interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "dimandocs/"+Version)
+	resp, err := publishClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return errPageNotFound
+	}
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Message string `json:"message"`
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		if json.Unmarshal(body, &failure) == nil && failure.Message != "" {
+			return fmt.Errorf("%s %s returned %s: %s", req.Method, req.URL.Path, resp.Status, failure.Message)
+		}
+		return fmt.Errorf("%s %s returned %s", req.Method, req.URL.Path, resp.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("invalid response to %s %s: %w", req.Method, req.URL.Path, err)
+	}
+	return nil
+}
+
+// newJSONRequest returns a request with body encoded as JSON, if not nil
+func newJSONRequest(method, url string, body interface{}) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = strings.NewReader(string(data))
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// missingPublishSettings returns an error naming the settings of a target
+// that are empty, by their config key
+func missingPublishSettings(settings map[string]string) error {
+	var missing []string
+	for key, value := range settings {
+		if value == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+	env := make([]string, len(missing))
+	for i, key := range missing {
+		env[i] = "DIMANDOCS_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+	}
+	return fmt.Errorf("%s must be set in the config file or with %s", strings.Join(missing, ", "), strings.Join(env, ", "))
+}
+
+// checkPublish validates the publish settings. Missing settings are only
+// reported by publish, since they are not needed to serve the documents.
+func (v *configValidator) checkPublish(config PublishConfig) {
+	if config.Confluence.URL != "" {
+		if u, err := url.Parse(config.Confluence.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add("publish.confluence.url", "invalid URL %q (use the address of the site, e.g. \"https://example.atlassian.net/wiki\")", config.Confluence.URL)
+		}
+	}
+}
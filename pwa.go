@@ -0,0 +1,67 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// WebManifest is served at /manifest.webmanifest so browsers can install
+// the docs as an app
+type WebManifest struct {
+	Name            string         `json:"name"`
+	ShortName       string         `json:"short_name"`
+	StartURL        string         `json:"start_url"`
+	Scope           string         `json:"scope"`
+	Display         string         `json:"display"`
+	BackgroundColor string         `json:"background_color"`
+	ThemeColor      string         `json:"theme_color"`
+	Icons           []ManifestIcon `json:"icons"`
+}
+
+// ManifestIcon is an icon of the web manifest
+type ManifestIcon struct {
+	Src   string `json:"src"`
+	Sizes string `json:"sizes"`
+	Type  string `json:"type"`
+}
+
+// handleManifest serves the web manifest, named after the configured title
+func (a *App) handleManifest(w http.ResponseWriter, r *http.Request) {
+	name := a.Config.Title
+	if name == "" {
+		name = "DimanDocs"
+	}
+	manifest := WebManifest{
+		Name:            name,
+		ShortName:       name,
+		StartURL:        a.Config.BasePath + "/",
+		Scope:           a.Config.BasePath + "/",
+		Display:         "standalone",
+		BackgroundColor: "#f5f5f5",
+		ThemeColor:      "#667eea",
+		Icons: []ManifestIcon{
+			{Src: a.Config.BasePath + "/static/favicon.svg", Sizes: "any", Type: "image/svg+xml"},
+		},
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/manifest+json")
+	serveCached(w, r, "", time.Time{}, data)
+}
+
+// handleServiceWorker serves the service worker from the site root, so it
+// controls every page. It is revalidated on each request so updates reach
+// browsers right away.
+func (a *App) handleServiceWorker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	serveCached(w, r, "", time.Time{}, a.assets().files["sw.js"])
+}
+
+// handleFavicon points browsers asking for /favicon.ico to the SVG icon
+func (a *App) handleFavicon(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, a.Config.BasePath+"/static/favicon.svg", http.StatusMovedPermanently)
+}
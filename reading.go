@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// readingWordsPerMinute is the reading speed reading times are estimated with
+const readingWordsPerMinute = 200
+
+// ReadingTime returns the estimated minutes it takes to read the document,
+// rounded up (0 for a document without words)
+func (d Document) ReadingTime() int {
+	return (d.Words + readingWordsPerMinute - 1) / readingWordsPerMinute
+}
+
+// countWords returns the number of words of a document without its
+// frontmatter. head is the start of the file, already read for the title;
+// the rest of a larger file is streamed rather than loaded, up to
+// max_file_size when large files are truncated.
+func (a *App) countWords(path string, head []byte, size int64) int {
+	limit := a.Config.MaxFileSize
+	if limit > 0 && int64(len(head)) > limit {
+		head = head[:limit]
+	}
+	words := len(strings.Fields(removeFrontmatter(string(head))))
+	if int64(len(head)) >= size || (limit > 0 && int64(len(head)) >= limit) {
+		return words
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return words
+	}
+	defer f.Close()
+	if _, err := f.Seek(int64(len(head)), io.SeekStart); err != nil {
+		return words
+	}
+	var rest io.Reader = f
+	if limit > 0 {
+		rest = io.LimitReader(f, limit-int64(len(head)))
+	}
+	reader := bufio.NewReader(rest)
+
+	// A word cut at the end of head was already counted
+	if len(head) > 0 && !isSpaceByte(head[len(head)-1]) {
+		if next, err := reader.Peek(1); err == nil && !isSpaceByte(next[0]) {
+			words--
+		}
+	}
+	scanner := bufio.NewScanner(reader)
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		words++
+	}
+	return words
+}
+
+// isSpaceByte reports whether b is ASCII white space
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r' || b == '\v' || b == '\f'
+}
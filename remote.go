@@ -0,0 +1,509 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Directory source types (type of a directory config). Remote sources are
+// mirrored to a local directory, which is then scanned like any other.
+const (
+	sourceLocal = "local"
+	sourceHTTP  = "http"
+	sourceS3    = "s3"
+)
+
+// remoteClient downloads remote sources
+var remoteClient = &http.Client{Timeout: 5 * time.Minute}
+
+const (
+	// defaultMaxDownloadSize limits remote directories when
+	// max_download_size is not set
+	defaultMaxDownloadSize = 1 << 30
+
+	// maxRemoteFiles limits the files extracted from an archive or mirrored
+	// from an s3 prefix
+	maxRemoteFiles = 100000
+)
+
+// downloadLimit counts the files and bytes written for a remote directory,
+// failing the download once either goes over its limit
+type downloadLimit struct {
+	maxSize int64
+	size    int64
+	files   int
+}
+
+// addFile counts a file about to be written
+func (l *downloadLimit) addFile() error {
+	l.files++
+	if l.files > maxRemoteFiles {
+		return fmt.Errorf("more than %d files", maxRemoteFiles)
+	}
+	return nil
+}
+
+// reader returns r, failing once the bytes read from every reader of the
+// limit go over max_download_size
+func (l *downloadLimit) reader(r io.Reader) io.Reader {
+	return &limitedReader{r: io.LimitReader(r, l.maxSize-l.size+1), limit: l}
+}
+
+// limitedReader reads for a downloadLimit
+type limitedReader struct {
+	r     io.Reader
+	limit *downloadLimit
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	lr.limit.size += int64(n)
+	if lr.limit.size > lr.limit.maxSize {
+		return n, fmt.Errorf("larger than max_download_size (%d bytes)", lr.limit.maxSize)
+	}
+	return n, err
+}
+
+// maxDownloadSize returns max_download_size, or its default
+func (a *App) maxDownloadSize() int64 {
+	if a.Config.MaxDownloadSize > 0 {
+		return a.Config.MaxDownloadSize
+	}
+	return defaultMaxDownloadSize
+}
+
+// remoteSources tracks when each remote source was last synced
+type remoteSources struct {
+	mu     sync.Mutex
+	synced map[string]time.Time // by URL
+}
+
+// remoteState is what is known about the mirror of a remote source, kept
+// next to it so unchanged sources are not downloaded again after a restart
+type remoteState struct {
+	URL          string            `json:"url"`
+	ETag         string            `json:"etag,omitempty"`          // of the archive (http)
+	LastModified string            `json:"last_modified,omitempty"` // of the archive (http)
+	Objects      map[string]string `json:"objects,omitempty"`       // key -> ETag of mirrored objects (s3)
+}
+
+// isRemote reports whether a directory is downloaded rather than local
+func isRemote(dir DirectoryConfig) bool {
+	return dir.Type == sourceHTTP || dir.Type == sourceS3
+}
+
+// remoteMirrorDir returns the local directory a remote source is mirrored
+// to, in the user cache directory
+func remoteMirrorDir(dir DirectoryConfig) string {
+	sum := sha256.Sum256([]byte(dir.Type + "\n" + dir.URL))
+	name := hex.EncodeToString(sum[:])[:16]
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return filepath.Join(".dimandocs-remote", name)
+	}
+	return filepath.Join(base, "dimandocs", "remote", name)
+}
+
+// resolveRemoteDirectories sets the path of remote directories to their
+// local mirror
+func (a *App) resolveRemoteDirectories() {
+	for i, dir := range a.Config.Directories {
+		if isRemote(dir) {
+			a.Config.Directories[i].Path = remoteMirrorDir(dir)
+		}
+	}
+}
+
+// syncRemoteSources downloads the remote sources that were not synced yet
+// by this process, or longer ago than their refresh interval. A source that
+// cannot be downloaded keeps its previous mirror, which may be empty.
+func (a *App) syncRemoteSources() {
+	for _, dir := range a.Config.Directories {
+		if !isRemote(dir) {
+			continue
+		}
+		a.remotes.mu.Lock()
+		last, synced := a.remotes.synced[dir.URL]
+		a.remotes.mu.Unlock()
+		if synced && (dir.Refresh == "" || time.Since(last) < remoteRefresh(dir)) {
+			continue
+		}
+
+		start := time.Now()
+		changed, err := syncRemote(dir, a.maxDownloadSize())
+		a.remotes.mu.Lock()
+		if a.remotes.synced == nil {
+			a.remotes.synced = make(map[string]time.Time)
+		}
+		a.remotes.synced[dir.URL] = start
+		a.remotes.mu.Unlock()
+		switch {
+		case err != nil:
+			slog.Error("failed to download remote directory, using the previous copy", "name", dir.Name, "url", redactURL(dir.URL), "error", err)
+			// The walk needs the directory even if nothing was ever downloaded
+			os.MkdirAll(dir.Path, 0o755)
+		case changed:
+			slog.Info("remote directory downloaded", "name", dir.Name, "url", redactURL(dir.URL), "duration", time.Since(start).Round(time.Millisecond))
+		default:
+			slog.Debug("remote directory unchanged", "name", dir.Name, "url", redactURL(dir.URL))
+		}
+	}
+}
+
+// isRemoteDocument reports whether doc was downloaded from a remote
+// directory, where edits would be lost on the next download
+func (a *App) isRemoteDocument(doc *Document) bool {
+	for _, dir := range a.Config.Directories {
+		if dir.Path == doc.SourceDir {
+			return isRemote(dir)
+		}
+	}
+	return false
+}
+
+// refreshRemoteSources re-scans every interval, which downloads the remote
+// sources whose refresh interval has passed, until the server exits
+func (a *App) refreshRemoteSources(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := a.rescan(false); err != nil {
+			slog.Error("re-scan after refreshing remote directories failed", "error", err)
+		}
+	}
+}
+
+// remoteRefreshInterval returns the shortest refresh interval of the remote
+// sources, 0 if none is refreshed
+func (a *App) remoteRefreshInterval() time.Duration {
+	var shortest time.Duration
+	for _, dir := range a.Config.Directories {
+		if interval := remoteRefresh(dir); isRemote(dir) && interval > 0 && (shortest == 0 || interval < shortest) {
+			shortest = interval
+		}
+	}
+	return shortest
+}
+
+// remoteRefresh returns the refresh interval of a directory, 0 if unset.
+// The value is checked when the config is loaded.
+func remoteRefresh(dir DirectoryConfig) time.Duration {
+	interval, _ := time.ParseDuration(dir.Refresh)
+	return interval
+}
+
+// syncRemote updates the mirror of a remote source, reporting whether
+// anything changed. maxSize limits the bytes downloaded.
+func syncRemote(dir DirectoryConfig, maxSize int64) (bool, error) {
+	state := readRemoteState(dir)
+	var changed bool
+	var err error
+	if dir.Type == sourceS3 {
+		changed, err = syncS3(dir, state, maxSize)
+	} else {
+		changed, err = syncArchive(dir, state, maxSize)
+	}
+	if err != nil || !changed {
+		return changed, err
+	}
+	return true, writeRemoteState(dir, state)
+}
+
+// remoteStateFile is the file the state of a mirror is kept in
+func remoteStateFile(dir DirectoryConfig) string {
+	return dir.Path + ".json"
+}
+
+// readRemoteState reads the state of a mirror, empty if there is none or
+// it belongs to another URL
+func readRemoteState(dir DirectoryConfig) *remoteState {
+	state := &remoteState{}
+	if data, err := os.ReadFile(remoteStateFile(dir)); err == nil {
+		json.Unmarshal(data, state)
+	}
+	if state.URL != dir.URL {
+		state = &remoteState{}
+	}
+	state.URL = dir.URL
+	if _, err := os.Stat(dir.Path); err != nil {
+		// The mirror is gone, download everything again
+		state.ETag, state.LastModified, state.Objects = "", "", nil
+	}
+	return state
+}
+
+// writeRemoteState saves the state of a mirror
+func writeRemoteState(dir DirectoryConfig, state *remoteState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(remoteStateFile(dir), data, 0o644)
+}
+
+// syncArchive downloads the zip or tarball of an http source, unless the
+// server reports it unchanged, and replaces the mirror with its contents.
+// Both the archive and its contents are limited to maxSize bytes.
+func syncArchive(dir DirectoryConfig, state *remoteState, maxSize int64) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, dir.URL, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("User-Agent", "dimandocs/"+Version)
+	if state.ETag != "" {
+		req.Header.Set("If-None-Match", state.ETag)
+	}
+	if state.LastModified != "" {
+		req.Header.Set("If-Modified-Since", state.LastModified)
+	}
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("GET returned %s", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir.Path), 0o755); err != nil {
+		return false, err
+	}
+	archive, err := os.CreateTemp(filepath.Dir(dir.Path), ".download-*")
+	if err != nil {
+		return false, err
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+	download := &downloadLimit{maxSize: maxSize}
+	if _, err := io.Copy(archive, download.reader(resp.Body)); err != nil {
+		return false, fmt.Errorf("failed to download: %w", err)
+	}
+
+	staging := dir.Path + ".new"
+	os.RemoveAll(staging)
+	if err := extractArchive(archive, staging, &downloadLimit{maxSize: maxSize}); err != nil {
+		os.RemoveAll(staging)
+		return false, err
+	}
+	if err := replaceDir(staging, dir.Path); err != nil {
+		return false, err
+	}
+	state.ETag, state.LastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	return true, nil
+}
+
+// replaceDir moves staging to target, replacing what was there
+func replaceDir(staging, target string) error {
+	old := target + ".old"
+	os.RemoveAll(old)
+	if err := os.Rename(target, old); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Rename(staging, target); err != nil {
+		os.Rename(old, target)
+		return err
+	}
+	return os.RemoveAll(old)
+}
+
+// extractArchive extracts a zip, tar or gzipped tar file, detected by its
+// content, to dir. When everything is inside one top-level directory, as in
+// tarballs of a repository, that directory becomes dir. limit caps the files
+// and bytes extracted.
+func extractArchive(f *os.File, dir string, limit *downloadLimit) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	head := make([]byte, 512)
+	n, _ := f.ReadAt(head, 0)
+	head = head[:n]
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")):
+		err = extractZip(f, info.Size(), dir, limit)
+	case bytes.HasPrefix(head, []byte("\x1f\x8b")):
+		var gz *gzip.Reader
+		if gz, err = gzip.NewReader(io.NewSectionReader(f, 0, info.Size())); err != nil {
+			return fmt.Errorf("invalid gzip archive: %w", err)
+		}
+		defer gz.Close()
+		err = extractTar(gz, dir, limit)
+	case len(head) > 262 && string(head[257:262]) == "ustar":
+		err = extractTar(io.NewSectionReader(f, 0, info.Size()), dir, limit)
+	default:
+		return fmt.Errorf("unsupported archive format (use .zip, .tar or .tar.gz)")
+	}
+	if err != nil {
+		return err
+	}
+	return liftTopDir(dir)
+}
+
+// extractZip extracts the regular files of a zip archive to dir
+func extractZip(r io.ReaderAt, size int64, dir string, limit *downloadLimit) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("invalid zip archive: %w", err)
+	}
+	for _, file := range zr.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return err
+		}
+		err = extractFile(dir, file.Name, rc, file.Modified, limit)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// extractTar extracts the regular files of a tar stream to dir
+func extractTar(r io.Reader, dir string, limit *downloadLimit) error {
+	tr := tar.NewReader(bufio.NewReader(r))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid tar archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := extractFile(dir, header.Name, tr, header.ModTime, limit); err != nil {
+			return err
+		}
+	}
+}
+
+// extractFile writes an archive entry below dir, skipping names that would
+// end up outside of it
+func extractFile(dir, name string, r io.Reader, modTime time.Time, limit *downloadLimit) error {
+	if err := limit.addFile(); err != nil {
+		return fmt.Errorf("archive has %w", err)
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" || !filepath.IsLocal(filepath.FromSlash(name)) {
+		slog.Warn("skipping archive entry outside of the directory", "name", name)
+		return nil
+	}
+	if err := writeFile(filepath.Join(dir, filepath.FromSlash(name)), limit.reader(r), modTime); err != nil {
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	return nil
+}
+
+// liftTopDir replaces dir with its only entry when that is a directory
+func liftTopDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return err
+	}
+	lifted := dir + ".lift"
+	os.RemoveAll(lifted)
+	if err := os.Rename(filepath.Join(dir, entries[0].Name()), lifted); err != nil {
+		return err
+	}
+	if err := os.Remove(dir); err != nil {
+		return err
+	}
+	return os.Rename(lifted, dir)
+}
+
+// writeFile writes a file, creating its directory, and sets its
+// modification time so incremental re-scans skip unchanged files
+func writeFile(name string, r io.Reader, modTime time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if !modTime.IsZero() {
+		return os.Chtimes(name, modTime, modTime)
+	}
+	return nil
+}
+
+// redactURL hides the credentials of a URL for logs
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
+// checkRemoteDirectory validates the source type of a directory
+func (v *configValidator) checkRemoteDirectory(field string, dir DirectoryConfig) {
+	switch dir.Type {
+	case "", sourceLocal:
+		if dir.URL != "" {
+			v.add(field+".url", "only used with type %q or %q", sourceHTTP, sourceS3)
+		}
+		if dir.Refresh != "" {
+			v.add(field+".refresh", "only used with type %q or %q", sourceHTTP, sourceS3)
+		}
+		return
+	case sourceHTTP:
+		if u, err := url.Parse(dir.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add(field+".url", "invalid URL %q (use the http(s) URL of a .zip or .tar.gz file)", dir.URL)
+		}
+	case sourceS3:
+		if _, _, err := parseS3URL(dir.URL); err != nil {
+			v.add(field+".url", "%v", err)
+		}
+	default:
+		v.add(field+".type", "invalid type %q (valid types: %s, %s, %s)", dir.Type, sourceLocal, sourceHTTP, sourceS3)
+		return
+	}
+	if dir.Path != "" {
+		v.add(field+".path", "not used with type %q: remote directories are downloaded to the cache directory", dir.Type)
+	}
+	if dir.Refresh != "" {
+		if interval, err := time.ParseDuration(dir.Refresh); err != nil {
+			v.add(field+".refresh", "invalid duration %q (use e.g. \"15m\" or \"1h\")", dir.Refresh)
+		} else if interval < time.Minute {
+			v.add(field+".refresh", "%s is too short (at least 1m)", dir.Refresh)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tarGz returns a gzipped tarball of files (name -> content)
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSyncArchiveLimits(t *testing.T) {
+	// Zeros compress well: the archive is small, its contents are not
+	archive := tarGz(t, map[string]string{"docs/guide.md": "# Guide\n", "docs/zeros.md": strings.Repeat("\x00", 100000)})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name    string
+		maxSize int64
+		wantErr string
+	}{
+		{"download", int64(len(archive)) - 1, "failed to download"},
+		{"extracted", 50000, "failed to extract"},
+		{"within limits", defaultMaxDownloadSize, ""},
+	} {
+		dir := DirectoryConfig{Type: sourceHTTP, URL: server.URL, Path: filepath.Join(t.TempDir(), "mirror")}
+		_, err := syncArchive(dir, &remoteState{}, tc.maxSize)
+		if tc.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+			} else if _, err := os.Stat(filepath.Join(dir.Path, "guide.md")); err != nil {
+				t.Errorf("%s: %v", tc.name, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.wantErr)
+		}
+		if _, err := os.Stat(dir.Path); !os.IsNotExist(err) {
+			t.Errorf("%s: mirror created after a failed download", tc.name)
+		}
+	}
+}
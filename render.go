@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const defaultRenderCacheSize = 256
+
+// RenderCache caches rendered HTML keyed by file path and content hash.
+// Entries are kept in memory (least recently used are evicted first) and
+// optionally persisted to a directory so they survive restarts.
+type RenderCache struct {
+	mu      sync.Mutex
+	size    int
+	dir     string
+	order   *list.List               // most recently used at the front
+	entries map[string]*list.Element // path -> element holding *renderEntry
+}
+
+// renderEntry is a cached rendering of a single document
+type renderEntry struct {
+	path string
+	hash string
+	html []byte
+}
+
+// NewRenderCache creates a render cache holding up to size documents.
+// If dir is not empty, rendered HTML is also stored on disk.
+func NewRenderCache(size int, dir string) *RenderCache {
+	if size == 0 {
+		size = defaultRenderCacheSize
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			slog.Warn("failed to create render cache directory", "dir", dir, "error", err)
+			dir = ""
+		}
+	}
+	return &RenderCache{
+		size:    size,
+		dir:     dir,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// contentHash returns the hex encoded SHA-256 hash of content
+func contentHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the cached HTML for path if it was rendered from content with the given hash
+func (rc *RenderCache) Get(path, hash string) ([]byte, bool) {
+	if rc == nil || rc.size < 0 {
+		return nil, false
+	}
+
+	rc.mu.Lock()
+	if el, ok := rc.entries[path]; ok {
+		entry := el.Value.(*renderEntry)
+		if entry.hash == hash {
+			rc.order.MoveToFront(el)
+			rc.mu.Unlock()
+			return entry.html, true
+		}
+	}
+	rc.mu.Unlock()
+
+	if rc.dir == "" {
+		return nil, false
+	}
+	html, err := ioutil.ReadFile(rc.diskPath(hash))
+	if err != nil {
+		return nil, false
+	}
+	rc.store(path, hash, html)
+	return html, true
+}
+
+// Put stores the rendered HTML for path
+func (rc *RenderCache) Put(path, hash string, html []byte) {
+	if rc == nil || rc.size < 0 {
+		return
+	}
+	rc.store(path, hash, html)
+	if rc.dir != "" {
+		if err := ioutil.WriteFile(rc.diskPath(hash), html, 0644); err != nil {
+			slog.Warn("failed to write render cache", "path", path, "error", err)
+		}
+	}
+}
+
+// Invalidate drops the in-memory entry for path
+func (rc *RenderCache) Invalidate(path string) {
+	if rc == nil {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if el, ok := rc.entries[path]; ok {
+		rc.order.Remove(el)
+		delete(rc.entries, path)
+	}
+}
+
+// Clear drops all in-memory entries
+func (rc *RenderCache) Clear() {
+	if rc == nil {
+		return
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.order.Init()
+	rc.entries = make(map[string]*list.Element)
+}
+
+// Len returns the number of documents cached in memory
+func (rc *RenderCache) Len() int {
+	if rc == nil {
+		return 0
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.order.Len()
+}
+
+// ClearDisk drops all entries, including the rendered HTML stored on disk,
+// and returns the number of files removed
+func (rc *RenderCache) ClearDisk() (int, error) {
+	if rc == nil {
+		return 0, nil
+	}
+	rc.Clear()
+	if rc.dir == "" {
+		return 0, nil
+	}
+	files, err := filepath.Glob(filepath.Join(rc.dir, "*.html"))
+	if err != nil {
+		return 0, err
+	}
+	removed := 0
+	for _, file := range files {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// store adds an entry in memory, evicting the least recently used ones if needed
+func (rc *RenderCache) store(path, hash string, html []byte) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if el, ok := rc.entries[path]; ok {
+		el.Value = &renderEntry{path: path, hash: hash, html: html}
+		rc.order.MoveToFront(el)
+		return
+	}
+
+	rc.entries[path] = rc.order.PushFront(&renderEntry{path: path, hash: hash, html: html})
+	for rc.order.Len() > rc.size {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.entries, oldest.Value.(*renderEntry).path)
+	}
+}
+
+// diskPath returns the on-disk location of a cached rendering
+func (rc *RenderCache) diskPath(hash string) string {
+	return filepath.Join(rc.dir, hash+".html")
+}
+
+// renderMarkdown converts markdown content to HTML, substituting variables
+// and sanitizing it unless raw HTML is allowed
+func (a *App) renderMarkdown(content string) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := a.Markdown.Convert([]byte(a.renderedText(content)), &buf); err != nil {
+		return nil, fmt.Errorf("failed to render markdown: %w", err)
+	}
+	if a.Sanitizer != nil {
+		return a.Sanitizer.SanitizeBytes(buf.Bytes()), nil
+	}
+	return buf.Bytes(), nil
+}
+
+// renderDocument returns the rendered HTML of a document, using the render cache
+func (a *App) renderDocument(doc *Document) ([]byte, error) {
+	content, err := a.readDocumentContent(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	if html, ok, err := a.renderWhole(doc, content); ok {
+		return html, err
+	}
+	return a.renderCached(doc.Path, content)
+}
+
+// renderWhole renders the documents that are not markdown, API specs and
+// tables, which are never split into pages. ok is false for markdown.
+func (a *App) renderWhole(doc *Document, content string) (html []byte, ok bool, err error) {
+	switch {
+	case isOpenAPIFile(doc.Path):
+		html, err = a.renderOpenAPICached(doc.Path, content)
+		return html, true, err
+	case isTableFile(doc.Path):
+		html, err = a.renderTableCached(doc, content)
+		return html, true, err
+	}
+	return nil, false, nil
+}
+
+// documentMarkdown returns the markdown of a document as it is rendered:
+// without frontmatter and with variables substituted. API specs are a code
+// block of their source and tables a markdown table.
+func (a *App) documentMarkdown(doc *Document) (string, error) {
+	content, err := a.readDocumentContent(doc)
+	if err != nil {
+		return "", fmt.Errorf("failed to read document: %w", err)
+	}
+	if isOpenAPIFile(doc.Path) {
+		language := strings.TrimPrefix(strings.ToLower(filepath.Ext(doc.Path)), ".")
+		if language == "yml" {
+			language = "yaml"
+		}
+		return "~~~~~~~~ " + language + "\n" + content + "\n~~~~~~~~\n", nil
+	}
+	if isTableFile(doc.Path) {
+		return tableMarkdown(doc.Path, content), nil
+	}
+	return a.renderedText(content), nil
+}
+
+// renderDocumentPage renders a page (numbered from 1, clamped to the valid
+// range) of a document larger than page_size, and returns it with the list of
+// pages and the page of each heading on the other pages. Documents that fit
+// in a page are rendered whole, with no pages.
+func (a *App) renderDocumentPage(doc *Document, page int) ([]byte, []DocumentPage, map[string]int, error) {
+	content, err := a.readDocumentContent(doc)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read document: %w", err)
+	}
+	if html, ok, err := a.renderWhole(doc, content); ok {
+		return html, nil, nil, err
+	}
+
+	pages := splitPages(content, a.pageSizeBytes())
+	if len(pages) == 1 {
+		html, err := a.renderCached(doc.Path, content)
+		return html, nil, nil, err
+	}
+
+	if page < 1 {
+		page = 1
+	} else if page > len(pages) {
+		page = len(pages)
+	}
+	sources := pageSources(pages)
+	html, err := a.renderCached(pageCacheKey(doc.Path, page), sources[page-1])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	anchors, err := a.pageAnchors(doc.Path, sources, page)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return html, documentPages(pages, page), anchors, nil
+}
+
+// pageCacheKey is the render cache key of a page of a document
+func pageCacheKey(path string, page int) string {
+	return fmt.Sprintf("%s#page=%d", path, page)
+}
+
+// renderCached renders markdown, reusing the cached HTML stored under key
+// if the content and rendering settings have not changed
+func (a *App) renderCached(key, content string) ([]byte, error) {
+	hash := contentHash(markdownFingerprint(a.Config) + "\n" + content)
+	if html, ok := a.Renders.Get(key, hash); ok {
+		return html, nil
+	}
+
+	html, err := a.renderMarkdown(content)
+	if err != nil {
+		return nil, err
+	}
+	a.Renders.Put(key, hash, html)
+	return html, nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Re-scan modes (rescan_mode). Incremental re-scans still walk every
+// directory but only process files whose size or modification time changed.
+const (
+	rescanIncremental = "incremental"
+	rescanFull        = "full"
+)
+
+var rescanModes = map[string]bool{rescanIncremental: true, rescanFull: true}
+
+// rescanInterval returns the configured rescan_interval, 0 if disabled.
+// The value is checked when the config is loaded.
+func (a *App) rescanInterval() time.Duration {
+	interval, err := time.ParseDuration(a.Config.RescanInterval)
+	if err != nil || a.Config.RescanInterval == "" {
+		return 0
+	}
+	return interval
+}
+
+// rescanMode returns the configured rescan_mode
+func (a *App) rescanMode() string {
+	if a.Config.RescanMode == "" {
+		return rescanIncremental
+	}
+	return a.Config.RescanMode
+}
+
+// rescan scans the directories again and swaps in the documents found.
+// Scanning happens while requests are still served from the current
+// documents; only the swap holds the documents lock, so a request sees
+// either the old or the new document set, never a mix. If the scan fails,
+// the current documents are kept. Re-scans do not overlap. Returns whether
+// the documents changed.
+func (a *App) rescan(full bool) (bool, error) {
+	a.rescanMu.Lock()
+	defer a.rescanMu.Unlock()
+
+	previous := a.allDocuments()
+	var reuse map[string]Document
+	if !full {
+		reuse = make(map[string]Document, len(previous))
+		for _, doc := range previous {
+			reuse[doc.Path] = doc
+		}
+	}
+
+	docs, err := a.scanAll(reuse)
+	if err != nil {
+		return false, err
+	}
+	if !full && int(a.Scan.Reused()) == len(docs) && len(docs) == len(reuse) {
+		return false, nil
+	}
+
+	a.docsMu.Lock()
+	a.setDocuments(docs)
+	a.Links = a.buildLinkGraph()
+	a.Renders.Clear()
+	a.docsMu.Unlock()
+	current := a.allDocuments()
+	a.Notifier.Record(diffDocuments(previous, current))
+	a.trackMoves(previous, current)
+
+	if a.UseCache {
+		if err := a.saveToCache(); err != nil {
+			slog.Warn("failed to update cache", "error", err)
+		}
+	}
+	a.prerenderDocuments(a.allDocuments())
+	return true, nil
+}
+
+// documentCount returns the number of documents, for handlers that are not
+// already holding the documents lock
+func (a *App) documentCount() int {
+	a.docsMu.RLock()
+	defer a.docsMu.RUnlock()
+	return len(a.Documents)
+}
+
+// rescanPeriodically re-scans the directories every rescan_interval until
+// the server exits
+func (a *App) rescanPeriodically(interval time.Duration) {
+	full := a.rescanMode() == rescanFull
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		start := time.Now()
+		changed, err := a.rescan(full)
+		if err != nil {
+			slog.Error("periodic re-scan failed", "error", err)
+			continue
+		}
+		if changed {
+			slog.Info("documents re-scanned", "documents", a.documentCount(), "duration", time.Since(start).Round(time.Millisecond))
+		} else {
+			slog.Debug("re-scan found no changes", "duration", time.Since(start).Round(time.Millisecond))
+		}
+	}
+}
+
+// withDocumentsLock holds the documents read lock while a request is
+// handled, so re-scans wait for in-flight requests before swapping the
+// documents. The response is kept in memory and only sent to the client
+// once the lock is released, so a slow client doesn't hold up re-scans
+// (and, while one waits for the lock, every other request). Event streams
+// stay open for as long as a tab is, and reloads, document saves, exports
+// and the admin API take the lock themselves, so none of them holds it.
+func (a *App) withDocumentsLock(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/events" || r.URL.Path == "/api/reload" || strings.HasPrefix(r.URL.Path, "/admin/") ||
+			strings.HasPrefix(r.URL.Path, "/export/") ||
+			strings.HasPrefix(r.URL.Path, "/api/documents/") && (r.Method == http.MethodPost || r.Method == http.MethodPatch) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		buffered := &bufferedResponse{ResponseWriter: w}
+		func() {
+			a.docsMu.RLock()
+			defer a.docsMu.RUnlock()
+			next.ServeHTTP(buffered, r)
+		}()
+		buffered.send()
+	})
+}
+
+// bufferedResponse keeps the status and body of a response in memory until
+// send writes them. Headers go to the underlying response directly.
+type bufferedResponse struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+// WriteHeader records the status code, the first one written winning as
+// with net/http
+func (br *bufferedResponse) WriteHeader(status int) {
+	if br.status == 0 {
+		br.status = status
+	}
+}
+
+// Write appends to the body
+func (br *bufferedResponse) Write(p []byte) (int, error) {
+	if br.status == 0 {
+		br.status = http.StatusOK
+	}
+	return br.body.Write(p)
+}
+
+// send writes the response to the client
+func (br *bufferedResponse) send() {
+	if br.status == 0 {
+		br.status = http.StatusOK
+	}
+	if br.body.Len() > 0 && br.status != http.StatusNotModified && br.ResponseWriter.Header().Get("Content-Length") == "" {
+		br.ResponseWriter.Header().Set("Content-Length", strconv.Itoa(br.body.Len()))
+	}
+	br.ResponseWriter.WriteHeader(br.status)
+	br.ResponseWriter.Write(br.body.Bytes())
+}
+
+// checkRescan validates rescan_interval and rescan_mode
+func (v *configValidator) checkRescan(config Config) {
+	if config.RescanInterval != "" {
+		interval, err := time.ParseDuration(config.RescanInterval)
+		if err != nil {
+			v.add("rescan_interval", "invalid duration %q (use e.g. \"30s\", \"5m\" or \"1h\")", config.RescanInterval)
+		} else if interval < time.Second {
+			v.add("rescan_interval", "%s is too short (at least 1s)", config.RescanInterval)
+		}
+	}
+	if config.RescanMode != "" && !rescanModes[config.RescanMode] {
+		v.add("rescan_mode", "invalid re-scan mode %q (valid values: %s, %s)", config.RescanMode, rescanIncremental, rescanFull)
+	}
+}
+
+// scanProgress returns the progress of the most recent directory scan
+func (a *App) scanProgress() *ScanProgress {
+	a.scanMu.Lock()
+	defer a.scanMu.Unlock()
+	return a.Scan
+}
+
+// Re-scan job states
+const (
+	rescanRunning = "running"
+	rescanDone    = "done"
+	rescanFailed  = "failed"
+)
+
+// rescanJobsKept is the number of finished re-scan jobs that can still be
+// looked up by id
+const rescanJobsKept = 20
+
+// RescanJob is a re-scan started with POST /api/rescan. The file counters
+// are those of the scan in progress while it runs, and final once it ends.
+type RescanJob struct {
+	ID        string     `json:"id"`
+	State     string     `json:"state"` // "running", "done" or "failed"
+	Full      bool       `json:"full"`
+	Started   time.Time  `json:"started"`
+	Finished  *time.Time `json:"finished,omitempty"`
+	Walked    int64      `json:"walked"`    // files visited
+	Matched   int64      `json:"matched"`   // files matching a file pattern
+	Processed int64      `json:"processed"` // matching files processed
+	Changed   bool       `json:"changed"`   // documents were added, removed or changed
+	Documents int        `json:"documents"` // documents found, once done
+	Error     string     `json:"error,omitempty"`
+
+	previous *ScanProgress // scan before this one, whose counters are not shown
+}
+
+// rescanJobs holds the running re-scan job, if any, and the last finished ones
+type rescanJobs struct {
+	mu      sync.Mutex
+	next    int
+	running *RescanJob
+	jobs    []*RescanJob // oldest first
+}
+
+// startRescan starts a re-scan in the background and returns its job. While
+// one runs, it is returned instead of starting another.
+func (a *App) startRescan(full bool) (job RescanJob, started bool) {
+	a.rescans.mu.Lock()
+	defer a.rescans.mu.Unlock()
+	if running := a.rescans.running; running != nil {
+		return a.rescanStatus(running), false
+	}
+
+	a.rescans.next++
+	running := &RescanJob{
+		ID:      fmt.Sprintf("%d-%d", a.Instance.Started.Unix(), a.rescans.next),
+		State:   rescanRunning,
+		Full:    full,
+		Started: time.Now(),
+
+		previous: a.scanProgress(),
+	}
+	a.rescans.running = running
+	a.rescans.jobs = append(a.rescans.jobs, running)
+	if len(a.rescans.jobs) > rescanJobsKept {
+		a.rescans.jobs = a.rescans.jobs[len(a.rescans.jobs)-rescanJobsKept:]
+	}
+
+	go func() {
+		changed, err := a.rescan(full)
+		progress := a.scanProgress()
+		count := a.documentCount()
+
+		a.rescans.mu.Lock()
+		defer a.rescans.mu.Unlock()
+		finished := time.Now()
+		running.Finished = &finished
+		running.Changed = changed
+		running.Documents = count
+		if progress != nil {
+			running.Walked, running.Matched, running.Processed = progress.Walked(), progress.Matched(), progress.Processed()
+		}
+		if err != nil {
+			running.State, running.Error = rescanFailed, err.Error()
+			slog.Error("re-scan failed", "job", running.ID, "error", err)
+		} else {
+			running.State = rescanDone
+			slog.Info("documents re-scanned", "job", running.ID, "documents", running.Documents, "duration", finished.Sub(running.Started).Round(time.Millisecond))
+		}
+		a.rescans.running = nil
+	}()
+	return a.rescanStatus(running), true
+}
+
+// rescanStatus returns a copy of job with the progress of the scan in
+// progress if it is running. rescans.mu must be held.
+func (a *App) rescanStatus(job *RescanJob) RescanJob {
+	status := *job
+	if status.State == rescanRunning {
+		if progress := a.scanProgress(); progress != nil && progress != job.previous {
+			status.Walked, status.Matched, status.Processed = progress.Walked(), progress.Matched(), progress.Processed()
+		}
+	}
+	return status
+}
+
+// rescanJob returns the job with the given id
+func (a *App) rescanJob(id string) (RescanJob, bool) {
+	a.rescans.mu.Lock()
+	defer a.rescans.mu.Unlock()
+	for _, job := range a.rescans.jobs {
+		if job.ID == id {
+			return a.rescanStatus(job), true
+		}
+	}
+	return RescanJob{}, false
+}
+
+// handleRescan starts a re-scan of all directories (POST, fully unless
+// ?full=0) and reports its progress (GET /api/rescan/{id}). Starting one
+// while another runs returns the running job.
+func (a *App) handleRescan(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/api/rescan":
+		job, started := a.startRescan(r.URL.Query().Get("full") != "0")
+		w.Header().Set("Location", a.Config.BasePath+"/api/rescan/"+job.ID)
+		status := http.StatusAccepted
+		if !started {
+			status = http.StatusOK
+		}
+		writeJSON(w, status, job)
+
+	case r.Method == http.MethodGet:
+		job, ok := a.rescanJob(strings.TrimPrefix(r.URL.Path, "/api/rescan/"))
+		if !ok {
+			http.Error(w, "Unknown re-scan job", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFailedRescanKeepsDocuments(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n", "api/index.md": "# API\n"})
+	before := len(a.Documents)
+	if before != 2 {
+		t.Fatalf("scanned %d documents, want 2", before)
+	}
+	// Walking a directory that is gone fails the scan
+	if err := os.RemoveAll(a.Config.Directories[0].Path); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, full := range []bool{true, false} {
+		if changed, err := a.rescan(full); err == nil || changed {
+			t.Errorf("rescan(%v): got changed %v, error %v; want an error", full, changed, err)
+		}
+		if len(a.Documents) != before || a.findDocument("guide.md") == nil {
+			t.Errorf("rescan(%v): %d documents left, want %d", full, len(a.Documents), before)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	a.handleReload(w, httptest.NewRequest(http.MethodPost, "/api/reload", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("reload: got %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if len(a.Documents) != before {
+		t.Errorf("reload: %d documents left, want %d", len(a.Documents), before)
+	}
+}
+
+// slowWriter blocks writes until release is closed, like a client that
+// doesn't read its response
+type slowWriter struct {
+	*httptest.ResponseRecorder
+	release chan struct{}
+}
+
+func (sw *slowWriter) Write(p []byte) (int, error) {
+	<-sw.release
+	return sw.ResponseRecorder.Write(p)
+}
+
+func TestSlowClientDoesNotHoldDocumentsLock(t *testing.T) {
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+	for target, handle := range map[string]http.HandlerFunc{
+		"/raw/guide.md":    a.handleRaw,
+		"/export/Docs.zip": a.handleExport,
+	} {
+		handler := a.withDocumentsLock(handle)
+		w := &slowWriter{ResponseRecorder: httptest.NewRecorder(), release: make(chan struct{})}
+		done := make(chan struct{})
+		go func() {
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+			close(done)
+		}()
+
+		locked := make(chan struct{})
+		go func() {
+			a.docsMu.Lock()
+			a.docsMu.Unlock()
+			close(locked)
+		}()
+		select {
+		case <-locked:
+		case <-time.After(2 * time.Second):
+			t.Errorf("%s: documents lock held while the response is written", target)
+		}
+		close(w.release)
+		<-done
+		if w.Code != http.StatusOK || w.Body.Len() == 0 {
+			t.Errorf("%s: got %d with %d bytes", target, w.Code, w.Body.Len())
+		}
+	}
+}
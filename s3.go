@@ -0,0 +1,327 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// parseS3URL splits "s3://bucket/prefix" into the bucket and the key
+// prefix, which ends with "/" unless empty
+func parseS3URL(raw string) (bucket, prefix string, err error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "s3" || u.Host == "" {
+		return "", "", fmt.Errorf("invalid S3 URL %q (use s3://bucket/prefix)", raw)
+	}
+	prefix = strings.TrimPrefix(u.Path, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return u.Host, prefix, nil
+}
+
+// s3Client lists and downloads the objects of a bucket. Requests are signed
+// with the credentials in the standard AWS environment variables, and
+// anonymous (for public buckets) without them.
+type s3Client struct {
+	bucket       string
+	region       string
+	endpoint     *url.URL // AWS_ENDPOINT_URL(_S3), for S3-compatible storage
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// s3Object is an object of a bucket listing
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	ETag         string    `xml:"ETag"`
+	LastModified time.Time `xml:"LastModified"`
+}
+
+// newS3Client returns a client for a bucket configured from the environment
+func newS3Client(bucket string) (*s3Client, error) {
+	c := &s3Client{
+		bucket:       bucket,
+		region:       firstEnv("AWS_REGION", "AWS_DEFAULT_REGION"),
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if c.region == "" {
+		c.region = "us-east-1"
+	}
+	if endpoint := firstEnv("AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"); endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid S3 endpoint %q", endpoint)
+		}
+		c.endpoint = u
+	}
+	return c, nil
+}
+
+// firstEnv returns the first of the environment variables that is set
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// objectURL returns the URL of a key of the bucket, the bucket itself for
+// "". Custom endpoints and bucket names with dots use path-style URLs.
+func (c *s3Client) objectURL(key string, query url.Values) *url.URL {
+	var u *url.URL
+	switch {
+	case c.endpoint != nil:
+		u = &url.URL{Scheme: c.endpoint.Scheme, Host: c.endpoint.Host, Path: strings.TrimRight(c.endpoint.Path, "/") + "/" + c.bucket + "/" + key}
+	case strings.Contains(c.bucket, "."):
+		u = &url.URL{Scheme: "https", Host: "s3." + c.region + ".amazonaws.com", Path: "/" + c.bucket + "/" + key}
+	default:
+		u = &url.URL{Scheme: "https", Host: c.bucket + ".s3." + c.region + ".amazonaws.com", Path: "/" + key}
+	}
+	u.RawPath = awsEscape(u.Path, false)
+	u.RawQuery = canonicalQuery(query)
+	return u
+}
+
+// get sends a signed GET request, failing unless it returns 200
+func (c *s3Client) get(u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "dimandocs/"+Version)
+	c.sign(req, time.Now())
+	resp, err := remoteClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var s3Err struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		}
+		if body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024)); xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+			return nil, fmt.Errorf("GET %s returned %s: %s: %s", u.Path, resp.Status, s3Err.Code, s3Err.Message)
+		}
+		return nil, fmt.Errorf("GET %s returned %s", u.Path, resp.Status)
+	}
+	return resp, nil
+}
+
+// list returns every object whose key starts with prefix
+func (c *s3Client) list(prefix string) ([]s3Object, error) {
+	var objects []s3Object
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := c.get(c.objectURL("", query))
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Contents              []s3Object `xml:"Contents"`
+			IsTruncated           bool       `xml:"IsTruncated"`
+			NextContinuationToken string     `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("invalid bucket listing: %w", err)
+		}
+		objects = append(objects, page.Contents...)
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// download writes an object to a file
+func (c *s3Client) download(object s3Object, name string, limit *downloadLimit) error {
+	resp, err := c.get(c.objectURL(object.Key, nil))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	part := name + ".part"
+	if err := writeFile(part, limit.reader(resp.Body), object.LastModified); err != nil {
+		os.Remove(part)
+		return err
+	}
+	return os.Rename(part, name)
+}
+
+// syncS3 mirrors the objects under the prefix of an s3 source, downloading
+// those added or changed (by ETag) and removing those deleted since the
+// last sync. maxSize limits the bytes downloaded by one sync.
+func syncS3(dir DirectoryConfig, state *remoteState, maxSize int64) (bool, error) {
+	bucket, prefix, err := parseS3URL(dir.URL)
+	if err != nil {
+		return false, err
+	}
+	client, err := newS3Client(bucket)
+	if err != nil {
+		return false, err
+	}
+	objects, err := client.list(prefix)
+	if err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(dir.Path, 0o755); err != nil {
+		return false, err
+	}
+
+	changed := false
+	limit := &downloadLimit{maxSize: maxSize}
+	current := make(map[string]string, len(objects))
+	for _, object := range objects {
+		name := strings.TrimPrefix(object.Key, prefix)
+		if name == "" || strings.HasSuffix(name, "/") {
+			continue // "folder" placeholders
+		}
+		name = strings.TrimPrefix(path.Clean("/"+name), "/")
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			continue
+		}
+		if err := limit.addFile(); err != nil {
+			return changed, fmt.Errorf("prefix has %w", err)
+		}
+		local := filepath.Join(dir.Path, filepath.FromSlash(name))
+		current[object.Key] = object.ETag
+		if state.Objects[object.Key] == object.ETag {
+			if _, err := os.Stat(local); err == nil {
+				continue
+			}
+		}
+		if err := client.download(object, local, limit); err != nil {
+			return changed, err
+		}
+		changed = true
+	}
+	for key := range state.Objects {
+		if _, ok := current[key]; !ok {
+			os.Remove(filepath.Join(dir.Path, filepath.FromSlash(strings.TrimPrefix(key, prefix))))
+			changed = true
+		}
+	}
+	state.Objects = current
+	return changed, nil
+}
+
+// sign adds an AWS Signature Version 4 to a GET request without a body,
+// unless no credentials are configured
+func (c *s3Client) sign(req *http.Request, now time.Time) {
+	if c.accessKey == "" || c.secretKey == "" {
+		return
+	}
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if c.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.sessionToken)
+	}
+
+	names := []string{"host"}
+	for name := range req.Header {
+		if lower := strings.ToLower(name); strings.HasPrefix(lower, "x-amz-") {
+			names = append(names, lower)
+		}
+	}
+	sort.Strings(names)
+	var headers strings.Builder
+	for _, name := range names {
+		value := req.URL.Host
+		if name != "host" {
+			value = strings.TrimSpace(req.Header.Get(name))
+		}
+		headers.WriteString(name + ":" + value + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		headers.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	scope := date + "/" + c.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+c.secretKey), date)
+	key = hmacSHA256(key, c.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+c.accessKey+"/"+scope+", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes a query string the way AWS signatures expect it:
+// sorted by key, with spaces as %20
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, awsEscape(key, true)+"="+awsEscape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape percent-encodes everything but unreserved characters, and "/"
+// unless encodeSlash is set
+func awsEscape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dimandocs/search"
+)
+
+const defaultQuickOpenLimit = 20
+
+const defaultSearchMaxResults = 100
+
+// fuzzyScore matches pattern as a subsequence of text (case-insensitive), like
+// an editor's quick-open. Matches at word boundaries and consecutive matches
+// score higher, and shorter texts are preferred.
+func fuzzyScore(pattern, text string) (int, bool) {
+	// Spaces in the pattern are optional separators
+	p := []rune(strings.ToLower(strings.Join(strings.Fields(pattern), "")))
+	t := []rune(strings.ToLower(text))
+	if len(p) == 0 {
+		return 0, false
+	}
+
+	score := 0
+	pi := 0
+	prev := -2
+	for ti := 0; ti < len(t) && pi < len(p); ti++ {
+		if t[ti] != p[pi] {
+			continue
+		}
+		score++
+		if ti == prev+1 {
+			score += 5
+		}
+		if ti == 0 || isWordBoundary(t[ti-1]) {
+			score += 10
+		}
+		prev = ti
+		pi++
+	}
+	if pi < len(p) {
+		return 0, false
+	}
+
+	return score*10 - len(t), true
+}
+
+// isWordBoundary reports whether r separates words in titles and paths
+func isWordBoundary(r rune) bool {
+	switch r {
+	case '/', '\\', '-', '_', '.', ' ':
+		return true
+	}
+	return false
+}
+
+// quickOpen returns the documents readable with access best matching query,
+// best first
+func (a *App) quickOpen(access *Access, query string, limit int) []QuickOpenResult {
+	var results []QuickOpenResult
+	for _, doc := range a.Documents {
+		if !access.CanReadSource(doc.SourceName) {
+			continue
+		}
+		best, matched := 0, false
+		for _, candidate := range []string{doc.Title, path.Base(doc.RelPath), doc.RelPath} {
+			if score, ok := fuzzyScore(query, candidate); ok && (!matched || score > best) {
+				best, matched = score, true
+			}
+		}
+		if matched {
+			results = append(results, QuickOpenResult{
+				Title:      doc.Title,
+				RelPath:    doc.RelPath,
+				URL:        docURL(doc.RelPath),
+				SourceName: doc.SourceName,
+				Score:      best,
+			})
+		}
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// handleQuickOpen handles fuzzy title/path matching requests
+func (a *App) handleQuickOpen(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	limit := defaultQuickOpenLimit
+	if l := r.URL.Query().Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	results := []QuickOpenResult{}
+	if query != "" {
+		if matches := a.quickOpen(a.access(r), query, limit); matches != nil {
+			results = matches
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(results); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode results: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// parseSearchQuery parses a query with the configured search options
+func parseSearchQuery(query string, config SearchConfig) (*search.Query, error) {
+	return search.Parse(query, config.Fields, config.CaseSensitive)
+}
+
+// searchDoc returns what queries match in doc, besides its content
+func searchDoc(doc *Document) search.Doc {
+	return search.Doc{Title: doc.Title, Path: doc.RelPath, Overview: doc.Overview, Tags: doc.Tags}
+}
+
+// queryInt parses an optional non-negative integer query parameter
+func queryInt(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: %s", name, value)
+	}
+	return n, nil
+}
+
+// pathProximity rates how close two documents are in the tree: one point
+// per leading directory they share, and one more if they are in the same
+// directory
+func pathProximity(from, to string) int {
+	fromDir, toDir := path.Dir(from), path.Dir(to)
+	score := 0
+	if fromDir == toDir {
+		score++
+	}
+	if fromDir == "." || toDir == "." {
+		return score
+	}
+	fromParts, toParts := strings.Split(fromDir, "/"), strings.Split(toDir, "/")
+	for i := 0; i < len(fromParts) && i < len(toParts) && fromParts[i] == toParts[i]; i++ {
+		score++
+	}
+	return score
+}
+
+// search returns the documents readable with access matching query, best
+// first. Documents whose content matches are returned once per matching
+// section. Results near from, the document being viewed (if any), rank higher.
+func (a *App) search(access *Access, query *search.Query, from string) []SearchResult {
+	results := []SearchResult{}
+	for i := range a.Documents {
+		doc := &a.Documents[i]
+		if !access.CanRead(doc) {
+			continue
+		}
+
+		// Content is only read when a term needs to search the body
+		var content *string
+		loadContent := func() string {
+			if content == nil {
+				c, err := a.readDocumentContent(doc)
+				if err != nil {
+					slog.Warn("failed to read content", "path", doc.Path, "error", err)
+				}
+				content = &c
+			}
+			return *content
+		}
+
+		if !query.Match(searchDoc(doc), loadContent) {
+			continue
+		}
+		docResults := a.documentResults(doc, query, loadContent)
+		if from != "" {
+			for j := range docResults {
+				docResults[j].Score += pathProximity(from, doc.RelPath)
+			}
+		}
+		results = append(results, docResults...)
+	}
+
+	// Equal scores keep document order
+	sort.SliceStable(results, func(i, j int) bool { return results[i].Score > results[j].Score })
+	return results
+}
+
+// newSearchResult builds the search response entry for a matching document
+func newSearchResult(doc *Document, q *search.Query, content func() string) SearchResult {
+	snippet, body := "", ""
+	var headings []string
+	if q.Searches("content") {
+		body = removeFrontmatter(content())
+		snippet = q.Snippet(body)
+		for _, h := range markdownHeadings(body) {
+			headings = append(headings, h.text)
+		}
+	}
+	if snippet == "" {
+		snippet = doc.Overview
+	}
+	return SearchResult{
+		Title:   doc.Title,
+		Path:    doc.RelPath,
+		URL:     docURL(doc.RelPath),
+		Snippet: snippet,
+		Score:   q.Score(searchDoc(doc), headings, body),
+		matchAt: -1,
+	}
+}
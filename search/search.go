@@ -0,0 +1,353 @@
+// Package search parses the queries of the search API and matches, scores
+// and excerpts documents with them.
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultFields are searched by unqualified terms when not configured
+var DefaultFields = []string{"title", "overview", "content"}
+
+// ValidFields are the values accepted in the search.fields config
+var ValidFields = map[string]bool{"title": true, "overview": true, "content": true, "path": true, "tags": true}
+
+// qualifiers are the fields terms can be restricted to in queries
+var qualifiers = map[string]bool{"title": true, "path": true, "tag": true}
+
+// Doc is what queries match in a document, besides its content
+type Doc struct {
+	Title    string
+	Path     string // relative path
+	Overview string
+	Tags     []string
+}
+
+// term is a single condition of a search query
+type term struct {
+	field  string // "" (any text), "title", "path" or "tag"
+	value  string // lowercased text to look for (or the regex source)
+	negate bool   // -term: documents must NOT match
+	re     *regexp.Regexp
+}
+
+// Query is a parsed search query. The syntax supports:
+//
+//	word "exact phrase"   text in title, overview or content
+//	title:x path:x tag:x  restrict a term to a field (values may be quoted)
+//	-term                 exclude documents matching term
+//	regex:1               treat every term as a regular expression
+//
+// All terms must match (AND semantics). Unqualified terms look at the
+// configured search fields; matching is case-insensitive unless configured.
+type Query struct {
+	terms         []term
+	regex         bool
+	fields        map[string]bool
+	caseSensitive bool
+}
+
+// Tokenize splits a query on whitespace, keeping quoted sections together
+func Tokenize(query string) []string {
+	var tokens []string
+	var current strings.Builder
+	inQuote := false
+	for _, r := range query {
+		switch {
+		case r == '"':
+			inQuote = !inQuote
+			current.WriteRune(r)
+		case unicode.IsSpace(r) && !inQuote:
+			if current.Len() > 0 {
+				tokens = append(tokens, current.String())
+				current.Reset()
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if current.Len() > 0 {
+		tokens = append(tokens, current.String())
+	}
+	return tokens
+}
+
+// Parse parses a query string into its terms. Unqualified terms search
+// fields (DefaultFields if empty).
+func Parse(query string, fields []string, caseSensitive bool) (*Query, error) {
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	q := &Query{
+		fields:        make(map[string]bool),
+		caseSensitive: caseSensitive,
+	}
+	for _, field := range fields {
+		q.fields[strings.ToLower(field)] = true
+	}
+
+	for _, token := range Tokenize(query) {
+		if strings.EqualFold(token, "regex:1") || strings.EqualFold(token, "regex:true") {
+			q.regex = true
+			continue
+		}
+
+		t := term{}
+		if strings.HasPrefix(token, "-") && len(token) > 1 {
+			t.negate = true
+			token = token[1:]
+		}
+		if idx := strings.Index(token, ":"); idx > 0 && qualifiers[strings.ToLower(token[:idx])] {
+			t.field = strings.ToLower(token[:idx])
+			token = token[idx+1:]
+		}
+		t.value = strings.Trim(token, `"`)
+		if t.value == "" {
+			continue
+		}
+		q.terms = append(q.terms, t)
+	}
+
+	flags := "(?i)"
+	if q.caseSensitive {
+		flags = ""
+	}
+	for i := range q.terms {
+		if !q.regex {
+			if !q.caseSensitive {
+				q.terms[i].value = strings.ToLower(q.terms[i].value)
+			}
+			continue
+		}
+		re, err := regexp.Compile(flags + q.terms[i].value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regular expression '%s': %w", q.terms[i].value, err)
+		}
+		q.terms[i].re = re
+	}
+
+	return q, nil
+}
+
+// Empty reports whether the query has no terms
+func (q *Query) Empty() bool {
+	return len(q.terms) == 0
+}
+
+// Searches reports whether unqualified terms look at field
+func (q *Query) Searches(field string) bool {
+	return q.fields[field]
+}
+
+// matchText reports whether text matches the term's value
+func (t *term) matchText(text string, caseSensitive bool) bool {
+	if t.re != nil {
+		return t.re.MatchString(text)
+	}
+	if caseSensitive {
+		return strings.Contains(text, t.value)
+	}
+	return strings.Contains(strings.ToLower(text), t.value)
+}
+
+// matchTag reports whether one of tags matches the term's value exactly
+func (t *term) matchTag(tags []string, caseSensitive bool) bool {
+	for _, tag := range tags {
+		switch {
+		case t.re != nil:
+			if t.re.MatchString(tag) {
+				return true
+			}
+		case caseSensitive:
+			if tag == t.value {
+				return true
+			}
+		default:
+			if strings.EqualFold(tag, t.value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Match reports whether doc satisfies every term of the query. The content
+// func is only called when a term needs to look at the document body.
+func (q *Query) Match(doc Doc, content func() string) bool {
+	for i := range q.terms {
+		t := &q.terms[i]
+
+		var matched bool
+		switch t.field {
+		case "title":
+			matched = t.matchText(doc.Title, q.caseSensitive)
+		case "path":
+			matched = t.matchText(doc.Path, q.caseSensitive)
+		case "tag":
+			matched = t.matchTag(doc.Tags, q.caseSensitive)
+		default:
+			matched = q.fields["title"] && t.matchText(doc.Title, q.caseSensitive) ||
+				q.fields["overview"] && t.matchText(doc.Overview, q.caseSensitive) ||
+				q.fields["path"] && t.matchText(doc.Path, q.caseSensitive) ||
+				q.fields["tags"] && t.matchTag(doc.Tags, q.caseSensitive) ||
+				q.fields["content"] && t.matchText(content(), q.caseSensitive)
+		}
+
+		if matched == t.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchSection reports whether every unqualified term of the query occurs
+// in text. It is false for queries without such terms.
+func (q *Query) MatchSection(text string) bool {
+	matched := false
+	for i := range q.terms {
+		t := &q.terms[i]
+		if t.negate || t.field != "" {
+			continue
+		}
+		if !t.matchText(text, q.caseSensitive) {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+const (
+	snippetBefore = 60
+	snippetAfter  = 100
+)
+
+// FirstMatch returns the byte range of the first match in text of the
+// query's unqualified terms, trying terms in order, or -1, -1 if none occur
+func (q *Query) FirstMatch(text string) (int, int) {
+	for i := range q.terms {
+		t := &q.terms[i]
+		if t.negate || t.field != "" {
+			continue
+		}
+
+		if t.re != nil {
+			if loc := t.re.FindStringIndex(text); loc != nil {
+				return loc[0], loc[1]
+			}
+			continue
+		}
+		haystack := text
+		if !q.caseSensitive {
+			haystack = strings.ToLower(text)
+		}
+		// Lowercasing can change byte lengths of some characters; only use
+		// the offset if it still lines up with the original text
+		if idx := strings.Index(haystack, t.value); idx >= 0 && len(haystack) == len(text) {
+			return idx, idx + len(t.value)
+		}
+	}
+	return -1, -1
+}
+
+// Snippet returns a short excerpt of text around the first match of the
+// query's unqualified terms, or an empty string if none of them occur
+func (q *Query) Snippet(text string) string {
+	start, end := q.FirstMatch(text)
+	if start < 0 {
+		return ""
+	}
+
+	from := start - snippetBefore
+	if from < 0 {
+		from = 0
+	}
+	to := end + snippetAfter
+	if to > len(text) {
+		to = len(text)
+	}
+	for from > 0 && !utf8.RuneStart(text[from]) {
+		from--
+	}
+	for to < len(text) && !utf8.RuneStart(text[to]) {
+		to++
+	}
+
+	snippet := strings.Join(strings.Fields(text[from:to]), " ")
+	if from > 0 {
+		snippet = "…" + snippet
+	}
+	if to < len(text) {
+		snippet += "…"
+	}
+	return snippet
+}
+
+// Score weights of a term matching in a field
+const (
+	scoreTitle    = 10
+	scoreHeading  = 6
+	scoreField    = 5 // title:, path: or tag: term
+	scoreOverview = 3
+
+	// maxTermFrequency caps how many occurrences of a term in the body count
+	maxTermFrequency = 5
+)
+
+// Score returns the relevance of a match. For each term, a match in the
+// title weighs most, then in one of headings, then in the overview; each
+// occurrence in body adds a point, up to maxTermFrequency.
+func (q *Query) Score(doc Doc, headings []string, body string) int {
+	score := 0
+	for i := range q.terms {
+		t := &q.terms[i]
+		if t.negate {
+			continue
+		}
+		if t.field != "" {
+			score += scoreField
+			continue
+		}
+		if t.matchText(doc.Title, q.caseSensitive) {
+			score += scoreTitle
+		}
+		for _, heading := range headings {
+			if !strings.EqualFold(heading, doc.Title) && t.matchText(heading, q.caseSensitive) {
+				score += scoreHeading
+				break
+			}
+		}
+		if t.matchText(doc.Overview, q.caseSensitive) {
+			score += scoreOverview
+		}
+		score += t.countText(body, q.caseSensitive, maxTermFrequency)
+	}
+	return score
+}
+
+// countText returns how many times the term occurs in text, up to max
+func (t *term) countText(text string, caseSensitive bool, max int) int {
+	if text == "" {
+		return 0
+	}
+	if t.re != nil {
+		return len(t.re.FindAllStringIndex(text, max))
+	}
+	if !caseSensitive {
+		text = strings.ToLower(text)
+	}
+	count := 0
+	for count < max {
+		i := strings.Index(text, t.value)
+		if i < 0 {
+			break
+		}
+		count++
+		text = text[i+len(t.value):]
+	}
+	return count
+}
@@ -0,0 +1,155 @@
+package search
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  []term
+		regex bool
+	}{
+		{"words", "Install Guide", []term{{value: "install"}, {value: "guide"}}, false},
+		{"quoted phrase", `"getting started" now`, []term{{value: "getting started"}, {value: "now"}}, false},
+		{"qualifiers", `title:Setup path:docs/ TAG:beta`, []term{{field: "title", value: "setup"}, {field: "path", value: "docs/"}, {field: "tag", value: "beta"}}, false},
+		{"quoted qualifier", `title:"quick start"`, []term{{field: "title", value: "quick start"}}, false},
+		{"unknown qualifier", "http://example.com", []term{{value: "http://example.com"}}, false},
+		{"exclusion", "guide -draft -tag:old", []term{{value: "guide"}, {value: "draft", negate: true}, {field: "tag", value: "old", negate: true}}, false},
+		{"lone dash", "a - b", []term{{value: "a"}, {value: "-"}, {value: "b"}}, false},
+		{"empty terms", `"" title: -`, []term{{value: "-"}}, false},
+		{"regex", "regex:1 ^inst", []term{{value: "^inst"}}, true},
+		{"regex true", "REGEX:true a.c", []term{{value: "a.c"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(tt.query, nil, false)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.query, err)
+			}
+			if q.regex != tt.regex {
+				t.Errorf("regex = %v, want %v", q.regex, tt.regex)
+			}
+			if len(q.terms) != len(tt.want) {
+				t.Fatalf("Parse(%q) has %d terms, want %d: %+v", tt.query, len(q.terms), len(tt.want), q.terms)
+			}
+			for i, got := range q.terms {
+				want := tt.want[i]
+				if got.field != want.field || got.value != want.value || got.negate != want.negate {
+					t.Errorf("term %d = %+v, want %+v", i, got, want)
+				}
+				if (got.re != nil) != tt.regex {
+					t.Errorf("term %d compiled = %v, want %v", i, got.re != nil, tt.regex)
+				}
+			}
+		})
+	}
+}
+
+func TestParseInvalidRegex(t *testing.T) {
+	for _, query := range []string{"regex:1 (unclosed", "regex:1 ok [a-", "regex:true *"} {
+		if _, err := Parse(query, nil, false); err == nil || !strings.Contains(err.Error(), "invalid regular expression") {
+			t.Errorf("Parse(%q) error = %v, want an invalid regular expression error", query, err)
+		}
+	}
+	// Without regex:1 the same text is searched literally
+	if _, err := Parse("(unclosed", nil, false); err != nil {
+		t.Errorf("Parse without regex: %v", err)
+	}
+}
+
+func TestMatch(t *testing.T) {
+	doc := Doc{Title: "Installation Guide", Path: "ops/install.md", Overview: "How to set up the server", Tags: []string{"Setup", "beta"}}
+	content := "Run the installer.\nThen restart the daemon."
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"install", true},
+		{"INSTALL guide", true},
+		{"install missing", false},
+		{`"restart the daemon"`, true},
+		{`"the daemon restart"`, false},
+		{"title:guide", true},
+		{"title:installer", false},
+		{"path:ops/", true},
+		{"path:guide", false},
+		{"tag:setup", true},
+		{"tag:set", false},
+		{"-draft", true},
+		{"install -daemon", false},
+		{"-tag:beta", false},
+		{"-title:guide server", false},
+		{"regex:1 ^Inst", true},
+		{"regex:1 daemon\\.$", true},
+		{"regex:1 tag:^b", true},
+		{"regex:1 -path:^ops/", false},
+		{"regex:1 (?-i)INSTALL", false},
+		{"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := Parse(tt.query, nil, false)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.query, err)
+			}
+			if got := q.Match(doc, func() string { return content }); got != tt.want {
+				t.Errorf("Match(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchFieldsAndCase(t *testing.T) {
+	doc := Doc{Title: "Guide", Path: "ops/Deploy.md", Tags: []string{"ops"}}
+	loaded := false
+	content := func() string {
+		loaded = true
+		return "Deploy with care"
+	}
+
+	q, _ := Parse("deploy", []string{"title"}, false)
+	if q.Match(doc, content) || loaded {
+		t.Errorf("a title-only search matched or read the content")
+	}
+	q, _ = Parse("deploy", []string{"path"}, false)
+	if !q.Match(doc, content) {
+		t.Errorf("a path search did not match the path")
+	}
+	q, _ = Parse("deploy", []string{"content"}, true)
+	if q.Match(doc, content) {
+		t.Errorf("a case-sensitive search matched different case")
+	}
+	q, _ = Parse("Deploy", []string{"content"}, true)
+	if !q.Match(doc, content) {
+		t.Errorf("a case-sensitive search did not match the same case")
+	}
+}
+
+func TestSnippet(t *testing.T) {
+	text := strings.Repeat("lorem ipsum ", 20) + "the needle is here " + strings.Repeat("dolor sit ", 20)
+	q, _ := Parse("needle -lorem title:x", nil, false)
+	snippet := q.Snippet(text)
+	if !strings.Contains(snippet, "needle") || !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Errorf("Snippet = %q", snippet)
+	}
+	if got := q.Snippet("nothing to see"); got != "" {
+		t.Errorf("Snippet without a match = %q, want empty", got)
+	}
+}
+
+func TestScore(t *testing.T) {
+	doc := Doc{Title: "Deploy", Overview: "Deploying the app"}
+	q, _ := Parse("deploy", nil, false)
+	inTitle := q.Score(doc, nil, "")
+	inBody := q.Score(Doc{Title: "Other"}, nil, "deploy deploy")
+	if inTitle <= inBody {
+		t.Errorf("title match scored %d, body match %d", inTitle, inBody)
+	}
+	if got := q.Score(Doc{}, nil, strings.Repeat("deploy ", 50)); got != maxTermFrequency {
+		t.Errorf("body occurrences scored %d, want %d", got, maxTermFrequency)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// secretContent is only in the body of a document, far from the match, so
+// it can only reach a search response with the content itself
+const secretContent = "SECRET-BODY-TEXT"
+
+func TestSearchResultJSON(t *testing.T) {
+	long := "# Guide\n\nThe deploy step is explained here.\n\n" + strings.Repeat("Filler text. ", 200) + secretContent + "\n\n## Rollback\n\nUndo a deploy.\n"
+	a := newTestApp(t, map[string]string{"guide.md": long})
+
+	rec := httptest.NewRecorder()
+	a.handleSearch(rec, httptest.NewRequest(http.MethodGet, "/api/search?q=deploy", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /api/search = %d: %s", rec.Code, rec.Body)
+	}
+	if strings.Contains(rec.Body.String(), secretContent) {
+		t.Errorf("the search response contains the document content: %s", rec.Body)
+	}
+
+	var results []map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) == 0 {
+		t.Fatal("no results")
+	}
+	// Whole documents have the result fields; sections add where the match is
+	base := []string{"path", "score", "snippet", "title", "url"}
+	allowed := map[string]bool{"section": true, "anchor": true, "page": true}
+	for _, key := range base {
+		allowed[key] = true
+	}
+	for _, result := range results {
+		for key := range result {
+			if !allowed[key] {
+				t.Errorf("unexpected field %q in result %v", key, result)
+			}
+		}
+		for _, key := range base {
+			if _, ok := result[key]; !ok {
+				t.Errorf("result %v has no %q", result, key)
+			}
+		}
+		if snippet, _ := result["snippet"].(string); len(snippet) > 200 {
+			t.Errorf("snippet of %d bytes: %q", len(snippet), snippet)
+		}
+	}
+
+	// The DTO itself has no field for the content
+	data, err := json.Marshal(SearchResult{Title: "t", Path: "p", Snippet: "s", Score: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]interface{}
+	json.Unmarshal(data, &fields)
+	if len(fields) != len(base) {
+		t.Errorf("SearchResult JSON = %s, want only %v", data, base)
+	}
+	for _, key := range []string{"content", "Content", "body"} {
+		if _, ok := fields[key]; ok {
+			t.Errorf("SearchResult JSON has %q: %s", key, data)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/text"
+
+	"dimandocs/search"
+)
+
+// sectionHeading is a heading of a document as rendered, with the ID the
+// renderer gives it
+type sectionHeading struct {
+	ID     string
+	Offset int // byte offset of the heading text in the markdown
+}
+
+// renderedText returns markdown as it is given to the renderer
+func (a *App) renderedText(content string) string {
+	return substituteVariables(stripFrontmatter(content), a.Config.Variables)
+}
+
+// sectionHeadings returns the headings of markdown that have an ID, in order
+func (a *App) sectionHeadings(markdown string) []sectionHeading {
+	var headings []sectionHeading
+	root := a.Markdown.Parser().Parse(text.NewReader([]byte(markdown)))
+	ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		heading, ok := n.(*ast.Heading)
+		if !ok || !entering || heading.Lines().Len() == 0 {
+			return ast.WalkContinue, nil
+		}
+		if id, ok := heading.AttributeString("id"); ok {
+			if b, ok := id.([]byte); ok {
+				headings = append(headings, sectionHeading{ID: string(b), Offset: heading.Lines().At(0).Start})
+			}
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	return headings
+}
+
+// linkSections sets the heading ID to scroll to for the section holding the
+// match of each search result and, for document results, the page of a
+// paginated document with the first match. Only the results returned are
+// looked at, since this parses the document.
+func (a *App) linkSections(results []SearchResult, q *search.Query) {
+	if !q.Searches("content") {
+		return
+	}
+	for i := range results {
+		result := &results[i]
+		doc := a.findDocument(result.Path)
+		if doc == nil {
+			continue
+		}
+		content, err := a.readDocumentContent(doc)
+		if err != nil {
+			slog.Warn("failed to read content", "path", doc.Path, "error", err)
+			continue
+		}
+
+		pages := splitPages(content, a.pageSizeBytes())
+		for n, page := range pages {
+			if result.Page > 0 && n+1 != result.Page {
+				continue
+			}
+			markdown := a.renderedText(page)
+			start := result.matchAt
+			if start < 0 {
+				start, _ = q.FirstMatch(markdown)
+			}
+			if start < 0 {
+				continue
+			}
+			for _, h := range a.sectionHeadings(markdown) {
+				if h.Offset > start {
+					break
+				}
+				result.Anchor = h.ID
+			}
+			if len(pages) > 1 {
+				result.Page = n + 1
+			}
+			break
+		}
+	}
+}
+
+// markdownSection is the part of markdown from a heading to the next one
+type markdownSection struct {
+	trail []string // the heading and its enclosing headings, outermost first
+	start int      // byte offset in the markdown
+	text  string
+}
+
+// markdownSections splits markdown at every heading. Text before the first
+// heading is a section without headings.
+func markdownSections(markdown string) []markdownSection {
+	var sections []markdownSection
+	var enclosing []markdownHeading
+	var trail []string
+	start := 0
+	for _, h := range markdownHeadings(markdown) {
+		if h.offset > start {
+			sections = append(sections, markdownSection{trail: trail, start: start, text: markdown[start:h.offset]})
+		}
+		for len(enclosing) > 0 && enclosing[len(enclosing)-1].level >= h.level {
+			enclosing = enclosing[:len(enclosing)-1]
+		}
+		enclosing = append(enclosing, h)
+		trail = make([]string, len(enclosing))
+		for i, e := range enclosing {
+			trail[i] = e.text
+		}
+		start = h.offset
+	}
+	return append(sections, markdownSection{trail: trail, start: start, text: markdown[start:]})
+}
+
+// sectionName joins the headings of a section, leaving out the document
+// title, e.g. "Install > Linux"
+func sectionName(trail []string, title string) string {
+	if len(trail) > 0 && strings.EqualFold(trail[0], title) {
+		trail = trail[1:]
+	}
+	return strings.Join(trail, " > ")
+}
+
+// documentResults returns a search result for every section of doc where
+// all unqualified terms of q occur, or a single result for the document if
+// there is no such section (terms spread over sections, or only field terms)
+func (a *App) documentResults(doc *Document, q *search.Query, content func() string) []SearchResult {
+	if !q.Searches("content") || !q.MatchSection(content()) {
+		return []SearchResult{newSearchResult(doc, q, content)}
+	}
+
+	var results []SearchResult
+	pages := splitPages(content(), a.pageSizeBytes())
+	for n, page := range pages {
+		for _, section := range markdownSections(a.renderedText(page)) {
+			if !q.MatchSection(section.text) {
+				continue
+			}
+			start, _ := q.FirstMatch(section.text)
+			result := SearchResult{
+				Title:   doc.Title,
+				Path:    doc.RelPath,
+				URL:     docURL(doc.RelPath),
+				Section: sectionName(section.trail, doc.Title),
+				Snippet: q.Snippet(section.text),
+				Score:   q.Score(searchDoc(doc), section.trail, section.text),
+				matchAt: section.start + start,
+			}
+			if len(pages) > 1 {
+				result.Page = n + 1
+			}
+			results = append(results, result)
+		}
+	}
+	if len(results) == 0 {
+		return []SearchResult{newSearchResult(doc, q, content)}
+	}
+	return results
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+)
+
+// systemdUnit is the systemd unit installed by `dimandocs service install`
+var systemdUnit = template.Must(template.New("systemd").Parse(`[Unit]
+Description=DimanDocs documentation portal ({{.Name}})
+After=network.target
+
+[Service]
+Type=simple
+{{- if .System}}
+User={{.User}}
+NoNewPrivileges=true
+ProtectSystem=full
+{{- end}}
+WorkingDirectory={{.WorkingDir}}
+ExecStart={{.ExecStart}}
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy={{if .System}}multi-user.target{{else}}default.target{{end}}
+`))
+
+// launchdPlist is the launchd agent installed by `dimandocs service install` on macOS
+var launchdPlist = template.Must(template.New("launchd").Funcs(template.FuncMap{"xml": xmlEscape}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>Label</key>
+    <string>{{xml .Label}}</string>
+    <key>ProgramArguments</key>
+    <array>
+{{- range .Args}}
+        <string>{{xml .}}</string>
+{{- end}}
+    </array>
+    <key>WorkingDirectory</key>
+    <string>{{xml .WorkingDir}}</string>
+    <key>RunAtLoad</key>
+    <true/>
+    <key>KeepAlive</key>
+    <true/>
+    <key>StandardOutPath</key>
+    <string>{{xml .LogFile}}</string>
+    <key>StandardErrorPath</key>
+    <string>{{xml .LogFile}}</string>
+</dict>
+</plist>
+`))
+
+// xmlEscape escapes s for use in XML text
+func xmlEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// serviceSpec describes the service to install
+type serviceSpec struct {
+	Name       string
+	Label      string // launchd label
+	WorkingDir string
+	Args       []string // executable and its arguments
+	LogFile    string
+	System     bool   // system-wide systemd unit instead of a user unit
+	User       string // user a system-wide unit runs as
+}
+
+// CommandLine returns Args quoted for a systemd ExecStart line
+func (s serviceSpec) CommandLine() string {
+	quoted := make([]string, len(s.Args))
+	for i, arg := range s.Args {
+		if strings.ContainsAny(arg, " \t\"'\\") {
+			arg = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " ")
+}
+
+// ExecStart returns the command line for a systemd unit, where % and $ are special
+func (s serviceSpec) ExecStart() string {
+	return strings.NewReplacer("%", "%%", "$", "$$").Replace(s.CommandLine())
+}
+
+// runServiceCommand implements `dimandocs service install|uninstall`
+func runServiceCommand(args []string) error {
+	if len(args) == 0 || (args[0] != "install" && args[0] != "uninstall") {
+		return fmt.Errorf("usage: dimandocs service install|uninstall [OPTIONS] [-- SERVER OPTIONS]")
+	}
+	action := args[0]
+
+	fs := flag.NewFlagSet("service "+action, flag.ExitOnError)
+	name := fs.String("name", "dimandocs", "Service name")
+	configFile := fs.String("config-file", "", "Config file used by the service (default: the one found in the current directory)")
+	system := fs.Bool("system", false, "Install a system-wide systemd unit instead of a user unit (Linux, requires root)")
+	runAs := fs.String("user", "", "User the system-wide unit runs as (default: $SUDO_USER or the current user)")
+	printOnly := fs.Bool("print", false, "Print the service definition instead of installing it")
+	fs.Parse(args[1:])
+
+	spec, err := newServiceSpec(*name, *configFile, *system, fs.Args())
+	if err != nil {
+		return err
+	}
+	if spec.System {
+		if spec.User, err = serviceUser(*runAs); err != nil {
+			return err
+		}
+	}
+
+	switch runtime.GOOS {
+	case "linux":
+		return installSystemd(action, spec, *printOnly)
+	case "darwin":
+		return installLaunchd(action, spec, *printOnly)
+	case "windows":
+		return installScheduledTask(action, spec, *printOnly)
+	}
+	return fmt.Errorf("services are not supported on %s", runtime.GOOS)
+}
+
+// newServiceSpec builds the service for the current directory and config.
+// extraArgs are passed to the server.
+func newServiceSpec(name, configFile string, system bool, extraArgs []string) (serviceSpec, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return serviceSpec{}, fmt.Errorf("failed to find executable: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+	workingDir, err := GetWorkingDirectory()
+	if err != nil {
+		return serviceSpec{}, err
+	}
+
+	args := []string{executable, "--serve"}
+	if configFile == "" {
+		configFile = findDefaultConfigFile()
+	}
+	if configFile != "" {
+		absConfig, err := filepath.Abs(configFile)
+		if err != nil {
+			return serviceSpec{}, fmt.Errorf("failed to resolve config file: %w", err)
+		}
+		if _, err := os.Stat(absConfig); err != nil {
+			return serviceSpec{}, fmt.Errorf("config file not found: %s", configFile)
+		}
+		args = append(args, "--config-file", absConfig)
+	}
+	args = append(args, extraArgs...)
+
+	return serviceSpec{
+		Name:       name,
+		Label:      "com.dimandocs." + name,
+		WorkingDir: workingDir,
+		Args:       args,
+		LogFile:    filepath.Join(workingDir, daemonLogName),
+		System:     system,
+	}, nil
+}
+
+// serviceUser returns the user a system-wide unit runs as: name, or the user
+// who ran sudo, or the current user. The server never needs to run as root.
+func serviceUser(name string) (string, error) {
+	if name == "" {
+		name = os.Getenv("SUDO_USER")
+	}
+	if name == "" {
+		current, err := user.Current()
+		if err != nil {
+			return "", fmt.Errorf("failed to find the current user, set --user: %w", err)
+		}
+		name = current.Username
+	}
+	if strings.ContainsAny(name, " \t\r\n") {
+		return "", fmt.Errorf("invalid user name %q", name)
+	}
+	if name == "root" {
+		fmt.Fprintln(os.Stderr, "Warning: the service will run as root; use --user to run it as another user")
+	}
+	return name, nil
+}
+
+// installSystemd installs or removes a systemd unit and enables it
+func installSystemd(action string, spec serviceSpec, printOnly bool) error {
+	unitName := spec.Name + ".service"
+	systemctl := []string{"systemctl"}
+	var unitDir string
+	if spec.System {
+		unitDir = "/etc/systemd/system"
+	} else {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("failed to find home directory: %w", err)
+		}
+		unitDir = filepath.Join(home, ".config", "systemd", "user")
+		systemctl = append(systemctl, "--user")
+	}
+	unitPath := filepath.Join(unitDir, unitName)
+
+	if action == "uninstall" {
+		// The unit may already be stopped or disabled
+		runCommands(append(systemctl, "disable", "--now", unitName))
+		if err := os.Remove(unitPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", unitPath, err)
+		}
+		runCommands(append(systemctl, "daemon-reload"))
+		fmt.Printf("Removed %s\n", unitPath)
+		return nil
+	}
+
+	var unit bytes.Buffer
+	if err := systemdUnit.Execute(&unit, spec); err != nil {
+		return fmt.Errorf("failed to generate unit: %w", err)
+	}
+	if printOnly {
+		fmt.Print(unit.String())
+		return nil
+	}
+
+	if err := os.MkdirAll(unitDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", unitDir, err)
+	}
+	if err := ioutil.WriteFile(unitPath, unit.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", unitPath, err)
+	}
+	fmt.Printf("Wrote %s\n", unitPath)
+	if err := runCommands(append(systemctl, "daemon-reload"), append(systemctl, "enable", "--now", unitName)); err != nil {
+		return err
+	}
+	fmt.Printf("Service %s is running. Check it with: %s status %s\n", spec.Name, strings.Join(systemctl, " "), unitName)
+	if !spec.System {
+		fmt.Printf("To keep it running after you log out: loginctl enable-linger %s\n", os.Getenv("USER"))
+	}
+	return nil
+}
+
+// installLaunchd installs or removes a launchd agent and loads it
+func installLaunchd(action string, spec serviceSpec, printOnly bool) error {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to find home directory: %w", err)
+	}
+	plistPath := filepath.Join(home, "Library", "LaunchAgents", spec.Label+".plist")
+
+	if action == "uninstall" {
+		// The agent may already be unloaded
+		runCommands([]string{"launchctl", "unload", "-w", plistPath})
+		if err := os.Remove(plistPath); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", plistPath, err)
+		}
+		fmt.Printf("Removed %s\n", plistPath)
+		return nil
+	}
+
+	var plist bytes.Buffer
+	if err := launchdPlist.Execute(&plist, spec); err != nil {
+		return fmt.Errorf("failed to generate plist: %w", err)
+	}
+	if printOnly {
+		fmt.Print(plist.String())
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(plistPath), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(plistPath), err)
+	}
+	if err := ioutil.WriteFile(plistPath, plist.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", plistPath, err)
+	}
+	fmt.Printf("Wrote %s\n", plistPath)
+	if err := runCommands([]string{"launchctl", "load", "-w", plistPath}); err != nil {
+		return err
+	}
+	fmt.Printf("Service %s is running. Logs: %s\n", spec.Label, spec.LogFile)
+	return nil
+}
+
+// installScheduledTask registers a task that starts the server at logon.
+// The server does not implement the Windows service control protocol, so a
+// scheduled task is used instead of a service: it only runs while the user
+// who installed it is logged on, and isn't restarted if it stops.
+func installScheduledTask(action string, spec serviceSpec, printOnly bool) error {
+	if action == "uninstall" {
+		if err := runCommands([]string{"schtasks", "/Delete", "/F", "/TN", spec.Name}); err != nil {
+			return err
+		}
+		fmt.Printf("Removed scheduled task %s\n", spec.Name)
+		return nil
+	}
+
+	// schtasks has no working directory option, so change to it first
+	taskCommand := fmt.Sprintf(`cmd /c cd /d "%s" && %s`, spec.WorkingDir, spec.CommandLine())
+	create := []string{"schtasks", "/Create", "/F", "/SC", "ONLOGON", "/RL", "LIMITED", "/TN", spec.Name, "/TR", taskCommand}
+	if printOnly {
+		fmt.Println(strings.Join(create, " "))
+		return nil
+	}
+	if err := runCommands(create, []string{"schtasks", "/Run", "/TN", spec.Name}); err != nil {
+		return err
+	}
+	fmt.Printf("Scheduled task %s is running and will start at logon\n", spec.Name)
+	fmt.Println("Note: this is not a Windows service; the server only runs while you are logged on and is not restarted if it stops")
+	return nil
+}
+
+// runCommands runs commands in order, stopping at the first failure
+func runCommands(commands ...[]string) error {
+	for _, args := range commands {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %w", strings.Join(args, " "), err)
+		}
+	}
+	return nil
+}
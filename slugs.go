@@ -0,0 +1,90 @@
+package main
+
+import (
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// slugIndex maps the permalink slugs of the documents of the default
+// version to their RelPath and back (slug_urls)
+type slugIndex struct {
+	byPath map[string]string // RelPath -> slug
+	bySlug map[string]string // slug -> RelPath
+}
+
+// slugify lowercases s and joins its letters and digits with dashes, e.g.
+// "Getting Started: Linux" becomes "getting-started-linux"
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// buildSlugs gives each document a slug: its frontmatter "slug", or its
+// title. Frontmatter slugs are assigned first so they are never taken by a
+// title; later documents with a taken slug get "-2", "-3"... in scan order.
+func buildSlugs(docs []Document) slugIndex {
+	index := slugIndex{byPath: make(map[string]string), bySlug: make(map[string]string)}
+	assign := func(doc *Document, slug string) {
+		if slug == "" {
+			slug = slugify(strings.TrimSuffix(path.Base(doc.RelPath), path.Ext(doc.RelPath)))
+		}
+		if slug == "" {
+			slug = "doc"
+		}
+		unique := slug
+		for n := 2; index.bySlug[unique] != ""; n++ {
+			unique = slug + "-" + strconv.Itoa(n)
+		}
+		index.byPath[doc.RelPath] = unique
+		index.bySlug[unique] = doc.RelPath
+	}
+	for i := range docs {
+		if docs[i].Slug != "" {
+			assign(&docs[i], slugify(docs[i].Slug))
+		}
+	}
+	for i := range docs {
+		if docs[i].Slug == "" {
+			assign(&docs[i], slugify(docs[i].Title))
+		}
+	}
+	return index
+}
+
+// documentSlug returns the slug of doc, "" unless slug_urls is enabled
+func (a *App) documentSlug(doc *Document) string {
+	if !a.Config.SlugURLs || doc.Version != "" {
+		return ""
+	}
+	return a.slugs.byPath[doc.RelPath]
+}
+
+// handleSlug redirects /d/{slug} to the document with that slug, wherever
+// its file is now
+func (a *App) handleSlug(w http.ResponseWriter, r *http.Request) {
+	relPath, ok := a.slugs.bySlug[strings.TrimPrefix(r.URL.Path, "/d/")]
+	if !ok || !a.Config.SlugURLs || a.readableDocument(r, relPath) == nil {
+		a.notFound(w, r)
+		return
+	}
+	target := a.Config.BasePath + docURL(relPath)
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, target, http.StatusFound)
+}
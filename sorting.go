@@ -0,0 +1,126 @@
+package main
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Tree sort modes (tree_sort)
+const (
+	treeSortAlphabetical = "alphabetical"
+	treeSortOrder        = "order"
+)
+
+var treeSortModes = map[string]bool{treeSortAlphabetical: true, treeSortOrder: true}
+
+// sourceNames returns the names of grouped sources in the order their
+// directories are configured. Names not in the config (documents loaded
+// from a stale cache) follow alphabetically.
+func (a *App) sourceNames(groups map[string][]Document) []string {
+	names := make([]string, 0, len(groups))
+	seen := make(map[string]bool)
+	for _, dir := range a.Config.Directories {
+		if _, ok := groups[dir.Name]; ok && !seen[dir.Name] {
+			names = append(names, dir.Name)
+			seen[dir.Name] = true
+		}
+	}
+
+	var rest []string
+	for name := range groups {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+// navOrder is the position of the nodes listed in a directory's nav, from 1,
+// by path relative to the directory. A folder takes the position of its
+// first entry.
+type navOrder map[string]int
+
+// navOrder returns the positions of the nav of the directories named
+// sourceName, nil if they have none
+func (a *App) navOrder(sourceName string) navOrder {
+	var order navOrder
+	position := 0
+	for _, dir := range a.Config.Directories {
+		if dir.Name != sourceName || len(dir.Nav) == 0 {
+			continue
+		}
+		if order == nil {
+			order = make(navOrder)
+		}
+		for _, entry := range dir.Nav {
+			entry = strings.Trim(path.Clean("/"+filepath.ToSlash(entry)), "/")
+			if entry == "" {
+				continue
+			}
+			position++
+			for p := entry; p != "."; p = path.Dir(p) {
+				if _, ok := order[p]; !ok {
+					order[p] = position
+				}
+			}
+		}
+	}
+	return order
+}
+
+// sortTree sorts the children of node and of its subdirectories by the
+// directory's nav, then tree_sort and directories_first
+func (a *App) sortTree(node *TreeNode, nav navOrder) {
+	for _, child := range node.Children {
+		if !child.IsFile {
+			a.sortTree(child, nav)
+		}
+	}
+	sort.Slice(node.Children, func(i, j int) bool {
+		return a.lessTreeNode(node.Children[i], node.Children[j], nav)
+	})
+}
+
+// lessTreeNode reports whether x is listed before y. Names are compared
+// ignoring case, then exactly, so siblings always have a single order.
+func (a *App) lessTreeNode(x, y *TreeNode, nav navOrder) bool {
+	// Nodes in the nav come first, in its order
+	if px, py := nav[x.Path], nav[y.Path]; px != py {
+		if px == 0 || py == 0 {
+			return py == 0
+		}
+		return px < py
+	}
+	if a.Config.DirectoriesFirst && x.IsFile != y.IsFile {
+		return !x.IsFile
+	}
+	if a.Config.TreeSort == treeSortOrder {
+		// Nodes with an order come first, lowest first
+		ox, oy := nodeOrder(x), nodeOrder(y)
+		if ox != oy {
+			if ox == 0 || oy == 0 {
+				return oy == 0
+			}
+			return ox < oy
+		}
+	}
+	if lx, ly := strings.ToLower(x.Name), strings.ToLower(y.Name); lx != ly {
+		return lx < ly
+	}
+	return x.Name < y.Name
+}
+
+// nodeOrder returns the frontmatter order of a document, or for a directory
+// the order of its landing page
+func nodeOrder(node *TreeNode) int {
+	if node.IsFile {
+		return node.Document.Order
+	}
+	if node.Index != nil {
+		return node.Index.Order
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// sortingApp returns an app with documents in two sources, configured in
+// the opposite of alphabetical order
+func sortingApp(treeSort string, directoriesFirst bool) *App {
+	a := NewApp()
+	a.Config.Directories = []DirectoryConfig{{Path: "/zeta", Name: "Zeta"}, {Path: "/alpha", Name: "Alpha"}}
+	a.Config.TreeSort = treeSort
+	a.Config.DirectoriesFirst = directoriesFirst
+	add := func(dir, source, rel string, order int) {
+		a.Documents = append(a.Documents, Document{
+			Title:      strings.TrimSuffix(filepath.Base(rel), ".md"),
+			Path:       filepath.Join(dir, rel),
+			RelPath:    rel,
+			SourceDir:  dir,
+			SourceName: source,
+			Order:      order,
+		})
+	}
+	add("/zeta", "Zeta", "b.md", 0)
+	add("/zeta", "Zeta", "A.md", 0)
+	add("/zeta", "Zeta", "a.md", 0)
+	add("/zeta", "Zeta", "guide/intro.md", 2)
+	add("/zeta", "Zeta", "guide/setup.md", 1)
+	add("/zeta", "Zeta", "guide/README.md", 3)
+	add("/zeta", "Zeta", "api/zz.md", 1)
+	add("/zeta", "Zeta", "c.md", 2)
+	add("/zeta", "Zeta", "d.md", 1)
+	add("/alpha", "Alpha", "one.md", 0)
+	add("/alpha", "Alpha", "two/three.md", 0)
+	return a
+}
+
+// flattenTrees lists the paths of the trees' nodes in display order
+func flattenTrees(trees []DirectoryTree) []string {
+	var paths []string
+	var walk func(prefix string, node *TreeNode)
+	walk = func(prefix string, node *TreeNode) {
+		for _, child := range node.Children {
+			paths = append(paths, prefix+child.Path)
+			walk(prefix, child)
+		}
+	}
+	for _, tree := range trees {
+		paths = append(paths, tree.Name+":")
+		walk(tree.Name+":", tree.Root)
+	}
+	return paths
+}
+
+// flattenGroups lists the paths of the groups' documents in display order
+func flattenGroups(groups []DirectoryGroup) []string {
+	var paths []string
+	for _, group := range groups {
+		for _, doc := range group.Documents {
+			paths = append(paths, group.Name+":"+doc.RelPath)
+		}
+	}
+	return paths
+}
+
+func TestSortingIsStable(t *testing.T) {
+	tests := []struct {
+		name             string
+		treeSort         string
+		directoriesFirst bool
+		wantTree         []string
+	}{
+		{"alphabetical", treeSortAlphabetical, false, []string{
+			"Zeta:", "Zeta:A.md", "Zeta:a.md", "Zeta:api", "Zeta:api/zz.md", "Zeta:b.md", "Zeta:c.md", "Zeta:d.md",
+			"Zeta:guide", "Zeta:guide/intro.md", "Zeta:guide/README.md", "Zeta:guide/setup.md",
+			"Alpha:", "Alpha:one.md", "Alpha:two", "Alpha:two/three.md",
+		}},
+		// A folder takes the order of its landing page (guide/README.md)
+		{"frontmatter order", treeSortOrder, false, []string{
+			"Zeta:", "Zeta:d.md", "Zeta:c.md",
+			"Zeta:guide", "Zeta:guide/setup.md", "Zeta:guide/intro.md", "Zeta:guide/README.md",
+			"Zeta:A.md", "Zeta:a.md", "Zeta:api", "Zeta:api/zz.md", "Zeta:b.md",
+			"Alpha:", "Alpha:one.md", "Alpha:two", "Alpha:two/three.md",
+		}},
+		{"directories first", treeSortAlphabetical, true, []string{
+			"Zeta:", "Zeta:api", "Zeta:api/zz.md", "Zeta:guide", "Zeta:guide/intro.md", "Zeta:guide/README.md", "Zeta:guide/setup.md",
+			"Zeta:A.md", "Zeta:a.md", "Zeta:b.md", "Zeta:c.md", "Zeta:d.md",
+			"Alpha:", "Alpha:two", "Alpha:two/three.md", "Alpha:one.md",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := sortingApp(tt.treeSort, tt.directoriesFirst)
+			docs := append([]Document(nil), a.Documents...)
+			random := rand.New(rand.NewSource(1))
+
+			var firstGroups []string
+			for i := 0; i < 50; i++ {
+				// Documents come in any order from a scan
+				random.Shuffle(len(docs), func(i, j int) { docs[i], docs[j] = docs[j], docs[i] })
+				a.Documents = append([]Document(nil), docs...)
+
+				if got := flattenTrees(a.BuildDirectoryTrees()); !reflect.DeepEqual(got, tt.wantTree) {
+					t.Fatalf("round %d: tree = %v, want %v", i, got, tt.wantTree)
+				}
+				groups := flattenGroups(a.GroupDocumentsByDirectory())
+				if firstGroups == nil {
+					firstGroups = groups
+					if !strings.HasPrefix(groups[0], "Zeta:") {
+						t.Errorf("groups are not in config order: %v", groups)
+					}
+				} else if !reflect.DeepEqual(groups, firstGroups) {
+					t.Fatalf("round %d: groups = %v, first round %v", i, groups, firstGroups)
+				}
+			}
+		})
+	}
+}
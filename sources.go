@@ -0,0 +1,82 @@
+package main
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strings"
+)
+
+// sourcePrefix is the path segment that namespaces the documents of a
+// directory: its name as a slug, "api-reference" for "API Reference"
+func sourcePrefix(sourceName string) string {
+	if prefix := slugify(sourceName); prefix != "" {
+		return prefix
+	}
+	return "source"
+}
+
+// sourceRelPath returns the path of a document relative to its directory,
+// which is its RelPath unless that was prefixed by disambiguatePaths
+func sourceRelPath(doc *Document) string {
+	relPath, err := filepath.Rel(doc.SourceDir, doc.Path)
+	if err != nil {
+		return doc.RelPath
+	}
+	return filepath.ToSlash(relPath)
+}
+
+// disambiguatePaths gives each document whose relative path is taken by a
+// document of an earlier directory a path prefixed with its source, e.g.
+// "api/README.md" for README.md in the directory named "API", so both can
+// be opened. The first one keeps its path. Collisions are logged since
+// they are usually unintended.
+func disambiguatePaths(docs []Document) {
+	owners := make(map[string]string, len(docs)) // path -> source name
+	for i := range docs {
+		docs[i].RelPath = sourceRelPath(&docs[i])
+		if _, ok := owners[docs[i].RelPath]; !ok {
+			owners[docs[i].RelPath] = docs[i].SourceName
+		}
+	}
+	for i := range docs {
+		doc := &docs[i]
+		owner := owners[doc.RelPath]
+		if owner == doc.SourceName {
+			continue
+		}
+		prefixed := sourcePrefix(doc.SourceName) + "/" + doc.RelPath
+		slog.Warn("documents of two directories share a path", "path", doc.RelPath, "directory", owner, "other", doc.SourceName, "renamed", prefixed)
+		doc.RelPath = prefixed
+	}
+}
+
+// lookupDocument returns the document with the given relative path, or
+// nil. "<source>/<path>" also finds the document at path in the directory
+// whose prefix is source, so links relative to a prefixed document work.
+func lookupDocument(docs []Document, relPath string) *Document {
+	for i := range docs {
+		if docs[i].RelPath == relPath {
+			return &docs[i]
+		}
+	}
+	if prefix, rest, ok := strings.Cut(relPath, "/"); ok {
+		for i := range docs {
+			if docs[i].RelPath == rest && sourcePrefix(docs[i].SourceName) == prefix {
+				return &docs[i]
+			}
+		}
+	}
+	return nil
+}
+
+// findSourceDocument returns the document at relPath, relative to the
+// directory named sourceName, whether its path was prefixed or not
+func findSourceDocument(docs []Document, sourceName, relPath string) *Document {
+	prefixed := sourcePrefix(sourceName) + "/" + relPath
+	for i := range docs {
+		if docs[i].SourceName == sourceName && (docs[i].RelPath == relPath || docs[i].RelPath == prefixed) {
+			return &docs[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+//go:embed static/*
+var staticFS embed.FS
+
+// layeredFS serves files from the first layer that has them. Directories are
+// reported as missing so the file server never produces listings.
+type layeredFS []fs.FS
+
+// Open implements fs.FS
+func (l layeredFS) Open(name string) (fs.File, error) {
+	for _, layer := range l {
+		f, err := layer.Open(name)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			f.Close()
+			continue
+		}
+		return f, nil
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// dirFS serves the files of a directory, like os.DirFS, except those whose
+// real path is outside of it: symlinks can't expose other files.
+type dirFS string // the directory, with symlinks resolved
+
+// newDirFS returns the dirFS of dir
+func newDirFS(dir string) (dirFS, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", err
+	}
+	return dirFS(real), nil
+}
+
+// Open implements fs.FS
+func (d dirFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	real, err := filepath.EvalSymlinks(filepath.Join(string(d), filepath.FromSlash(name)))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	if rel, err := filepath.Rel(string(d), real); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return os.Open(real)
+}
+
+// newStaticHandler serves /static/ from the configured static_dir (if any),
+// falling back to the assets embedded in the binary. Both layers reject
+// ".." and absolute paths, and static_dir symlinks leading out of it, so
+// requests cannot escape their directory.
+func newStaticHandler(staticDir string) http.Handler {
+	var layers layeredFS
+
+	if staticDir != "" {
+		if info, err := os.Stat(staticDir); err != nil || !info.IsDir() {
+			slog.Warn("static_dir is not a directory, serving embedded assets only", "dir", staticDir)
+		} else if dir, err := newDirFS(staticDir); err != nil {
+			slog.Warn("static_dir can't be read, serving embedded assets only", "dir", staticDir, "error", err)
+		} else {
+			layers = append(layers, dir)
+		}
+	}
+
+	embedded, err := fs.Sub(staticFS, "static")
+	if err != nil {
+		// Only possible if the embed directive changes
+		panic(errors.New("embedded static assets missing"))
+	}
+	layers = append(layers, embedded)
+
+	return http.StripPrefix("/static", &staticHandler{
+		layers: layers,
+		files:  http.FileServer(http.FS(layers)),
+		etags:  make(map[string]string),
+	})
+}
+
+// staticHandler serves static assets with an ETag and Cache-Control header.
+// The file server answers conditional requests once the ETag is set.
+type staticHandler struct {
+	layers layeredFS
+	files  http.Handler
+
+	mu    sync.Mutex
+	etags map[string]string // "name size modtime" -> ETag
+}
+
+// ServeHTTP implements http.Handler
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if etag := h.etag(r.URL.Path); etag != "" {
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", staticCacheControl)
+	}
+	h.files.ServeHTTP(w, r)
+}
+
+// etag returns the ETag of an asset, or "" if it does not exist. ETags are
+// cached until the file's size or modification time changes.
+func (h *staticHandler) etag(urlPath string) string {
+	name := strings.TrimPrefix(path.Clean("/"+urlPath), "/")
+	f, err := h.layers.Open(name)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return ""
+	}
+
+	key := fmt.Sprintf("%s %d %d", name, info.Size(), info.ModTime().UnixNano())
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if etag, ok := h.etags[key]; ok {
+		return etag
+	}
+	data, err := fs.ReadFile(h.layers, name)
+	if err != nil {
+		return ""
+	}
+	etag := etagFor(data)
+	h.etags[key] = etag
+	return etag
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// staticFixture creates a static_dir overriding favicon.svg and adding
+// custom.css, next to a secret file it links to
+func staticFixture(t *testing.T) (staticDir, secret string) {
+	t.Helper()
+	root := t.TempDir()
+	staticDir = filepath.Join(root, "static")
+	secret = filepath.Join(root, "secret.txt")
+	if err := os.MkdirAll(filepath.Join(staticDir, "css"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		filepath.Join(staticDir, "favicon.svg"):     "<svg>override</svg>",
+		filepath.Join(staticDir, "css", "site.css"): "body {}",
+		secret: "top secret",
+	} {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(secret, filepath.Join(staticDir, "leak.txt")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(root, filepath.Join(staticDir, "up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(staticDir, "css", "site.css"), filepath.Join(staticDir, "inside.css")); err != nil {
+		t.Fatal(err)
+	}
+	return staticDir, secret
+}
+
+// serveStatic requests target from h, given as the raw request URI
+func serveStatic(h http.Handler, target string) (int, string) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestStaticHandlerLayers(t *testing.T) {
+	staticDir, _ := staticFixture(t)
+	embedded, err := fs.ReadFile(staticFS, "static/favicon.svg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		staticDir string
+		target    string
+		want      string
+	}{
+		{"embedded", "", "/static/favicon.svg", string(embedded)},
+		{"override", staticDir, "/static/favicon.svg", "<svg>override</svg>"},
+		{"added file", staticDir, "/static/css/site.css", "body {}"},
+		{"symlink inside", staticDir, "/static/inside.css", "body {}"},
+		{"missing static_dir", filepath.Join(staticDir, "missing"), "/static/favicon.svg", string(embedded)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := serveStatic(newStaticHandler(tt.staticDir), tt.target)
+			if code != http.StatusOK || body != tt.want {
+				t.Errorf("GET %s = %d %q, want 200 %q", tt.target, code, body, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaticHandlerTraversal(t *testing.T) {
+	staticDir, secret := staticFixture(t)
+	h := newStaticHandler(staticDir)
+	mainGo, err := filepath.Abs("main.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, target := range []string{
+		"/static/../main.go",
+		"/static/../../main.go",
+		"/static/%2e%2e/main.go",
+		"/static/%2e%2e%2fmain.go",
+		"/static/..%2f..%2fmain.go",
+		"/static/css/%2e%2e/%2e%2e/main.go",
+		"/static/" + mainGo,
+		"/static//" + strings.TrimPrefix(filepath.ToSlash(secret), "/"),
+		"/static/leak.txt",
+		"/static/up/secret.txt",
+		"/static/",
+		"/static/css/",
+	} {
+		code, body := serveStatic(h, target)
+		if code == http.StatusOK || strings.Contains(body, "package main") || strings.Contains(body, "top secret") || strings.Contains(body, "site.css") {
+			t.Errorf("GET %s = %d %q, want it rejected", target, code, body)
+		}
+	}
+}
+
+func TestDirFSRejectsEscapes(t *testing.T) {
+	staticDir, secret := staticFixture(t)
+	dir, err := newDirFS(staticDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"../secret.txt", "/" + filepath.ToSlash(secret), "leak.txt", "up/secret.txt", "css/../../secret.txt", ""} {
+		if f, err := dir.Open(name); err == nil {
+			f.Close()
+			t.Errorf("Open(%q) succeeded", name)
+		}
+	}
+	if f, err := dir.Open("css/site.css"); err != nil {
+		t.Errorf("Open(css/site.css): %v", err)
+	} else {
+		f.Close()
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+// statsTopDocuments is the number of documents listed as largest, oldest and newest
+const statsTopDocuments = 5
+
+// CorpusStats summarizes the documents for the /stats page
+type CorpusStats struct {
+	Title           string
+	TotalDocuments  int
+	TotalWords      int
+	TotalSize       int64
+	Sources         []SourceStats
+	Largest         []DocumentStats
+	Oldest          []DocumentStats
+	Newest          []DocumentStats
+	MissingTitle    []DocumentStats // no "# " heading, titled after the file name
+	MissingOverview []DocumentStats // no "## Overview" section
+	BrokenLinks     []BrokenLink
+	StaleAfter      string // stale_after, when /stale lists outdated documents
+}
+
+// SourceStats are the totals of one configured directory
+type SourceStats struct {
+	Name      string `json:"name"`
+	Documents int    `json:"documents"`
+	Words     int    `json:"words"`
+	Size      int64  `json:"size"`
+}
+
+// DocumentStats describes a document in the stats lists
+type DocumentStats struct {
+	Path     string
+	Title    string
+	Size     int64
+	Words    int
+	Modified time.Time
+}
+
+// collectStats computes the statistics of the documents readable with access
+func (a *App) collectStats(access *Access) CorpusStats {
+	stats := CorpusStats{Title: a.Config.Title, StaleAfter: a.Config.StaleAfter}
+	sources := make(map[string]*SourceStats)
+	var docs []DocumentStats
+
+	for i := range a.Documents {
+		doc := &a.Documents[i]
+		if !access.CanRead(doc) {
+			continue
+		}
+		stats.TotalDocuments++
+		ds := DocumentStats{Path: doc.RelPath, Title: doc.Title, Size: doc.Size}
+		if info, err := os.Stat(doc.Path); err == nil {
+			ds.Modified = info.ModTime()
+		}
+		ds.Words = doc.Words
+		docs = append(docs, ds)
+
+		source, ok := sources[doc.SourceName]
+		if !ok {
+			source = &SourceStats{Name: doc.SourceName}
+			sources[doc.SourceName] = source
+		}
+		source.Documents++
+		source.Words += ds.Words
+		source.Size += ds.Size
+		stats.TotalWords += ds.Words
+		stats.TotalSize += ds.Size
+
+		if doc.Title == doc.DirName {
+			stats.MissingTitle = append(stats.MissingTitle, ds)
+		}
+		if doc.Overview == "" {
+			stats.MissingOverview = append(stats.MissingOverview, ds)
+		}
+	}
+
+	stats.BrokenLinks = a.checkLinks(LinkCheckOptions{Access: access}).Broken
+
+	// Sources are listed in config order
+	for _, dir := range a.Config.Directories {
+		if source, ok := sources[dir.Name]; ok {
+			stats.Sources = append(stats.Sources, *source)
+			delete(sources, dir.Name)
+		}
+	}
+	var rest []string
+	for name := range sources {
+		rest = append(rest, name)
+	}
+	sort.Strings(rest)
+	for _, name := range rest {
+		stats.Sources = append(stats.Sources, *sources[name])
+	}
+
+	stats.Largest = topDocuments(docs, func(x, y DocumentStats) bool { return x.Size > y.Size })
+	stats.Oldest = topDocuments(docs, func(x, y DocumentStats) bool { return x.Modified.Before(y.Modified) })
+	stats.Newest = topDocuments(docs, func(x, y DocumentStats) bool { return x.Modified.After(y.Modified) })
+	return stats
+}
+
+// topDocuments returns the first statsTopDocuments documents ordered by less
+func topDocuments(docs []DocumentStats, less func(x, y DocumentStats) bool) []DocumentStats {
+	sorted := append([]DocumentStats(nil), docs...)
+	sort.SliceStable(sorted, func(i, j int) bool { return less(sorted[i], sorted[j]) })
+	if len(sorted) > statsTopDocuments {
+		sorted = sorted[:statsTopDocuments]
+	}
+	return sorted
+}
+
+// formatSize formats a size in bytes for display
+func formatSize(size int64) string {
+	switch {
+	case size >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(size)/(1<<20))
+	case size >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(size)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", size)
+}
+
+// handleStats serves the corpus statistics and health page
+func (a *App) handleStats(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := a.parseTemplates("templates/stats.html")
+	if err != nil {
+		a.serveError(w, fmt.Sprintf("Failed to parse template: %v", err), http.StatusInternalServerError)
+		return
+	}
+	servePage(w, r, tmpl, a.collectStats(a.access(r)))
+}
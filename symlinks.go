@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// walkFiles walks the tree rooted at root like filepath.Walk. With follow
+// set, symbolic links to directories are walked as directories, and a
+// directory or file reached more than once (through a link cycle, or two
+// links to the same target) is only reported the first time.
+func walkFiles(root string, follow bool, fn filepath.WalkFunc) error {
+	if !follow {
+		return filepath.Walk(root, fn)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	realRoot, err := resolvePath(root)
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	w := &symlinkWalker{fn: fn, visited: make(map[string]bool)}
+	err = w.walk(root, realRoot, info)
+	if errors.Is(err, filepath.SkipDir) || errors.Is(err, filepath.SkipAll) {
+		return nil
+	}
+	return err
+}
+
+// symlinkWalker walks a tree following links, remembering the resolved
+// paths of the directories and files it has reported
+type symlinkWalker struct {
+	fn      filepath.WalkFunc
+	visited map[string]bool
+}
+
+// walk reports path, whose resolved path is realPath, and the entries below
+// it when it is a directory
+func (w *symlinkWalker) walk(path, realPath string, info os.FileInfo) error {
+	if w.visited[realPath] {
+		slog.Debug("skipping path already scanned", "path", path, "target", realPath)
+		return nil
+	}
+	if err := w.fn(path, info, nil); err != nil {
+		return err
+	}
+	w.visited[realPath] = true
+	if !info.IsDir() {
+		return nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		if err := w.fn(path, info, err); err != nil && !errors.Is(err, filepath.SkipDir) {
+			return err
+		}
+		return nil
+	}
+
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+		realChild := filepath.Join(realPath, entry.Name())
+		var childInfo os.FileInfo
+		if entry.Type()&fs.ModeSymlink != 0 {
+			target, err := resolvePath(child)
+			if err != nil {
+				// A broken link is reported as the link itself
+				if childInfo, err = os.Lstat(child); err != nil {
+					if err := w.fn(child, nil, err); err != nil && !errors.Is(err, filepath.SkipDir) {
+						return err
+					}
+					continue
+				}
+			} else if childInfo, err = os.Stat(target); err != nil {
+				if err := w.fn(child, nil, err); err != nil && !errors.Is(err, filepath.SkipDir) {
+					return err
+				}
+				continue
+			} else {
+				realChild = target
+			}
+		} else if childInfo, err = entry.Info(); err != nil {
+			if err := w.fn(child, nil, err); err != nil && !errors.Is(err, filepath.SkipDir) {
+				return err
+			}
+			continue
+		}
+
+		if err := w.walk(child, realChild, childInfo); err != nil {
+			if !errors.Is(err, filepath.SkipDir) {
+				return err
+			}
+			if !childInfo.IsDir() {
+				// SkipDir from a file skips the rest of its directory
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// resolvePath returns the absolute path of p with all links resolved
+func resolvePath(p string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
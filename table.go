@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// defaultTableRows is how many rows of a table are shown when table_rows
+// is 0
+const defaultTableRows = 1000
+
+// isTableFile reports whether a document is a CSV or TSV table rather
+// than markdown
+func isTableFile(path string) bool {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv", ".tsv":
+		return true
+	}
+	return false
+}
+
+// tableView is a CSV or TSV table as templates/table.html shows it
+type tableView struct {
+	Header   []string
+	Rows     [][]string // the first table_rows rows
+	Total    int        // rows of the file, without the header
+	Download string     // URL of the file
+	Error    string     // why the table stops early, "" if it was read whole
+}
+
+// tableRows returns the most rows of a table shown, 0 for all of them
+func (a *App) tableRows() int {
+	switch {
+	case a.Config.TableRows < 0:
+		return 0
+	case a.Config.TableRows == 0:
+		return defaultTableRows
+	}
+	return a.Config.TableRows
+}
+
+// renderTableCached renders a table document, reusing the cached HTML if
+// the file and settings have not changed
+func (a *App) renderTableCached(doc *Document, content string) ([]byte, error) {
+	download := a.Config.BasePath + "/download/" + escapePath(doc.RelPath)
+	hash := contentHash(fmt.Sprintf("table\n%d\n%s\n%s", a.tableRows(), download, content))
+	if html, ok := a.Renders.Get(doc.Path, hash); ok {
+		return html, nil
+	}
+
+	html, err := a.renderTable(doc.Path, content, download)
+	if err != nil {
+		return nil, err
+	}
+	a.Renders.Put(doc.Path, hash, html)
+	return html, nil
+}
+
+// renderTable renders a CSV or TSV file as a table whose columns sort when
+// their header is clicked. The first row is the header. Rows past
+// table_rows are left out, with a link to download the whole file.
+func (a *App) renderTable(path, content, download string) ([]byte, error) {
+	reader := newTableReader(path, content)
+	view := tableView{Download: download}
+	limit := a.tableRows()
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			view.Error = err.Error()
+			break
+		}
+		if view.Header == nil {
+			view.Header = record
+			continue
+		}
+		view.Total++
+		if limit == 0 || len(view.Rows) < limit {
+			view.Rows = append(view.Rows, record)
+		}
+	}
+
+	// Rows of different lengths are padded so the cells line up
+	columns := len(view.Header)
+	for _, row := range view.Rows {
+		columns = max(columns, len(row))
+	}
+	view.Header = padRow(view.Header, columns)
+	for i, row := range view.Rows {
+		view.Rows[i] = padRow(row, columns)
+	}
+
+	tmpl, err := a.parseTemplates("templates/table.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, view); err != nil {
+		return nil, fmt.Errorf("failed to render table: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// newTableReader returns a reader of the rows of a CSV or TSV file, which
+// may have rows of different lengths and stray quotes
+func newTableReader(path, content string) *csv.Reader {
+	reader := csv.NewReader(strings.NewReader(strings.TrimPrefix(content, "\ufeff"))) // byte order mark of Excel exports
+	if strings.EqualFold(filepath.Ext(path), ".tsv") {
+		reader.Comma = '\t'
+	}
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader
+}
+
+// tableContentType returns the media type a table is downloaded as
+func tableContentType(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".tsv") {
+		return "text/tab-separated-values; charset=utf-8"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// tableMarkdown returns a CSV or TSV file as a markdown table, all rows
+// included; rows after one that cannot be read are left out
+func tableMarkdown(path, content string) string {
+	reader := newTableReader(path, content)
+	var rows [][]string
+	columns := 0
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			break
+		}
+		rows = append(rows, record)
+		columns = max(columns, len(record))
+	}
+	if len(rows) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	cell := strings.NewReplacer("|", "\\|", "\r\n", " ", "\n", " ")
+	for i, row := range rows {
+		row = padRow(row, columns)
+		b.WriteString("|")
+		for _, value := range row {
+			b.WriteString(" " + cell.Replace(value) + " |")
+		}
+		b.WriteString("\n")
+		if i == 0 {
+			b.WriteString(strings.Repeat("| --- ", columns) + "|\n")
+		}
+	}
+	return b.String()
+}
+
+// padRow returns row with empty cells added up to columns
+func padRow(row []string, columns int) []string {
+	for len(row) < columns {
+		row = append(row, "")
+	}
+	return row
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+	extast "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// TaskProgress counts the task list items ("- [ ]", "- [x]") of a document
+type TaskProgress struct {
+	Total int `json:"total"`
+	Done  int `json:"done"`
+}
+
+// Percent returns the share of done tasks, rounded down
+func (p TaskProgress) Percent() int {
+	if p.Total == 0 {
+		return 0
+	}
+	return p.Done * 100 / p.Total
+}
+
+// taskItem is a task list item found in markdown
+type taskItem struct {
+	offset  int // byte offset of the character between the brackets
+	checked bool
+}
+
+// taskPattern matches a task list item, possibly inside a blockquote
+var taskPattern = regexp.MustCompile(`^(?:[ \t]*>)*[ \t]*(?:[-*+]|\d{1,9}[.)])[ \t]+\[([ xX])\](?:[ \t]|$)`)
+
+// findTasks returns the task list items of markdown in document order,
+// which is the order their checkboxes are rendered in. Frontmatter and
+// fenced code blocks are skipped.
+func findTasks(content string) []taskItem {
+	body := removeFrontmatter(content)
+	offset := len(content) - len(body)
+
+	var tasks []taskItem
+	fence := ""
+	for _, line := range strings.SplitAfter(body, "\n") {
+		lineOffset := offset
+		offset += len(line)
+		trimmed := strings.TrimSpace(line)
+
+		if fence != "" {
+			if strings.HasPrefix(trimmed, fence) {
+				fence = ""
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			fence = trimmed[:3]
+			continue
+		}
+
+		if m := taskPattern.FindStringSubmatchIndex(line); m != nil {
+			tasks = append(tasks, taskItem{offset: lineOffset + m[2], checked: line[m[2]] != ' '})
+		}
+	}
+	return tasks
+}
+
+// countTasks returns the task progress of markdown
+func countTasks(content string) TaskProgress {
+	var p TaskProgress
+	for _, task := range findTasks(content) {
+		p.Total++
+		if task.checked {
+			p.Done++
+		}
+	}
+	return p
+}
+
+// taskCheckBoxRenderer renders the checkboxes of task list items like
+// goldmark does, with a name for screen readers: the text of the item
+// follows the box without labelling it
+type taskCheckBoxRenderer struct {
+	html.Config
+}
+
+// newTaskCheckBoxRenderer returns a taskCheckBoxRenderer
+func newTaskCheckBoxRenderer() *taskCheckBoxRenderer {
+	return &taskCheckBoxRenderer{Config: html.NewConfig()}
+}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *taskCheckBoxRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(extast.KindTaskCheckBox, r.render)
+}
+
+func (r *taskCheckBoxRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	if node.(*extast.TaskCheckBox).IsChecked {
+		w.WriteString(`<input aria-label="Task" checked="" disabled="" type="checkbox"`)
+	} else {
+		w.WriteString(`<input aria-label="Task" disabled="" type="checkbox"`)
+	}
+	if r.XHTML {
+		w.WriteString(" /> ")
+	} else {
+		w.WriteString("> ")
+	}
+	return ast.WalkContinue, nil
+}
+
+// taskRequest is the body of PATCH /api/documents/{relpath}
+type taskRequest struct {
+	Task    int  `json:"task"` // index of the checkbox on the page, from 0
+	Page    int  `json:"page"` // page the checkbox is on, for paginated documents
+	Checked bool `json:"checked"`
+}
+
+// errTaskNotFound is returned when a toggled task is not in the document
+var errTaskNotFound = fmt.Errorf("task not found")
+
+// handleTaskToggle checks or unchecks a task list item and writes the
+// document back. Checkboxes are identified by their position on the
+// rendered page. The document is written through updateDocument, like
+// saves from the editor.
+func (a *App) handleTaskToggle(w http.ResponseWriter, r *http.Request, doc Document) {
+	var req taskRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	index := -1
+	var content []byte
+	_, err := a.updateDocument(doc, func(source []byte) ([]byte, error) {
+		// Tasks on earlier pages come first
+		start := 0
+		if pages := splitPages(string(source), a.pageSizeBytes()); len(pages) > 1 && req.Page > 1 {
+			for _, page := range pages[:min(req.Page, len(pages))-1] {
+				start += len(page)
+			}
+		}
+		tasks := findTasks(string(source))
+		index = req.Task
+		for _, task := range tasks {
+			if task.offset < start {
+				index++
+			}
+		}
+		if req.Task < 0 || index >= len(tasks) {
+			return nil, errTaskNotFound
+		}
+
+		mark := byte(' ')
+		if req.Checked {
+			mark = 'x'
+		}
+		source[tasks[index].offset] = mark
+		content = source
+		return source, nil
+	})
+	if err == errTaskNotFound {
+		http.Error(w, fmt.Sprintf("Task %d not found", req.Task), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to toggle task: %v", err), http.StatusInternalServerError)
+		return
+	}
+	slog.Info("toggled task", "path", doc.Path, "task", index, "checked", req.Checked)
+	writeJSON(w, http.StatusOK, countTasks(string(content)))
+}
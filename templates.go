@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// templateCache holds page templates by the files they are parsed from.
+// Embedded templates can't change while the server runs, so each page is
+// only parsed the first time it is served.
+type templateCache struct {
+	mu    sync.Mutex
+	pages map[string]*template.Template
+}
+
+// parseTemplates returns the page template made of files with
+// templateFuncs: parsed once from the embedded templates, or on every call
+// from the templates/ directory in --dev mode
+func (a *App) parseTemplates(files ...string) (*template.Template, error) {
+	if a.DevDir != "" {
+		return a.newTemplates(os.DirFS(a.DevDir), files)
+	}
+
+	key := strings.Join(files, ",")
+	a.templates.mu.Lock()
+	defer a.templates.mu.Unlock()
+	if tmpl, ok := a.templates.pages[key]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := a.newTemplates(templatesFS, files)
+	if err != nil {
+		return nil, err
+	}
+	if a.templates.pages == nil {
+		a.templates.pages = make(map[string]*template.Template)
+	}
+	a.templates.pages[key] = tmpl
+	return tmpl, nil
+}
+
+// newTemplates parses files from fsys into a template named after the first
+func (a *App) newTemplates(fsys fs.FS, files []string) (*template.Template, error) {
+	return template.New(path.Base(files[0])).Funcs(a.templateFuncs()).ParseFS(fsys, files...)
+}
+
+// assets returns the embedded assets, or in --dev mode the ones in the
+// assets/ directory, read again on every call
+func (a *App) assets() *assetBundle {
+	if a.DevDir != "" {
+		return loadAssetBundle(os.DirFS(a.DevDir))
+	}
+	return bundledAssets
+}
+
+// handleAssets serves /assets/ (see assetBundle.ServeHTTP)
+func (a *App) handleAssets(w http.ResponseWriter, r *http.Request) {
+	a.assets().ServeHTTP(w, r)
+}
+
+// devDir returns the directory --dev reads templates and assets from: the
+// current directory, which must be a dimandocs source tree
+func devDir() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{"templates", "assets"} {
+		if info, err := os.Stat(filepath.Join(dir, name)); err != nil || !info.IsDir() {
+			return "", fmt.Errorf("no %s/ directory in %s; run dimandocs --dev from its source tree", name, dir)
+		}
+	}
+	return dir, nil
+}
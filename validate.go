@@ -0,0 +1,527 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dimandocs/search"
+)
+
+// ConfigProblem is a single issue found while validating a config file
+type ConfigProblem struct {
+	Line    int    // 1-based line in the config file, 0 if unknown
+	Field   string // path of the offending field, e.g. directories[0].path
+	Message string
+}
+
+// String formats the problem with its location
+func (p ConfigProblem) String() string {
+	var location []string
+	if p.Line > 0 {
+		location = append(location, fmt.Sprintf("line %d", p.Line))
+	}
+	if p.Field != "" {
+		location = append(location, p.Field)
+	}
+	if len(location) == 0 {
+		return p.Message
+	}
+	return strings.Join(location, ": ") + ": " + p.Message
+}
+
+// ConfigError reports every problem found in a config file
+type ConfigError struct {
+	File     string
+	Problems []ConfigProblem
+}
+
+// newConfigError returns a ConfigError with problems ordered by line, or nil
+// if there are no problems
+func newConfigError(file string, problems []ConfigProblem) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Line < problems[j].Line
+	})
+	return &ConfigError{File: file, Problems: problems}
+}
+
+// Error implements the error interface
+func (e *ConfigError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration in %s (%d problem", e.File, len(e.Problems))
+	if len(e.Problems) != 1 {
+		b.WriteString("s")
+	}
+	b.WriteString("):")
+	for _, p := range e.Problems {
+		b.WriteString("\n  - ")
+		b.WriteString(p.String())
+	}
+	return b.String()
+}
+
+// configValidator collects problems for a config file
+type configValidator struct {
+	lines    map[string]int
+	problems []ConfigProblem
+}
+
+// add records a problem for field
+func (v *configValidator) add(field, format string, args ...interface{}) {
+	v.problems = append(v.problems, ConfigProblem{
+		Line:    v.line(field),
+		Field:   field,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// line returns the line of field, or of its closest enclosing field if field
+// does not appear in the file (e.g. a missing required key)
+func (v *configValidator) line(field string) int {
+	for field != "" {
+		if line, ok := v.lines[field]; ok {
+			return line
+		}
+		cut := strings.LastIndexAny(field, ".[")
+		if cut < 0 {
+			break
+		}
+		field = field[:cut]
+	}
+	return 0
+}
+
+// checkConfigData checks raw JSON config data against the Config structure:
+// syntax, unknown keys and value types. lines maps fields to the line they
+// appear on in the config file.
+func checkConfigData(data []byte, lines map[string]int) []ConfigProblem {
+	var raw interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&raw); err != nil {
+		line := 0
+		if syntaxErr, ok := err.(*json.SyntaxError); ok {
+			line = lineAt(data, syntaxErr.Offset)
+		}
+		return []ConfigProblem{{Line: line, Message: fmt.Sprintf("invalid JSON: %v", err)}}
+	}
+
+	v := &configValidator{lines: lines}
+	v.checkType(raw, reflect.TypeOf(Config{}), "")
+	return v.problems
+}
+
+// checkType verifies that value can be decoded into t, reporting unknown keys
+func (v *configValidator) checkType(value interface{}, t reflect.Type, field string) {
+	if t.Kind() == reflect.Ptr {
+		if value == nil {
+			return
+		}
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			v.add(field, "expected an object, got %s", jsonKind(value))
+			return
+		}
+		fields := jsonFields(t)
+		keys := make([]string, 0, len(obj))
+		for key := range obj {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sub := joinField(field, key)
+			f, ok := fields[key]
+			if !ok {
+				msg := fmt.Sprintf("unknown key %q", key)
+				if suggestion := closestKey(key, fields); suggestion != "" {
+					msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+				}
+				v.add(sub, "%s", msg)
+				continue
+			}
+			v.checkType(obj[key], f.Type, sub)
+		}
+
+	case reflect.Slice:
+		arr, ok := value.([]interface{})
+		if !ok {
+			v.add(field, "expected an array, got %s", jsonKind(value))
+			return
+		}
+		for i, item := range arr {
+			v.checkType(item, t.Elem(), fmt.Sprintf("%s[%d]", field, i))
+		}
+
+	case reflect.Map:
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			v.add(field, "expected an object, got %s", jsonKind(value))
+			return
+		}
+		for key, item := range obj {
+			v.checkType(item, t.Elem(), joinField(field, key))
+		}
+
+	case reflect.String:
+		if _, ok := value.(string); !ok {
+			hint := ""
+			if _, isNumber := value.(json.Number); isNumber {
+				hint = fmt.Sprintf(" (quote it: \"%v\")", value)
+			}
+			v.add(field, "expected a string, got %s%s", jsonKind(value), hint)
+		}
+
+	case reflect.Bool:
+		if _, ok := value.(bool); !ok {
+			v.add(field, "expected true or false, got %s", jsonKind(value))
+		}
+
+	case reflect.Int, reflect.Int64:
+		n, ok := value.(json.Number)
+		if !ok {
+			v.add(field, "expected a number, got %s", jsonKind(value))
+			return
+		}
+		if _, err := n.Int64(); err != nil {
+			v.add(field, "expected a whole number, got %s", n)
+		}
+	}
+}
+
+// checkConfig checks the semantics of a decoded configuration: required
+// values, port range, patterns that do not compile and conflicting options
+func checkConfig(lines map[string]int, config Config, hasTargetPath bool) []ConfigProblem {
+	v := &configValidator{lines: lines}
+
+	if len(config.Directories) == 0 && !hasTargetPath {
+		v.add("directories", "at least one directory is required")
+	}
+
+	seenPaths := make(map[string]int)
+	for i, dir := range config.Directories {
+		field := fmt.Sprintf("directories[%d]", i)
+		v.checkRemoteDirectory(field, dir)
+		key := dir.Path
+		if isRemote(dir) {
+			key = dir.URL // downloaded to the cache directory
+		}
+		switch prev, seen := seenPaths[key]; {
+		case seen && isRemote(dir):
+			v.add(field+".url", "duplicate url %q (also used by directories[%d])", dir.URL, prev)
+		case isRemote(dir):
+			seenPaths[key] = i
+		case strings.TrimSpace(dir.Path) == "":
+			v.add(field+".path", "path is required")
+		case seen:
+			v.add(field+".path", "duplicate path %q (also used by directories[%d])", dir.Path, prev)
+		default:
+			seenPaths[dir.Path] = i
+		}
+		if _, err := newFileMatcher(dir); err != nil {
+			v.add(field, "%v", err)
+		}
+		if dir.MaxDepth < 0 {
+			v.add(field+".max_depth", "must not be negative")
+		}
+		for j, entry := range dir.Nav {
+			if !filepath.IsLocal(filepath.FromSlash(strings.TrimSuffix(entry, "/"))) {
+				v.add(fmt.Sprintf("%s.nav[%d]", field, j), "invalid path %q (use a path relative to the directory, e.g. \"guide/setup.md\")", entry)
+			}
+		}
+	}
+	v.checkVersions(config.Directories)
+
+	if config.Port != "" {
+		if port, err := strconv.Atoi(config.Port); err != nil || port < 1 || port > 65535 {
+			v.add("port", "invalid port %q (must be a number between 1 and 65535)", config.Port)
+		}
+	}
+
+	if config.BasePath != "" {
+		if !strings.HasPrefix(config.BasePath, "/") {
+			v.add("base_path", "invalid base path %q (must start with /, e.g. \"/docs\")", config.BasePath)
+		} else if strings.ContainsAny(config.BasePath, "?# \t") {
+			v.add("base_path", "invalid base path %q (must be a plain URL path)", config.BasePath)
+		}
+	}
+
+	for i, pattern := range config.IgnorePatterns {
+		if _, err := regexp.Compile(pattern); err != nil {
+			v.add(fmt.Sprintf("ignore_patterns[%d]", i), "invalid regular expression: %v", err)
+		}
+	}
+
+	for i, field := range config.Search.Fields {
+		if !search.ValidFields[strings.ToLower(field)] {
+			v.add(fmt.Sprintf("search.fields[%d]", i), "invalid search field %q (valid fields: title, overview, content, path, tags)", field)
+		}
+	}
+
+	if config.TreeSort != "" && !treeSortModes[config.TreeSort] {
+		v.add("tree_sort", "invalid tree sort %q (valid values: alphabetical, order)", config.TreeSort)
+	}
+
+	v.checkRescan(config)
+	v.checkScanLimits(config)
+	v.checkStaleAfter(config.StaleAfter)
+	v.checkNotify(config.Notify)
+	v.checkPublish(config.Publish)
+	v.checkDiagrams(config.Diagrams)
+	v.checkAuth(config)
+	v.checkAdmin(config)
+
+	if config.CacheFormat != "" && indexOf(cacheFormats, config.CacheFormat) < 0 {
+		v.add("cache_format", "invalid cache format %q (valid values: %s)", config.CacheFormat, strings.Join(cacheFormats, ", "))
+	}
+
+	if config.DefaultLanguage != "" && normalizeLanguage(config.DefaultLanguage) == "" {
+		v.add("default_language", "unknown language %q (use an ISO 639-1 code such as \"en\" or \"pt-BR\")", config.DefaultLanguage)
+	}
+
+	for name := range config.Variables {
+		if !variableName.MatchString(name) {
+			v.add("variables."+name, "invalid variable name %q (use letters, digits, '_', '-' and '.')", name)
+		}
+	}
+
+	for i, name := range config.Markdown.Extensions {
+		if _, ok := markdownExtensions[strings.ToLower(name)]; !ok {
+			v.add(fmt.Sprintf("markdown.extensions[%d]", i), "unknown markdown extension %q (valid extensions: footnotes, definition_lists, admonitions, emoji, figures)", name)
+		}
+	}
+	switch markdownFlavor(config) {
+	case flavorGitHub, flavorGitLab, flavorBitbucket:
+	default:
+		v.add("markdown.flavor", "unknown flavor %q (use \"github\", \"gitlab\" or \"bitbucket\")", config.Markdown.Flavor)
+	}
+
+	if config.ScanWorkers < 0 {
+		v.add("scan_workers", "must not be negative")
+	}
+	if config.Prerender && config.RenderCacheSize < 0 {
+		v.add("prerender", "needs the render cache, which render_cache_size disables")
+	}
+	if config.MaxFileSize < 0 {
+		v.add("max_file_size", "must not be negative")
+	}
+	if config.TruncateLargeFiles && config.MaxFileSize == 0 {
+		v.add("truncate_large_files", "has no effect without max_file_size")
+	}
+	for i, heading := range config.Overview.Headings {
+		if strings.TrimSpace(heading) == "" {
+			v.add(fmt.Sprintf("overview.headings[%d]", i), "heading must not be empty")
+		}
+	}
+	if config.Overview.MaxLength < 0 {
+		v.add("overview.max_length", "must not be negative")
+	}
+	if config.Search.MaxResults < 0 {
+		v.add("search.max_results", "must not be negative")
+	}
+	if config.AccessLogMaxSize < 0 {
+		v.add("access_log_max_size", "must not be negative")
+	}
+	if config.AccessLogMaxBackups < 0 {
+		v.add("access_log_max_backups", "must not be negative")
+	}
+	if config.AccessLog == "" && (config.AccessLogMaxSize != 0 || config.AccessLogMaxBackups != 0) {
+		v.add("access_log", "access_log_max_size and access_log_max_backups have no effect without access_log")
+	}
+
+	return v.problems
+}
+
+// fieldLines maps field paths (e.g. directories[0].path) to the line where
+// they appear in data
+func fieldLines(data []byte) map[string]int {
+	lines := make(map[string]int)
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	// Stack of containers: object key being read or array index
+	type frame struct {
+		field   string
+		isArray bool
+		index   int
+		key     string
+		wantKey bool
+	}
+	var stack []*frame
+
+	// current returns the field path of the value about to be read
+	current := func() string {
+		if len(stack) == 0 {
+			return ""
+		}
+		top := stack[len(stack)-1]
+		if top.isArray {
+			return fmt.Sprintf("%s[%d]", top.field, top.index)
+		}
+		return joinField(top.field, top.key)
+	}
+	// valueDone advances the parent container after a value was read
+	valueDone := func() {
+		if len(stack) == 0 {
+			return
+		}
+		top := stack[len(stack)-1]
+		if top.isArray {
+			top.index++
+		} else {
+			top.wantKey = true
+		}
+	}
+
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return lines
+		}
+
+		if len(stack) > 0 && !stack[len(stack)-1].isArray && stack[len(stack)-1].wantKey {
+			if key, ok := tok.(string); ok {
+				top := stack[len(stack)-1]
+				top.key = key
+				top.wantKey = false
+				lines[joinField(top.field, key)] = lineAt(data, tokenStart(data, offset))
+				continue
+			}
+		}
+
+		if len(stack) > 0 && stack[len(stack)-1].isArray {
+			lines[current()] = lineAt(data, tokenStart(data, offset))
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, &frame{field: current(), wantKey: true})
+		case json.Delim('['):
+			stack = append(stack, &frame{field: current(), isArray: true})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+}
+
+// tokenStart skips the separators and whitespace preceding the token that
+// follows offset
+func tokenStart(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// lineAt returns the 1-based line number of a byte offset in data
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// jsonFields maps the JSON names of a struct's fields to the fields
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// closestKey suggests a known key for a misspelled one
+func closestKey(key string, fields map[string]reflect.StructField) string {
+	best, bestDist := "", 3
+	for name := range fields {
+		if d := editDistance(strings.ToLower(key), name); d < bestDist || (d == bestDist && name < best) {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(minInt(prev[j]+1, curr[j-1]+1), prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// minInt returns the smaller of a and b
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// joinField appends key to a field path
+func joinField(field, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+// jsonKind describes the JSON type of a decoded value
+func jsonKind(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "a string"
+	case bool:
+		return "a boolean"
+	case json.Number:
+		return "a number"
+	case []interface{}:
+		return "an array"
+	case map[string]interface{}:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", value)
+}
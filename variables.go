@@ -0,0 +1,48 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// variablePattern matches {{var.name}} placeholders, optionally escaped
+// with a backslash to keep them literal
+var variablePattern = regexp.MustCompile(`\\?\{\{\s*var\.([A-Za-z0-9_.-]+)\s*\}\}`)
+
+// variableName matches the names allowed in the variables config
+var variableName = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// substituteVariables replaces {{var.name}} placeholders with the configured
+// values. Unknown variables are left as they are, and \{{var.name}} is
+// written as {{var.name}}.
+func substituteVariables(content string, vars map[string]string) string {
+	if len(vars) == 0 || !strings.Contains(content, "{{") {
+		return content
+	}
+	return variablePattern.ReplaceAllStringFunc(content, func(match string) string {
+		if strings.HasPrefix(match, `\`) {
+			return match[1:]
+		}
+		name := variablePattern.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// variablesFingerprint identifies the variable values for the render cache
+func variablesFingerprint(vars map[string]string) string {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + "=" + vars[name] + "\x00")
+	}
+	return contentHash(b.String())
+}
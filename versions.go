@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// latestVersionLabel names the default version of a doc set that has no
+// version configured
+const latestVersionLabel = "latest"
+
+// versionPattern matches version names, which are used as a URL segment
+var versionPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// reservedVersions cannot be used as versions since they are routes
+var reservedVersions = map[string]bool{
+	"doc": true, "dir": true, "raw": true, "download": true, "api": true, "static": true, "assets": true,
+	"events": true, "debug": true, "stats": true, "stale": true, "graph": true, "login": true, "admin": true, "search": true, "d": true,
+	"manifest.webmanifest": true, "sw.js": true, "favicon.ico": true,
+}
+
+// DocumentVersion is an entry of the version dropdown of a document
+type DocumentVersion struct {
+	Name    string
+	URL     string // without the base path
+	Current bool
+	Missing bool // the document does not exist in this version
+}
+
+// checkVersions validates the versions of directories sharing a name. The
+// first directory of a set is its default version; the others need a
+// distinct version.
+func (v *configValidator) checkVersions(dirs []DirectoryConfig) {
+	first := make(map[string]int)
+	seen := make(map[string]int) // name + version -> directory index
+	for i, dir := range dirs {
+		field := fmt.Sprintf("directories[%d].version", i)
+		if dir.Version != "" {
+			if !versionPattern.MatchString(dir.Version) {
+				v.add(field, "invalid version %q (use letters, digits, '.', '_' and '-', e.g. \"v2\")", dir.Version)
+			} else if reservedVersions[dir.Version] {
+				v.add(field, "version %q is reserved for a route", dir.Version)
+			}
+		}
+
+		if _, ok := first[dir.Name]; !ok {
+			first[dir.Name] = i
+		} else if dir.Version == "" {
+			v.add(field, "required: directories[%d] is also named %q, so this directory is another version of it", first[dir.Name], dir.Name)
+		}
+		key := dir.Name + "\x00" + dir.Version
+		if prev, ok := seen[key]; ok && dir.Version != "" {
+			v.add(field, "duplicate version %q of %q (also used by directories[%d])", dir.Version, dir.Name, prev)
+		}
+		seen[key] = i
+	}
+}
+
+// setDocuments stores scanned documents. Documents of directories that are
+// not the default version of their set are kept apart in a.Versions, so
+// the index, search and graph only show one version of each document.
+func (a *App) setDocuments(docs []Document) {
+	secondary := make(map[string]string) // directory path -> version
+	seen := make(map[string]bool)
+	for _, dir := range a.Config.Directories {
+		if seen[dir.Name] && dir.Version != "" {
+			secondary[dir.Path] = dir.Version
+		}
+		seen[dir.Name] = true
+	}
+
+	current := make([]Document, 0, len(docs))
+	versions := make(map[string][]Document)
+	for _, doc := range docs {
+		if version, ok := secondary[doc.SourceDir]; ok {
+			doc.Version = version
+			versions[version] = append(versions[version], doc)
+			continue
+		}
+		current = append(current, doc)
+	}
+	disambiguatePaths(current)
+	for _, docs := range versions {
+		disambiguatePaths(docs)
+	}
+	a.Documents = current
+	a.Versions = versions
+	if a.Config.SlugURLs {
+		a.slugs = buildSlugs(a.Documents)
+	}
+}
+
+// allDocuments returns the documents of every version, for the scan cache
+func (a *App) allDocuments() []Document {
+	docs := append([]Document(nil), a.Documents...)
+	names := make([]string, 0, len(a.Versions))
+	for name := range a.Versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		docs = append(docs, a.Versions[name]...)
+	}
+	return docs
+}
+
+// findVersionedDocument returns a document of a version other than the default
+func (a *App) findVersionedDocument(version, relPath string) *Document {
+	return lookupDocument(a.Versions[version], relPath)
+}
+
+// handleVersionedDocument serves /{version}/doc/{path}. It reports false if
+// the request is not for a known version.
+func (a *App) handleVersionedDocument(w http.ResponseWriter, r *http.Request) bool {
+	version, relPath, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/doc/")
+	if !ok || strings.Contains(version, "/") || a.Versions[version] == nil {
+		return false
+	}
+	doc := a.findVersionedDocument(version, relPath)
+	if !a.access(r).CanRead(doc) {
+		a.notFound(w, r)
+		return true
+	}
+	a.serveDocument(w, r, doc)
+	return true
+}
+
+// documentVersions lists doc in every version of its doc set, in config
+// order, or returns nil if the set has a single version
+func (a *App) documentVersions(doc *Document) []DocumentVersion {
+	relPath := sourceRelPath(doc)
+	var versions []DocumentVersion
+	for _, dir := range a.Config.Directories {
+		if dir.Name != doc.SourceName {
+			continue
+		}
+
+		v := DocumentVersion{Name: dir.Version}
+		var found *Document
+		if len(versions) == 0 {
+			// The default version
+			if v.Name == "" {
+				v.Name = latestVersionLabel
+			}
+			v.URL = docURL(relPath)
+			if d := findSourceDocument(a.Documents, dir.Name, relPath); d != nil && d.SourceDir == dir.Path {
+				found = d
+				v.URL = docURL(d.RelPath)
+			}
+		} else {
+			v.URL = "/" + escapePath(dir.Version) + docURL(relPath)
+			if d := findSourceDocument(a.Versions[dir.Version], dir.Name, relPath); d != nil {
+				found = d
+				v.URL = "/" + escapePath(dir.Version) + docURL(d.RelPath)
+			}
+		}
+		v.Missing = found == nil
+		v.Current = found != nil && found.Path == doc.Path
+		versions = append(versions, v)
+	}
+	if len(versions) < 2 {
+		return nil
+	}
+	return versions
+}
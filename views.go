@@ -0,0 +1,193 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// viewsFileName stores how often each document was viewed, in the
+	// state directory (see statePath)
+	viewsFileName = ".dimandocs-views.json"
+
+	// viewsSaveInterval is how often changed view counts are written
+	viewsSaveInterval = 30 * time.Second
+
+	// mostViewedCount is the number of documents listed as most viewed on
+	// the index page
+	mostViewedCount = 10
+)
+
+// ViewCounter counts document views in memory; the counts are written to a
+// file periodically so they survive restarts
+type ViewCounter struct {
+	mu     sync.Mutex
+	path   string
+	counts map[string]int64 // by document RelPath
+	dirty  bool             // counts changed since the last save
+}
+
+// LoadViews reads the view counts file, starting empty if it does not exist
+func LoadViews(path string) *ViewCounter {
+	vc := &ViewCounter{path: path, counts: make(map[string]int64)}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read view counts", "file", path, "error", err)
+		}
+		return vc
+	}
+	if err := json.Unmarshal(data, &vc.counts); err != nil {
+		slog.Warn("failed to parse view counts, starting empty", "file", path, "error", err)
+		vc.counts = make(map[string]int64)
+	}
+	return vc
+}
+
+// Add counts a view of a document
+func (vc *ViewCounter) Add(relPath string) {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	vc.counts[relPath]++
+	vc.dirty = true
+}
+
+// Counts returns a copy of the view counts by document
+func (vc *ViewCounter) Counts() map[string]int64 {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	counts := make(map[string]int64, len(vc.counts))
+	for relPath, n := range vc.counts {
+		counts[relPath] = n
+	}
+	return counts
+}
+
+// Save writes the view counts if they changed since the last save
+func (vc *ViewCounter) Save() {
+	vc.mu.Lock()
+	defer vc.mu.Unlock()
+	if !vc.dirty {
+		return
+	}
+	data, err := json.MarshalIndent(vc.counts, "", "  ")
+	if err == nil {
+		err = ioutil.WriteFile(vc.path, data, 0644)
+	}
+	if err != nil {
+		slog.Warn("failed to save view counts", "file", vc.path, "error", err)
+		return
+	}
+	vc.dirty = false
+}
+
+// saveEvery saves the view counts every interval, for as long as the server
+// runs
+func (vc *ViewCounter) saveEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		vc.Save()
+	}
+}
+
+// saveState writes the view counts and history changed since they were last
+// saved, before the server exits
+func (a *App) saveState() {
+	a.Views.Save()
+	a.History.Save()
+}
+
+// statePath returns where the state file name (history, view counts, ...)
+// of this working directory and config is kept: a directory of its own under
+// the user config directory, or the working directory if there is none. A
+// file an older version left in the working directory is moved there.
+func (a *App) statePath(name string) string {
+	legacy := filepath.Join(a.WorkingDir, name)
+	base, err := os.UserConfigDir()
+	if err != nil {
+		return legacy
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n", a.WorkingDir, a.ConfigFile)
+	dir := filepath.Join(base, "dimandocs", hex.EncodeToString(h.Sum(nil))[:16])
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		slog.Warn("failed to create state directory, using the working directory", "dir", dir, "error", err)
+		return legacy
+	}
+
+	path := filepath.Join(dir, strings.TrimPrefix(name, ".dimandocs-"))
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if _, err := os.Stat(legacy); err == nil {
+			if err := os.Rename(legacy, path); err != nil {
+				slog.Warn("failed to move state file", "file", legacy, "error", err)
+				return legacy
+			}
+			slog.Info("moved state file", "from", legacy, "to", path)
+		}
+	}
+	return path
+}
+
+// DocumentViews is a document with the number of times it was viewed
+type DocumentViews struct {
+	Path  string `json:"path"`
+	Title string `json:"title"`
+	Views int64  `json:"views"`
+}
+
+// documentViews returns the viewed documents that still exist and can be
+// read with access, most viewed first, and the total number of views of all
+// of them. limit caps the documents returned unless it is 0.
+func (a *App) documentViews(access *Access, limit int) ([]DocumentViews, int64) {
+	var views []DocumentViews
+	var total int64
+	for relPath, n := range a.Views.Counts() {
+		doc := a.findDocument(relPath)
+		if !access.CanRead(doc) || n == 0 {
+			continue
+		}
+		views = append(views, DocumentViews{Path: doc.RelPath, Title: doc.Title, Views: n})
+		total += n
+	}
+	sort.Slice(views, func(i, j int) bool {
+		if views[i].Views != views[j].Views {
+			return views[i].Views > views[j].Views
+		}
+		return strings.ToLower(views[i].Title) < strings.ToLower(views[j].Title)
+	})
+	if limit > 0 && len(views) > limit {
+		views = views[:limit]
+	}
+	return views, total
+}
+
+// ViewStats is the response of /api/stats/views
+type ViewStats struct {
+	Total     int64           `json:"total"`
+	Documents []DocumentViews `json:"documents"`
+}
+
+// handleViewStats returns the view counts of documents, most viewed first
+// (?limit=n returns the first n)
+func (a *App) handleViewStats(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	views, total := a.documentViews(a.access(r), limit)
+	if views == nil {
+		views = []DocumentViews{}
+	}
+	writeJSON(w, http.StatusOK, ViewStats{Total: total, Documents: views})
+}
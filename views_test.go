@@ -0,0 +1,36 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStatePath(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configDir)
+	a := newTestApp(t, map[string]string{"guide.md": "# Guide\n"})
+
+	// A file left in the working directory is moved to the state directory
+	legacy := filepath.Join(a.WorkingDir, historyFileName)
+	if err := os.WriteFile(legacy, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	path := a.statePath(historyFileName)
+	if !strings.HasPrefix(path, filepath.Join(configDir, "dimandocs")+string(filepath.Separator)) || filepath.Base(path) != "history.json" {
+		t.Errorf("state file at %s", path)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("state file not moved: %v", err)
+	}
+	if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+		t.Errorf("state file left in the working directory: %v", err)
+	}
+
+	// Another config file of the same directory gets its own state
+	a.ConfigFile = filepath.Join(a.WorkingDir, "other.json")
+	if a.statePath(historyFileName) == path {
+		t.Error("configs share their state")
+	}
+}
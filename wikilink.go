@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindWikiLink is the node kind of [[WikiLink]]s
+var KindWikiLink = ast.NewNodeKind("WikiLink")
+
+// WikiLink is a [[Page Name]], [[path/to/doc|alias]] or [[Page#heading]] link
+type WikiLink struct {
+	ast.BaseInline
+	Target   string // document title or path, empty for a heading of the same document
+	Fragment string // heading ID, without "#"
+	Label    string // alias, empty to show the target
+	Start    int    // offset of "[[" in the source
+}
+
+// Kind implements ast.Node
+func (n *WikiLink) Kind() ast.NodeKind {
+	return KindWikiLink
+}
+
+// Dump implements ast.Node
+func (n *WikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"Target":   n.Target,
+		"Fragment": n.Fragment,
+		"Label":    n.Label,
+	}, nil)
+}
+
+// Caption returns the text shown for the link
+func (n *WikiLink) Caption() string {
+	switch {
+	case n.Label != "":
+		return n.Label
+	case n.Target == "":
+		return n.Fragment
+	case n.Fragment != "":
+		return n.Target + " > " + n.Fragment
+	}
+	return n.Target
+}
+
+// wikiLinkParser parses [[...]] before the standard link parser sees the "["
+type wikiLinkParser struct {
+	labelFirst bool // [[alias|target]], as GitLab writes them
+}
+
+// Trigger implements parser.InlineParser
+func (p *wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+// Parse implements parser.InlineParser
+func (p *wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line[2:], []byte("]]"))
+	if end < 0 {
+		return nil
+	}
+	inner := line[2 : 2+end]
+	if bytes.ContainsAny(inner, "[]") {
+		return nil
+	}
+
+	// In tables the alias separator is written "\|"
+	content := strings.ReplaceAll(string(inner), `\|`, "|")
+	target, label := content, ""
+	if i := strings.Index(content, "|"); i >= 0 {
+		target, label = content[:i], strings.TrimSpace(content[i+1:])
+		if p.labelFirst {
+			target, label = content[i+1:], strings.TrimSpace(content[:i])
+		}
+	}
+	target, fragment := splitWikiTarget(target)
+	if target == "" && fragment == "" {
+		return nil
+	}
+
+	block.Advance(end + 4)
+	return &WikiLink{Target: target, Fragment: fragment, Label: label, Start: segment.Start}
+}
+
+// Destination returns the link as written, without the alias
+func (n *WikiLink) Destination() string {
+	if n.Fragment != "" {
+		return n.Target + "#" + n.Fragment
+	}
+	return n.Target
+}
+
+// splitWikiTarget splits "Page#heading" into the page and the heading
+func splitWikiTarget(target string) (name, fragment string) {
+	if i := strings.Index(target, "#"); i >= 0 {
+		return strings.TrimSpace(target[:i]), strings.TrimSpace(target[i+1:])
+	}
+	return strings.TrimSpace(target), ""
+}
+
+// wikiLinkRenderer renders resolved wiki links as links to /doc/... and
+// unresolved ones as a highlighted span
+type wikiLinkRenderer struct {
+	basePath string
+	resolve  func(target string) (relPath string, ok bool)
+}
+
+// RegisterFuncs implements renderer.NodeRenderer
+func (r *wikiLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindWikiLink, r.render)
+}
+
+func (r *wikiLinkRenderer) render(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*WikiLink)
+	label := util.EscapeHTML([]byte(n.Caption()))
+
+	href := ""
+	if n.Target != "" {
+		relPath, ok := r.resolve(n.Target)
+		if !ok {
+			w.WriteString(`<span class="wikilink wikilink-missing" title="No document named `)
+			w.Write(util.EscapeHTML([]byte(n.Target)))
+			w.WriteString(`">`)
+			w.Write(label)
+			w.WriteString("</span>")
+			return ast.WalkSkipChildren, nil
+		}
+		href = r.basePath + docURL(relPath)
+	}
+	if n.Fragment != "" {
+		href += "#" + url.PathEscape(n.Fragment)
+	}
+
+	w.WriteString(`<a class="wikilink" href="`)
+	w.Write(util.EscapeHTML([]byte(href)))
+	w.WriteString(`">`)
+	w.Write(label)
+	w.WriteString("</a>")
+	return ast.WalkSkipChildren, nil
+}
+
+// wikiLinks is the goldmark extension adding [[WikiLink]] support
+type wikiLinks struct {
+	basePath   string
+	resolve    func(target string) (relPath string, ok bool)
+	labelFirst bool
+}
+
+// Extend implements goldmark.Extender
+func (e *wikiLinks) Extend(m goldmark.Markdown) {
+	// Runs before the standard link parser (priority 200)
+	m.Parser().AddOptions(parser.WithInlineParsers(util.Prioritized(&wikiLinkParser{labelFirst: e.labelFirst}, 199)))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(&wikiLinkRenderer{basePath: e.basePath, resolve: e.resolve}, 199)))
+}
+
+// wikiLinkDocument returns the document a wiki link destination
+// ("Page#heading") points to and its fragment. The document is nil for links
+// to a heading of the same document ("#heading").
+func (a *App) wikiLinkDocument(destination string) (doc *Document, fragment string, ok bool) {
+	name, fragment := splitWikiTarget(destination)
+	if name == "" {
+		return nil, fragment, true
+	}
+	relPath, ok := a.resolveWikiLink(name)
+	if !ok {
+		return nil, "", false
+	}
+	doc = a.findDocument(relPath)
+	return doc, fragment, doc != nil
+}
+
+// resolveWikiLink finds the document a wiki link target names. Targets are
+// matched, ignoring case, against document paths (with or without the
+// extension), then titles, then file names without extension.
+func (a *App) resolveWikiLink(target string) (relPath string, ok bool) {
+	target = strings.TrimPrefix(target, "/")
+	if target == "" {
+		return "", false
+	}
+	withoutExt := func(p string) string { return strings.TrimSuffix(p, path.Ext(p)) }
+
+	docs := a.Documents
+	for _, doc := range docs {
+		if strings.EqualFold(doc.RelPath, target) || strings.EqualFold(withoutExt(doc.RelPath), target) {
+			return doc.RelPath, true
+		}
+	}
+	for _, doc := range docs {
+		if strings.EqualFold(strings.TrimSpace(doc.Title), target) {
+			return doc.RelPath, true
+		}
+	}
+	for _, doc := range docs {
+		if strings.EqualFold(withoutExt(path.Base(doc.RelPath)), target) {
+			return doc.RelPath, true
+		}
+	}
+	return "", false
+}